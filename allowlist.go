@@ -0,0 +1,101 @@
+package sketchy
+
+import (
+	"net/netip"
+	"sync"
+)
+
+// An Allowlist is a set of keys, such as those of monitoring probes and
+// internal services, that a Limiter configured with WithAllowlist never
+// limits. Besides exact keys, it may hold IP prefixes, which contain keys
+// that are IP addresses in text form or as 4 or 16 bytes. It may be changed
+// while in use, and shared between limiters.
+type Allowlist struct {
+	m        sync.RWMutex
+	keys     map[string]struct{}
+	prefixes CIDRSet
+}
+
+// NewAllowlist returns an Allowlist holding the given keys.
+func NewAllowlist(keys ...[]byte) *Allowlist {
+	a := &Allowlist{keys: make(map[string]struct{}, len(keys))}
+	for _, key := range keys {
+		a.keys[string(key)] = struct{}{}
+	}
+	return a
+}
+
+// Add adds key to the allowlist.
+func (a *Allowlist) Add(key []byte) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.keys[string(key)] = struct{}{}
+}
+
+// Remove removes key from the allowlist.
+func (a *Allowlist) Remove(key []byte) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	delete(a.keys, string(key))
+}
+
+// AddPrefix adds every IP address in p to the allowlist.
+func (a *Allowlist) AddPrefix(p netip.Prefix) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.prefixes.Add(p)
+}
+
+// RemovePrefix removes a prefix added by AddPrefix.
+func (a *Allowlist) RemovePrefix(p netip.Prefix) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.prefixes.Remove(p)
+}
+
+// Contains reports whether key is in the allowlist, either itself or as an
+// IP address in one of its prefixes. A nil Allowlist contains nothing.
+func (a *Allowlist) Contains(key []byte) bool {
+	if a == nil {
+		return false
+	}
+	a.m.RLock()
+	defer a.m.RUnlock()
+	if _, ok := a.keys[string(key)]; ok {
+		return true
+	}
+	if a.prefixes.Len() == 0 {
+		return false
+	}
+	addr, ok := keyAddr(key)
+	return ok && a.prefixes.Contains(addr)
+}
+
+// keyAddr returns the IP address that key holds, in text form or as 4 or 16
+// bytes.
+func keyAddr(key []byte) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(string(key)); err == nil {
+		return addr, true
+	}
+	return netip.AddrFromSlice(key)
+}
+
+// WithAllowlist makes a Limiter allow every event for keys in a, without
+// checking their rates or recording denials. If count is true their events
+// are still recorded in the counter; otherwise they are left out entirely,
+// so that they don't appear in reports built from it.
+func WithAllowlist(a *Allowlist, count bool) LimiterOption {
+	return func(l *Limiter) { l.allowlist, l.countAllowlisted = a, count }
+}
+
+// bypass reports whether key is allowlisted, recording its n events if the
+// limiter counts them.
+func (l *Limiter) bypass(key []byte, n int) bool {
+	if !l.allowlist.Contains(key) {
+		return false
+	}
+	if l.countAllowlisted {
+		Add(l.counter, key, n)
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package sketchy
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAllowlist(t *testing.T) {
+	Convey("Keys can be added and removed", t, func() {
+		a := NewAllowlist([]byte("probe"))
+		So(a.Contains([]byte("probe")), ShouldBeTrue)
+		So(a.Contains([]byte("client")), ShouldBeFalse)
+		a.Add([]byte("client"))
+		So(a.Contains([]byte("client")), ShouldBeTrue)
+		a.Remove([]byte("probe"))
+		So(a.Contains([]byte("probe")), ShouldBeFalse)
+		So((*Allowlist)(nil).Contains([]byte("probe")), ShouldBeFalse)
+	})
+
+	Convey("IP keys can be allowed by prefix", t, func() {
+		a := NewAllowlist()
+		So(a.Contains([]byte("10.1.2.3")), ShouldBeFalse)
+		a.AddPrefix(netip.MustParsePrefix("10.0.0.0/8"))
+		a.AddPrefix(netip.MustParsePrefix("2001:db8::/32"))
+		So(a.Contains([]byte("10.1.2.3")), ShouldBeTrue)
+		So(a.Contains([]byte{10, 1, 2, 3}), ShouldBeTrue)
+		So(a.Contains(netip.MustParseAddr("2001:db8::1").AsSlice()), ShouldBeTrue)
+		So(a.Contains([]byte("2001:db8::1:2:34")), ShouldBeTrue)
+		So(a.Contains([]byte("11.1.2.3")), ShouldBeFalse)
+		So(a.Contains([]byte("probe")), ShouldBeFalse)
+
+		a.RemovePrefix(netip.MustParsePrefix("10.0.0.0/8"))
+		So(a.Contains([]byte("10.1.2.3")), ShouldBeFalse)
+	})
+}
+
+func TestWithAllowlist(t *testing.T) {
+	probe := []byte("probe")
+
+	Convey("Allowlisted keys are never limited", t, func() {
+		counter := RollingCounter(0, 0, time.Second, 11)
+		limiter := NewLimiter(counter, 1, 10*time.Second, WithAllowlist(NewAllowlist(probe), true), WithDecisionLog(10))
+		for i := 0; i < 20; i++ {
+			So(limiter.Allow(probe), ShouldBeTrue)
+		}
+		delay, ok := limiter.ReserveN(probe, 100)
+		So(ok, ShouldBeTrue)
+		So(delay, ShouldEqual, 0)
+		So(limiter.WaitN(context.Background(), probe, 100), ShouldBeNil)
+		So(limiter.DecideN(probe, 100), ShouldEqual, Allowed)
+		So(limiter.RecentDenials(10), ShouldBeEmpty)
+
+		So(QueryDetailed(counter, probe, time.Minute).Events, ShouldEqual, 320)
+		So(limiter.AllowN([]byte("client"), 20), ShouldBeFalse)
+	})
+
+	Convey("Allowlisted keys can be left out of the counter", t, func() {
+		counter := RollingCounter(0, 0, time.Second, 11)
+		limiter := NewLimiter(counter, 1, 10*time.Second, WithAllowlist(NewAllowlist(probe), false))
+		So(limiter.AllowN(probe, 100), ShouldBeTrue)
+		So(QueryDetailed(counter, probe, time.Minute).Events, ShouldEqual, 0)
+	})
+}
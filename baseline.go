@@ -0,0 +1,58 @@
+package sketchy
+
+import (
+	"math"
+	"time"
+)
+
+// Offsets of the baselines compared by VsBaseline.
+const (
+	baselineDay  = 24 * time.Hour
+	baselineWeek = 7 * baselineDay
+)
+
+// vsBaseline compares the rate over the window ending now with the mean of
+// the rates over the same window one day and one week earlier, skipping
+// baselines that query reports no data for. Query is given the offset of
+// the window's end from now.
+func vsBaseline(query func(offset time.Duration) QueryDetail) float64 {
+	var sum float64
+	var n int
+	for _, offset := range []time.Duration{baselineDay, baselineWeek} {
+		if detail := query(offset); detail.Covered > 0 {
+			sum += detail.Rate
+			n++
+		}
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return query(0).Rate / (sum / float64(n))
+}
+
+// VsBaseline returns the ratio of the key's rate over the last window to its
+// rate over the same window one day and one week ago, averaged over those
+// the counter retains, so that daily and weekly cycles don't look like
+// anomalies. If the counter retains neither, NaN is returned. If the
+// baseline rate is 0, the ratio is +Inf, or NaN if the current rate is also
+// 0.
+func (rl *rollingCounter) VsBaseline(key []byte, window time.Duration) float64 {
+	k, now, latest := rl.prehash(key).k, rl.now(), rl.latest()
+	return vsBaseline(func(offset time.Duration) QueryDetail {
+		return rl.privacy.detail(rl.queryAt(k, now.Add(-offset), window), k, window, latest.Add(-offset))
+	})
+}
+
+// VsBaseline returns the ratio of the key's rate over the last window to its
+// rate over the same window one day and one week ago, averaged over those
+// the counter retains, so that daily and weekly cycles don't look like
+// anomalies. Older windows are answered by coarser levels, so a rollup with
+// levels of up to a week keeps both baselines. If the counter retains
+// neither, NaN is returned. If the baseline rate is 0, the ratio is +Inf, or
+// NaN if the current rate is also 0.
+func (rc *rollupCounter) VsBaseline(key []byte, window time.Duration) float64 {
+	k, now, latest := rc.prehash(key).k, rc.now(), rc.latest()
+	return vsBaseline(func(offset time.Duration) QueryDetail {
+		return rc.privacy.detail(rc.queryAt(k, now.Add(-offset), window), k, window, latest.Add(-offset))
+	})
+}
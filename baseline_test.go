@@ -0,0 +1,57 @@
+package sketchy
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVsBaseline(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	// feed counts a steady rate of one per second for eight days, doubling
+	// in the final hour
+	feed := func(counter RateSketch, step time.Duration) {
+		end := now.Add(8 * 24 * time.Hour)
+		for ; now.Before(end); now = now.Add(step) {
+			n := int(step / time.Second)
+			if end.Sub(now) <= time.Hour {
+				n *= 2
+			}
+			counter.Count(key, n, 0)
+		}
+	}
+
+	Convey("Rolling counters compare with the same window a day and a week ago", t, func() {
+		counter := RollingCounter(0, 0, time.Hour, 8*24+1).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		So(math.IsNaN(counter.VsBaseline(key, time.Hour)), ShouldBeTrue)
+
+		feed(counter, time.Hour)
+		So(counter.VsBaseline(key, time.Hour), ShouldAlmostEqual, 2)
+		So(counter.VsBaseline(key, 2*time.Hour), ShouldAlmostEqual, 1.5)
+		So(math.IsNaN(counter.VsBaseline([]byte("other"), time.Hour)), ShouldBeTrue)
+	})
+
+	Convey("Only retained baselines are used", t, func() {
+		counter := RollingCounter(0, 0, time.Hour, 26).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		feed(counter, time.Hour)
+		So(counter.VsBaseline(key, time.Hour), ShouldAlmostEqual, 2)
+
+		short := RollingCounter(0, 0, time.Hour, 2).(*rollingCounter)
+		short.clock = func() time.Time { return now }
+		feed(short, time.Hour)
+		So(math.IsNaN(short.VsBaseline(key, time.Hour)), ShouldBeTrue)
+	})
+
+	Convey("Rollup counters answer baselines from coarser levels", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, time.Hour, 24*time.Hour, 8*24*time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		feed(rollup, time.Minute)
+		So(rollup.VsBaseline(key, time.Hour), ShouldAlmostEqual, 2, 0.1)
+	})
+}
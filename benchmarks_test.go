@@ -58,6 +58,22 @@ func BenchmarkSketch(b *testing.B) {
 	runtime.GC()
 }
 
+func BenchmarkPrehash(b *testing.B) {
+	handles := make([]KeyHandle, len(ips))
+	for i := 0; i < b.N; i++ {
+		for j, ip := range ips {
+			handles[j] = Prehash(ip)
+		}
+	}
+}
+
+func BenchmarkHashBatch(b *testing.B) {
+	handles := make([]KeyHandle, 0, len(ips))
+	for i := 0; i < b.N; i++ {
+		handles = AppendHashBatch(handles[:0], ips)
+	}
+}
+
 func BenchmarkRollingCounter(b *testing.B) {
 	b.StopTimer()
 	runtime.GC()
@@ -0,0 +1,137 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// A Bloom is a Bloom filter (http://en.wikipedia.org/wiki/Bloom_filter): a
+// set of keys that answers whether it contains a key with no false
+// negatives, and false positives at a rate chosen when it is created. It
+// hashes keys as sketches do, so a key hashed once by Prehash may be both
+// counted and tested. Bits are set atomically, so Test may run concurrently
+// with Add.
+type Bloom struct {
+	bits   uint // the number of bits in words
+	hashes uint // the number of bits set for each key
+	words  []uint64
+}
+
+// NewBloom returns a new, empty Bloom filter sized to hold n keys with a
+// false positive rate of fpRate, which must be in (0, 1). Adding more than n
+// keys raises the rate. N must be positive.
+func NewBloom(n uint, fpRate float64) *Bloom {
+	if n == 0 || !(fpRate > 0 && fpRate < 1) {
+		panic(fmt.Sprintf("sketchy: bloom filter for %d keys with false positive rate %v: need a positive size and a rate in (0, 1)", n, fpRate))
+	}
+	return newBloom(bloomSize(n, fpRate))
+}
+
+func newBloom(bits, hashes uint) *Bloom {
+	return &Bloom{bits: bits, hashes: hashes, words: make([]uint64, (bits+63)/64)}
+}
+
+// bloomSize returns the optimal number of bits and hashes for a filter of n
+// keys with the given false positive rate.
+func bloomSize(n uint, fpRate float64) (bits, hashes uint) {
+	bits = uint(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	hashes = uint(math.Round(float64(bits) / float64(n) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return bits, hashes
+}
+
+// Add adds key to the filter.
+func (b *Bloom) Add(key []byte) { b.add(multihash(key)) }
+
+// Test reports whether the filter may contain key. It is false only if key
+// was never added.
+func (b *Bloom) Test(key []byte) bool { return b.test(multihash(key)) }
+
+// AddHandle is Add for a key hashed in advance by Prehash.
+func (b *Bloom) AddHandle(h KeyHandle) { b.add(FNV1.handle(h).k) }
+
+// TestHandle is Test for a key hashed in advance by Prehash.
+func (b *Bloom) TestHandle(h KeyHandle) bool { return b.test(FNV1.handle(h).k) }
+
+func (b *Bloom) add(k hashKernel) {
+	for i := uint(0); i < b.hashes; i++ {
+		j := k.index(i, b.bits)
+		word, bit := &b.words[j/64], uint64(1)<<(j%64)
+		for {
+			old := atomic.LoadUint64(word)
+			if old&bit != 0 || atomic.CompareAndSwapUint64(word, old, old|bit) {
+				break
+			}
+		}
+	}
+}
+
+func (b *Bloom) test(k hashKernel) bool {
+	for i := uint(0); i < b.hashes; i++ {
+		j := k.index(i, b.bits)
+		if atomic.LoadUint64(&b.words[j/64])&(1<<(j%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge adds every key of o to b, so that b holds the union of the two. The
+// filters must have been created with the same size and false positive
+// rate.
+func (b *Bloom) Merge(o *Bloom) error {
+	if b.bits != o.bits || b.hashes != o.hashes {
+		return fmt.Errorf("%w: bloom filters of %d bits with %d hashes and %d bits with %d hashes can't be merged",
+			ErrIncompatibleSketch, b.bits, b.hashes, o.bits, o.hashes)
+	}
+	for i := range b.words {
+		w := atomic.LoadUint64(&o.words[i])
+		for {
+			old := atomic.LoadUint64(&b.words[i])
+			if old|w == old || atomic.CompareAndSwapUint64(&b.words[i], old, old|w) {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// bloomState is the gob encoding of a Bloom.
+type bloomState struct {
+	Bits, Hashes uint
+	Words        []uint64
+}
+
+// GobEncode returns the gob encoding of the filter.
+func (b *Bloom) GobEncode() ([]byte, error) {
+	state := bloomState{Bits: b.bits, Hashes: b.hashes, Words: make([]uint64, len(b.words))}
+	for i := range b.words {
+		state.Words[i] = atomic.LoadUint64(&b.words[i])
+	}
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode replaces the filter with the one encoded in data.
+func (b *Bloom) GobDecode(data []byte) error {
+	var state bloomState
+	if err := decodeAll(data, &state); err != nil {
+		return fmt.Errorf("%w: %s", ErrCorruptEncoding, err)
+	}
+	if state.Bits == 0 || state.Hashes == 0 || state.Hashes > state.Bits {
+		return fmt.Errorf("%w: bloom filter of %d bits with %d hashes", ErrCorruptEncoding, state.Bits, state.Hashes)
+	}
+	if uint(len(state.Words)) != (state.Bits+63)/64 {
+		return fmt.Errorf("%w: bloom filter size doesn't match its bits", ErrCorruptEncoding)
+	}
+	*b = Bloom{bits: state.Bits, hashes: state.Hashes, words: state.Words}
+	return nil
+}
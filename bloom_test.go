@@ -0,0 +1,86 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBloom(t *testing.T) {
+	Convey("Filters are sized for their keys and false positive rate", t, func() {
+		bits, hashes := bloomSize(1000, 0.01)
+		So(bits, ShouldEqual, 9586)
+		So(hashes, ShouldEqual, 7)
+
+		bits, hashes = bloomSize(1, 0.9)
+		So(bits, ShouldEqual, 1)
+		So(hashes, ShouldEqual, 1)
+	})
+
+	Convey("Added keys are always found, and others rarely", t, func() {
+		b := NewBloom(10000, 0.01)
+		for i := 0; i < 10000; i++ {
+			b.Add([]byte(fmt.Sprint("in", i)))
+		}
+		for i := 0; i < 10000; i++ {
+			So(b.Test([]byte(fmt.Sprint("in", i))), ShouldBeTrue)
+		}
+		positives := 0
+		for i := 0; i < 10000; i++ {
+			if b.Test([]byte(fmt.Sprint("out", i))) {
+				positives++
+			}
+		}
+		So(positives, ShouldBeLessThan, 200)
+	})
+
+	Convey("Handles test the same keys", t, func() {
+		b := NewBloom(100, 0.01)
+		b.AddHandle(Prehash([]byte("a")))
+		b.AddHandle(FNV1a.Prehash([]byte("b")))
+		So(b.Test([]byte("a")), ShouldBeTrue)
+		So(b.Test([]byte("b")), ShouldBeTrue)
+		So(b.TestHandle(Prehash([]byte("b"))), ShouldBeTrue)
+		So(b.TestHandle(Prehash([]byte("c"))), ShouldBeFalse)
+	})
+
+	Convey("Merged filters hold the union", t, func() {
+		a, b := NewBloom(100, 0.01), NewBloom(100, 0.01)
+		a.Add([]byte("a"))
+		b.Add([]byte("b"))
+		So(a.Merge(b), ShouldBeNil)
+		So(a.Test([]byte("a")), ShouldBeTrue)
+		So(a.Test([]byte("b")), ShouldBeTrue)
+
+		err := a.Merge(NewBloom(1000, 0.01))
+		So(errors.Is(err, ErrIncompatibleSketch), ShouldBeTrue)
+	})
+
+	Convey("Filters survive gob encoding", t, func() {
+		b := NewBloom(100, 0.01)
+		b.Add([]byte("a"))
+		buf := &bytes.Buffer{}
+		So(gob.NewEncoder(buf).Encode(b), ShouldBeNil)
+
+		var decoded Bloom
+		So(gob.NewDecoder(buf).Decode(&decoded), ShouldBeNil)
+		So(decoded.Test([]byte("a")), ShouldBeTrue)
+		So(decoded.Test([]byte("b")), ShouldBeFalse)
+		So(decoded.Merge(b), ShouldBeNil)
+
+		data, err := (&Bloom{bits: 128, hashes: 2, words: make([]uint64, 1)}).GobEncode()
+		So(err, ShouldBeNil)
+		So(errors.Is(decoded.GobDecode(data), ErrCorruptEncoding), ShouldBeTrue)
+		So(errors.Is(decoded.GobDecode([]byte("junk")), ErrCorruptEncoding), ShouldBeTrue)
+	})
+
+	Convey("The size and rate must be valid", t, func() {
+		So(func() { NewBloom(0, 0.01) }, ShouldPanic)
+		So(func() { NewBloom(10, 0) }, ShouldPanic)
+		So(func() { NewBloom(10, 1) }, ShouldPanic)
+	})
+}
@@ -0,0 +1,108 @@
+package sketchy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithQueryCache makes a counter remember the results of Query for up to
+// staleness, so repeated queries for the same key and interval skip the
+// buckets entirely. Results may therefore lag Count by up to staleness;
+// one bucket interval is a reasonable choice. At most size results are
+// kept. Both staleness and size must be positive.
+func WithQueryCache(staleness time.Duration, size int) Option {
+	if staleness <= 0 || size <= 0 {
+		panic(fmt.Sprintf("sketchy: query cache staleness %s and size %d must be positive", staleness, size))
+	}
+	return func(o *options) { o.cache = &queryCache{staleness: staleness, size: size} }
+}
+
+type queryCache struct {
+	staleness time.Duration
+	size      int
+
+	m       sync.Mutex
+	n       int
+	entries map[time.Duration]map[hashKernel]cachedRate // by key hash
+}
+
+type cachedRate struct {
+	rate float64
+	at   time.Time
+}
+
+// get returns the cached rate of the key with the given hash over interval,
+// if there is one that isn't stale at now.
+func (c *queryCache) get(k hashKernel, interval time.Duration, now time.Time) (float64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.entries[interval][k]
+	if !ok || now.Sub(e.at) >= c.staleness || now.Before(e.at) {
+		return 0, false
+	}
+	return e.rate, true
+}
+
+// put caches the rate of the key with the given hash over interval as of now. If the cache is full,
+// stale entries are dropped first, and if that isn't enough, all of them.
+func (c *queryCache) put(k hashKernel, interval time.Duration, now time.Time, rate float64) {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if _, ok := c.entries[interval][k]; !ok {
+		if c.n >= c.size {
+			c.evict(now)
+		}
+		c.n++
+	}
+	if c.entries == nil {
+		c.entries = map[time.Duration]map[hashKernel]cachedRate{}
+	}
+	m := c.entries[interval]
+	if m == nil {
+		m = map[hashKernel]cachedRate{}
+		c.entries[interval] = m
+	}
+	m[k] = cachedRate{rate: rate, at: now}
+}
+
+// forget drops every cached rate of the key with the given hash.
+func (c *queryCache) forget(k hashKernel) {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, m := range c.entries {
+		if _, ok := m[k]; ok {
+			delete(m, k)
+			c.n--
+		}
+	}
+}
+
+func (c *queryCache) evict(now time.Time) {
+	for interval, m := range c.entries {
+		for k, e := range m {
+			if now.Sub(e.at) >= c.staleness || now.Before(e.at) {
+				delete(m, k)
+				c.n--
+			}
+		}
+		if len(m) == 0 {
+			delete(c.entries, interval)
+		}
+	}
+	if c.n >= c.size {
+		c.entries, c.n = nil, 0
+	}
+}
@@ -0,0 +1,85 @@
+package sketchy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithQueryCache(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	Convey("Query results are reused until they're stale", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(
+			WithQueryCache(10*time.Second, 100)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		counter.Count(key, 60, 0)
+		now = now.Add(time.Minute)
+		So(counter.Query(key, time.Minute), ShouldEqual, 1)
+
+		counter.Count(key, 600, 0)
+		now = now.Add(5 * time.Second)
+		So(counter.Query(key, time.Minute), ShouldEqual, 1)
+		So(counter.Query([]byte("other"), time.Minute), ShouldEqual, 0)
+		So(counter.QueryDetailed(key, time.Minute).Rate, ShouldBeGreaterThan, 1)
+
+		now = now.Add(5 * time.Second)
+		So(counter.Query(key, time.Minute), ShouldBeGreaterThan, 1)
+	})
+
+	Convey("Counters given the same option have their own caches", t, func() {
+		caching := WithQueryCache(time.Hour, 100)
+		clock := WithClock(func() time.Time { return now })
+		params := RollingParams{Interval: time.Minute, NumIntervals: 10}
+		a, b := params.New(caching, clock), params.New(caching, clock)
+		a.Count(key, 60, 0)
+		b.Count(key, 120, 0)
+		now = now.Add(time.Minute)
+		So(a.Query(key, time.Minute), ShouldEqual, 1)
+		So(b.Query(key, time.Minute), ShouldEqual, 2)
+	})
+
+	Convey("Rollup counters cache too", t, func() {
+		rollup := RollupParams{Durations: []time.Duration{time.Minute, time.Hour}}.New(
+			WithQueryCache(time.Minute, 100)).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		rollup.Count(key, 60, 0)
+		now = now.Add(time.Minute)
+		So(rollup.Query(key, time.Minute), ShouldEqual, 1)
+		rollup.Count(key, 600, 0)
+		So(rollup.Query(key, time.Minute), ShouldEqual, 1)
+	})
+
+	Convey("The cache is bounded", t, func() {
+		cache := &queryCache{staleness: time.Minute, size: 10}
+		for i := 0; i < 10; i++ {
+			cache.put(multihash([]byte(fmt.Sprint(i))), time.Minute, now, 1)
+		}
+		So(cache.n, ShouldEqual, 10)
+		cache.put(multihash([]byte("0")), time.Minute, now, 2)
+		So(cache.n, ShouldEqual, 10)
+
+		// fresh entries are dropped only if evicting stale ones isn't enough
+		cache.put(multihash([]byte("new")), time.Minute, now, 1)
+		So(cache.n, ShouldEqual, 1)
+		later := now.Add(2 * time.Minute)
+		for i := 0; i < 9; i++ {
+			cache.put(multihash([]byte(fmt.Sprint(i))), time.Hour, later, 1)
+		}
+		cache.put(multihash([]byte("newer")), time.Hour, later, 1)
+		So(cache.n, ShouldEqual, 10)
+		_, ok := cache.get(multihash([]byte("new")), time.Minute, later)
+		So(ok, ShouldBeFalse)
+		rate, ok := cache.get(multihash([]byte("newer")), time.Hour, later)
+		So(ok, ShouldBeTrue)
+		So(rate, ShouldEqual, 1)
+	})
+
+	Convey("Staleness and size must be positive", t, func() {
+		So(func() { WithQueryCache(0, 1) }, ShouldPanic)
+		So(func() { WithQueryCache(time.Second, 0) }, ShouldPanic)
+	})
+}
@@ -0,0 +1,165 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/netip"
+)
+
+// A CIDRSet is a set of IP prefixes, stored as a binary trie of address
+// bits, that answers whether an address falls in any of them in time
+// proportional to the address length. IPv4 addresses and prefixes are
+// matched whether or not they are mapped into IPv6. The zero value is an
+// empty set. A CIDRSet may be read concurrently, but must not be changed
+// while it is read.
+type CIDRSet struct {
+	v4, v6 *cidrNode
+	n      int
+}
+
+type cidrNode struct {
+	child [2]*cidrNode
+	in    bool // whether the prefix ending at this node is in the set
+}
+
+// normalize returns p masked, with an IPv4-mapped address unmapped.
+func normalize(p netip.Prefix) netip.Prefix {
+	if a := p.Addr(); a.Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(a.Unmap(), p.Bits()-96)
+	}
+	return p.Masked()
+}
+
+// root returns the trie for addresses like a, creating it if create is
+// true.
+func (s *CIDRSet) root(a netip.Addr, create bool) *cidrNode {
+	r := &s.v6
+	if a.Is4() {
+		r = &s.v4
+	}
+	if *r == nil && create {
+		*r = &cidrNode{}
+	}
+	return *r
+}
+
+// bit returns the i'th bit of a, counting from the most significant.
+func bit(a []byte, i int) int { return int(a[i/8]>>(7-uint(i%8))) & 1 }
+
+// Add adds p to the set. Invalid prefixes are ignored.
+func (s *CIDRSet) Add(p netip.Prefix) {
+	if !p.IsValid() {
+		return
+	}
+	p = normalize(p)
+	a := p.Addr().AsSlice()
+	n := s.root(p.Addr(), true)
+	for i := 0; i < p.Bits(); i++ {
+		b := bit(a, i)
+		if n.child[b] == nil {
+			n.child[b] = &cidrNode{}
+		}
+		n = n.child[b]
+	}
+	if !n.in {
+		n.in = true
+		s.n++
+	}
+}
+
+// Remove removes p from the set, if it was added. Addresses in p may still
+// be contained in the set if other prefixes cover them.
+func (s *CIDRSet) Remove(p netip.Prefix) {
+	if !p.IsValid() {
+		return
+	}
+	p = normalize(p)
+	a := p.Addr().AsSlice()
+	path := []*cidrNode{s.root(p.Addr(), false)}
+	for i := 0; i < p.Bits() && path[i] != nil; i++ {
+		path = append(path, path[i].child[bit(a, i)])
+	}
+	n := path[len(path)-1]
+	if n == nil || !n.in {
+		return
+	}
+	n.in = false
+	s.n--
+	// prune nodes left with nothing beneath them
+	for i := len(path) - 1; i > 0; i-- {
+		if n := path[i]; n.in || n.child[0] != nil || n.child[1] != nil {
+			break
+		}
+		path[i-1].child[bit(a, i-1)] = nil
+	}
+}
+
+// Contains reports whether a is in any prefix in the set.
+func (s *CIDRSet) Contains(a netip.Addr) bool {
+	if !a.IsValid() {
+		return false
+	}
+	a = a.Unmap()
+	b := a.AsSlice()
+	n := s.root(a, false)
+	for i := 0; n != nil; i++ {
+		if n.in {
+			return true
+		}
+		if i == a.BitLen() {
+			break
+		}
+		n = n.child[bit(b, i)]
+	}
+	return false
+}
+
+// Len returns the number of prefixes in the set.
+func (s *CIDRSet) Len() int { return s.n }
+
+// Prefixes returns the prefixes in the set, IPv4 first, each in order of
+// address and then length.
+func (s *CIDRSet) Prefixes() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, s.n)
+	var walk func(n *cidrNode, a []byte, bits int)
+	walk = func(n *cidrNode, a []byte, bits int) {
+		if n == nil {
+			return
+		}
+		if n.in {
+			addr, _ := netip.AddrFromSlice(a)
+			prefixes = append(prefixes, netip.PrefixFrom(addr, bits))
+		}
+		for b, c := range n.child {
+			next := append([]byte(nil), a...)
+			next[bits/8] |= byte(b) << (7 - uint(bits%8))
+			walk(c, next, bits+1)
+		}
+	}
+	walk(s.v4, make([]byte, 4), 0)
+	walk(s.v6, make([]byte, 16), 0)
+	return prefixes
+}
+
+// GobEncode returns the gob encoding of the set's prefixes.
+func (s *CIDRSet) GobEncode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(s.Prefixes()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode replaces the set with the gob-encoded prefixes in data.
+func (s *CIDRSet) GobDecode(data []byte) error {
+	var prefixes []netip.Prefix
+	if err := decodeAll(data, &prefixes); err != nil {
+		return fmt.Errorf("%w: %s", ErrCorruptEncoding, err)
+	}
+	*s = CIDRSet{}
+	for _, p := range prefixes {
+		s.Add(p)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"net/netip"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCIDRSet(t *testing.T) {
+	addr := netip.MustParseAddr
+	prefix := netip.MustParsePrefix
+
+	Convey("Addresses are contained in the prefixes that cover them", t, func() {
+		var s CIDRSet
+		So(s.Contains(addr("10.1.2.3")), ShouldBeFalse)
+		s.Add(prefix("10.0.0.0/8"))
+		s.Add(prefix("192.168.1.7/24"))
+		s.Add(prefix("2001:db8::/32"))
+
+		So(s.Contains(addr("10.1.2.3")), ShouldBeTrue)
+		So(s.Contains(addr("11.1.2.3")), ShouldBeFalse)
+		So(s.Contains(addr("192.168.1.255")), ShouldBeTrue)
+		So(s.Contains(addr("192.168.2.1")), ShouldBeFalse)
+		So(s.Contains(addr("2001:db8:1::1")), ShouldBeTrue)
+		So(s.Contains(addr("2001:db9::1")), ShouldBeFalse)
+		So(s.Contains(addr("::ffff:10.0.0.1")), ShouldBeTrue)
+		So(s.Contains(netip.Addr{}), ShouldBeFalse)
+		So(s.Len(), ShouldEqual, 3)
+	})
+
+	Convey("Single addresses and everything can be added", t, func() {
+		var s CIDRSet
+		s.Add(prefix("1.2.3.4/32"))
+		So(s.Contains(addr("1.2.3.4")), ShouldBeTrue)
+		So(s.Contains(addr("1.2.3.5")), ShouldBeFalse)
+		s.Add(prefix("::/0"))
+		So(s.Contains(addr("fe80::1")), ShouldBeTrue)
+		So(s.Contains(addr("1.2.3.5")), ShouldBeFalse)
+	})
+
+	Convey("Removing a prefix leaves those that overlap it", t, func() {
+		var s CIDRSet
+		s.Add(prefix("10.0.0.0/8"))
+		s.Add(prefix("10.1.0.0/16"))
+		s.Add(prefix("::ffff:10.2.0.0/112"))
+		So(s.Prefixes(), ShouldResemble, []netip.Prefix{prefix("10.0.0.0/8"), prefix("10.1.0.0/16"), prefix("10.2.0.0/16")})
+
+		s.Remove(prefix("10.0.0.0/8"))
+		So(s.Contains(addr("10.1.2.3")), ShouldBeTrue)
+		So(s.Contains(addr("10.3.2.3")), ShouldBeFalse)
+		s.Remove(prefix("10.1.0.0/16"))
+		s.Remove(prefix("10.2.0.0/16"))
+		s.Remove(prefix("10.3.0.0/16"))
+		So(s.Len(), ShouldEqual, 0)
+		So(s.v4.child, ShouldResemble, [2]*cidrNode{})
+	})
+
+	Convey("Sets survive a gob round trip", t, func() {
+		var s CIDRSet
+		s.Add(prefix("10.0.0.0/8"))
+		s.Add(prefix("2001:db8::/32"))
+		buf := &bytes.Buffer{}
+		So(gob.NewEncoder(buf).Encode(&s), ShouldBeNil)
+
+		var clone CIDRSet
+		So(gob.NewDecoder(buf).Decode(&clone), ShouldBeNil)
+		So(clone.Prefixes(), ShouldResemble, s.Prefixes())
+		So(errors.Is(clone.GobDecode([]byte("garbage")), ErrCorruptEncoding), ShouldBeTrue)
+	})
+}
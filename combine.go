@@ -0,0 +1,125 @@
+package sketchy
+
+import "fmt"
+
+// A Combiner builds a sketch or counter in parallel, as the combine function
+// of a map-reduce pipeline such as Apache Beam's or Spark's: each worker
+// adds its share of the inputs to an accumulator of its own, the
+// accumulators are merged, and the output is extracted from the one left.
+// Accumulators are gob-encodable, so that they may be shipped between
+// workers.
+//
+// AddInput and MergeAccumulators may update the accumulator they are given
+// and return it, as such pipelines allow. They panic if given inputs or
+// accumulators of the wrong type, or ones that can't be merged, such as
+// sketches of other parameters, since a pipeline can't recover from either.
+type Combiner interface {
+	// CreateAccumulator returns a new, empty accumulator.
+	CreateAccumulator() interface{}
+
+	// AddInput adds input to acc and returns the result.
+	AddInput(acc, input interface{}) interface{}
+
+	// MergeAccumulators merges b into a and returns the result.
+	MergeAccumulators(a, b interface{}) interface{}
+
+	// ExtractOutput returns the sketch or counter built in acc.
+	ExtractOutput(acc interface{}) interface{}
+}
+
+// SketchCombiner returns a Combiner that counts keys into a count-min sketch
+// with the given parameters. Its inputs are keys, each counted once, or
+// KeyCounts, and its accumulators and output are CountSketches.
+func SketchCombiner(p SketchParams) Combiner { return sketchCombiner{p} }
+
+type sketchCombiner struct{ p SketchParams }
+
+func (c sketchCombiner) CreateAccumulator() interface{} { return c.p.New() }
+
+func (c sketchCombiner) AddInput(acc, input interface{}) interface{} {
+	s := c.sketch(acc)
+	switch in := input.(type) {
+	case []byte:
+		s.Add(in, 1)
+	case KeyCount:
+		s.Add(in.Key, int(in.Count))
+	default:
+		panic(fmt.Sprintf("sketchy: sketch combiner can't count a %T", input))
+	}
+	return s
+}
+
+func (c sketchCombiner) MergeAccumulators(a, b interface{}) interface{} {
+	s := c.sketch(a)
+	if err := s.merge(c.sketch(b)); err != nil {
+		panic(fmt.Sprintf("sketchy: sketch combiner: %s", err))
+	}
+	return s
+}
+
+func (c sketchCombiner) ExtractOutput(acc interface{}) interface{} { return c.sketch(acc) }
+
+func (c sketchCombiner) sketch(acc interface{}) *fnvSketch {
+	s, ok := acc.(*fnvSketch)
+	if !ok {
+		panic(fmt.Sprintf("sketchy: %T isn't a sketch combiner's accumulator", acc))
+	}
+	return s
+}
+
+// CounterCombiner returns a Combiner that merges rolling counters, as
+// MergeAll does, into one with the given parameters and options: for
+// instance, to combine the snapshots of a counter taken on many nodes. Its
+// inputs are rolling counters, or the encodings their GobEncode methods
+// return, which are decoded as the options direct. Its accumulators and
+// output are RateSketches.
+func CounterCombiner(p RollingParams, opts ...Option) Combiner {
+	return counterCombiner{p, opts}
+}
+
+type counterCombiner struct {
+	p    RollingParams
+	opts []Option
+}
+
+func (c counterCombiner) CreateAccumulator() interface{} { return c.p.New(c.opts...) }
+
+func (c counterCombiner) AddInput(acc, input interface{}) interface{} {
+	rl := c.counter(acc)
+	switch in := input.(type) {
+	case []byte:
+		snapshot := rl.blank()
+		if err := snapshot.GobDecode(in); err != nil {
+			rl.merged(0, err)
+			panic(fmt.Sprintf("sketchy: counter combiner: %s", err))
+		}
+		c.merge(rl, snapshot)
+	case *rollingCounter:
+		c.merge(rl, in)
+	default:
+		panic(fmt.Sprintf("sketchy: counter combiner can't merge a %T", input))
+	}
+	return rl
+}
+
+func (c counterCombiner) MergeAccumulators(a, b interface{}) interface{} {
+	rl := c.counter(a)
+	c.merge(rl, c.counter(b))
+	return rl
+}
+
+func (c counterCombiner) ExtractOutput(acc interface{}) interface{} { return c.counter(acc) }
+
+func (c counterCombiner) merge(rl, o *rollingCounter) {
+	if err := rl.merge(o); err != nil {
+		panic(fmt.Sprintf("sketchy: counter combiner: %s", err))
+	}
+}
+
+func (c counterCombiner) counter(acc interface{}) *rollingCounter {
+	rl, ok := acc.(*rollingCounter)
+	if !ok {
+		panic(fmt.Sprintf("sketchy: %T isn't a counter combiner's accumulator", acc))
+	}
+	return rl
+}
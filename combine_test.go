@@ -0,0 +1,86 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCombiner(t *testing.T) {
+	Convey("Sketches combined in parallel match one counted serially", t, func() {
+		c := SketchCombiner(SketchParams{Epsilon: 0.9})
+		serial := SketchParams{Epsilon: 0.9}.New()
+		workers := make([]interface{}, 3)
+		for i := range workers {
+			workers[i] = c.CreateAccumulator()
+		}
+		for i := 0; i < 300; i++ {
+			key := []byte(fmt.Sprint("key", i%40))
+			workers[i%3] = c.AddInput(workers[i%3], key)
+			serial.Add(key, 1)
+		}
+		workers[0] = c.AddInput(workers[0], KeyCount{Key: []byte("heavy"), Count: 100})
+		serial.Add([]byte("heavy"), 100)
+
+		acc := c.MergeAccumulators(workers[0], workers[1])
+		acc = c.MergeAccumulators(acc, workers[2])
+		out := c.ExtractOutput(acc).(CountSketch)
+		for i := 0; i < 40; i++ {
+			key := []byte(fmt.Sprint("key", i))
+			So(out.Query(key), ShouldEqual, serial.Query(key))
+		}
+		So(out.Query([]byte("heavy")), ShouldEqual, serial.Query([]byte("heavy")))
+	})
+
+	Convey("Sketch accumulators survive gob", t, func() {
+		c := SketchCombiner(SketchParams{})
+		acc := c.AddInput(c.CreateAccumulator(), []byte("a"))
+		buf := &bytes.Buffer{}
+		So(gob.NewEncoder(buf).Encode(acc), ShouldBeNil)
+		decoded := c.CreateAccumulator()
+		So(gob.NewDecoder(buf).Decode(decoded), ShouldBeNil)
+
+		acc = c.MergeAccumulators(decoded, c.AddInput(c.CreateAccumulator(), []byte("a")))
+		So(c.ExtractOutput(acc).(CountSketch).Query([]byte("a")), ShouldEqual, 2)
+	})
+
+	Convey("Sketch combiners refuse what they can't merge", t, func() {
+		c := SketchCombiner(SketchParams{})
+		So(func() { c.AddInput(c.CreateAccumulator(), "key") }, ShouldPanic)
+		So(func() { c.AddInput(NewBloom(10, 0.1), []byte("key")) }, ShouldPanic)
+		other := SketchCombiner(SketchParams{Epsilon: 0.9}).CreateAccumulator()
+		So(func() { c.MergeAccumulators(c.CreateAccumulator(), other) }, ShouldPanic)
+	})
+
+	Convey("Counters and their encodings combine into one", t, func() {
+		now := time.Unix(1500000000, 0)
+		clock := func() time.Time { return now }
+		params := RollingParams{Interval: time.Minute, NumIntervals: 10}
+		c := CounterCombiner(params, WithClock(clock))
+
+		nodes := make([]RateSketch, 3)
+		for i := range nodes {
+			nodes[i] = params.New(WithClock(clock))
+			Add(nodes[i], []byte("shared"), 60)
+		}
+		now = now.Add(time.Minute)
+		encoded, err := nodes[2].(gob.GobEncoder).GobEncode()
+		So(err, ShouldBeNil)
+
+		a := c.AddInput(c.CreateAccumulator(), nodes[0])
+		b := c.AddInput(c.CreateAccumulator(), nodes[1])
+		b = c.AddInput(b, encoded)
+		out := c.ExtractOutput(c.MergeAccumulators(a, b)).(RateSketch)
+		So(out.Query([]byte("shared"), time.Minute), ShouldEqual, 3)
+		So(nodes[0].Query([]byte("shared"), time.Minute), ShouldEqual, 1)
+
+		other := RollingParams{Interval: time.Second, NumIntervals: 10}.New()
+		So(func() { c.AddInput(c.CreateAccumulator(), other) }, ShouldPanic)
+		So(func() { c.AddInput(c.CreateAccumulator(), []byte("garbage")) }, ShouldPanic)
+		So(func() { c.AddInput(c.CreateAccumulator(), RollupCounter(0, 0, time.Minute)) }, ShouldPanic)
+	})
+}
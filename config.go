@@ -0,0 +1,139 @@
+package sketchy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config declares a sketch, counter or limiter, for services that define
+// their counters in configuration files. Params holds the text form of the
+// parameters for the given type: SketchParams for "sketch", RollingParams
+// for "rolling" and RollupParams for "rollup". Any of them may choose the
+// hash variant with hash=fnv1a.
+//
+// A "limiter" is a Limiter over a rolling counter, or over a rollup counter
+// if Counter is "rollup". Its Params are those of the counter, plus the
+// limit in events per second and the window it is measured over, e.g.
+// "interval=5s,num=13,limit=10,window=1m".
+//
+// Width and Depth, if set, fix the dimensions of the sketches in place of
+// the epsilon and delta in Params. Either may be left 0 to keep the one
+// Params implies.
+type Config struct {
+	Type    string `json:"type"`
+	Params  string `json:"params"`
+	Counter string `json:"counter,omitempty"`
+	Width   uint   `json:"width,omitempty"`
+	Depth   uint   `json:"depth,omitempty"`
+}
+
+// Build constructs the sketch, counter or limiter declared by cfg. The
+// result is a CountSketch if cfg.Type is "sketch", a *Limiter if it is
+// "limiter", or a RateSketch otherwise. The given options apply to rate
+// counters, including a limiter's.
+func Build(cfg Config, opts ...Option) (interface{}, error) {
+	switch cfg.Type {
+	case "sketch":
+		var p SketchParams
+		if err := p.Set(cfg.Params); err != nil {
+			return nil, err
+		}
+		if err := cfg.size(&p); err != nil {
+			return nil, err
+		}
+		return p.New(), nil
+	case "rolling", "rollup":
+		return cfg.counter(cfg.Type, cfg.Params, opts)
+	case "limiter":
+		return cfg.limiter(opts)
+	default:
+		return nil, fmt.Errorf("%w: unknown counter type %q", ErrInvalidParams, cfg.Type)
+	}
+}
+
+// counter builds a rate counter of the given type from params.
+func (cfg Config) counter(typ, params string, opts []Option) (RateSketch, error) {
+	switch typ {
+	case "rolling":
+		var p RollingParams
+		if err := p.Set(params); err != nil {
+			return nil, err
+		}
+		if err := cfg.size(&p.SketchParams); err != nil {
+			return nil, err
+		}
+		return p.New(opts...), nil
+	case "rollup":
+		var p RollupParams
+		if err := p.Set(params); err != nil {
+			return nil, err
+		}
+		if err := cfg.size(&p.SketchParams); err != nil {
+			return nil, err
+		}
+		return p.New(opts...), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown limiter counter type %q", ErrInvalidParams, typ)
+	}
+}
+
+// limiter builds a Limiter, taking its limit and window out of the
+// counter's params.
+func (cfg Config) limiter(opts []Option) (*Limiter, error) {
+	var (
+		limit  float64
+		window time.Duration
+		rest   []string
+	)
+	for _, field := range strings.Split(cfg.Params, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+		var err error
+		switch strings.TrimSpace(k) {
+		case "limit":
+			limit, err = strconv.ParseFloat(strings.TrimSpace(v), 64)
+		case "window":
+			window, err = time.ParseDuration(strings.TrimSpace(v))
+		default:
+			rest = append(rest, field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: parameter %q: %s", ErrInvalidParams, field, err)
+		}
+	}
+	if !(limit > 0) || window <= 0 {
+		return nil, fmt.Errorf("%w: limiter params %q: limit and window must be positive", ErrInvalidParams, cfg.Params)
+	}
+	typ := cfg.Counter
+	if typ == "" {
+		typ = "rolling"
+	}
+	counter, err := cfg.counter(typ, strings.Join(rest, ","), opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewLimiter(counter, limit, window), nil
+}
+
+// size replaces the epsilon and delta of p with those giving the
+// configured dimensions, if any.
+func (cfg Config) size(p *SketchParams) error {
+	if cfg.Width == 0 && cfg.Depth == 0 {
+		return nil
+	}
+	d := p.withDefaults()
+	width, depth := sketchSize(d.Epsilon, d.Delta)
+	if cfg.Width != 0 {
+		width = cfg.Width
+	}
+	if cfg.Depth != 0 {
+		depth = cfg.Depth
+	}
+	epsilon, delta, ok := sizeParams(width, depth)
+	if !ok {
+		return fmt.Errorf("%w: sketches of %dx%d counters can't be made", ErrInvalidParams, width, depth)
+	}
+	p.Epsilon, p.Delta = epsilon, delta
+	return nil
+}
@@ -0,0 +1,78 @@
+package sketchy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBuild(t *testing.T) {
+	Convey("Build constructs each type of counter", t, func() {
+		var cfgs map[string]Config
+		So(json.Unmarshal([]byte(`{
+			"names": {"type": "sketch", "params": "epsilon=0.99"},
+			"logins": {"type": "rolling", "params": "interval=1m,num=10"},
+			"requests": {"type": "rollup", "params": "15m,1h,4h,24h"}
+		}`), &cfgs), ShouldBeNil)
+
+		v, err := Build(cfgs["names"])
+		So(err, ShouldBeNil)
+		So(v.(*fnvSketch).Epsilon, ShouldEqual, 0.99)
+
+		v, err = Build(cfgs["logins"])
+		So(err, ShouldBeNil)
+		So(v.(*rollingCounter).Interval, ShouldEqual, time.Minute)
+
+		v, err = Build(cfgs["requests"])
+		So(err, ShouldBeNil)
+		So(len(v.(*rollupCounter).Levels), ShouldEqual, 3)
+	})
+
+	Convey("Build constructs limiters over either counter", t, func() {
+		v, err := Build(Config{Type: "limiter", Params: "interval=5s,num=13,limit=10,window=1m,hash=fnv1a"})
+		So(err, ShouldBeNil)
+		l := v.(*Limiter)
+		So(l.Limit(), ShouldEqual, 10)
+		So(l.window, ShouldEqual, time.Minute)
+		So(l.counter.(*rollingCounter).Interval, ShouldEqual, 5*time.Second)
+		So(l.counter.(*rollingCounter).Variant, ShouldEqual, FNV1a)
+
+		v, err = Build(Config{Type: "limiter", Counter: "rollup", Params: "limit=1,window=1h,1m,1h,24h"})
+		So(err, ShouldBeNil)
+		So(len(v.(*Limiter).counter.(*rollupCounter).Levels), ShouldEqual, 2)
+	})
+
+	Convey("Width and depth fix the sketches' dimensions", t, func() {
+		v, err := Build(Config{Type: "sketch", Width: 1000, Depth: 3})
+		So(err, ShouldBeNil)
+		width, depth := v.(CountSketch).Dimensions()
+		So(width, ShouldEqual, 1000)
+		So(depth, ShouldEqual, 3)
+
+		v, err = Build(Config{Type: "rolling", Params: "interval=1m,num=10", Width: 500})
+		So(err, ShouldBeNil)
+		rl := v.(*rollingCounter)
+		width, depth = sketchSize(rl.Epsilon, rl.Delta)
+		So(width, ShouldEqual, 500)
+		_, defaultDepth := sketchSize(DefaultEpsilon, DefaultDelta)
+		So(depth, ShouldEqual, defaultDepth)
+	})
+
+	Convey("Build rejects bad configs", t, func() {
+		_, err := Build(Config{Type: "bogus"})
+		So(errors.Is(err, ErrInvalidParams), ShouldBeTrue)
+		_, err = Build(Config{Type: "rolling", Params: "num=3"})
+		So(err, ShouldNotBeNil)
+		_, err = Build(Config{Type: "limiter", Params: "interval=5s,num=13,window=1m"})
+		So(errors.Is(err, ErrInvalidParams), ShouldBeTrue)
+		_, err = Build(Config{Type: "limiter", Params: "interval=5s,num=13,limit=x,window=1m"})
+		So(errors.Is(err, ErrInvalidParams), ShouldBeTrue)
+		_, err = Build(Config{Type: "limiter", Counter: "sketch", Params: "limit=1,window=1m"})
+		So(errors.Is(err, ErrInvalidParams), ShouldBeTrue)
+		_, err = Build(Config{Type: "sketch", Width: 2})
+		So(errors.Is(err, ErrInvalidParams), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,51 @@
+package sketchy
+
+import "sync/atomic"
+
+// NewSketchConservative returns a new, empty count-min sketch like
+// NewSketch, but one that counts with conservative update: each count
+// raises a key's counters only as far as needed for its smallest counter to
+// grow by delta, leaving larger counters, already inflated by collisions,
+// as they are. Estimates remain upper bounds on the true counts, but are
+// much closer to them under skewed traffic, where a few heavy keys would
+// otherwise inflate the counters they share.
+//
+// A conservative sketch must have a single writer, since two concurrent
+// counts could both raise a counter to the same value. Negative deltas are
+// counted as in other sketches.
+func NewSketchConservative(epsilon, delta float64) CountSketch {
+	cs := NewSketch(epsilon, delta).(*fnvSketch)
+	cs.Conservative = true
+	return cs
+}
+
+// WithConservativeUpdate makes a counter count with conservative update, as
+// NewSketchConservative does, for a more accurate rate of each key under
+// skewed traffic. Counters already serialize their writers, so it is safe
+// for any counter.
+func WithConservativeUpdate() Option {
+	return func(o *options) { o.conservative = true }
+}
+
+// countConservative adds delta, which must be positive, to the count of the
+// key with the given hash by conservative update, and returns the smallest
+// and largest of its updated counters.
+func (r *fnvSketch) countConservative(k hashKernel, delta int) (min, max uint64) {
+	min = r.query(k) + uint64(delta)
+	for i := uint(0); i < r.Depth; i++ {
+		k := r.offset(i, k.index(i, r.Width))
+		if r.Stamps != nil && atomic.LoadUint32(&r.Stamps[k]) != r.Epoch {
+			atomic.StoreUint64(&r.Matrix[k], 0)
+			atomic.StoreUint32(&r.Stamps[k], r.Epoch)
+		}
+		v := atomic.LoadUint64(&r.Matrix[k])
+		if v < min {
+			v = min
+			atomic.StoreUint64(&r.Matrix[k], v)
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return min, max
+}
@@ -0,0 +1,71 @@
+package sketchy
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConservativeUpdate(t *testing.T) {
+	// skewed traffic, in which a few keys account for most events
+	rnd := rand.New(rand.NewSource(1))
+	truth := map[string]uint64{}
+	var keys, events []string
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprint(int(rnd.ExpFloat64() * 100))
+		if truth[key] == 0 {
+			keys = append(keys, key)
+		}
+		truth[key]++
+		events = append(events, key)
+	}
+
+	Convey("Conservative update overestimates less, but never underestimates", t, func() {
+		standard, conservative := NewSketch(0.99, 0.9), NewSketchConservative(0.99, 0.9)
+		for i, key := range events {
+			if i%2 == 0 {
+				standard.Count([]byte(key), 1)
+				conservative.Count([]byte(key), 1)
+			} else {
+				standard.Add([]byte(key), 1)
+				conservative.Add([]byte(key), 1)
+			}
+		}
+
+		var standardError, conservativeError uint64
+		for _, key := range keys {
+			s, c := standard.Query([]byte(key)), conservative.Query([]byte(key))
+			So(c, ShouldBeGreaterThanOrEqualTo, truth[key])
+			So(c, ShouldBeLessThanOrEqualTo, s)
+			standardError += s - truth[key]
+			conservativeError += c - truth[key]
+		}
+		So(conservativeError, ShouldBeLessThan, standardError/2)
+	})
+
+	Convey("Negative deltas are subtracted from every counter", t, func() {
+		cs := NewSketchConservative(0.99, 0.9)
+		cs.Count([]byte("a"), 5)
+		So(cs.Count([]byte("a"), -2), ShouldEqual, 3)
+		cs.Forget([]byte("a"))
+		So(cs.Query([]byte("a")), ShouldEqual, 0)
+	})
+
+	Convey("Counters can count conservatively", t, func() {
+		now := time.Now()
+		clock := func() time.Time { return now }
+		counter := RollingParams{SketchParams: SketchParams{Epsilon: 0.99, Delta: 0.9}, Interval: time.Minute, NumIntervals: 2}.New(
+			WithConservativeUpdate(), WithClock(clock))
+		for i := 0; i < 3; i++ {
+			counter.Count([]byte("key"), 60, time.Minute)
+			now = now.Add(time.Minute)
+		}
+		buckets := counter.(*rollingCounter).loadBuckets()
+		So(len(buckets), ShouldEqual, 2)
+		So(buckets[1].CountSketch.Conservative, ShouldBeTrue)
+		So(buckets[1].Query([]byte("key")), ShouldEqual, 60)
+	})
+}
@@ -0,0 +1,294 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// decayRescale is the number of half-lives after which a DecayingSketch
+// rescales its counters, before their weights overflow.
+const decayRescale = 64
+
+// A DecayingSketch is a count-min sketch whose counts decay exponentially
+// over time, halving every half-life, so that it weights recent activity
+// continuously rather than in the discrete buckets of a rolling counter. A
+// count made one half-life ago contributes half as much as one made now,
+// and one made ten half-lives ago a thousandth as much.
+//
+// Rather than decaying every counter as time passes, counts are added with
+// a weight that grows as time passes, and estimates are divided by the
+// current weight (this is forward decay, as described by Cormode et al.),
+// so counting and querying cost no more than in a count-min sketch. Once
+// the weights have grown for 64 half-lives, the next count rescales the
+// counters in place, so the weights never overflow.
+//
+// Like a count-min sketch's, its estimates are upper bounds. It is a
+// CountSketch, rounding its estimates to whole numbers; Estimate returns
+// them unrounded. Counters are accessed atomically, so Query may run
+// concurrently with Count.
+type DecayingSketch struct {
+	width, depth uint
+	halfLife     time.Duration
+	clock        func() time.Time
+
+	m        sync.RWMutex // held exclusively to rescale
+	landmark time.Time    // when counts are added with a weight of 1
+	matrix   []uint64     // float64 bits
+}
+
+// NewDecayingSketch returns a new, empty DecayingSketch with the dimensions
+// of a count-min sketch with the given parameters (see NewSketch), whose
+// counts halve every halfLife, which must be positive. Of the options, only
+// WithClock applies.
+func NewDecayingSketch(epsilon, delta float64, halfLife time.Duration, opts ...Option) *DecayingSketch {
+	if halfLife <= 0 {
+		panic(fmt.Sprintf("sketchy: decaying sketch half-life %s must be positive", halfLife))
+	}
+	if epsilon == 0 {
+		epsilon = DefaultEpsilon
+	}
+	if delta == 0 {
+		delta = DefaultDelta
+	}
+	s := &DecayingSketch{halfLife: halfLife, clock: newOptions(opts).clock}
+	s.width, s.depth = sketchSize(epsilon, delta)
+	s.matrix = make([]uint64, s.width*s.depth)
+	s.landmark = s.now()
+	return s
+}
+
+func (s *DecayingSketch) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock()
+}
+
+// HalfLife returns the time it takes the sketch's counts to halve.
+func (s *DecayingSketch) HalfLife() time.Duration { return s.halfLife }
+
+// Count adds delta to the count of occurrences of the given key as of now,
+// and returns its updated decayed estimate, as Query does.
+func (s *DecayingSketch) Count(key []byte, delta int) uint64 {
+	return roundEstimate(s.count(multihash(key), delta, s.now()))
+}
+
+// Add adds delta to the count of occurrences of the given key as of now,
+// without computing the updated estimate.
+func (s *DecayingSketch) Add(key []byte, delta int) { s.count(multihash(key), delta, s.now()) }
+
+// Query returns the estimated decayed count of the given key as of now,
+// rounded to the nearest whole number.
+func (s *DecayingSketch) Query(key []byte) uint64 {
+	return roundEstimate(s.estimate(multihash(key), s.now()))
+}
+
+// Estimate returns the estimated decayed count of the given key as of now.
+func (s *DecayingSketch) Estimate(key []byte) float64 { return s.estimate(multihash(key), s.now()) }
+
+// CountHandle is Count for a key hashed in advance by Prehash.
+func (s *DecayingSketch) CountHandle(h KeyHandle, delta int) uint64 {
+	return roundEstimate(s.count(FNV1.handle(h).k, delta, s.now()))
+}
+
+// QueryHandle is Query for a key hashed in advance by Prehash.
+func (s *DecayingSketch) QueryHandle(h KeyHandle) uint64 {
+	return roundEstimate(s.estimate(FNV1.handle(h).k, s.now()))
+}
+
+// CountUint64 is Count for the 8-byte big-endian encoding of key.
+func (s *DecayingSketch) CountUint64(key uint64, delta int) uint64 {
+	return roundEstimate(s.count(uint64hash(key), delta, s.now()))
+}
+
+// QueryUint64 is Query for the 8-byte big-endian encoding of key.
+func (s *DecayingSketch) QueryUint64(key uint64) uint64 {
+	return roundEstimate(s.estimate(uint64hash(key), s.now()))
+}
+
+// Forget removes the key's estimated count from each of its counters, so
+// that its estimate drops to 0. As in a count-min sketch, keys that share
+// those counters may be underestimated afterwards.
+func (s *DecayingSketch) Forget(key []byte) {
+	k := multihash(key)
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	n := s.min(k)
+	for i := uint(0); i < s.depth; i++ {
+		addFloat(&s.matrix[i*s.width+k.index(i, s.width)], -n)
+	}
+}
+
+// Dimensions returns the width and depth of the sketch's matrix of counters.
+func (s *DecayingSketch) Dimensions() (width, depth uint) { return s.width, s.depth }
+
+// Params returns the effective parameters of the sketch.
+func (s *DecayingSketch) Params() SketchParams {
+	var p SketchParams
+	p.Epsilon, p.Delta, _ = sizeParams(s.width, s.depth)
+	return p
+}
+
+// Merge adds the decayed counts of o to s, so that s holds the counts of
+// both. The sketches must have the same dimensions and half-life.
+func (s *DecayingSketch) Merge(o *DecayingSketch) error {
+	if s.width != o.width || s.depth != o.depth || s.halfLife != o.halfLife {
+		return fmt.Errorf("%w: decaying sketches of %dx%d halving every %s and %dx%d halving every %s can't be merged",
+			ErrIncompatibleSketch, s.width, s.depth, s.halfLife, o.width, o.depth, o.halfLife)
+	}
+	other := o.state()
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+	// o's counts are weighted relative to its landmark
+	f := s.weight(other.Landmark)
+	for i, v := range other.Matrix {
+		if v != 0 {
+			addFloat(&s.matrix[i], v*f)
+		}
+	}
+	return nil
+}
+
+// weight returns the weight of a count made at t, relative to the
+// landmark. The caller must hold s.m.
+func (s *DecayingSketch) weight(t time.Time) float64 {
+	return math.Exp2(float64(t.Sub(s.landmark)) / float64(s.halfLife))
+}
+
+// count adds delta occurrences of the key with the given hash at now, and
+// returns its updated estimate.
+func (s *DecayingSketch) count(k hashKernel, delta int, now time.Time) float64 {
+	s.rescale(now)
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	w := s.weight(now)
+	min := math.Inf(1)
+	for i := uint(0); i < s.depth; i++ {
+		min = math.Min(min, addFloat(&s.matrix[i*s.width+k.index(i, s.width)], float64(delta)*w))
+	}
+	return min / w
+}
+
+// estimate returns the estimated count of the key with the given hash as
+// of now.
+func (s *DecayingSketch) estimate(k hashKernel, now time.Time) float64 {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.min(k) / s.weight(now)
+}
+
+// min returns the smallest of the key's counters. The caller must hold s.m.
+func (s *DecayingSketch) min(k hashKernel) float64 {
+	min := math.Inf(1)
+	for i := uint(0); i < s.depth; i++ {
+		min = math.Min(min, math.Float64frombits(atomic.LoadUint64(&s.matrix[i*s.width+k.index(i, s.width)])))
+	}
+	return min
+}
+
+// rescale moves the landmark to now, scaling every counter down to match,
+// if it is decayRescale half-lives old.
+func (s *DecayingSketch) rescale(now time.Time) {
+	s.m.RLock()
+	due := now.Sub(s.landmark) >= decayRescale*s.halfLife
+	s.m.RUnlock()
+	if !due {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if now.Sub(s.landmark) < decayRescale*s.halfLife {
+		return
+	}
+	f := 1 / s.weight(now)
+	for i, v := range s.matrix {
+		s.matrix[i] = math.Float64bits(math.Float64frombits(v) * f)
+	}
+	s.landmark = now
+}
+
+// addFloat atomically adds d to the float64 whose bits are at p, stopping at
+// 0, and returns the sum.
+func addFloat(p *uint64, d float64) float64 {
+	for {
+		old := atomic.LoadUint64(p)
+		v := math.Max(math.Float64frombits(old)+d, 0)
+		if atomic.CompareAndSwapUint64(p, old, math.Float64bits(v)) {
+			return v
+		}
+	}
+}
+
+func roundEstimate(n float64) uint64 {
+	if !(n > 0) {
+		return 0
+	}
+	return uint64(math.Round(n))
+}
+
+// decayingState is the gob encoding of a DecayingSketch.
+type decayingState struct {
+	Width, Depth uint
+	HalfLife     time.Duration
+	Landmark     time.Time
+	Matrix       []float64
+}
+
+// state returns a copy of the sketch's state.
+func (s *DecayingSketch) state() decayingState {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	state := decayingState{Width: s.width, Depth: s.depth, HalfLife: s.halfLife, Landmark: s.landmark, Matrix: make([]float64, len(s.matrix))}
+	for i := range s.matrix {
+		state.Matrix[i] = math.Float64frombits(atomic.LoadUint64(&s.matrix[i]))
+	}
+	return state
+}
+
+// GobEncode returns the gob encoding of the sketch.
+func (s *DecayingSketch) GobEncode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(s.state()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode replaces the sketch with the one encoded in data, keeping its
+// clock.
+func (s *DecayingSketch) GobDecode(data []byte) error {
+	var state decayingState
+	if err := decodeAll(data, &state); err != nil {
+		return fmt.Errorf("%w: %s", ErrCorruptEncoding, err)
+	}
+	if _, _, ok := sizeParams(state.Width, state.Depth); !ok || state.HalfLife <= 0 {
+		return fmt.Errorf("%w: decaying sketch of %dx%d counters halving every %s",
+			ErrCorruptEncoding, state.Width, state.Depth, state.HalfLife)
+	}
+	if uint(len(state.Matrix)) != state.Width*state.Depth {
+		return fmt.Errorf("%w: decaying sketch matrix size doesn't match its dimensions", ErrCorruptEncoding)
+	}
+	matrix := make([]uint64, len(state.Matrix))
+	for i, v := range state.Matrix {
+		if !(v >= 0) || math.IsInf(v, 0) {
+			return fmt.Errorf("%w: decaying sketch counter %v", ErrCorruptEncoding, v)
+		}
+		matrix[i] = math.Float64bits(v)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.width, s.depth, s.halfLife = state.Width, state.Depth, state.HalfLife
+	s.landmark, s.matrix = state.Landmark, matrix
+	return nil
+}
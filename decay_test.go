@@ -0,0 +1,115 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecayingSketch(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	clock := func() time.Time { return now }
+
+	Convey("Decaying sketches are count sketches", t, func() {
+		var s CountSketch = NewDecayingSketch(0, 0, time.Minute)
+		width, depth := s.Dimensions()
+		So(width, ShouldEqual, 2719)
+		So(depth, ShouldEqual, 5)
+		So(s.Params(), ShouldResemble, NewSketch(0, 0).Params())
+		So(func() { NewDecayingSketch(0, 0, 0) }, ShouldPanic)
+	})
+
+	Convey("Counts halve every half-life", t, func() {
+		s := NewDecayingSketch(0, 0, time.Minute, WithClock(clock))
+		So(s.Count([]byte("a"), 1000), ShouldEqual, 1000)
+		now = now.Add(time.Minute)
+		So(s.Query([]byte("a")), ShouldEqual, 500)
+		now = now.Add(30 * time.Second)
+		So(s.Estimate([]byte("a")), ShouldAlmostEqual, 353.553, 0.001)
+
+		// recent counts outweigh older ones
+		So(s.Count([]byte("a"), 100), ShouldEqual, 454)
+		now = now.Add(10 * time.Minute)
+		So(s.Query([]byte("a")), ShouldEqual, 0)
+	})
+
+	Convey("Steady counts reach a steady estimate across rescaling", t, func() {
+		s := NewDecayingSketch(0, 0, time.Second, WithClock(clock))
+		for i := 0; i < 200; i++ {
+			s.Add([]byte("a"), 1)
+			now = now.Add(time.Second)
+		}
+		// 1 + 1/2 + 1/4 + ..., a second after the last count
+		So(s.Estimate([]byte("a")), ShouldAlmostEqual, 1, 1e-9)
+		So(s.landmark.After(now.Add(-decayRescale*time.Second)), ShouldBeTrue)
+
+		// counts long decayed are rescaled to nothing
+		now = now.Add(10000 * time.Second)
+		So(s.Count([]byte("b"), 1), ShouldEqual, 1)
+		So(s.Estimate([]byte("a")), ShouldEqual, 0)
+	})
+
+	Convey("Handles and numeric keys count the same keys", t, func() {
+		s := NewDecayingSketch(0, 0, time.Minute, WithClock(clock))
+		So(s.CountHandle(Prehash([]byte("a")), 2), ShouldEqual, 2)
+		So(s.QueryHandle(FNV1a.Prehash([]byte("a"))), ShouldEqual, 2)
+		So(s.CountUint64(7, 3), ShouldEqual, 3)
+		So(s.Query([]byte{0, 0, 0, 0, 0, 0, 0, 7}), ShouldEqual, 3)
+		So(s.QueryUint64(7), ShouldEqual, 3)
+	})
+
+	Convey("Forgotten keys drop to 0", t, func() {
+		s := NewDecayingSketch(0, 0, time.Minute, WithClock(clock))
+		s.Add([]byte("a"), 10)
+		s.Add([]byte("b"), 4)
+		s.Forget([]byte("a"))
+		So(s.Query([]byte("a")), ShouldEqual, 0)
+		So(s.Query([]byte("b")), ShouldEqual, 4)
+	})
+
+	Convey("Merged sketches hold the decayed counts of both", t, func() {
+		a := NewDecayingSketch(0, 0, time.Minute, WithClock(clock))
+		a.Add([]byte("x"), 100)
+		now = now.Add(time.Minute)
+		b := NewDecayingSketch(0, 0, time.Minute, WithClock(clock))
+		b.Add([]byte("x"), 100)
+		So(a.Merge(b), ShouldBeNil)
+		So(a.Query([]byte("x")), ShouldEqual, 150)
+		So(b.Query([]byte("x")), ShouldEqual, 100)
+
+		err := a.Merge(NewDecayingSketch(0, 0, time.Hour))
+		So(errors.Is(err, ErrIncompatibleSketch), ShouldBeTrue)
+	})
+
+	Convey("Decaying sketches round-trip through gob", t, func() {
+		s := NewDecayingSketch(0.9, 0.99, time.Minute, WithClock(clock))
+		s.Add([]byte("a"), 64)
+		buf := &bytes.Buffer{}
+		So(gob.NewEncoder(buf).Encode(s), ShouldBeNil)
+
+		decoded := NewDecayingSketch(0, 0, time.Hour, WithClock(clock))
+		So(gob.NewDecoder(buf).Decode(decoded), ShouldBeNil)
+		now = now.Add(2 * time.Minute)
+		So(decoded.Query([]byte("a")), ShouldEqual, 16)
+		So(decoded.HalfLife(), ShouldEqual, time.Minute)
+		So(decoded.Params(), ShouldResemble, s.Params())
+	})
+
+	Convey("Corrupt encodings are rejected", t, func() {
+		for _, state := range []decayingState{
+			{Width: 3, Depth: 1, Matrix: make([]float64, 3)},
+			{Width: 2, Depth: 1, HalfLife: time.Second, Matrix: make([]float64, 2)},
+			{Width: 3, Depth: 2, HalfLife: time.Second, Matrix: make([]float64, 5)},
+			{Width: 3, Depth: 1, HalfLife: time.Second, Matrix: []float64{0, -1, 0}},
+		} {
+			buf := &bytes.Buffer{}
+			So(gob.NewEncoder(buf).Encode(state), ShouldBeNil)
+			var s DecayingSketch
+			So(errors.Is(s.GobDecode(buf.Bytes()), ErrCorruptEncoding), ShouldBeTrue)
+		}
+	})
+}
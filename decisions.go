@@ -0,0 +1,95 @@
+package sketchy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A Denial records a request that a Limiter refused, or that DecideN
+// decided anything other than Allowed for.
+type Denial struct {
+	Time     time.Time
+	Key      []byte
+	N        int      // The number of events asked for.
+	Rate     float64  // The key's observed rate over the window when it was refused.
+	Limit    float64  // The limit in force, in events per second.
+	Decision Decision // Deny, or the tier's decision for DecideN.
+
+	// DryRun is true if the limiter was in dry-run mode, so the events
+	// were allowed without delay after all.
+	DryRun bool
+}
+
+// WithDecisionLog makes a Limiter remember its most recent denials, up to
+// size of them, for RecentDenials. Size must be positive.
+func WithDecisionLog(size int) LimiterOption {
+	if size <= 0 {
+		panic(fmt.Sprintf("sketchy: decision log size %d must be positive", size))
+	}
+	return func(l *Limiter) { l.denials = &decisionLog{entries: make([]Denial, size)} }
+}
+
+// decisionLog is a ring buffer of denials.
+type decisionLog struct {
+	m       sync.Mutex
+	entries []Denial
+	next    int
+	n       int
+}
+
+func (d *decisionLog) record(denial Denial) {
+	if d == nil {
+		return
+	}
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.entries[d.next] = denial
+	d.next = (d.next + 1) % len(d.entries)
+	if d.n < len(d.entries) {
+		d.n++
+	}
+}
+
+// recent returns up to n of the most recent denials, newest first.
+func (d *decisionLog) recent(n int) []Denial {
+	if d == nil {
+		return nil
+	}
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if n > d.n {
+		n = d.n
+	}
+	result := make([]Denial, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, d.entries[(d.next-i+len(d.entries))%len(d.entries)])
+	}
+	return result
+}
+
+// deny logs a refusal of n events for key, which had the given number of
+// events in the last window, with the given decision.
+func (l *Limiter) deny(key []byte, n int, events float64, d Decision) {
+	if l.wouldBlock != nil {
+		l.wouldBlock.Add(key, n)
+	}
+	if l.denials == nil {
+		return
+	}
+	l.denials.record(Denial{
+		Time:     l.now(),
+		Key:      append([]byte(nil), key...),
+		N:        n,
+		Rate:     events / l.window.Seconds(),
+		Limit:    l.limit,
+		Decision: d,
+		DryRun:   l.dryRun,
+	})
+}
+
+// RecentDenials returns up to n of the limiter's most recent denials, newest
+// first. It returns nil unless the limiter was created with WithDecisionLog.
+func (l *Limiter) RecentDenials(n int) []Denial { return l.denials.recent(n) }
@@ -0,0 +1,79 @@
+package sketchy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithDecisionLog(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	newLimiter := func(opts ...LimiterOption) *Limiter {
+		counter := RollingCounter(0, 0, time.Second, 11).(*rollingCounter)
+		counter.clock = func() time.Time {
+			now = now.Add(time.Millisecond)
+			return now
+		}
+		return NewLimiter(counter, 2, 10*time.Second, opts...)
+	}
+
+	Convey("Denials are logged newest first", t, func() {
+		limiter := newLimiter(WithDecisionLog(3))
+		So(limiter.RecentDenials(10), ShouldBeEmpty)
+
+		So(limiter.AllowN(key, 20), ShouldBeTrue)
+		So(limiter.Allow(key), ShouldBeFalse)
+		_, ok := limiter.ReserveN([]byte("other"), 21)
+		So(ok, ShouldBeFalse)
+		So(limiter.WaitN(context.Background(), key, 21), ShouldNotBeNil)
+
+		denials := limiter.RecentDenials(10)
+		So(len(denials), ShouldEqual, 3)
+		So(string(denials[0].Key), ShouldEqual, "key")
+		So(denials[0].N, ShouldEqual, 21)
+		So(string(denials[1].Key), ShouldEqual, "other")
+		So(denials[1].Rate, ShouldEqual, 0)
+		So(denials[2].N, ShouldEqual, 1)
+		So(denials[2].Rate, ShouldAlmostEqual, 2, 0.01)
+		So(denials[2].Limit, ShouldEqual, 2)
+
+		Convey("and the oldest are dropped when the log is full", func() {
+			limiter.Allow(key)
+			denials := limiter.RecentDenials(2)
+			So(len(denials), ShouldEqual, 2)
+			So(denials[0].N, ShouldEqual, 1)
+			So(denials[1].N, ShouldEqual, 21)
+			So(len(limiter.RecentDenials(10)), ShouldEqual, 3)
+		})
+	})
+
+	Convey("Denials are stamped by the limiter's clock", t, func() {
+		limiter := newLimiter(WithDecisionLog(1))
+		at := time.Unix(1<<30, 0)
+		limiter.clock = func() time.Time { return at }
+		limiter.AllowN(key, 21)
+		So(limiter.RecentDenials(1)[0].Time, ShouldEqual, at)
+	})
+
+	Convey("Logged keys don't alias the caller's buffer", t, func() {
+		limiter := newLimiter(WithDecisionLog(1))
+		buf := []byte("key")
+		limiter.AllowN(buf, 21)
+		buf[0] = 'x'
+		So(string(limiter.RecentDenials(1)[0].Key), ShouldEqual, "key")
+	})
+
+	Convey("Without a log there are no denials", t, func() {
+		limiter := newLimiter()
+		So(limiter.AllowN(key, 21), ShouldBeFalse)
+		So(limiter.RecentDenials(1), ShouldBeNil)
+	})
+
+	Convey("The log size must be positive", t, func() {
+		So(func() { WithDecisionLog(0) }, ShouldPanic)
+	})
+}
@@ -0,0 +1,71 @@
+package sketchy
+
+import (
+	"fmt"
+	"time"
+)
+
+// dedupeFPRate is the false positive rate each generation of a counter's
+// filter of event IDs is sized for: the chance that a new event is taken
+// for a redelivery and dropped.
+const dedupeFPRate = 0.001
+
+// WithDedupe makes CountOnce count each event ID only once within window,
+// so that events redelivered by an at-least-once queue don't inflate rates.
+// The IDs are kept in a pair of Bloom filters, each sized for expectedIDs
+// distinct IDs and covering a window, so an ID is remembered for between
+// one and two windows. New events are occasionally taken for redeliveries
+// and dropped, more often once more than expectedIDs arrive in a window.
+// Both expectedIDs and window must be positive. A RollupCounter keeps one
+// filter for all its levels, so an event is counted once in each or none.
+func WithDedupe(expectedIDs int, window time.Duration) Option {
+	if expectedIDs <= 0 || window <= 0 {
+		panic(fmt.Sprintf("sketchy: dedupe size %d and window %s must be positive", expectedIDs, window))
+	}
+	bits, hashes := bloomSize(uint(expectedIDs), dedupeFPRate)
+	return func(o *options) {
+		o.dedupe = &rollingBloom{bits: bits, hashes: hashes}
+		o.dedupeWindow = window
+	}
+}
+
+// A DedupingCounter counts events identified by IDs at most once each.
+// Rolling and rollup counters are DedupingCounters.
+type DedupingCounter interface {
+	CountOnce(key, id []byte, delta int, interval time.Duration) (rate float64, counted bool)
+}
+
+// CountOnce records delta occurrences of key as Count does, unless the
+// event with the given ID has already been counted, and returns the key's
+// updated rate and whether the event was counted. If s isn't a
+// DedupingCounter, every event is counted.
+func CountOnce(s RateSketch, key, id []byte, delta int, interval time.Duration) (rate float64, counted bool) {
+	if c, ok := s.(DedupingCounter); ok {
+		return c.CountOnce(key, id, delta, interval)
+	}
+	return s.Count(key, delta, interval), true
+}
+
+// CountOnce records delta occurrences of key as Count does, unless the
+// event with the given ID was counted within the window set by WithDedupe,
+// in which case it only returns the key's rate. It reports whether the
+// event was counted. If the counter wasn't created WithDedupe, every event
+// is counted.
+func (rl *rollingCounter) CountOnce(key, id []byte, delta int, interval time.Duration) (rate float64, counted bool) {
+	if rl.dedupe != nil && !rl.dedupe.addNew(multihash(id), rl.now(), rl.dedupeWindow) {
+		return rl.Query(key, interval), false
+	}
+	return rl.Count(key, delta, interval), true
+}
+
+// CountOnce records delta occurrences of key in every level as Count does,
+// unless the event with the given ID was counted within the window set by
+// WithDedupe, in which case it only returns the key's rate. It reports
+// whether the event was counted. If the counter wasn't created WithDedupe,
+// every event is counted.
+func (rc *rollupCounter) CountOnce(key, id []byte, delta int, interval time.Duration) (rate float64, counted bool) {
+	if rc.dedupe != nil && !rc.dedupe.addNew(multihash(id), rc.now(), rc.dedupeWindow) {
+		return rc.Query(key, interval), false
+	}
+	return rc.Count(key, delta, interval), true
+}
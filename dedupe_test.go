@@ -0,0 +1,102 @@
+package sketchy
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDedupe(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	params := RollingParams{Interval: time.Minute, NumIntervals: 10}
+
+	Convey("Redelivered events are counted once", t, func() {
+		now := start
+		counter := params.New(WithClock(func() time.Time { return now }), WithDedupe(1000, time.Minute))
+		for delivery := 0; delivery < 3; delivery++ {
+			for i := 0; i < 60; i++ {
+				_, counted := CountOnce(counter, []byte("key"), []byte(fmt.Sprint("event", i)), 1, time.Minute)
+				So(counted, ShouldEqual, delivery == 0)
+			}
+		}
+		now = now.Add(time.Minute)
+		So(counter.Query([]byte("key"), time.Minute), ShouldEqual, 1)
+	})
+
+	Convey("Rollup counters count redelivered events once in every level", t, func() {
+		now := start
+		rollup := RollupParams{Durations: []time.Duration{time.Minute, time.Hour, 24 * time.Hour}}.New(
+			WithClock(func() time.Time { return now }), WithDedupe(1000, time.Minute))
+		for delivery := 0; delivery < 3; delivery++ {
+			for i := 0; i < 60; i++ {
+				_, counted := CountOnce(rollup, []byte("key"), []byte(fmt.Sprint("event", i)), 1, time.Minute)
+				So(counted, ShouldEqual, delivery == 0)
+			}
+		}
+		now = now.Add(time.Minute)
+		So(rollup.Query([]byte("key"), time.Minute), ShouldEqual, 1)
+		for _, level := range rollup.(*rollupCounter).Levels {
+			So(level.loadBuckets()[0].query(multihash([]byte("key"))), ShouldEqual, 60)
+		}
+	})
+
+	Convey("IDs are forgotten after two windows", t, func() {
+		now := start
+		counter := params.New(WithClock(func() time.Time { return now }), WithDedupe(1000, time.Minute))
+		_, counted := CountOnce(counter, []byte("key"), []byte("id"), 1, time.Minute)
+		So(counted, ShouldBeTrue)
+		now = now.Add(90 * time.Second)
+		_, counted = CountOnce(counter, []byte("key"), []byte("id"), 1, time.Minute)
+		So(counted, ShouldBeFalse)
+		now = now.Add(2 * time.Minute)
+		_, counted = CountOnce(counter, []byte("key"), []byte("id"), 1, time.Minute)
+		So(counted, ShouldBeTrue)
+	})
+
+	Convey("Concurrent deliveries of an event count it once", t, func() {
+		counter := params.New(WithDedupe(1000, time.Minute))
+		var wg sync.WaitGroup
+		var counts int64
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, counted := CountOnce(counter, []byte("key"), []byte("id"), 1, time.Minute); counted {
+					atomic.AddInt64(&counts, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		So(counts, ShouldEqual, 1)
+	})
+
+	Convey("Counters sharing the option keep their own IDs", t, func() {
+		dedupe := WithDedupe(1000, time.Minute)
+		a, b := params.New(dedupe), params.New(dedupe)
+		_, counted := CountOnce(a, []byte("key"), []byte("id"), 1, time.Minute)
+		So(counted, ShouldBeTrue)
+		_, counted = CountOnce(b, []byte("key"), []byte("id"), 1, time.Minute)
+		So(counted, ShouldBeTrue)
+	})
+
+	Convey("Without the option, every event is counted", t, func() {
+		counter := params.New()
+		m := &minimalSketch{counts: map[string]int{}}
+		for i := 0; i < 2; i++ {
+			_, counted := CountOnce(counter, []byte("key"), []byte("id"), 1, time.Minute)
+			So(counted, ShouldBeTrue)
+			_, counted = CountOnce(m, []byte("key"), []byte("id"), 1, time.Minute)
+			So(counted, ShouldBeTrue)
+		}
+		So(m.counts["key"], ShouldEqual, 2)
+	})
+
+	Convey("Bad dedupe sizes and windows are refused", t, func() {
+		So(func() { WithDedupe(0, time.Minute) }, ShouldPanic)
+		So(func() { WithDedupe(10, 0) }, ShouldPanic)
+	})
+}
@@ -0,0 +1,74 @@
+package sketchy
+
+import "time"
+
+// QueryDetail describes the data behind a rate returned by QueryDetailed.
+type QueryDetail struct {
+	// Rate is the observed rate, as returned by Query.
+	Rate float64
+
+	// Covered is the duration of the data the rate was computed from. It is
+	// less than the interval asked for if the counter doesn't retain enough
+	// history, and 0 if Rate is 0 for lack of data.
+	Covered time.Duration
+
+	// Events is the estimated number of occurrences of the key in the
+	// interval. Unlike Rate, it is reported even if the data covers less
+	// than a second.
+	Events float64
+
+	// Buckets is the number of buckets consulted, including every level of a
+	// RollupCounter.
+	Buckets int
+
+	// Interpolated is true if the oldest bucket consulted began before the
+	// interval, so that only a proportion of its count was used.
+	Interpolated bool
+}
+
+// QueryDetailed returns the observed rate of the given key over the given
+// interval, as Query does, along with a description of the data it was
+// computed from.
+func (rl *rollingCounter) QueryDetailed(key []byte, interval time.Duration) QueryDetail {
+	k := rl.prehash(key).k
+	end, latest := rl.complete(rl.now())
+	return rl.privacy.detail(rl.queryAt(k, end, interval), k, interval, latest)
+}
+
+// queryAt describes the rate of the key with the given hash over the interval
+// ending at now.
+func (rl *rollingCounter) queryAt(k hashKernel, now time.Time, interval time.Duration) QueryDetail {
+	var detail QueryDetail
+	if tc, d := rl.queryDetail(k, now, interval, 0, &rl.options, &detail); d != 0 {
+		detail.Rate = (tc / float64(d)) * float64(time.Second)
+	}
+	return detail
+}
+
+// QueryDetailed returns the observed rate of the given key over the given
+// interval, as Query does, along with a description of the data it was
+// computed from.
+func (rc *rollupCounter) QueryDetailed(key []byte, interval time.Duration) QueryDetail {
+	k := rc.prehash(key).k
+	return rc.privacy.detail(rc.queryAt(k, rc.now(), interval), k, interval, rc.latest())
+}
+
+// queryAt describes the rate of the key with the given hash over the interval
+// ending at now, consulting the finest levels first.
+func (rc *rollupCounter) queryAt(k hashKernel, now time.Time, interval time.Duration) QueryDetail {
+	var detail QueryDetail
+	tc := float64(0)
+	for _, c := range rc.Levels {
+		if interval <= 0 {
+			break
+		}
+		n, d := c.queryDetail(k, now, interval, 0, &rc.options, &detail)
+		tc += n
+		now = now.Add(-d)
+		interval -= d
+	}
+	if detail.Covered != 0 {
+		detail.Rate = (tc / float64(detail.Covered)) * float64(time.Second)
+	}
+	return detail
+}
@@ -0,0 +1,79 @@
+package sketchy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueryDetailed(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	Convey("Rolling counters describe the buckets behind a rate", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 3).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		So(counter.QueryDetailed(key, time.Minute), ShouldResemble, QueryDetail{})
+
+		for i := 0; i < 5; i++ {
+			counter.Count(key, 60, 0)
+			now = now.Add(time.Minute)
+		}
+
+		So(counter.QueryDetailed(key, 2*time.Minute), ShouldResemble, QueryDetail{
+			Rate: 1, Covered: 2 * time.Minute, Events: 120, Buckets: 2,
+		})
+		So(counter.QueryDetailed(key, 90*time.Second), ShouldResemble, QueryDetail{
+			Rate: 1, Covered: 90 * time.Second, Events: 90, Buckets: 2, Interpolated: true,
+		})
+		So(counter.QueryDetailed(key, time.Hour), ShouldResemble, QueryDetail{
+			Rate: 1, Covered: 3 * time.Minute, Events: 180, Buckets: 3,
+		})
+		So(counter.QueryDetailed(key, time.Hour).Rate, ShouldEqual, counter.Query(key, time.Hour))
+
+	})
+
+	Convey("Checked queries report intervals the data doesn't cover", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 3).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		_, err := QueryChecked(counter, key, time.Minute)
+		So(errors.Is(err, ErrInsufficientData), ShouldBeTrue)
+
+		for i := 0; i < 5; i++ {
+			counter.Count(key, 60, 0)
+			now = now.Add(time.Minute)
+		}
+		rate, err := QueryChecked(counter, key, 3*time.Minute)
+		So(rate, ShouldEqual, 1)
+		So(err, ShouldBeNil)
+
+		rate, err = QueryChecked(counter, key, time.Hour)
+		So(rate, ShouldEqual, 1)
+		So(errors.Is(err, ErrInsufficientData), ShouldBeTrue)
+	})
+
+	Convey("Events are reported even without enough data for a rate", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 3).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		counter.Count(key, 5, 0)
+		now = now.Add(time.Millisecond)
+		So(counter.QueryDetailed(key, time.Minute), ShouldResemble, QueryDetail{Events: 5})
+	})
+
+	Convey("Rollup counters describe every level consulted", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, 5*time.Minute, time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		for i := 0; i < 10; i++ {
+			rollup.Count(key, 60, 0)
+			now = now.Add(time.Minute)
+		}
+
+		detail := rollup.QueryDetailed(key, 7*time.Minute)
+		So(detail.Rate, ShouldAlmostEqual, 1)
+		So(detail.Covered, ShouldEqual, 7*time.Minute)
+		So(detail.Buckets, ShouldBeGreaterThan, 5)
+		So(detail.Interpolated, ShouldBeTrue)
+	})
+}
@@ -0,0 +1,113 @@
+package sketchy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A KeyDictionary remembers the original bytes of frequently counted keys,
+// which a sketch can't recover from their counters, so that reports can
+// show real keys. A key is added once its count in a counter's current
+// bucket reaches a threshold, and the dictionary's EvictionPolicy chooses
+// which keys to forget once it is full. Keys counted through handles that
+// don't know their bytes, such as those from CompositeKey or CountUint64,
+// are never added.
+//
+// A KeyDictionary is attached to counters with WithKeyDictionary, and may be
+// shared between several of them.
+type KeyDictionary struct {
+	size      int
+	threshold uint64
+	policy    EvictionPolicy
+	clock     func() time.Time
+
+	m       sync.Mutex
+	entries map[hashKernel][]byte
+}
+
+// NewKeyDictionary returns a KeyDictionary that holds up to size keys, each
+// counted at least threshold times in a single bucket, forgetting the least
+// recently counted keys first. Size must be positive.
+func NewKeyDictionary(size int, threshold uint64) *KeyDictionary {
+	return NewKeyDictionaryWithPolicy(size, threshold, NewLRUPolicy())
+}
+
+// NewKeyDictionaryWithPolicy returns a KeyDictionary like NewKeyDictionary,
+// but with the given eviction policy, which must not be shared with another
+// dictionary.
+func NewKeyDictionaryWithPolicy(size int, threshold uint64, policy EvictionPolicy) *KeyDictionary {
+	if size <= 0 {
+		panic(fmt.Sprintf("sketchy: key dictionary size %d must be positive", size))
+	}
+	return &KeyDictionary{size: size, threshold: threshold, policy: policy, entries: map[hashKernel][]byte{}}
+}
+
+// WithKeyDictionary makes a counter record the keys it counts in d.
+func WithKeyDictionary(d *KeyDictionary) Option {
+	return func(o *options) { o.dict = d }
+}
+
+func (d *KeyDictionary) now() time.Time {
+	if d.clock == nil {
+		return time.Now()
+	}
+	return d.clock()
+}
+
+// observe records that the key was counted, with the given updated count in
+// the current bucket.
+func (d *KeyDictionary) observe(h KeyHandle, count uint64) {
+	if d == nil || h.key == nil || count < d.threshold {
+		return
+	}
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	now := d.now()
+	d.policy.Touched(uint64(h.k), count, now)
+	if _, ok := d.entries[h.k]; !ok {
+		d.entries[h.k] = append([]byte(nil), h.key...)
+	}
+	d.evict(now)
+}
+
+// evict forgets the keys the policy chooses. The caller must hold d.m.
+func (d *KeyDictionary) evict(now time.Time) {
+	for _, hash := range d.policy.Evict(len(d.entries)-d.size, now) {
+		delete(d.entries, hashKernel(hash))
+	}
+}
+
+// Lookup returns the original bytes of the key with the same hash as h, if
+// the dictionary holds it.
+func (d *KeyDictionary) Lookup(h KeyHandle) ([]byte, bool) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.evict(d.now())
+	key, ok := d.entries[h.k]
+	return key, ok
+}
+
+// Keys returns every key the dictionary holds, in no particular order.
+func (d *KeyDictionary) Keys() [][]byte {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.evict(d.now())
+	keys := make([][]byte, 0, len(d.entries))
+	for _, key := range d.entries {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Len returns the number of keys the dictionary holds.
+func (d *KeyDictionary) Len() int {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.evict(d.now())
+	return len(d.entries)
+}
@@ -0,0 +1,64 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeyDictionary(t *testing.T) {
+	now := time.Now()
+
+	Convey("Keys are remembered once they reach the threshold", t, func() {
+		dict := NewKeyDictionary(10, 3)
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(
+			WithKeyDictionary(dict)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		key := []byte("key")
+		counter.Count(key, 2, 0)
+		So(dict.Len(), ShouldEqual, 0)
+		counter.Add(key, 1)
+		So(dict.Len(), ShouldEqual, 1)
+
+		found, ok := dict.Lookup(Prehash([]byte("key")))
+		So(ok, ShouldBeTrue)
+		So(string(found), ShouldEqual, "key")
+		_, ok = dict.Lookup(Prehash([]byte("other")))
+		So(ok, ShouldBeFalse)
+
+		Convey("without aliasing the caller's buffer", func() {
+			key[0] = 'x'
+			So(string(dict.Keys()[0]), ShouldEqual, "key")
+		})
+
+		Convey("but not keys without bytes", func() {
+			counter.CountUint64(42, 10, 0)
+			counter.CountHandle(CompositeKey([]byte("a"), []byte("b")), 10, 0)
+			So(dict.Len(), ShouldEqual, 1)
+		})
+	})
+
+	Convey("The least recently counted keys are forgotten", t, func() {
+		dict := NewKeyDictionary(2, 0)
+		rollup := RollupParams{Durations: []time.Duration{time.Minute, time.Hour}}.New(
+			WithKeyDictionary(dict)).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+
+		rollup.Count([]byte("a"), 1, 0)
+		rollup.Count([]byte("b"), 1, 0)
+		rollup.Count([]byte("a"), 1, 0)
+		rollup.Add([]byte("c"), 1)
+		So(dict.Len(), ShouldEqual, 2)
+
+		_, ok := dict.Lookup(Prehash([]byte("b")))
+		So(ok, ShouldBeFalse)
+		_, ok = dict.Lookup(Prehash([]byte("a")))
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("The size must be positive", t, func() {
+		So(func() { NewKeyDictionary(0, 1) }, ShouldPanic)
+	})
+}
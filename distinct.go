@@ -0,0 +1,154 @@
+package sketchy
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// hllPrecision is the number of hash bits used to pick a HyperLogLog
+// register. 1024 registers estimate cardinality to within about 3%.
+const (
+	hllPrecision = 10
+	hllRegisters = 1 << hllPrecision
+	hllWords     = hllRegisters / 8
+)
+
+// hll is a HyperLogLog (http://algo.inria.fr/flajolet/Publications/FlFuGaMe07.pdf)
+// cardinality estimator. Its registers are bytes packed eight to a word so
+// that they can be accessed atomically; like a sketch with stamps, an hll
+// must have a single writer.
+type hll []uint64
+
+func newHLL() hll { return make(hll, hllWords) }
+
+// add records an observation of the key with the given hash.
+func (h hll) add(k hashKernel) {
+	x := mix64(uint64(k))
+	i := x >> (64 - hllPrecision)
+	rho := uint64(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+
+	w := &h[i/8]
+	shift := (i % 8) * 8
+	v := atomic.LoadUint64(w)
+	if cur := (v >> shift) & 0xff; rho > cur {
+		atomic.StoreUint64(w, v&^(0xff<<shift)|rho<<shift)
+	}
+}
+
+// register returns the value of the i'th register.
+func (h hll) register(i int) uint64 {
+	return (atomic.LoadUint64(&h[i/8]) >> (uint(i%8) * 8)) & 0xff
+}
+
+// union returns a new hll that has observed every key observed by h or o.
+func (h hll) union(o hll) hll {
+	u := newHLL()
+	for i := 0; i < hllRegisters; i++ {
+		r := h.register(i)
+		if o != nil {
+			if s := o.register(i); s > r {
+				r = s
+			}
+		}
+		u[i/8] |= r << (uint(i%8) * 8)
+	}
+	return u
+}
+
+// estimate returns the estimated number of distinct keys observed.
+func (h hll) estimate() float64 {
+	if h == nil {
+		return 0
+	}
+	var (
+		sum   float64
+		zeros int
+	)
+	for i := 0; i < hllRegisters; i++ {
+		r := h.register(i)
+		if r == 0 {
+			zeros++
+		}
+		sum += math.Ldexp(1, -int(r))
+	}
+	const m = float64(hllRegisters)
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// small range correction
+		e = m * math.Log(m/float64(zeros))
+	}
+	return e
+}
+
+// mix64 is the finalizer of MurmurHash3, which spreads FNV's weak high bits
+// over the whole word.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// window returns the index of the oldest of the buckets that overlap the
+// given interval before now. Buckets only partly inside the interval are
+// included in full.
+func window(buckets []sketchWithTime, now time.Time, interval time.Duration) int {
+	if interval <= 0 || len(buckets) == 0 {
+		return len(buckets)
+	}
+	start := now.Add(-interval)
+	i := len(buckets) - 1
+	for i > 0 && buckets[i].Time.After(start) {
+		i--
+	}
+	return i
+}
+
+// distinct returns the union of the registers of the buckets that overlap
+// the given interval before now. It doesn't lock the counter.
+func (rl *rollingCounter) distinct(now time.Time, interval time.Duration) hll {
+	var u hll
+	buckets := rl.loadBuckets()
+	for _, b := range buckets[window(buckets, now, interval):] {
+		if b.Distinct != nil {
+			u = b.Distinct.union(u)
+		}
+	}
+	return u
+}
+
+// DistinctKeys returns the estimated number of distinct keys counted over
+// the given interval. Buckets that overlap the start of the interval are
+// counted in full, so the estimate covers up to one bucket more than asked.
+func (rl *rollingCounter) DistinctKeys(interval time.Duration) float64 {
+	if interval <= 0 {
+		return 0
+	}
+	return rl.distinct(rl.now(), interval).estimate()
+}
+
+// DistinctKeys returns the estimated number of distinct keys counted over
+// the given interval. The estimate comes from the finest level that retains
+// the whole interval, or the coarsest level if none does, so buckets that
+// overlap the start of the interval may be counted in full.
+func (rc *rollupCounter) DistinctKeys(interval time.Duration) float64 {
+	if interval <= 0 || len(rc.Levels) == 0 {
+		return 0
+	}
+	return rc.covering(interval).distinct(rc.now(), interval).estimate()
+}
+
+// covering returns the finest level that retains the whole interval, or the
+// coarsest level if none does.
+func (rc *rollupCounter) covering(interval time.Duration) *rollingCounter {
+	for _, c := range rc.Levels {
+		if v := c.view(); v.interval*time.Duration(v.num-1) >= interval {
+			return c
+		}
+	}
+	return rc.Levels[len(rc.Levels)-1]
+}
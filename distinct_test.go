@@ -0,0 +1,81 @@
+package sketchy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDistinctKeys(t *testing.T) {
+	now := time.Now()
+
+	Convey("HyperLogLog estimates are within a few percent", t, func() {
+		h := newHLL()
+		So(h.estimate(), ShouldEqual, 0)
+		for i := 0; i < 100000; i++ {
+			h.add(multihash([]byte(fmt.Sprintf("key%d", i))))
+		}
+		So(h.estimate(), ShouldAlmostEqual, 100000, 10000)
+
+		for i := 0; i < 100000; i++ {
+			h.add(multihash([]byte(fmt.Sprintf("key%d", i))))
+		}
+		So(h.estimate(), ShouldAlmostEqual, 100000, 10000)
+
+		o := newHLL()
+		for i := 50000; i < 150000; i++ {
+			o.add(multihash([]byte(fmt.Sprintf("key%d", i))))
+		}
+		So(h.union(o).estimate(), ShouldAlmostEqual, 150000, 15000)
+	})
+
+	Convey("Rolling counters count distinct keys per window", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		So(counter.DistinctKeys(time.Hour), ShouldEqual, 0)
+
+		for m := 0; m < 5; m++ {
+			for i := 0; i < 100; i++ {
+				counter.Count([]byte(fmt.Sprintf("key%d-%d", m, i)), 1, 0)
+				counter.Count([]byte("shared"), 1, 0)
+			}
+			now = now.Add(time.Minute)
+		}
+
+		So(counter.DistinctKeys(0), ShouldEqual, 0)
+		So(counter.DistinctKeys(time.Minute), ShouldAlmostEqual, 101, 10)
+		So(counter.DistinctKeys(90*time.Second), ShouldAlmostEqual, 201, 15)
+		So(counter.DistinctKeys(time.Hour), ShouldAlmostEqual, 501, 30)
+	})
+
+	Convey("Rollup counters use the finest level covering the interval", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, 5*time.Minute, time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		for m := 0; m < 20; m++ {
+			for i := 0; i < 50; i++ {
+				rollup.Count([]byte(fmt.Sprintf("key%d-%d", m, i)), 1, 0)
+			}
+			now = now.Add(time.Minute)
+		}
+
+		So(rollup.DistinctKeys(time.Minute), ShouldAlmostEqual, 50, 5)
+		So(rollup.DistinctKeys(20*time.Minute), ShouldAlmostEqual, 1000, 60)
+	})
+
+	Convey("Buckets decoded from older encodings have no register", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		counter.Count([]byte("key"), 1, 0)
+		buckets := counter.loadBuckets()
+		buckets[0].Distinct = nil
+		So(counter.DistinctKeys(time.Minute), ShouldEqual, 0)
+		So(counter.Stats().Buckets[0].DistinctKeys, ShouldAlmostEqual, 1, 0.01)
+
+		buckets[0].Distinct = make(hll, 3)
+		data, err := encode(counter)
+		So(err, ShouldBeNil)
+		So(decode(RollingCounter(0, 0, time.Minute, 10), data), ShouldNotBeNil)
+	})
+}
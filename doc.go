@@ -4,5 +4,10 @@ probabilistic data structures that can track the occurrences of a very
 large number of distinct keys using a relatively small amount of space.
 The resulting counts/rates are estimates with a guaranteed level of
 accuracy.
+
+Sketches and counters can be persisted with encoding/gob. Any encoding
+written by a released version of this package can be decoded by every later
+version; golden encodings for each version are kept under testdata/golden
+and checked by the tests.
 */
 package sketchy
@@ -0,0 +1,49 @@
+package sketchy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteDOT writes a Graphviz (https://graphviz.org) diagram of the counter's
+// buckets to w, for seeing at a glance where its data lives. Each level of a
+// RollupCounter is drawn as a cluster of its buckets, oldest first, each
+// labelled with when it started, how long it has covered, its total events
+// and its occupancy. Render it with, for example, dot -Tsvg.
+func WriteDOT(w io.Writer, counter RateSketch) error {
+	stats := StatsOf(counter)
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString("digraph sketchy {\n\trankdir=LR;\n\tnode [shape=record];\n")
+	level := -1
+	for i, b := range stats.Buckets {
+		first := i == 0 || stats.Buckets[i-1].Interval != b.Interval
+		if first {
+			if level >= 0 {
+				bw.WriteString("\t}\n")
+			}
+			level++
+			fmt.Fprintf(bw, "\tsubgraph cluster_%d {\n\t\tlabel=\"level %d: %s buckets\";\n",
+				level, level, formatDuration(b.Interval))
+		}
+		fmt.Fprintf(bw, "\t\tb%d [label=\"{%s|%s|%d events|%.1f%% occupied}\"];\n",
+			i, dotEscape(b.Start.UTC().Format(time.RFC3339)), dotEscape(formatDuration(b.Duration)),
+			b.Events, 100*b.Occupancy)
+		if !first {
+			fmt.Fprintf(bw, "\t\tb%d -> b%d;\n", i-1, i)
+		}
+	}
+	if level >= 0 {
+		bw.WriteString("\t}\n")
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// dotEscape escapes s for use in a record label.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "{", `\{`, "}", `\}`, "|", `\|`, "<", `\<`, ">", `\>`).Replace(s)
+}
@@ -0,0 +1,47 @@
+package sketchy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteDOT(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC)
+
+	Convey("Each level is drawn as a cluster of its buckets", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, time.Hour, 24*time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		rollup.Count([]byte("key"), 60, 0)
+		now = now.Add(time.Minute)
+		rollup.Count([]byte("key"), 30, 0)
+		now = now.Add(30 * time.Second)
+
+		buf := &bytes.Buffer{}
+		So(WriteDOT(buf, rollup), ShouldBeNil)
+		out := buf.String()
+
+		So(strings.HasPrefix(out, "digraph sketchy {\n"), ShouldBeTrue)
+		So(out, ShouldContainSubstring, "subgraph cluster_0 {\n\t\tlabel=\"level 0: 1m buckets\";\n")
+		So(out, ShouldContainSubstring, "subgraph cluster_1 {\n\t\tlabel=\"level 1: 1h buckets\";\n")
+		So(out, ShouldContainSubstring, "b0 [label=\"{2020-01-02T03:04:00Z|1m|60 events|")
+		So(out, ShouldContainSubstring, "b1 [label=\"{2020-01-02T03:05:00Z|30s|30 events|")
+		So(out, ShouldContainSubstring, "b2 [label=\"{2020-01-02T03:04:00Z|1m30s|90 events|")
+		So(out, ShouldContainSubstring, "b0 -> b1;")
+		So(out, ShouldNotContainSubstring, "b1 -> b2;")
+		So(strings.HasSuffix(out, "\t}\n}\n"), ShouldBeTrue)
+	})
+
+	Convey("An empty counter has no clusters", t, func() {
+		buf := &bytes.Buffer{}
+		So(WriteDOT(buf, RollingCounter(0, 0, time.Minute, 2)), ShouldBeNil)
+		So(buf.String(), ShouldNotContainSubstring, "subgraph")
+	})
+
+	Convey("Record labels are escaped", t, func() {
+		So(dotEscape(`{a|b}<"c">`), ShouldEqual, `\{a\|b\}\<\"c\"\>`)
+	})
+}
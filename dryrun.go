@@ -0,0 +1,24 @@
+package sketchy
+
+// WithDryRun puts a Limiter in dry-run mode, for validating a new limit
+// against live traffic before enforcing it. Every event is allowed without
+// delay, and recorded, but events that would have been refused or delayed
+// are counted for WouldBlock, and logged as denials if the limiter has a
+// decision log.
+func WithDryRun() LimiterOption {
+	return func(l *Limiter) {
+		l.dryRun = true
+		l.wouldBlock = NewSketch(0, 0)
+	}
+}
+
+// WouldBlock returns the estimated number of events for key that the
+// limiter would have refused or delayed since it was created, had it not
+// been in dry-run mode. It returns 0 unless the limiter was created with
+// WithDryRun.
+func (l *Limiter) WouldBlock(key []byte) uint64 {
+	if l.wouldBlock == nil {
+		return 0
+	}
+	return l.wouldBlock.Query(key)
+}
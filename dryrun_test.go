@@ -0,0 +1,52 @@
+package sketchy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithDryRun(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	newLimiter := func(opts ...LimiterOption) *Limiter {
+		counter := RollingCounter(0, 0, time.Second, 11).(*rollingCounter)
+		counter.clock = func() time.Time {
+			now = now.Add(time.Millisecond)
+			return now
+		}
+		return NewLimiter(counter, 2, 10*time.Second, opts...)
+	}
+
+	Convey("A dry-run limiter allows everything but counts what it would block", t, func() {
+		limiter := newLimiter(WithDryRun(), WithDecisionLog(10))
+		So(limiter.AllowN(key, 20), ShouldBeTrue)
+		So(limiter.WouldBlock(key), ShouldEqual, 0)
+
+		So(limiter.Allow(key), ShouldBeTrue)
+		delay, ok := limiter.ReserveN(key, 2)
+		So(ok, ShouldBeTrue)
+		So(delay, ShouldEqual, 0)
+		So(limiter.WaitN(context.Background(), key, 21), ShouldBeNil)
+		So(limiter.WouldBlock(key), ShouldEqual, 24)
+		So(limiter.WouldBlock([]byte("other")), ShouldEqual, 0)
+
+		denials := limiter.RecentDenials(10)
+		So(len(denials), ShouldEqual, 3)
+		So(denials[0].DryRun, ShouldBeTrue)
+
+		Convey("and records every event it allows", func() {
+			So(limiter.events(key), ShouldAlmostEqual, 44, 0.1)
+		})
+	})
+
+	Convey("An enforcing limiter doesn't count would-be blocks", t, func() {
+		limiter := newLimiter(WithDecisionLog(10))
+		So(limiter.AllowN(key, 21), ShouldBeFalse)
+		So(limiter.WouldBlock(key), ShouldEqual, 0)
+		So(limiter.RecentDenials(1)[0].DryRun, ShouldBeFalse)
+	})
+}
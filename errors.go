@@ -0,0 +1,36 @@
+package sketchy
+
+import "errors"
+
+// Errors returned by the package. Functions that fail for one of these
+// reasons return an error wrapping the corresponding value, so callers can
+// test for them with errors.Is.
+var (
+	// ErrIncompatibleSketch is returned when two sketches, or a sketch and
+	// its stored state, have different parameters.
+	ErrIncompatibleSketch = errors.New("sketchy: incompatible sketch")
+
+	// ErrCorruptEncoding is returned when stored state can't be decoded.
+	ErrCorruptEncoding = errors.New("sketchy: corrupt encoding")
+
+	// ErrChecksum is returned, along with ErrCorruptEncoding, when stored
+	// state is truncated or fails its checksum.
+	ErrChecksum = errors.New("sketchy: checksum mismatch")
+
+	// ErrInvalidParams is returned when parameters are malformed or out of
+	// range.
+	ErrInvalidParams = errors.New("sketchy: invalid parameters")
+
+	// ErrInsufficientData is returned by QueryChecked when the data doesn't
+	// cover the requested interval, which Query reports only by returning a
+	// rate over less of it, or 0.
+	ErrInsufficientData = errors.New("sketchy: insufficient data")
+
+	// ErrLimitExceeded is returned by Limiter.Wait when events can't be
+	// allowed before the context's deadline, or can never be allowed.
+	ErrLimitExceeded = errors.New("sketchy: rate limit exceeded")
+
+	// ErrTraceMismatch is returned by ReplayTrace when a counter's results
+	// differ from those recorded in a trace.
+	ErrTraceMismatch = errors.New("sketchy: trace mismatch")
+)
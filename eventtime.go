@@ -0,0 +1,194 @@
+package sketchy
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// An EventTimeCounter counts events at the times they happened, which may be
+// out of order, and tracks how far its counts are complete. Rolling counters
+// are EventTimeCounters.
+type EventTimeCounter interface {
+	CountAt(key []byte, delta int, at time.Time, interval time.Duration) float64
+	Watermark() time.Time
+}
+
+// CountAt records delta occurrences of key that happened at the given time,
+// and returns the key's rate over the given interval as Query does. If s
+// isn't an EventTimeCounter, the occurrences are counted now instead.
+func CountAt(s RateSketch, key []byte, delta int, at time.Time, interval time.Duration) float64 {
+	if c, ok := s.(EventTimeCounter); ok {
+		return c.CountAt(key, delta, at, interval)
+	}
+	return s.Count(key, delta, interval)
+}
+
+// Watermark returns the time before which s takes every event to have been
+// counted, or the zero time if s isn't an EventTimeCounter.
+func Watermark(s RateSketch) time.Time {
+	if c, ok := s.(EventTimeCounter); ok {
+		return c.Watermark()
+	}
+	return time.Time{}
+}
+
+// WithAllowedLateness sets how late an event may be counted by CountAt, for
+// events delivered out of order: the counter's watermark trails the latest
+// event counted by d, so windows ending less than d before that event are
+// taken to be incomplete. The value of d must not be negative.
+func WithAllowedLateness(d time.Duration) Option {
+	if d < 0 {
+		panic(fmt.Sprintf("sketchy: allowed lateness %s is negative", d))
+	}
+	return func(o *options) { o.lateness = d }
+}
+
+// WithCompleteWindows makes Query, QueryDetailed, QueryBetween and
+// QueryOffset leave out the buckets that aren't yet complete, since they
+// end after the counter's watermark: their windows end at the start of the
+// bucket the watermark falls in, rather than now. The latest window is then never underestimated while
+// events that happened in it are still arriving, at the cost of lagging by
+// up to a bucket interval plus the allowed lateness. If events stop
+// arriving, so does the watermark, and the rates reported are those of the
+// last complete windows until events resume. Until the first event is
+// counted, queries end now.
+func WithCompleteWindows() Option {
+	return func(o *options) { o.completeWindows = true }
+}
+
+// WithOnLateEvents makes CountAt call f when it counts late occurrences of
+// a key: those it counts into a bucket that had already closed, so that
+// queries made since may have reported a lower rate than they would now.
+// It is given the start of the bucket and the number of occurrences, and is
+// called synchronously, after they are counted, so it may call the
+// counter's methods. Stats reports the late occurrences in each bucket
+// whether or not f is set.
+func WithOnLateEvents(f func(key []byte, bucket time.Time, delta int)) Option {
+	return func(o *options) { o.onLate = f }
+}
+
+// CountAt records delta occurrences of key that happened at the given time,
+// in the retained bucket that was current then, and returns the key's rate
+// over the given interval as Query does. Occurrences from before the oldest
+// bucket are too old to be counted, and are dropped; those from after the
+// current bucket started, including any from the future, are counted in it.
+// Occurrences counted in a bucket that had closed are late (see
+// WithOnLateEvents).
+func (rl *rollingCounter) CountAt(key []byte, delta int, at time.Time, interval time.Duration) float64 {
+	h := rl.prehash(key)
+	if bucket, n := rl.addHandleAt(h, delta, at); n != 0 && rl.onLate != nil {
+		rl.onLate(key, bucket, n)
+	}
+	return rl.QueryHandle(h, interval)
+}
+
+// addHandleAt is CountAt for a prehashed key, without computing its rate.
+// If the occurrences were late, it returns the start of the bucket they
+// were counted in and their number after sampling.
+func (rl *rollingCounter) addHandleAt(h KeyHandle, delta int, at time.Time) (late time.Time, n int) {
+	start := rl.hooks.countStarted()
+	defer rl.hooks.counted(start)
+
+	now := rl.now()
+	delta, ok := rl.scale(delta, now)
+	if !ok {
+		return late, 0
+	}
+
+	rl.lock(&rl.m)
+	defer rl.m.Unlock()
+
+	buckets := rl.loadBuckets()
+	if len(buckets) == 0 || rl.due(buckets[len(buckets)-1].Time, now, rl.Interval) {
+		buckets = rl.rotate(rl.bucketStart(now, rl.Interval), &rl.options)
+	}
+	if at.After(now) {
+		at = now
+	}
+	i := len(buckets) - 1
+	for i >= 0 && buckets[i].Time.After(at) {
+		i--
+	}
+	if i < 0 {
+		return late, 0
+	}
+	rl.precheck.add(h.k, now, rl.horizon())
+	count, _ := buckets[i].count(h.k, delta)
+	rl.observeEvent(at)
+	if i == len(buckets)-1 {
+		rl.dict.observe(h, count)
+		return late, 0
+	}
+	if rl.late == nil {
+		rl.late = map[int64]uint64{}
+	}
+	rl.late[buckets[i].Time.UnixNano()] += uint64(delta)
+	return buckets[i].Time, delta
+}
+
+// pruneLate drops the late counts of buckets before the oldest of buckets.
+// The caller must hold rl.m.
+func (rl *rollingCounter) pruneLate(buckets []sketchWithTime) {
+	for t := range rl.late {
+		if len(buckets) == 0 || t < buckets[0].Time.UnixNano() {
+			delete(rl.late, t)
+		}
+	}
+}
+
+// lateStats fills in the late occurrences of each of the counter's buckets.
+func (rl *rollingCounter) lateStats(buckets []BucketStats) {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+	for i := range buckets {
+		buckets[i].Late = rl.late[buckets[i].Start.UnixNano()]
+	}
+}
+
+// observeEvent advances the latest event time, from which the watermark is
+// derived, to at. The caller must hold rl.m.
+func (rl *rollingCounter) observeEvent(at time.Time) {
+	if t := at.UnixNano(); t > atomic.LoadInt64(&rl.latestEvent) {
+		atomic.StoreInt64(&rl.latestEvent, t)
+	}
+}
+
+// Watermark returns the time before which the counter takes every event to
+// have been counted: the time of the latest event counted, by Count or
+// CountAt, less the allowed lateness (see WithAllowedLateness). It returns
+// the zero time if no event has been counted yet.
+func (rl *rollingCounter) Watermark() time.Time {
+	t := atomic.LoadInt64(&rl.latestEvent)
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, t).Add(-rl.lateness)
+}
+
+// complete returns the end of the window that queries made at now should
+// measure, and the start of the latest bucket as of then, for noise. If the
+// counter measures complete windows, that is the start of the bucket the
+// watermark falls in, and otherwise now.
+func (rl *rollingCounter) complete(now time.Time) (end, latest time.Time) {
+	end, latest = now, rl.latest()
+	wm := rl.Watermark()
+	if !rl.completeWindows || wm.IsZero() {
+		return end, latest
+	}
+	if wm.Before(now) {
+		end = wm
+	}
+	v := rl.view()
+	buckets := v.buckets
+	for i := len(buckets) - 1; i >= 0; i-- {
+		if buckets[i].Time.After(end) {
+			continue
+		}
+		if v.closes(i).After(end) {
+			end = buckets[i].Time
+		}
+		break
+	}
+	return end, latest.Add(-now.Sub(end))
+}
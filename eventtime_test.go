@@ -0,0 +1,129 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventTime(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	params := RollingParams{Interval: time.Minute, NumIntervals: 10}
+
+	Convey("Late events are counted in the bucket current when they happened", t, func() {
+		now := start
+		counter := params.New(WithClock(func() time.Time { return now }))
+		Add(counter, []byte("a"), 60)
+		now = now.Add(time.Minute)
+		Add(counter, []byte("b"), 1)
+
+		CountAt(counter, []byte("a"), 60, start.Add(30*time.Second), time.Minute)
+		now = now.Add(time.Minute)
+		So(QueryBetween(counter, []byte("a"), start, start.Add(time.Minute)), ShouldEqual, 2)
+		So(QueryBetween(counter, []byte("a"), start.Add(time.Minute), now), ShouldEqual, 0)
+
+		// events from before the oldest bucket are dropped, and those from
+		// the future are counted now
+		CountAt(counter, []byte("c"), 60, start.Add(-time.Hour), time.Minute)
+		So(counter.Query([]byte("c"), time.Hour), ShouldEqual, 0)
+		CountAt(counter, []byte("d"), 60, now.Add(time.Hour), time.Minute)
+		now = now.Add(time.Minute)
+		So(counter.Query([]byte("d"), time.Minute), ShouldEqual, 1)
+	})
+
+	Convey("The watermark trails the latest event by the allowed lateness", t, func() {
+		now := start
+		counter := params.New(WithClock(func() time.Time { return now }), WithAllowedLateness(10*time.Second))
+		So(Watermark(counter).IsZero(), ShouldBeTrue)
+
+		Add(counter, []byte("a"), 1)
+		So(Watermark(counter), ShouldEqual, start.Add(-10*time.Second))
+
+		now = now.Add(time.Minute)
+		CountAt(counter, []byte("a"), 1, start.Add(30*time.Second), time.Minute)
+		So(Watermark(counter), ShouldEqual, start.Add(20*time.Second))
+		CountAt(counter, []byte("a"), 1, start.Add(10*time.Second), time.Minute)
+		So(Watermark(counter), ShouldEqual, start.Add(20*time.Second))
+
+		So(func() { WithAllowedLateness(-time.Second) }, ShouldPanic)
+	})
+
+	Convey("Complete windows leave out buckets still receiving late events", t, func() {
+		now := start
+		clock := func() time.Time { return now }
+		plain := params.New(WithClock(clock))
+		complete := params.New(WithClock(clock), WithAllowedLateness(20*time.Second), WithCompleteWindows())
+		Rollover(plain)
+		Rollover(complete)
+
+		// one event a second, each delivered 20s after it happened
+		for now = start.Add(20 * time.Second); !now.After(start.Add(210 * time.Second)); now = now.Add(time.Second) {
+			at := now.Add(-20 * time.Second)
+			CountAt(plain, []byte("a"), 1, at, time.Minute)
+			CountAt(complete, []byte("a"), 1, at, time.Minute)
+		}
+		So(plain.Query([]byte("a"), time.Minute), ShouldBeLessThan, 0.75)
+		So(complete.Query([]byte("a"), time.Minute), ShouldEqual, 1)
+		So(QueryDetailed(complete, []byte("a"), time.Minute).Events, ShouldEqual, 60)
+
+		Convey("Including over ranges and offsets", func() {
+			from := now.Add(-2 * time.Minute)
+			So(QueryBetween(plain, []byte("a"), from, now), ShouldBeLessThan, 0.9)
+			So(QueryBetween(complete, []byte("a"), from, now), ShouldAlmostEqual, 1)
+			// the watermark is in the bucket from 120s, so nothing since is complete
+			So(QueryBetween(complete, []byte("a"), start.Add(130*time.Second), now), ShouldEqual, 0)
+			So(QueryOffset(complete, []byte("a"), time.Minute, 0), ShouldEqual, 1)
+			So(QueryOffset(complete, []byte("a"), time.Minute, time.Minute), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Events counted into closed buckets are reported late", t, func() {
+		now := start
+		type lateEvent struct {
+			key    string
+			bucket time.Time
+			delta  int
+		}
+		var late []lateEvent
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 2}.New(
+			WithClock(func() time.Time { return now }),
+			WithOnLateEvents(func(key []byte, bucket time.Time, delta int) {
+				late = append(late, lateEvent{string(key), bucket, delta})
+			}))
+		Add(counter, []byte("a"), 1)
+		now = now.Add(30 * time.Second)
+		CountAt(counter, []byte("a"), 2, start.Add(10*time.Second), time.Minute)
+		So(late, ShouldBeEmpty)
+
+		// the first bucket closes when the second starts
+		now = now.Add(30 * time.Second)
+		CountAt(counter, []byte("a"), 3, start.Add(time.Second), time.Minute)
+		CountAt(counter, []byte("b"), 4, start.Add(2*time.Second), time.Minute)
+		So(late, ShouldResemble, []lateEvent{{"a", start, 3}, {"b", start, 4}})
+		buckets := StatsOf(counter).Buckets
+		So(buckets[0].Late, ShouldEqual, 7)
+		So(buckets[1].Late, ShouldEqual, 0)
+
+		// and the count is forgotten with its bucket
+		now = now.Add(time.Minute)
+		Add(counter, []byte("a"), 1)
+		now = now.Add(time.Minute)
+		Add(counter, []byte("a"), 1)
+		for _, b := range StatsOf(counter).Buckets {
+			So(b.Late, ShouldEqual, 0)
+		}
+		So(counter.(*rollingCounter).late, ShouldBeEmpty)
+	})
+
+	Convey("Until an event is counted, complete windows end now", t, func() {
+		counter := params.New(WithCompleteWindows())
+		So(counter.Query([]byte("a"), time.Minute), ShouldEqual, 0)
+	})
+
+	Convey("Other RateSketches count events now", t, func() {
+		m := &minimalSketch{counts: map[string]int{}}
+		So(CountAt(m, []byte("a"), 60, start, time.Minute), ShouldEqual, 1)
+		So(Watermark(m).IsZero(), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,131 @@
+package sketchy
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+	"time"
+)
+
+// An EvictionPolicy chooses which keys a KeyDictionary forgets, trading the
+// memory the dictionary uses against how many keys it can report. Keys are
+// identified by their 64-bit hashes. The dictionary serializes calls to its
+// policy.
+type EvictionPolicy interface {
+	// Touched records that the key with the given hash was counted at now,
+	// with the given updated count in the counter's current bucket. It is
+	// called for keys being added, as well as for keys already held.
+	Touched(hash, count uint64, now time.Time)
+
+	// Evict returns the hashes of held keys that the dictionary should
+	// forget as of now, and forgets them itself: at least excess of them, if
+	// excess is positive, to bring the dictionary within its size, and any
+	// others the policy no longer wants held.
+	Evict(excess int, now time.Time) []uint64
+}
+
+// NewLRUPolicy returns an EvictionPolicy that forgets the least recently
+// counted keys first.
+func NewLRUPolicy() EvictionPolicy { return &lruPolicy{} }
+
+// NewTTLPolicy returns an EvictionPolicy that forgets keys that haven't
+// been counted for ttl, and the least recently counted keys first if the
+// dictionary is still full. The ttl must be positive.
+func NewTTLPolicy(ttl time.Duration) EvictionPolicy {
+	if ttl <= 0 {
+		panic(fmt.Sprintf("sketchy: eviction ttl %s must be positive", ttl))
+	}
+	return &lruPolicy{ttl: ttl}
+}
+
+// lruPolicy implements both NewLRUPolicy and, with a ttl, NewTTLPolicy.
+type lruPolicy struct {
+	ttl   time.Duration
+	order list.List // of *lruEntry, most recently counted first
+	elems map[uint64]*list.Element
+}
+
+type lruEntry struct {
+	hash uint64
+	at   time.Time
+}
+
+func (p *lruPolicy) Touched(hash, count uint64, now time.Time) {
+	if e, ok := p.elems[hash]; ok {
+		e.Value.(*lruEntry).at = now
+		p.order.MoveToFront(e)
+		return
+	}
+	if p.elems == nil {
+		p.elems = map[uint64]*list.Element{}
+	}
+	p.elems[hash] = p.order.PushFront(&lruEntry{hash: hash, at: now})
+}
+
+func (p *lruPolicy) Evict(excess int, now time.Time) []uint64 {
+	var evicted []uint64
+	for e := p.order.Back(); e != nil; e = p.order.Back() {
+		entry := e.Value.(*lruEntry)
+		if len(evicted) >= excess && (p.ttl == 0 || now.Sub(entry.at) < p.ttl) {
+			break
+		}
+		p.order.Remove(e)
+		delete(p.elems, entry.hash)
+		evicted = append(evicted, entry.hash)
+	}
+	return evicted
+}
+
+// NewLFUPolicy returns an EvictionPolicy that forgets the least frequently
+// counted keys first, judged by their estimated counts in the bucket they
+// were last counted in.
+func NewLFUPolicy() EvictionPolicy { return &lfuPolicy{index: map[uint64]int{}} }
+
+// lfuPolicy keeps a min-heap of keys by count.
+type lfuPolicy struct {
+	entries []lfuEntry
+	index   map[uint64]int // position of each key in entries
+}
+
+type lfuEntry struct {
+	hash, count uint64
+}
+
+func (p *lfuPolicy) Len() int           { return len(p.entries) }
+func (p *lfuPolicy) Less(i, j int) bool { return p.entries[i].count < p.entries[j].count }
+
+func (p *lfuPolicy) Swap(i, j int) {
+	p.entries[i], p.entries[j] = p.entries[j], p.entries[i]
+	p.index[p.entries[i].hash] = i
+	p.index[p.entries[j].hash] = j
+}
+
+func (p *lfuPolicy) Push(x interface{}) {
+	e := x.(lfuEntry)
+	p.index[e.hash] = len(p.entries)
+	p.entries = append(p.entries, e)
+}
+
+func (p *lfuPolicy) Pop() interface{} {
+	e := p.entries[len(p.entries)-1]
+	p.entries = p.entries[:len(p.entries)-1]
+	delete(p.index, e.hash)
+	return e
+}
+
+func (p *lfuPolicy) Touched(hash, count uint64, now time.Time) {
+	if i, ok := p.index[hash]; ok {
+		p.entries[i].count = count
+		heap.Fix(p, i)
+		return
+	}
+	heap.Push(p, lfuEntry{hash: hash, count: count})
+}
+
+func (p *lfuPolicy) Evict(excess int, now time.Time) []uint64 {
+	var evicted []uint64
+	for ; excess > 0 && len(p.entries) > 0; excess-- {
+		evicted = append(evicted, heap.Pop(p).(lfuEntry).hash)
+	}
+	return evicted
+}
@@ -0,0 +1,68 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvictionPolicies(t *testing.T) {
+	now := time.Now()
+	has := func(d *KeyDictionary, key string) bool {
+		_, ok := d.Lookup(Prehash([]byte(key)))
+		return ok
+	}
+	observe := func(d *KeyDictionary, key string, count uint64) {
+		d.observe(Prehash([]byte(key)), count)
+	}
+
+	Convey("LFU forgets the keys with the lowest counts", t, func() {
+		dict := NewKeyDictionaryWithPolicy(2, 0, NewLFUPolicy())
+		observe(dict, "a", 10)
+		observe(dict, "b", 1)
+		observe(dict, "b", 20)
+		observe(dict, "c", 15)
+		So(dict.Len(), ShouldEqual, 2)
+		So(has(dict, "a"), ShouldBeFalse)
+		So(has(dict, "b"), ShouldBeTrue)
+		So(has(dict, "c"), ShouldBeTrue)
+
+		Convey("including new keys counted less than every held key", func() {
+			observe(dict, "d", 5)
+			So(has(dict, "d"), ShouldBeFalse)
+			So(dict.Len(), ShouldEqual, 2)
+		})
+	})
+
+	Convey("TTL forgets keys that haven't been counted recently", t, func() {
+		dict := NewKeyDictionaryWithPolicy(10, 0, NewTTLPolicy(time.Minute))
+		dict.clock = func() time.Time { return now }
+		observe(dict, "a", 1)
+		now = now.Add(30 * time.Second)
+		observe(dict, "b", 1)
+		So(dict.Len(), ShouldEqual, 2)
+
+		now = now.Add(30 * time.Second)
+		So(dict.Len(), ShouldEqual, 1)
+		So(has(dict, "b"), ShouldBeTrue)
+
+		now = now.Add(time.Minute)
+		So(dict.Keys(), ShouldBeEmpty)
+	})
+
+	Convey("TTL also forgets the least recently counted keys when full", t, func() {
+		dict := NewKeyDictionaryWithPolicy(2, 0, NewTTLPolicy(time.Hour))
+		dict.clock = func() time.Time { return now }
+		observe(dict, "a", 1)
+		observe(dict, "b", 1)
+		observe(dict, "a", 1)
+		observe(dict, "c", 1)
+		So(has(dict, "a"), ShouldBeTrue)
+		So(has(dict, "b"), ShouldBeFalse)
+	})
+
+	Convey("The ttl must be positive", t, func() {
+		So(func() { NewTTLPolicy(0) }, ShouldPanic)
+	})
+}
@@ -0,0 +1,101 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sync"
+	"time"
+)
+
+// ExactSketch returns a new, empty CountSketch that counts every key
+// exactly, in a map, rather than estimating its count. Its memory grows with
+// the number of distinct keys counted, so it is meant for tests, where the
+// estimates of other sketches can be compared with it through the same
+// interface, and for keys known to be few.
+//
+// Keys are told apart by their 64-bit hashes, so two keys are only counted
+// together if their hashes collide: for a million keys, a chance of about 1
+// in 30 million. It has no matrix, so its Dimensions are 0 by 0.
+func ExactSketch() CountSketch {
+	return &fnvSketch{Exact: newExactCounts()}
+}
+
+// ExactCounter returns a RateSketch like RollingCounter, whose buckets count
+// every key exactly, as ExactSketch does. Rates are computed from the
+// buckets just as for a RollingCounter, so the two can be compared key for
+// key. Distinct keys and overlaps are still estimated, from the same
+// registers as a RollingCounter's.
+func ExactCounter(interval time.Duration, num int) RateSketch {
+	rl := &rollingCounter{Interval: interval, NumIntervals: num, Exact: true}
+	rl.storeBuckets(nil)
+	return rl
+}
+
+// exactCounts holds the exact count of each key counted into a sketch,
+// keyed by hash.
+type exactCounts struct {
+	m      sync.RWMutex
+	counts map[hashKernel]uint64
+}
+
+func newExactCounts() *exactCounts {
+	return &exactCounts{counts: map[hashKernel]uint64{}}
+}
+
+// add adds delta to the count of the key with hash k, and returns its
+// updated count.
+func (e *exactCounts) add(k hashKernel, delta int) uint64 {
+	e.m.Lock()
+	defer e.m.Unlock()
+	n := e.counts[k] + uint64(delta)
+	if n == 0 {
+		delete(e.counts, k)
+	} else {
+		e.counts[k] = n
+	}
+	return n
+}
+
+func (e *exactCounts) get(k hashKernel) uint64 {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.counts[k]
+}
+
+func (e *exactCounts) remove(k hashKernel) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	delete(e.counts, k)
+}
+
+// merge adds every count of o to e.
+func (e *exactCounts) merge(o *exactCounts) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	e.m.Lock()
+	defer e.m.Unlock()
+	for k, n := range o.counts {
+		e.counts[k] += n
+	}
+}
+
+// GobEncode returns the gob encoding of the counts.
+func (e *exactCounts) GobEncode() ([]byte, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(e.counts)
+	return buf.Bytes(), err
+}
+
+// GobDecode replaces the counts with those encoded in data.
+func (e *exactCounts) GobDecode(data []byte) error {
+	counts := map[hashKernel]uint64{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&counts); err != nil {
+		return err
+	}
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.counts = counts
+	return nil
+}
@@ -0,0 +1,85 @@
+package sketchy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExactSketch(t *testing.T) {
+	Convey("Exact sketches count every key exactly", t, func() {
+		cs := ExactSketch()
+		for i := 0; i < 10000; i++ {
+			cs.Add([]byte(fmt.Sprint(i%1000)), 1)
+		}
+		for i := 0; i < 1000; i++ {
+			So(cs.Query([]byte(fmt.Sprint(i))), ShouldEqual, 10)
+		}
+		So(cs.Query([]byte("absent")), ShouldEqual, 0)
+
+		So(cs.Count([]byte("0"), -4), ShouldEqual, 6)
+		So(cs.CountHandle(Prehash([]byte("0")), 1), ShouldEqual, 7)
+		So(cs.CountUint64(7, 3), ShouldEqual, 3)
+		So(cs.QueryUint64(7), ShouldEqual, 3)
+
+		cs.Forget([]byte("1"))
+		So(cs.Query([]byte("1")), ShouldEqual, 0)
+		So(cs.Query([]byte("2")), ShouldEqual, 10)
+	})
+
+	Convey("Exact and estimated sketches merge only with their own kind", t, func() {
+		a, b := ExactSketch().(*fnvSketch), ExactSketch().(*fnvSketch)
+		a.Count([]byte("key"), 2)
+		b.Count([]byte("key"), 3)
+		So(a.merge(b), ShouldBeNil)
+		So(a.Query([]byte("key")), ShouldEqual, 5)
+		So(a.merge(NewSketch(0, 0).(*fnvSketch)), ShouldNotBeNil)
+	})
+}
+
+func TestExactCounter(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	Convey("Exact counters report the rates estimated counters bound", t, func() {
+		exact := ExactCounter(time.Minute, 5).(*rollingCounter)
+		estimated := RollingCounter(0.9, 0.9, time.Minute, 5).(*rollingCounter)
+		exact.clock, estimated.clock = clock, clock
+		for i := 0; i < 3000; i++ {
+			key := []byte(fmt.Sprint(i % 300))
+			exact.Count(key, 1, 0)
+			estimated.Count(key, 1, 0)
+			now = now.Add(100 * time.Millisecond)
+		}
+		for i := 0; i < 300; i++ {
+			key := []byte(fmt.Sprint(i))
+			So(exact.Query(key, 5*time.Minute), ShouldAlmostEqual, 10.0/300)
+			So(estimated.Query(key, 5*time.Minute), ShouldBeGreaterThanOrEqualTo, exact.Query(key, 5*time.Minute))
+		}
+		So(len(exact.loadBuckets()), ShouldEqual, 5)
+	})
+
+	Convey("Exact counters stay exact through encoding", t, func() {
+		exact := ExactCounter(time.Minute, 5).(*rollingCounter)
+		exact.clock = clock
+		exact.Count([]byte("key"), 60, 0)
+		now = now.Add(time.Minute)
+		exact.Count([]byte("key"), 60, 0)
+		data, err := exact.GobEncode()
+		So(err, ShouldBeNil)
+
+		decoded := &rollingCounter{clock: clock}
+		So(decoded.GobDecode(data), ShouldBeNil)
+		So(decoded.Exact, ShouldBeTrue)
+		So(decoded.Query([]byte("key"), 2*time.Minute), ShouldEqual, exact.Query([]byte("key"), 2*time.Minute))
+		decoded.Rollover()
+		buckets := decoded.loadBuckets()
+		So(buckets[len(buckets)-1].CountSketch.Exact, ShouldNotBeNil)
+
+		estimated := RollingParams{Interval: time.Minute, NumIntervals: 5}.New(WithParamsPolicy(RejectParams))
+		So(errors.Is(estimated.(*rollingCounter).GobDecode(data), ErrIncompatibleSketch), ShouldBeTrue)
+	})
+}
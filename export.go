@@ -0,0 +1,135 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// An ExportRow is the estimated count of one key in one bucket, as written
+// by Export.
+type ExportRow struct {
+	Start    time.Time     // When the bucket was started.
+	Interval time.Duration // The maximum duration of the bucket, which identifies its level.
+	Key      []byte
+	Count    uint64
+}
+
+// A RowWriter writes the rows of an export. Implement it to export to
+// formats other than CSV, such as Parquet.
+type RowWriter interface {
+	WriteRow(row ExportRow) error
+}
+
+// CSVRowWriter writes exported rows as CSV, under a header row of start,
+// interval, key and count. Start is in RFC 3339 format and interval in
+// seconds. Call Flush when the export is done.
+type CSVRowWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVRowWriter returns a CSVRowWriter that writes to w.
+func NewCSVRowWriter(w io.Writer) *CSVRowWriter { return &CSVRowWriter{w: csv.NewWriter(w)} }
+
+// WriteRow writes row, preceded by the header if it's the first.
+func (c *CSVRowWriter) WriteRow(row ExportRow) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write([]string{"start", "interval", "key", "count"}); err != nil {
+			return err
+		}
+	}
+	return c.w.Write([]string{
+		row.Start.UTC().Format(time.RFC3339Nano),
+		formatFloat(row.Interval.Seconds()),
+		string(row.Key),
+		strconv.FormatUint(row.Count, 10),
+	})
+}
+
+// Flush writes any buffered rows to the underlying writer.
+func (c *CSVRowWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// bucketExporter is implemented by the counters that Export supports.
+type bucketExporter interface {
+	export(keys [][]byte, emit func(ExportRow) error) error
+}
+
+// Export writes a row to w for each key in keys and each bucket the counter
+// retains in which the key's estimated count is nonzero, so that the data
+// behind enforcement can be analyzed offline. Rows are written bucket by
+// bucket, oldest first and finest level first, with the keys of each bucket
+// in order. Counters must be made by this package. The counts of a counter
+// made with WithPrivacy have noise added.
+func Export(w RowWriter, counter RateSketch, keys *KeyDictionary) error {
+	e, ok := counter.(bucketExporter)
+	if !ok {
+		return errors.New("sketchy: counter doesn't support export")
+	}
+	sorted := keys.Keys()
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	return e.export(sorted, w.WriteRow)
+}
+
+func (rl *rollingCounter) export(keys [][]byte, emit func(ExportRow) error) error {
+	return rl.exportWith(keys, emit, rl.privacy)
+}
+
+// exportWith emits the counts of the given keys in each retained bucket,
+// with noise from p. Keys are hashed as given, since a dictionary holds keys
+// after any pseudonymization. It doesn't lock the counter.
+func (rl *rollingCounter) exportWith(keys [][]byte, emit func(ExportRow) error, p *privacy) error {
+	v := rl.view()
+	kernels := make([]hashKernel, len(keys))
+	for i, key := range keys {
+		kernels[i] = v.variant.hash(key)
+	}
+	for _, b := range v.buckets {
+		for i, k := range kernels {
+			if n := uint64(math.Round(p.count(b.query(k), k, v.interval, b.Time))); n != 0 {
+				row := ExportRow{Start: b.Time, Interval: v.interval, Key: keys[i], Count: n}
+				if err := emit(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (rc *rollupCounter) export(keys [][]byte, emit func(ExportRow) error) error {
+	for _, c := range rc.Levels {
+		if err := c.exportWith(keys, emit, rc.privacy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// export exports each shard in turn, each with the keys routed to it.
+func (s *ShardedRateSketch) export(keys [][]byte, emit func(ExportRow) error) error {
+	routed := make(map[RateSketch][][]byte, len(s.shards))
+	for _, key := range keys {
+		shard := s.Shard(key)
+		routed[shard] = append(routed[shard], key)
+	}
+	for _, shard := range s.shards {
+		e, ok := shard.(bucketExporter)
+		if !ok {
+			return errors.New("sketchy: shard doesn't support export")
+		}
+		if err := e.export(routed[shard], emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package sketchy
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type rowRecorder struct {
+	rows []ExportRow
+	err  error
+}
+
+func (r *rowRecorder) WriteRow(row ExportRow) error {
+	r.rows = append(r.rows, row)
+	return r.err
+}
+
+func TestExport(t *testing.T) {
+	start := time.Unix(1500000000, 0).UTC()
+	now := start
+	clock := func() time.Time { return now }
+
+	Convey("Rows are written bucket by bucket, finest level first", t, func() {
+		dict := NewKeyDictionary(10, 1)
+		counter := RollupParams{Durations: []time.Duration{time.Minute, time.Hour, 24 * time.Hour}}.New(
+			WithKeyDictionary(dict), WithClock(clock))
+		Add(counter, []byte("b"), 2)
+		Add(counter, []byte("a"), 1)
+		now = now.Add(time.Minute)
+		Add(counter, []byte("a"), 3)
+		now = now.Add(time.Second)
+
+		r := &rowRecorder{}
+		So(Export(r, counter, dict), ShouldBeNil)
+		So(r.rows, ShouldResemble, []ExportRow{
+			{start, time.Minute, []byte("a"), 1},
+			{start, time.Minute, []byte("b"), 2},
+			{start.Add(time.Minute), time.Minute, []byte("a"), 3},
+			{start, time.Hour, []byte("a"), 4},
+			{start, time.Hour, []byte("b"), 2},
+		})
+	})
+
+	Convey("Sharded counters export each key from its shard", t, func() {
+		dict := NewKeyDictionary(10, 1)
+		counter := NewShardedRateSketch(
+			RollingParams{Interval: time.Minute, NumIntervals: 2}.New(WithKeyDictionary(dict), WithClock(clock)),
+			RollingParams{Interval: time.Minute, NumIntervals: 2}.New(WithKeyDictionary(dict), WithClock(clock)))
+		for _, key := range []string{"a", "b", "c", "d"} {
+			counter.Add([]byte(key), 1)
+		}
+		r := &rowRecorder{}
+		So(Export(r, counter, dict), ShouldBeNil)
+		So(len(r.rows), ShouldEqual, 4)
+	})
+
+	Convey("Errors from the writer stop the export", t, func() {
+		dict := NewKeyDictionary(10, 1)
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 2}.New(WithKeyDictionary(dict), WithClock(clock))
+		Add(counter, []byte("a"), 1)
+		Add(counter, []byte("b"), 1)
+		r := &rowRecorder{err: errors.New("disk full")}
+		So(Export(r, counter, dict), ShouldEqual, r.err)
+		So(len(r.rows), ShouldEqual, 1)
+	})
+
+	Convey("Rows can be written as CSV", t, func() {
+		buf := &bytes.Buffer{}
+		w := NewCSVRowWriter(buf)
+		So(w.WriteRow(ExportRow{start, time.Minute, []byte("a,b"), 7}), ShouldBeNil)
+		So(w.WriteRow(ExportRow{start.Add(time.Minute), time.Minute, []byte("c"), 1}), ShouldBeNil)
+		So(w.Flush(), ShouldBeNil)
+		So(buf.String(), ShouldEqual, strings.Join([]string{
+			"start,interval,key,count",
+			`2017-07-14T02:40:00Z,60,"a,b",7`,
+			"2017-07-14T02:41:00Z,60,c,1",
+			"",
+		}, "\n"))
+	})
+}
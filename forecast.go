@@ -0,0 +1,80 @@
+package sketchy
+
+import "time"
+
+// Smoothing factors for the level and trend of Holt's linear method.
+const (
+	forecastAlpha = 0.5
+	forecastBeta  = 0.3
+)
+
+// rates returns the rate of the key with the given hash in each retained
+// bucket, oldest first, as of now, with noise from p. Buckets that have
+// covered less than a second are left out. It doesn't lock the counter.
+func (rl *rollingCounter) rates(k hashKernel, now time.Time, p *privacy) []float64 {
+	v := rl.view()
+	buckets := v.buckets
+	rates := make([]float64, 0, len(buckets))
+	for i, b := range buckets {
+		end := now
+		if i < len(buckets)-1 {
+			end = buckets[i+1].Time
+		}
+		d := end.Sub(b.Time)
+		if d > v.interval {
+			d = v.interval
+		}
+		if d < time.Second {
+			continue
+		}
+		rates = append(rates, p.count(b.query(k), k, v.interval, b.Time)/d.Seconds())
+	}
+	return rates
+}
+
+// forecast extrapolates the key's per-bucket rates by the given number of
+// buckets using Holt's linear method
+// (https://en.wikipedia.org/wiki/Exponential_smoothing#Double_exponential_smoothing).
+func forecast(rates []float64, steps float64) float64 {
+	if len(rates) == 0 {
+		return 0
+	}
+	level, trend := rates[0], 0.0
+	if len(rates) > 1 {
+		trend = rates[1] - rates[0]
+	}
+	for _, r := range rates[1:] {
+		prev := level
+		level = forecastAlpha*r + (1-forecastAlpha)*(level+trend)
+		trend = forecastBeta*(level-prev) + (1-forecastBeta)*trend
+	}
+	if f := level + steps*trend; f > 0 {
+		return f
+	}
+	return 0
+}
+
+// Forecast predicts the key's rate horizon from now, by extrapolating the
+// level and trend of its rate in each retained bucket. The forecast is never
+// negative. It doesn't model daily or weekly cycles; compare with
+// VsBaseline for those.
+func (rl *rollingCounter) Forecast(key []byte, horizon time.Duration) float64 {
+	return forecast(rl.rates(rl.prehash(key).k, rl.now(), rl.privacy), float64(horizon)/float64(rl.view().interval))
+}
+
+// Forecast predicts the key's rate horizon from now, by extrapolating the
+// level and trend of its rate in each retained bucket of the coarsest level
+// whose buckets are no longer than horizon (or the finest level, if every
+// level's are). The forecast is never negative.
+func (rc *rollupCounter) Forecast(key []byte, horizon time.Duration) float64 {
+	if len(rc.Levels) == 0 {
+		return 0
+	}
+	c := rc.Levels[0]
+	for _, l := range rc.Levels[1:] {
+		if l.view().interval <= horizon {
+			c = l
+		}
+	}
+	return forecast(c.rates(rc.prehash(key).k, rc.now(), rc.privacy), float64(horizon)/float64(c.view().interval))
+}
@@ -0,0 +1,45 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestForecast(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	Convey("Linear trends are extrapolated", t, func() {
+		So(forecast(nil, 1), ShouldEqual, 0)
+		So(forecast([]float64{3}, 5), ShouldEqual, 3)
+		So(forecast([]float64{1, 2, 3, 4, 5}, 2), ShouldAlmostEqual, 7)
+		So(forecast([]float64{5, 4, 3, 2, 1}, 10), ShouldEqual, 0)
+	})
+
+	Convey("Rolling counters forecast from per-bucket rates", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		So(counter.Forecast(key, time.Minute), ShouldEqual, 0)
+
+		for m := 1; m <= 5; m++ {
+			counter.Count(key, 60*m, 0)
+			now = now.Add(time.Minute)
+		}
+		So(counter.rates(multihash(key), now, nil), ShouldResemble, []float64{1, 2, 3, 4, 5})
+		So(counter.Forecast(key, 0), ShouldAlmostEqual, 5)
+		So(counter.Forecast(key, 3*time.Minute), ShouldAlmostEqual, 8)
+	})
+
+	Convey("Rollup counters forecast from a level matching the horizon", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, time.Hour, 24*time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		for m := 1; m <= 5; m++ {
+			rollup.Count(key, 60*m, 0)
+			now = now.Add(time.Minute)
+		}
+		So(rollup.Forecast(key, 3*time.Minute), ShouldAlmostEqual, 8)
+		So(rollup.Forecast(key, 2*time.Hour), ShouldAlmostEqual, 3)
+	})
+}
@@ -0,0 +1,88 @@
+package sketchy
+
+import "sync/atomic"
+
+// Forget removes, as far as it can, the key's counts from the sketch, so
+// that its estimate drops to 0. Each of the key's counters is reduced by the
+// key's estimated count; since the estimate may include collisions, keys
+// that share those counters may be underestimated afterwards, which a
+// count-min sketch otherwise never does.
+func (r *fnvSketch) Forget(key []byte) { r.forget(r.Variant.hash(key)) }
+
+func (r *fnvSketch) forget(k hashKernel) {
+	if r.Exact != nil {
+		r.Exact.remove(k)
+		return
+	}
+	n := r.query(k)
+	if n == 0 {
+		return
+	}
+	for i := uint(0); i < r.Depth; i++ {
+		k := r.offset(i, k.index(i, r.Width))
+		if r.Stamps != nil && atomic.LoadUint32(&r.Stamps[k]) != r.Epoch {
+			continue
+		}
+		subtractCounter(&r.Matrix[k], n)
+	}
+}
+
+// subtractCounter atomically subtracts n from the counter at p, stopping at 0.
+func subtractCounter(p *uint64, n uint64) {
+	for {
+		v := atomic.LoadUint64(p)
+		d := n
+		if v < d {
+			d = v
+		}
+		if atomic.CompareAndSwapUint64(p, v, v-d) {
+			return
+		}
+	}
+}
+
+// Forget removes, as far as it can, the key's counts from every bucket, so
+// that its rate drops to 0, for erasure requests or to clear a false
+// positive. As with a sketch, keys that collide with it may be
+// underestimated afterwards. The key still contributes to DistinctKeys and
+// Overlap until its buckets are forgotten.
+func (rl *rollingCounter) Forget(key []byte) {
+	k := rl.prehash(key).k
+	rl.lock(&rl.m)
+	defer rl.m.Unlock()
+
+	rl.forget(k)
+}
+
+// forget removes the key's counts from every bucket. The caller must hold
+// rl.m.
+func (rl *rollingCounter) forget(k hashKernel) {
+	for _, b := range rl.loadBuckets() {
+		if b.CountSketch != nil {
+			b.CountSketch.forget(k)
+		}
+	}
+	rl.cache.forget(k)
+}
+
+// Forget removes, as far as it can, the key's counts from every bucket of
+// every level, so that its rate drops to 0. As with a sketch, keys that
+// collide with it may be underestimated afterwards. The key still
+// contributes to DistinctKeys and Overlap until its buckets are forgotten.
+func (rc *rollupCounter) Forget(key []byte) {
+	k := rc.prehash(key).k
+	for _, c := range rc.Levels {
+		rc.lock(&c.m)
+		c.forget(k)
+		c.m.Unlock()
+	}
+	rc.cache.forget(k)
+}
+
+// Forget removes the key's counts from every shard, since it may have been
+// counted in more than one after shards were added.
+func (s *ShardedRateSketch) Forget(key []byte) {
+	for _, shard := range s.shards {
+		Forget(shard, key)
+	}
+}
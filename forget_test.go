@@ -0,0 +1,72 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestForget(t *testing.T) {
+	now := time.Now()
+	key, other := []byte("key"), []byte("other")
+
+	Convey("A forgotten key's count drops to 0", t, func() {
+		sketch := NewSketch(0, 0)
+		sketch.Count(key, 5)
+		sketch.Count(other, 3)
+		sketch.Forget(key)
+		So(sketch.Query(key), ShouldEqual, 0)
+		So(sketch.Query(other), ShouldEqual, 3)
+
+		Convey("and it can be counted again", func() {
+			So(sketch.Count(key, 1), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Forgetting a key leaves colliding keys no lower than 0", t, func() {
+		sketch := NewSketch(0.5, 0.5).(*fnvSketch)
+		for i := 0; i < 100; i++ {
+			sketch.Count([]byte{byte(i)}, 1)
+		}
+		sketch.Forget(key)
+		So(sketch.Query(key), ShouldEqual, 0)
+		for _, v := range sketch.Matrix {
+			So(v, ShouldBeLessThanOrEqualTo, 100)
+		}
+	})
+
+	Convey("A recycled sketch ignores stale counters", t, func() {
+		sketch := NewSketch(0, 0).(*fnvSketch)
+		sketch.Count(key, 5)
+		sketch = sketch.reset()
+		sketch.Count(key, 2)
+		sketch.Forget(key)
+		So(sketch.Query(key), ShouldEqual, 0)
+	})
+
+	Convey("A rolling counter forgets a key in every bucket", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(
+			WithQueryCache(time.Hour, 100)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		for i := 0; i < 3; i++ {
+			counter.Count(key, 60, 0)
+			counter.Count(other, 60, 0)
+			now = now.Add(time.Minute)
+		}
+		So(counter.Query(key, 3*time.Minute), ShouldEqual, 1)
+		counter.Forget(key)
+		So(counter.Query(key, 3*time.Minute), ShouldEqual, 0)
+		So(counter.Query(other, 3*time.Minute), ShouldEqual, 1)
+	})
+
+	Convey("A rollup counter forgets a key in every level", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, time.Hour, 24*time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		rollup.Count(key, 60, 0)
+		now = now.Add(time.Minute)
+		rollup.Forget(key)
+		So(rollup.Query(key, time.Minute), ShouldEqual, 0)
+		So(rollup.Query(key, 12*time.Hour), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,49 @@
+package sketchy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// Encodings from version 2 on are framed: frameMagic, then the length of
+// the payload and its CRC-32C, both big-endian uint32s, then the payload.
+// No gob stream starts with a zero byte, so framed and unframed encodings
+// can't be mistaken for each other.
+const (
+	frameMagic  = "\x00sky"
+	frameHeader = len(frameMagic) + 8
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// frame returns payload wrapped in a frame.
+func frame(payload []byte) []byte {
+	data := make([]byte, frameHeader, frameHeader+len(payload))
+	copy(data, frameMagic)
+	binary.BigEndian.PutUint32(data[len(frameMagic):], uint32(len(payload)))
+	binary.BigEndian.PutUint32(data[len(frameMagic)+4:], crc32.Checksum(payload, castagnoli))
+	return append(data, payload...)
+}
+
+// unframe returns the payload of a framed encoding, after checking its
+// length and checksum. If data isn't framed, it is returned unchanged with
+// framed set to false.
+func unframe(data []byte) (payload []byte, framed bool, err error) {
+	if len(data) < len(frameMagic) || string(data[:len(frameMagic)]) != frameMagic {
+		return data, false, nil
+	}
+	if len(data) < frameHeader {
+		return nil, true, fmt.Errorf("%w: truncated frame header", ErrChecksum)
+	}
+	n := binary.BigEndian.Uint32(data[len(frameMagic):])
+	sum := binary.BigEndian.Uint32(data[len(frameMagic)+4:])
+	payload = data[frameHeader:]
+	if uint64(len(payload)) != uint64(n) {
+		return nil, true, fmt.Errorf("%w: payload is %d bytes, expected %d", ErrChecksum, len(payload), n)
+	}
+	if got := crc32.Checksum(payload, castagnoli); got != sum {
+		return nil, true, fmt.Errorf("%w: checksum is %08x, expected %08x", ErrChecksum, got, sum)
+	}
+	return payload, true, nil
+}
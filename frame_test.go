@@ -0,0 +1,53 @@
+package sketchy
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFrame(t *testing.T) {
+	encoding, err := fuzzSeedCounter().GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Encodings are framed with their length and checksum", t, func() {
+		payload, framed, err := unframe(encoding)
+		So(err, ShouldBeNil)
+		So(framed, ShouldBeTrue)
+		So(frame(payload), ShouldResemble, encoding)
+		So(len(payload), ShouldEqual, len(encoding)-frameHeader)
+	})
+
+	Convey("Unframed data is returned as is", t, func() {
+		payload, framed, err := unframe([]byte("garbage"))
+		So(err, ShouldBeNil)
+		So(framed, ShouldBeFalse)
+		So(string(payload), ShouldEqual, "garbage")
+	})
+
+	Convey("Truncated encodings are rejected", t, func() {
+		for _, n := range []int{len(frameMagic), frameHeader - 1, frameHeader, len(encoding) - 1} {
+			err := (&rollingCounter{}).GobDecode(encoding[:n])
+			So(errors.Is(err, ErrChecksum), ShouldBeTrue)
+			So(errors.Is(err, ErrCorruptEncoding), ShouldBeTrue)
+		}
+	})
+
+	Convey("Every flipped bit of the payload is detected", t, func() {
+		for i := frameHeader; i < len(encoding); i++ {
+			flipped := append([]byte(nil), encoding...)
+			flipped[i] ^= 1 << uint(i%8)
+			So(errors.Is((&rollingCounter{}).GobDecode(flipped), ErrChecksum), ShouldBeTrue)
+		}
+	})
+
+	Convey("A framed encoding must be of a version that is framed", t, func() {
+		unframed, _, _ := unframe(encoding)
+		err := (&rollingCounter{}).GobDecode(unframed)
+		So(errors.Is(err, ErrCorruptEncoding), ShouldBeTrue)
+		So(err.Error(), ShouldContainSubstring, "wrongly framed")
+	})
+}
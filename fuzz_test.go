@@ -0,0 +1,57 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+)
+
+func fuzzSeedCounter() *rollingCounter {
+	now := time.Unix(1e9, 0)
+	counter := RollingCounter(0.9, 0.9, time.Minute, 3).(*rollingCounter)
+	counter.clock = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		counter.Count([]byte("key"), i, 0)
+		now = now.Add(time.Minute)
+	}
+	return counter
+}
+
+func FuzzRollingCounterGobDecode(f *testing.F) {
+	seed, err := fuzzSeedCounter().GobEncode()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(seed)
+	f.Add(seed[:len(seed)/2])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		counter := &rollingCounter{}
+		if err := counter.GobDecode(data); err != nil {
+			return
+		}
+		counter.Query([]byte("key"), time.Hour)
+		counter.Count([]byte("key"), 1, time.Hour)
+		counter.Count([]byte("key"), 1, time.Hour)
+	})
+}
+
+func FuzzRollupCounterGobDecode(f *testing.F) {
+	// two levels of two buckets keep the seeds cheap to decode and count
+	rollup := RollupCounter(0.9, 0.9, time.Minute, 2*time.Minute, 4*time.Minute).(*rollupCounter)
+	rollup.Count([]byte("key"), 1, 0)
+	seed, err := encode(rollup)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(seed)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		counter := &rollupCounter{}
+		if err := decode(counter, data); err != nil {
+			return
+		}
+		counter.Query([]byte("key"), time.Hour)
+		counter.Count([]byte("key"), 1, time.Hour)
+	})
+}
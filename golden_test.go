@@ -0,0 +1,111 @@
+package sketchy
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Golden encodings in testdata/golden are named <type>-v<version>.gob. Files
+// for earlier versions must never be regenerated: they are what users have
+// on disk. Run with -update-golden after bumping rollingVersion to write the
+// files for the new version.
+var updateGolden = flag.Bool("update-golden", false, "write golden encodings for the current version")
+
+var goldenEpoch = time.Unix(1500000000, 0).UTC()
+
+// goldenCounters rebuilds the state captured in the golden encodings, along
+// with the time at which it was captured.
+func goldenCounters() (map[string]interface{}, time.Time) {
+	now := goldenEpoch
+	rolling := RollingCounter(0.9, 0.9, time.Minute, 3).(*rollingCounter)
+	rolling.clock = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		rolling.Count([]byte("a"), i+1, 0)
+		rolling.Count([]byte("b"), 10, 0)
+		now = now.Add(time.Minute)
+	}
+
+	now = goldenEpoch
+	rollup := RollupCounter(0.9, 0.9, time.Minute, time.Hour, 24*time.Hour).(*rollupCounter)
+	rollup.clock = func() time.Time { return now }
+	for i := 0; i < 10; i++ {
+		rollup.Count([]byte("a"), i+1, 0)
+		rollup.Count([]byte("b"), 10, 0)
+		now = now.Add(10 * time.Minute)
+	}
+
+	sketch := NewSketch(0.9, 0.9)
+	sketch.Count([]byte("a"), 5)
+	sketch.Count([]byte("b"), 7)
+
+	return map[string]interface{}{"rolling": rolling, "rollup": rollup, "sketch": sketch}, now
+}
+
+func TestGoldenEncodings(t *testing.T) {
+	live, _ := goldenCounters()
+
+	if *updateGolden {
+		for name, v := range live {
+			data, err := encode(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", "golden", fmt.Sprintf("%s-v%d.gob", name, rollingVersion))
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("There are golden encodings for the current version", t, func() {
+		for name := range live {
+			_, err := os.Stat(filepath.Join("testdata", "golden", fmt.Sprintf("%s-v%d.gob", name, rollingVersion)))
+			So(err, ShouldBeNil)
+		}
+	})
+
+	for _, path := range paths {
+		name := strings.SplitN(filepath.Base(path), "-", 2)[0]
+		Convey("Decoding "+filepath.Base(path)+" matches the original state", t, func() {
+			data, err := os.ReadFile(path)
+			So(err, ShouldBeNil)
+
+			keys := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+			switch name {
+			case "sketch":
+				clone := NewSketch(0, 0)
+				So(decode(clone, data), ShouldBeNil)
+				for _, key := range keys {
+					So(clone.Query(key), ShouldEqual, live[name].(CountSketch).Query(key))
+				}
+			case "rolling", "rollup":
+				var clone RateSketch
+				if name == "rolling" {
+					clone = &rollingCounter{clock: live[name].(*rollingCounter).clock}
+				} else {
+					clone = &rollupCounter{clock: live[name].(*rollupCounter).clock}
+				}
+				So(decode(clone, data), ShouldBeNil)
+				for _, key := range keys {
+					for _, interval := range []time.Duration{time.Minute, 150 * time.Second, time.Hour} {
+						So(clone.Query(key, interval), ShouldEqual, live[name].(RateSketch).Query(key, interval))
+					}
+				}
+			default:
+				t.Fatalf("unknown golden encoding %s", path)
+			}
+		})
+	}
+}
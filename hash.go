@@ -1,5 +1,7 @@
 package sketchy
 
+import "fmt"
+
 // Constants and algorithm taken from hash/fnv.
 
 const (
@@ -14,11 +16,210 @@ func (k hashKernel) hash(index uint) uint64 {
 	return (v & 0xffffffff) + (v>>32)*uint64(index)
 }
 
+// wideWidth is the widest a sketch can be for hash's 32-bit halves to index
+// it uniformly; it is a little below 2^32/e, beyond which the first row
+// couldn't reach every counter at all.
+const wideWidth = 1 << 30
+
+// index returns the column of row i that k is counted in, for a sketch of
+// the given width. Sketches wider than wideWidth are indexed with wide.
+func (k hashKernel) index(i, width uint) uint {
+	if width <= wideWidth {
+		return uint(k.hash(i)) % width
+	}
+	return uint(k.wide(i) % uint64(width))
+}
+
+// wide is hash in 128-bit mode: it combines two 64-bit lanes rather than the
+// halves of one. The second lane is k mixed with a different seed, and is odd
+// so that no two rows share an index sequence.
+func (k hashKernel) wide(index uint) uint64 {
+	lo, hi := uint64(k), mix64(uint64(k)^0x9e3779b97f4a7c15)|1
+	return lo + hi*uint64(index)
+}
+
 func multihash(key []byte) hashKernel {
-	k := uint64(fnvOffset64)
-	for _, b := range key {
+	return hashKernel(fnvBytes(fnvOffset64, key))
+}
+
+// uint64hash returns the hash of the big-endian encoding of key, without
+// encoding it.
+func uint64hash(key uint64) hashKernel {
+	return hashKernel(fnvUint64(fnvOffset64, key))
+}
+
+// fnvBytes continues the hash k over b.
+func fnvBytes(k uint64, b []byte) uint64 {
+	for _, c := range b {
+		k *= fnvPrime64
+		k ^= uint64(c)
+	}
+	return k
+}
+
+// fnv1aBytes continues the FNV-1a hash k over b.
+func fnv1aBytes(k uint64, b []byte) uint64 {
+	for _, c := range b {
+		k ^= uint64(c)
 		k *= fnvPrime64
-		k ^= uint64(b)
 	}
-	return hashKernel(k)
+	return k
+}
+
+// fnvUint64 continues the hash k over the big-endian encoding of v.
+func fnvUint64(k, v uint64) uint64 {
+	for shift := 56; shift >= 0; shift -= 8 {
+		k *= fnvPrime64
+		k ^= (v >> uint(shift)) & 0xff
+	}
+	return k
+}
+
+// fnv1aUint64 continues the FNV-1a hash k over the big-endian encoding of v.
+func fnv1aUint64(k, v uint64) uint64 {
+	for shift := 56; shift >= 0; shift -= 8 {
+		k ^= (v >> uint(shift)) & 0xff
+		k *= fnvPrime64
+	}
+	return k
+}
+
+// A HashVariant selects the FNV hash (http://www.isthe.com/chongo/tech/comp/fnv/)
+// that a sketch or counter hashes keys with. The variant is recorded in
+// encodings, which decode with the variant they were written with.
+type HashVariant uint8
+
+const (
+	// FNV1 multiplies by the prime, then xors in each byte. It is the
+	// default, and the variant of every encoding that doesn't record one.
+	FNV1 HashVariant = iota
+
+	// FNV1a xors in each byte, then multiplies by the prime, which spreads
+	// the bits of short keys, such as 4-byte IP addresses, more evenly.
+	FNV1a
+)
+
+// String returns the name of v, as used in the text form of SketchParams.
+func (v HashVariant) String() string {
+	switch v {
+	case FNV1:
+		return "fnv1"
+	case FNV1a:
+		return "fnv1a"
+	}
+	return fmt.Sprintf("HashVariant(%d)", uint8(v))
+}
+
+func (v HashVariant) valid() bool { return v <= FNV1a }
+
+func parseHashVariant(s string) (HashVariant, error) {
+	for v := FNV1; v.valid(); v++ {
+		if s == v.String() {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hash %q", s)
+}
+
+func (v HashVariant) hash(key []byte) hashKernel {
+	if v == FNV1a {
+		return hashKernel(fnv1aBytes(fnvOffset64, key))
+	}
+	return multihash(key)
+}
+
+func (v HashVariant) hashUint64(key uint64) hashKernel {
+	if v == FNV1a {
+		return hashKernel(fnv1aUint64(fnvOffset64, key))
+	}
+	return uint64hash(key)
+}
+
+// Prehash is Prehash for sketches and counters that use v. Handles of
+// either variant may be used with either, but a handle of the matching
+// variant needn't be hashed again.
+func (v HashVariant) Prehash(key []byte) KeyHandle {
+	return KeyHandle{k: v.hash(key), key: key, v: v}
+}
+
+// handle returns h as hashed with v. Handles that don't know their keys,
+// such as those from CompositeKey, are returned unchanged: they are always
+// hashed the same way, so are still counted consistently.
+func (v HashVariant) handle(h KeyHandle) KeyHandle {
+	if h.v == v || h.key == nil {
+		return h
+	}
+	return v.Prehash(h.key)
+}
+
+// A KeyHandle is a key hashed in advance by Prehash. Counting or querying a
+// handle is equivalent to counting or querying its key, but skips hashing
+// it, so a key used several times per event need only be hashed once.
+type KeyHandle struct {
+	k   hashKernel
+	key []byte      // for a KeyDictionary, if known
+	v   HashVariant // that k was hashed with
+}
+
+// Prehash hashes key with FNV1 for use with the Handle methods of sketches
+// and counters. The handle is valid for any sketch or counter. It refers to
+// key, which must not be modified while the handle is in use.
+func Prehash(key []byte) KeyHandle { return KeyHandle{k: multihash(key), key: key} }
+
+// HashBatch is Prehash for each of keys. It hashes four keys at a time, so
+// their multiplications overlap rather than each waiting on the last.
+func HashBatch(keys [][]byte) []KeyHandle {
+	return AppendHashBatch(make([]KeyHandle, 0, len(keys)), keys)
+}
+
+// AppendHashBatch is HashBatch, appending the handles to dst, so that a
+// pipeline can reuse one slice of handles for every batch.
+func AppendHashBatch(dst []KeyHandle, keys [][]byte) []KeyHandle {
+	start := len(dst)
+	if cap(dst)-start < len(keys) {
+		dst = append(dst, make([]KeyHandle, len(keys))...)
+	} else {
+		dst = dst[:start+len(keys)]
+	}
+	handles := dst[start:]
+	i := 0
+	for ; i+4 <= len(keys); i += 4 {
+		a, b, c, d := keys[i], keys[i+1], keys[i+2], keys[i+3]
+		n := minLen(minLen(len(a), len(b)), minLen(len(c), len(d)))
+		ka, kb, kc, kd := uint64(fnvOffset64), uint64(fnvOffset64), uint64(fnvOffset64), uint64(fnvOffset64)
+		pa, pb, pc, pd := a[:n], b[:n], c[:n], d[:n]
+		for j := range pa {
+			ka = ka*fnvPrime64 ^ uint64(pa[j])
+			kb = kb*fnvPrime64 ^ uint64(pb[j])
+			kc = kc*fnvPrime64 ^ uint64(pc[j])
+			kd = kd*fnvPrime64 ^ uint64(pd[j])
+		}
+		handles[i] = KeyHandle{k: hashKernel(fnvBytes(ka, a[n:])), key: a}
+		handles[i+1] = KeyHandle{k: hashKernel(fnvBytes(kb, b[n:])), key: b}
+		handles[i+2] = KeyHandle{k: hashKernel(fnvBytes(kc, c[n:])), key: c}
+		handles[i+3] = KeyHandle{k: hashKernel(fnvBytes(kd, d[n:])), key: d}
+	}
+	for ; i < len(keys); i++ {
+		handles[i] = Prehash(keys[i])
+	}
+	return dst
+}
+
+func minLen(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// CompositeKey hashes a key made of several parts, such as an IP address, a
+// path and a user agent, without concatenating them. Each part is prefixed
+// with its length, so parts can't run into each other: ("ab", "c") and
+// ("a", "bc") are different keys.
+func CompositeKey(parts ...[]byte) KeyHandle {
+	k := uint64(fnvOffset64)
+	for _, part := range parts {
+		k = fnvBytes(fnvUint64(k, uint64(len(part))), part)
+	}
+	return KeyHandle{k: hashKernel(k)}
 }
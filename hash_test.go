@@ -1,7 +1,13 @@
 package sketchy
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -20,3 +26,170 @@ func TestMultihash(t *testing.T) {
 		}
 	})
 }
+
+func TestUint64Hash(t *testing.T) {
+	Convey("A numeric key hashes as its big-endian encoding", t, func() {
+		for _, key := range []uint64{0, 1, 0xdeadbeef, math.MaxUint64} {
+			var b [8]byte
+			binary.BigEndian.PutUint64(b[:], key)
+			So(uint64hash(key), ShouldEqual, multihash(b[:]))
+		}
+
+		sketch := NewSketch(0, 0)
+		sketch.Count([]byte{0, 0, 0, 0, 0, 0, 0, 42}, 2)
+		So(sketch.CountUint64(42, 1), ShouldEqual, 3)
+		So(sketch.QueryUint64(42), ShouldEqual, 3)
+	})
+}
+
+func TestCompositeKey(t *testing.T) {
+	Convey("Composite keys", t, func() {
+		Convey("hash each part after its length", func() {
+			key := []byte{0, 0, 0, 0, 0, 0, 0, 2, 'a', 'b', 0, 0, 0, 0, 0, 0, 0, 1, 'c'}
+			So(CompositeKey([]byte("ab"), []byte("c")).k, ShouldEqual, Prehash(key).k)
+		})
+
+		Convey("keep parts separate", func() {
+			So(CompositeKey([]byte("ab"), []byte("c")).k, ShouldNotEqual, CompositeKey([]byte("a"), []byte("bc")).k)
+			So(CompositeKey([]byte("a"), nil).k, ShouldNotEqual, CompositeKey([]byte("a")).k)
+			So(CompositeKey().k, ShouldNotEqual, CompositeKey(nil).k)
+		})
+
+		Convey("don't allocate", func() {
+			ip, path := []byte("10.0.0.1"), []byte("/index.html")
+			So(testing.AllocsPerRun(100, func() { CompositeKey(ip, path) }), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestHashBatch(t *testing.T) {
+	Convey("A batch is hashed as Prehash hashes each key", t, func() {
+		keys := [][]byte{nil, []byte("a")}
+		for i := 0; i < 20; i++ {
+			keys = append(keys, []byte(strings.Repeat("ab", i%7)+fmt.Sprint(i)))
+		}
+		for n := 0; n <= len(keys); n++ {
+			handles := HashBatch(keys[:n])
+			So(handles, ShouldHaveLength, n)
+			for i, h := range handles {
+				So(h.k, ShouldEqual, Prehash(keys[i]).k)
+				So(h.key, ShouldResemble, keys[i])
+			}
+		}
+	})
+
+	Convey("Batches can be appended to a slice of handles", t, func() {
+		keys := [][]byte{[]byte("a"), []byte("b")}
+		handles := AppendHashBatch(HashBatch(keys), keys)
+		So(handles, ShouldHaveLength, 4)
+		So(handles[3].k, ShouldEqual, Prehash([]byte("b")).k)
+	})
+}
+
+func TestWideIndex(t *testing.T) {
+	var wider uint64 = 1 << 34
+	width := uint(wider)
+	if uint64(width) != wider {
+		t.Skip("sketches can't be wider than wideWidth on 32-bit platforms")
+	}
+	Convey("Sketches wider than wideWidth are indexed across their width", t, func() {
+		var top uint
+		for i := uint64(0); i < 1000; i++ {
+			k := uint64hash(i)
+			So(k.index(0, wideWidth), ShouldEqual, uint(k.hash(0))%wideWidth)
+			for row := uint(0); row < 5; row++ {
+				j := k.index(row, width)
+				So(j, ShouldBeLessThan, width)
+				if j > top {
+					top = j
+				}
+			}
+		}
+		// 32-bit halves would never index the top of the first rows
+		So(top, ShouldBeGreaterThan, width/100*99)
+	})
+}
+
+func TestPrehash(t *testing.T) {
+	Convey("A prehashed key counts as the key itself", t, func() {
+		key := []byte("key")
+		h := Prehash(key)
+
+		sketch := NewSketch(0, 0)
+		sketch.Count(key, 2)
+		So(sketch.CountHandle(h, 3), ShouldEqual, 5)
+		So(sketch.QueryHandle(h), ShouldEqual, sketch.Query(key))
+
+		now := time.Now()
+		clock := func() time.Time { return now }
+		for _, counter := range []RateSketch{
+			RollingCounter(0, 0, time.Minute, 5),
+			RollupCounter(0, 0, time.Minute, time.Hour),
+		} {
+			switch c := counter.(type) {
+			case *rollingCounter:
+				c.clock = clock
+			case *rollupCounter:
+				c.clock = clock
+			}
+			counter.Count(key, 1, time.Minute)
+			now = now.Add(time.Second)
+			So(CountHandle(counter, h, 1, time.Minute), ShouldBeGreaterThan, 0)
+			So(QueryHandle(counter, h, time.Minute), ShouldEqual, counter.Query(key, time.Minute))
+		}
+	})
+}
+
+func TestHashVariant(t *testing.T) {
+	Convey("FNV-1a", t, func() {
+		// Test cases taken from hash/fnv.
+		golden := map[string]uint64{
+			"":    0xcbf29ce484222325,
+			"a":   0xaf63dc4c8601ec8c,
+			"ab":  0x089c4407b545986a,
+			"abc": 0xe71fa2190541574b,
+		}
+		for in, out := range golden {
+			So(uint64(FNV1a.hash([]byte(in))), ShouldEqual, out)
+		}
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], 12345)
+		So(FNV1a.hashUint64(12345), ShouldEqual, FNV1a.hash(buf[:]))
+	})
+
+	Convey("Variants have a text form", t, func() {
+		for _, v := range []HashVariant{FNV1, FNV1a} {
+			parsed, err := parseHashVariant(v.String())
+			So(err, ShouldBeNil)
+			So(parsed, ShouldEqual, v)
+		}
+		_, err := parseHashVariant("fnv2")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Handles are rehashed for sketches of another variant", t, func() {
+		key := []byte("key")
+		sketch := SketchParams{Hash: FNV1a}.New()
+		sketch.Count(key, 2)
+		So(sketch.CountHandle(Prehash(key), 3), ShouldEqual, 5)
+		So(sketch.QueryHandle(Prehash(key)), ShouldEqual, 5)
+		So(NewSketch(0, 0).QueryHandle(FNV1a.Prehash(key)), ShouldEqual, 0)
+	})
+
+	Convey("Counters keep their variant through encoding", t, func() {
+		counter := RollingParams{SketchParams: SketchParams{Hash: FNV1a}, Interval: time.Minute, NumIntervals: 3}.New()
+		counter.Count([]byte("key"), 4, time.Minute)
+		data, err := counter.(*rollingCounter).GobEncode()
+		So(err, ShouldBeNil)
+
+		decoded := &rollingCounter{}
+		So(decoded.GobDecode(data), ShouldBeNil)
+		So(decoded.Variant, ShouldEqual, FNV1a)
+		So(decoded.Query([]byte("key"), time.Minute), ShouldEqual, counter.Query([]byte("key"), time.Minute))
+
+		rejecting := RollingParams{Interval: time.Minute, NumIntervals: 3}.New(WithParamsPolicy(RejectParams))
+		So(errors.Is(rejecting.(*rollingCounter).GobDecode(data), ErrIncompatibleSketch), ShouldBeTrue)
+		converting := RollingParams{Interval: time.Minute, NumIntervals: 3}.New(WithParamsPolicy(ConvertParams))
+		So(errors.Is(converting.(*rollingCounter).GobDecode(data), ErrIncompatibleSketch), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,66 @@
+package sketchy
+
+import "time"
+
+// InstrumentationHooks receive notifications of a counter's internal
+// operations, so its behavior can be observed in production. Any hook may
+// be nil. Hooks are called synchronously, some while the counter's lock is
+// held, so they must be fast and must not call back into the counter.
+type InstrumentationHooks struct {
+	// OnRotate is called when a counter starts a new bucket. For a
+	// RollupCounter, interval identifies the level.
+	OnRotate func(interval time.Duration, start time.Time)
+
+	// OnSnapshot is called when a RollingCounter is gob-encoded, with the
+	// size of the encoding or the error that prevented it.
+	OnSnapshot func(size int, err error)
+
+	// OnLockWait is called with the time Count spent waiting for a lock.
+	OnLockWait func(d time.Duration)
+
+	// OnCount is called with the total time taken by each call to Count.
+	OnCount func(d time.Duration)
+
+	// OnMerge is called when a counter made by MergeAll or a
+	// CounterCombiner merges in a snapshot or another counter, with the
+	// number of buckets merged in, or the error that prevented it.
+	OnMerge func(n int, err error)
+}
+
+// WithHooks attaches instrumentation hooks to a counter.
+func WithHooks(hooks *InstrumentationHooks) Option {
+	return func(o *options) { o.hooks = hooks }
+}
+
+func (h *InstrumentationHooks) rotated(interval time.Duration, start time.Time) {
+	if h != nil && h.OnRotate != nil {
+		h.OnRotate(interval, start)
+	}
+}
+
+func (h *InstrumentationHooks) snapshot(size int, err error) {
+	if h != nil && h.OnSnapshot != nil {
+		h.OnSnapshot(size, err)
+	}
+}
+
+func (h *InstrumentationHooks) merged(n int, err error) {
+	if h != nil && h.OnMerge != nil {
+		h.OnMerge(n, err)
+	}
+}
+
+// countStarted returns the time a call to Count began, or the zero time if
+// Count latency isn't being observed.
+func (h *InstrumentationHooks) countStarted() time.Time {
+	if h == nil || h.OnCount == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (h *InstrumentationHooks) counted(start time.Time) {
+	if h != nil && h.OnCount != nil {
+		h.OnCount(time.Since(start))
+	}
+}
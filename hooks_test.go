@@ -0,0 +1,109 @@
+package sketchy
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInstrumentationHooks(t *testing.T) {
+	key := []byte("key")
+	now := time.Now()
+
+	var (
+		rotations []time.Duration
+		snapshots []int
+		lockWaits int
+		counts    int
+	)
+	hooks := &InstrumentationHooks{
+		OnRotate:   func(interval time.Duration, start time.Time) { rotations = append(rotations, interval) },
+		OnSnapshot: func(size int, err error) { snapshots = append(snapshots, size) },
+		OnLockWait: func(time.Duration) { lockWaits++ },
+		OnCount:    func(time.Duration) { counts++ },
+	}
+
+	Convey("Rolling counters report their operations", t, func() {
+		rotations, snapshots, lockWaits, counts = nil, nil, 0, 0
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 2}.New(
+			WithHooks(hooks)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		counter.Count(key, 1, 0)
+		counter.Count(key, 1, 0)
+		now = now.Add(time.Minute)
+		counter.Count(key, 1, 0)
+		So(rotations, ShouldResemble, []time.Duration{time.Minute, time.Minute})
+		So(lockWaits, ShouldEqual, 3)
+		So(counts, ShouldEqual, 3)
+
+		encoding, err := encode(counter)
+		So(err, ShouldBeNil)
+		So(len(snapshots), ShouldEqual, 1)
+		So(snapshots[0], ShouldBeLessThan, len(encoding))
+	})
+
+	Convey("Merges report the buckets merged in", t, func() {
+		type merge struct {
+			n   int
+			err bool
+		}
+		var merges []merge
+		hooks := &InstrumentationHooks{OnMerge: func(n int, err error) { merges = append(merges, merge{n, err != nil}) }}
+		params := RollingParams{Interval: time.Minute, NumIntervals: 3}
+		snapshot := params.New(WithClock(func() time.Time { return now })).(*rollingCounter)
+		snapshot.Count(key, 1, 0)
+		now = now.Add(time.Minute)
+		snapshot.Count(key, 1, 0)
+		encoding, err := encode(snapshot)
+		So(err, ShouldBeNil)
+
+		_, err = MergeAll([]io.Reader{bytes.NewReader(encoding), bytes.NewReader(encoding)}, WithHooks(hooks))
+		So(err, ShouldBeNil)
+		So(merges, ShouldResemble, []merge{{2, false}, {2, false}})
+
+		merges = nil
+		_, err = MergeAll([]io.Reader{bytes.NewReader(encoding), bytes.NewReader(encoding[:10])}, WithHooks(hooks))
+		So(err, ShouldNotBeNil)
+		So(merges, ShouldResemble, []merge{{2, false}, {0, true}})
+
+		merges = nil
+		data, err := snapshot.GobEncode()
+		So(err, ShouldBeNil)
+		c := CounterCombiner(params, WithHooks(hooks))
+		acc := c.AddInput(c.CreateAccumulator(), snapshot)
+		c.MergeAccumulators(acc, c.AddInput(c.CreateAccumulator(), data))
+		So(merges, ShouldResemble, []merge{{2, false}, {2, false}, {2, false}})
+		So(func() { c.AddInput(acc, data[:10]) }, ShouldPanic)
+		So(merges[len(merges)-1], ShouldResemble, merge{0, true})
+	})
+
+	Convey("Rollup counters report rotations per level", t, func() {
+		rotations, lockWaits, counts = nil, 0, 0
+		counter := RollupParams{Durations: []time.Duration{time.Minute, time.Hour, 24 * time.Hour}}.New(
+			WithHooks(hooks)).(*rollupCounter)
+		counter.clock = func() time.Time { return now }
+
+		counter.Count(key, 1, 0)
+		So(rotations, ShouldResemble, []time.Duration{time.Minute, time.Hour})
+		So(lockWaits, ShouldEqual, 2)
+		So(counts, ShouldEqual, 1)
+
+		Convey("even after being decoded", func() {
+			encoding, err := encode(counter)
+			So(err, ShouldBeNil)
+			clone := RollupParams{Durations: []time.Duration{time.Minute, time.Hour}}.New(
+				WithHooks(hooks)).(*rollupCounter)
+			clone.clock = counter.clock
+			So(decode(clone, encoding), ShouldBeNil)
+
+			rotations = nil
+			now = now.Add(time.Hour)
+			clone.Count(key, 1, 0)
+			So(rotations, ShouldResemble, []time.Duration{time.Minute, time.Hour})
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package sketchy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithHysteresis makes a Limiter's Allow and AllowN keep refusing a key
+// once it has exceeded its limit, until its events in the last window have
+// fallen to the given fraction of those allowed, and at least dwell has
+// passed, so that a key hovering around its limit isn't allowed and refused
+// by turns as its events enter and leave the window. Release must be in
+// [0, 1) and dwell must not be negative. Reserve, Wait and DecideN, which
+// delay or grade events rather than refuse them, are unaffected.
+func WithHysteresis(release float64, dwell time.Duration) LimiterOption {
+	if !(release >= 0 && release < 1) || dwell < 0 {
+		panic(fmt.Sprintf("sketchy: hysteresis releasing at %v after %s needs a fraction in [0, 1) and a dwell that isn't negative", release, dwell))
+	}
+	return func(l *Limiter) {
+		l.hysteresis = &hysteresis{release: release, dwell: dwell, tripped: map[hashKernel]trip{}}
+	}
+}
+
+// hysteresis tracks the keys a Limiter has refused but not yet released.
+type hysteresis struct {
+	release float64
+	dwell   time.Duration
+
+	m       sync.Mutex
+	tripped map[hashKernel]trip
+	swept   time.Time
+}
+
+// trip records when a key was first refused, and when it was last held.
+type trip struct{ at, held time.Time }
+
+// hold reports whether a key should be refused, given whether it is over
+// its limit and its events out of the burst allowed. A key over its limit
+// trips; a tripped key is held until it is released.
+func (h *hysteresis) hold(k hashKernel, over bool, events, burst float64, now time.Time, window time.Duration) bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.sweep(now, window)
+	t, ok := h.tripped[k]
+	if over {
+		if !ok {
+			t.at = now
+		}
+		t.held = now
+		h.tripped[k] = t
+		return true
+	}
+	if !ok {
+		return false
+	}
+	if now.Sub(t.at) < h.dwell || events > h.release*burst {
+		t.held = now
+		h.tripped[k] = t
+		return true
+	}
+	delete(h.tripped, k)
+	return false
+}
+
+// sweep forgets keys that tripped at least a dwell ago and haven't been
+// held for a window, at most once per window. A held key's events are only
+// recorded in dry-run mode, as it is held, so by then its window is empty
+// and it would be released when next seen anyway, while keys that are
+// never seen again mustn't be kept forever.
+func (h *hysteresis) sweep(now time.Time, window time.Duration) {
+	if now.Sub(h.swept) < window {
+		return
+	}
+	h.swept = now
+	for k, t := range h.tripped {
+		if now.Sub(t.at) >= h.dwell && now.Sub(t.held) >= window {
+			delete(h.tripped, k)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithHysteresis(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	key := []byte("key")
+
+	newLimiter := func(opts ...LimiterOption) *Limiter {
+		counter := RollingCounter(0, 0, time.Second, 11).(*rollingCounter)
+		counter.clock = clock
+		limiter := NewLimiter(counter, 1, 10*time.Second, opts...)
+		limiter.clock = clock
+		return limiter
+	}
+
+	// trip offers a key two events a second until it is refused.
+	trip := func(limiter *Limiter) {
+		for i := 0; i < 1000 && limiter.Allow(key); i++ {
+			now = now.Add(500 * time.Millisecond)
+		}
+	}
+
+	// release offers a tripped key two events a second until it is
+	// allowed, and returns how long that took and its events just before.
+	release := func(limiter *Limiter) (time.Duration, float64) {
+		tripped := now
+		for i := 0; i < 1000; i++ {
+			now = now.Add(500 * time.Millisecond)
+			events := limiter.events(key)
+			if limiter.Allow(key) {
+				return now.Sub(tripped), events
+			}
+		}
+		return 0, 0
+	}
+
+	Convey("Keys over their limit are held until they fall to the release level", t, func() {
+		plain, held := newLimiter(), newLimiter(WithHysteresis(0.5, 0))
+		trip(plain)
+		trip(held)
+		plainWait, plainEvents := release(plain)
+		heldWait, heldEvents := release(held)
+		So(plainEvents, ShouldBeGreaterThan, 5)
+		So(heldEvents, ShouldBeLessThanOrEqualTo, 5)
+		So(heldWait, ShouldBeGreaterThan, plainWait)
+	})
+
+	Convey("Keys are held for at least the dwell", t, func() {
+		limiter := newLimiter(WithHysteresis(0.9, 30*time.Second))
+		trip(limiter)
+		tripped := now
+		for now.Sub(tripped) < 30*time.Second {
+			So(limiter.Allow(key), ShouldBeFalse)
+			now = now.Add(time.Second)
+		}
+		So(limiter.Allow(key), ShouldBeTrue)
+	})
+
+	Convey("Tripped keys that aren't seen again are forgotten", t, func() {
+		limiter := newLimiter(WithHysteresis(0.5, time.Minute))
+		trip(limiter)
+		So(len(limiter.hysteresis.tripped), ShouldEqual, 1)
+
+		now = now.Add(2 * time.Minute)
+		So(limiter.Allow([]byte("other")), ShouldBeTrue)
+		So(len(limiter.hysteresis.tripped), ShouldEqual, 0)
+	})
+
+	Convey("Dry runs keep holding keys whose events are still recorded", t, func() {
+		limiter := newLimiter(WithHysteresis(0.5, 0), WithDryRun(), WithDecisionLog(100))
+		for len(limiter.RecentDenials(1)) == 0 {
+			limiter.Allow(key)
+			now = now.Add(500 * time.Millisecond)
+		}
+		// below the limit, but above the release level
+		for i := 0; i < 20; i++ {
+			now = now.Add(1500 * time.Millisecond)
+			denials := len(limiter.RecentDenials(100))
+			So(limiter.Allow(key), ShouldBeTrue)
+			So(len(limiter.RecentDenials(100)), ShouldEqual, denials+1)
+		}
+	})
+
+	Convey("The release level and dwell must be valid", t, func() {
+		So(func() { WithHysteresis(1, 0) }, ShouldPanic)
+		So(func() { WithHysteresis(-0.1, 0) }, ShouldPanic)
+		So(func() { WithHysteresis(0.5, -time.Second) }, ShouldPanic)
+	})
+}
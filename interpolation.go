@@ -0,0 +1,98 @@
+package sketchy
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// An Interpolation decides how a query counts a bucket that only partly
+// overlaps the interval asked for: the oldest bucket consulted, when the
+// interval begins during it, or a bucket that closed after the interval's
+// end.
+type Interpolation int
+
+const (
+	// LinearInterpolation counts the proportion of the bucket's occurrences
+	// that its overlap with the interval is of its duration, as if they had
+	// been spread evenly across it. It is the default.
+	LinearInterpolation Interpolation = iota
+
+	// NoInterpolation counts a partly overlapping bucket in full, over its
+	// whole duration, so that rates are measured between bucket boundaries
+	// and may cover somewhat more than the interval. Bursts are then never
+	// split between windows, at the cost of coarser windows.
+	NoInterpolation
+
+	// ExponentialInterpolation takes the rate to grow or decay exponentially
+	// through the bucket, towards that of the neighbouring bucket inside the
+	// interval, and counts the share of the occurrences that would then fall
+	// in the overlap. When the rate is rising, as at the start of a burst,
+	// fewer of an older bucket's occurrences are counted than linearly, and
+	// more when it is falling. Where there is no such neighbour, or either
+	// bucket is empty, it falls back to LinearInterpolation.
+	ExponentialInterpolation
+)
+
+func (p Interpolation) valid() bool { return p >= LinearInterpolation && p <= ExponentialInterpolation }
+
+func (p Interpolation) String() string {
+	switch p {
+	case LinearInterpolation:
+		return "linear"
+	case NoInterpolation:
+		return "none"
+	case ExponentialInterpolation:
+		return "exponential"
+	}
+	return fmt.Sprintf("Interpolation(%d)", int(p))
+}
+
+// WithInterpolation sets how a counter's queries count the buckets that
+// only partly overlap the interval asked for.
+func WithInterpolation(p Interpolation) Option {
+	if !p.valid() {
+		panic(fmt.Sprintf("sketchy: unknown interpolation %d", p))
+	}
+	return func(o *options) { o.interpolation = p }
+}
+
+// share returns the share of a bucket's occurrences counted when the part of
+// it overlapping the interval is the fraction f of its duration, given the
+// bucket's mean rate and that of the neighbour the overlap adjoins, which
+// is 0 if there is none.
+func (p Interpolation) share(f, rate, neighbour float64) float64 {
+	if p != ExponentialInterpolation || !(rate > 0 && neighbour > 0) {
+		return f
+	}
+	// the rate a fraction x of the way towards the neighbour is taken to be
+	// proportional to trend^x
+	trend := neighbour / rate
+	if trend == 1 || math.IsInf(trend, 0) {
+		return f
+	}
+	return (trend - math.Pow(trend, 1-f)) / (trend - 1)
+}
+
+// closes returns when the bucket at i closed, or will close: when the next
+// bucket started, or an interval after its own start if sooner.
+func (v bucketState) closes(i int) time.Time {
+	end := v.buckets[i].Time.Add(v.interval)
+	if i < len(v.buckets)-1 && v.buckets[i+1].Time.Before(end) {
+		end = v.buckets[i+1].Time
+	}
+	return end
+}
+
+// closedRate returns the mean rate, per nanosecond, of the key with hash k
+// in the closed bucket at i, or 0 if there is no such bucket.
+func (v bucketState) closedRate(i int, k hashKernel) float64 {
+	if i < 0 || i >= len(v.buckets)-1 {
+		return 0
+	}
+	d := v.closes(i).Sub(v.buckets[i].Time)
+	if d <= 0 {
+		return 0
+	}
+	return float64(v.buckets[i].query(k)) / float64(d)
+}
@@ -0,0 +1,93 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInterpolation(t *testing.T) {
+	key := []byte("key")
+
+	// counter returns a counter of minute buckets with the given options,
+	// having counted 60 occurrences in one minute and 240 in the next.
+	counter := func(opts ...Option) *rollingCounter {
+		now := time.Unix(1<<30, 0)
+		opts = append(opts, WithClock(func() time.Time { return now }))
+		rl := RollingParams{Interval: time.Minute, NumIntervals: 5}.New(opts...).(*rollingCounter)
+		rl.Count(key, 60, 0)
+		now = now.Add(time.Minute)
+		rl.Count(key, 240, 0)
+		now = now.Add(time.Minute)
+		return rl
+	}
+
+	Convey("Linear interpolation spreads a bucket's count evenly", t, func() {
+		rl := counter()
+		So(rl.QueryDetailed(key, 90*time.Second), ShouldResemble, QueryDetail{
+			Rate: 3, Covered: 90 * time.Second, Events: 270, Buckets: 2, Interpolated: true,
+		})
+		So(counter(WithInterpolation(LinearInterpolation)).Query(key, 90*time.Second), ShouldEqual, 3)
+	})
+
+	Convey("Without interpolation, partial buckets count in full", t, func() {
+		rl := counter(WithInterpolation(NoInterpolation))
+		So(rl.QueryDetailed(key, 90*time.Second), ShouldResemble, QueryDetail{
+			Rate: 2.5, Covered: 2 * time.Minute, Events: 300, Buckets: 2,
+		})
+		So(rl.Query(key, time.Minute), ShouldEqual, 4)
+		So(rl.Query(key, 30*time.Second), ShouldEqual, 4)
+
+		Convey("Including those that closed after the interval", func() {
+			n, d := rl.query(multihash(key), rl.now().Add(-90*time.Second), 20*time.Second, 0, &rl.options)
+			So(n, ShouldEqual, 60)
+			So(d, ShouldEqual, time.Minute)
+		})
+	})
+
+	Convey("Exponential interpolation follows the trend into the next bucket", t, func() {
+		rl := counter(WithInterpolation(ExponentialInterpolation))
+		detail := rl.QueryDetailed(key, 90*time.Second)
+		So(detail.Events, ShouldAlmostEqual, 280)
+		So(detail.Covered, ShouldEqual, 90*time.Second)
+		So(detail.Interpolated, ShouldBeTrue)
+
+		Convey("Back to the previous bucket at the end of the interval", func() {
+			rl.Count([]byte("other"), 1, 0)
+			n, d := rl.query(multihash(key), rl.now().Add(-30*time.Second), 30*time.Second, 0, &rl.options)
+			So(n, ShouldAlmostEqual, 80)
+			So(d, ShouldEqual, 30*time.Second)
+		})
+
+		Convey("And linearly without a neighbour", func() {
+			So(rl.Query(key, 30*time.Second), ShouldEqual, 4)
+			n, _ := rl.query(multihash(key), rl.now().Add(-90*time.Second), 30*time.Second, 0, &rl.options)
+			So(n, ShouldAlmostEqual, 30)
+		})
+	})
+
+	Convey("Exponential shares", t, func() {
+		So(ExponentialInterpolation.share(0.25, 1, 1), ShouldEqual, 0.25)
+		So(ExponentialInterpolation.share(0.5, 1, 0), ShouldEqual, 0.5)
+		So(ExponentialInterpolation.share(0.5, 4, 1), ShouldAlmostEqual, 1/3.0)
+		So(ExponentialInterpolation.share(1, 4, 1), ShouldAlmostEqual, 1)
+		So(NoInterpolation.share(0.5, 1, 4), ShouldEqual, 0.5)
+	})
+
+	Convey("Rollup counters interpolate each level", t, func() {
+		now := time.Unix(1<<30, 0)
+		rollup := RollupParams{Durations: []time.Duration{time.Minute, time.Hour}}.New(
+			WithClock(func() time.Time { return now }), WithInterpolation(NoInterpolation))
+		rollup.Count(key, 60, 0)
+		now = now.Add(time.Minute)
+		rollup.Count(key, 240, 0)
+		now = now.Add(time.Minute)
+		So(rollup.Query(key, 90*time.Second), ShouldEqual, 2.5)
+	})
+
+	Convey("Unknown interpolations are refused", t, func() {
+		So(func() { WithInterpolation(Interpolation(3)) }, ShouldPanic)
+		So(ExponentialInterpolation.String(), ShouldEqual, "exponential")
+	})
+}
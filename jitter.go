@@ -0,0 +1,28 @@
+package sketchy
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithJitter varies the number of events a Limiter allows each key in a
+// window by up to the given fraction either way, so that clients pinned at
+// the limit aren't all refused, and don't all retry, at the same moment.
+// The variation is chosen afresh for each key in each window, but
+// deterministically from seed, so limiters with the same seed agree.
+// Fraction must be in [0, 1).
+func WithJitter(fraction float64, seed uint64) LimiterOption {
+	if !(fraction >= 0 && fraction < 1) {
+		panic(fmt.Sprintf("sketchy: jitter fraction %v must be in [0, 1)", fraction))
+	}
+	return func(l *Limiter) { l.jitter, l.jitterSeed = fraction, seed }
+}
+
+// jitterAt returns the variation, in [-1, 1), of the key's burst in the
+// window that contains now. Windows are aligned to multiples of the window
+// since the Unix epoch.
+func (l *Limiter) jitterAt(key []byte, now time.Time) float64 {
+	epoch := uint64(now.UnixNano() / int64(l.window))
+	x := mix64(uint64(multihash(key)) ^ mix64(l.jitterSeed^mix64(epoch)))
+	return float64(x>>11)/(1<<52) - 1
+}
@@ -0,0 +1,60 @@
+package sketchy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithJitter(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	Convey("Each key's burst varies within the fraction", t, func() {
+		limiter := NewLimiter(RollingCounter(0, 0, time.Second, 11), 2, 10*time.Second, WithJitter(0.1, 42))
+		limiter.clock = clock
+		var lo, hi, sum float64 = 20, 20, 0
+		for i := 0; i < 1000; i++ {
+			b := limiter.burst([]byte(fmt.Sprint(i)))
+			So(b, ShouldBeGreaterThanOrEqualTo, 18)
+			So(b, ShouldBeLessThanOrEqualTo, 22)
+			if b < lo {
+				lo = b
+			}
+			if b > hi {
+				hi = b
+			}
+			sum += b
+		}
+		So(lo, ShouldBeLessThan, 18.2)
+		So(hi, ShouldBeGreaterThan, 21.8)
+		So(sum/1000, ShouldAlmostEqual, 20, 0.2)
+	})
+
+	Convey("The variation is deterministic, but changes each window", t, func() {
+		key := []byte("key")
+		a := NewLimiter(RollingCounter(0, 0, time.Second, 11), 2, 10*time.Second, WithJitter(0.1, 42))
+		b := NewLimiter(RollingCounter(0, 0, time.Second, 11), 2, 10*time.Second, WithJitter(0.1, 42))
+		c := NewLimiter(RollingCounter(0, 0, time.Second, 11), 2, 10*time.Second, WithJitter(0.1, 43))
+		a.clock, b.clock, c.clock = clock, clock, clock
+		So(a.burst(key), ShouldEqual, b.burst(key))
+		So(a.burst(key), ShouldNotEqual, c.burst(key))
+
+		before := a.burst(key)
+		now = now.Add(10 * time.Second)
+		So(a.burst(key), ShouldNotEqual, before)
+	})
+
+	Convey("Without jitter every key has the same burst", t, func() {
+		limiter := NewLimiter(RollingCounter(0, 0, time.Second, 11), 2, 10*time.Second)
+		So(limiter.burst([]byte("a")), ShouldEqual, 20)
+		So(limiter.burst([]byte("b")), ShouldEqual, 20)
+	})
+
+	Convey("The fraction must be in [0, 1)", t, func() {
+		So(func() { WithJitter(1, 0) }, ShouldPanic)
+		So(func() { WithJitter(-0.1, 0) }, ShouldPanic)
+	})
+}
@@ -0,0 +1,66 @@
+package sketchy
+
+import "fmt"
+
+// A Layout decides how a sketch's counters are arranged in memory. Every
+// layout gives the same estimates; they differ only in which counters share
+// cache lines, and so in how fast counting is for a given width and depth.
+// The benchmarks in the layoutbench package compare them.
+type Layout uint8
+
+const (
+	// RowLayout stores each row's counters contiguously (depth-major), so a
+	// key's counters are a row's width apart. It is the default.
+	RowLayout Layout = iota
+
+	// InterleavedLayout stores the counters of each column in every row
+	// contiguously (width-major), so rows are interleaved counter by counter.
+	InterleavedLayout
+
+	// BlockLayout groups columns into blocks of a cache line's worth of
+	// counters, storing each block's rows contiguously.
+	BlockLayout
+)
+
+// layoutBlock is the number of counters in a column block of BlockLayout.
+const layoutBlock = 8
+
+// WithLayout makes a counter arrange the counters of its buckets' sketches
+// as l does. Decoded buckets keep the layout they were encoded with.
+func WithLayout(l Layout) Option {
+	if !l.valid() {
+		panic(fmt.Sprintf("sketchy: unknown layout %d", l))
+	}
+	return func(o *options) { o.layout = l }
+}
+
+// String returns the name of l.
+func (l Layout) String() string {
+	switch l {
+	case RowLayout:
+		return "rows"
+	case InterleavedLayout:
+		return "interleaved"
+	case BlockLayout:
+		return "blocks"
+	}
+	return fmt.Sprintf("Layout(%d)", uint8(l))
+}
+
+func (l Layout) valid() bool { return l <= BlockLayout }
+
+// offset returns the index in the matrix of the counter in row i, column j.
+func (r *fnvSketch) offset(i, j uint) uint {
+	switch r.Layout {
+	case InterleavedLayout:
+		return j*r.Depth + i
+	case BlockLayout:
+		start := j - j%layoutBlock
+		block := r.Width - start
+		if block > layoutBlock {
+			block = layoutBlock
+		}
+		return start*r.Depth + i*block + j%layoutBlock
+	}
+	return i*r.Width + j
+}
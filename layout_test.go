@@ -0,0 +1,83 @@
+package sketchy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLayout(t *testing.T) {
+	layouts := []Layout{RowLayout, InterleavedLayout, BlockLayout}
+
+	Convey("Every layout places each counter at its own index", t, func() {
+		for _, l := range layouts {
+			for _, size := range [][2]uint{{1, 1}, {8, 3}, {13, 5}, {272, 3}} {
+				r := &fnvSketch{Width: size[0], Depth: size[1], Layout: l}
+				seen := make([]bool, r.Width*r.Depth)
+				for i := uint(0); i < r.Depth; i++ {
+					for j := uint(0); j < r.Width; j++ {
+						k := r.offset(i, j)
+						So(k, ShouldBeLessThan, len(seen))
+						So(seen[k], ShouldBeFalse)
+						seen[k] = true
+					}
+				}
+			}
+		}
+	})
+
+	Convey("Counters give the same rates in every layout", t, func() {
+		now := time.Now()
+		clock := func() time.Time { return now }
+		p := RollingParams{SketchParams: SketchParams{Epsilon: 0.99, Delta: 0.9}, Interval: time.Minute, NumIntervals: 3}
+		var counters []RateSketch
+		for _, l := range layouts {
+			counters = append(counters, p.New(WithLayout(l), WithClock(clock)))
+		}
+		for i := 0; i < 1000; i++ {
+			for _, c := range counters {
+				c.Count([]byte(fmt.Sprint(i%300)), 1, 0)
+			}
+			now = now.Add(200 * time.Millisecond)
+		}
+		for i := 0; i < 300; i++ {
+			key := []byte(fmt.Sprint(i))
+			for _, c := range counters[1:] {
+				So(c.Query(key, time.Minute), ShouldEqual, counters[0].Query(key, time.Minute))
+			}
+		}
+		buckets := counters[2].(*rollingCounter).loadBuckets()
+		So(buckets[len(buckets)-1].CountSketch.Layout, ShouldEqual, BlockLayout)
+	})
+
+	Convey("Sketches of different layouts can be merged", t, func() {
+		rows := &fnvSketch{}
+		*rows = *NewSketch(0.99, 0.9).(*fnvSketch)
+		blocks := *rows
+		blocks.Matrix, blocks.Layout = make([]uint64, len(rows.Matrix)), BlockLayout
+		rows.Count([]byte("a"), 2)
+		blocks.Count([]byte("b"), 3)
+		So(rows.merge(&blocks), ShouldBeNil)
+		So(rows.Query([]byte("a")), ShouldEqual, 2)
+		So(rows.Query([]byte("b")), ShouldEqual, 3)
+	})
+
+	Convey("Counters keep their layout through encoding", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 3}.New(WithLayout(InterleavedLayout))
+		counter.Count([]byte("key"), 4, time.Minute)
+		data, err := counter.(*rollingCounter).GobEncode()
+		So(err, ShouldBeNil)
+
+		decoded := &rollingCounter{}
+		So(decoded.GobDecode(data), ShouldBeNil)
+		So(decoded.loadBuckets()[0].CountSketch.Layout, ShouldEqual, InterleavedLayout)
+		So(decoded.Query([]byte("key"), time.Minute), ShouldEqual, counter.Query([]byte("key"), time.Minute))
+	})
+
+	Convey("Layouts must be known", t, func() {
+		So(func() { WithLayout(BlockLayout + 1) }, ShouldPanic)
+		So(BlockLayout.String(), ShouldEqual, "blocks")
+	})
+}
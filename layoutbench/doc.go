@@ -0,0 +1,11 @@
+// Package layoutbench benchmarks the counter layouts of package sketchy
+// against each other, across widths and depths from small to production
+// sizes, to help choose a layout with sketchy.WithLayout. It contains no
+// code of its own; run its benchmarks with
+//
+//	go test -bench . euphoria.io/sketchy/layoutbench
+//
+// Sub-benchmarks are named by layout, width and depth, and report the cost
+// per counted or queried key. Results depend on how the sketch compares to
+// the CPU caches, so run them on the hardware you mean to deploy to.
+package layoutbench
@@ -0,0 +1,68 @@
+package layoutbench
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"euphoria.io/sketchy"
+)
+
+var layouts = []sketchy.Layout{sketchy.RowLayout, sketchy.InterleavedLayout, sketchy.BlockLayout}
+
+// sizes are sketch parameters from a few hundred counters per row to a few
+// hundred thousand, and from three rows to seven.
+var sizes = []sketchy.SketchParams{
+	{Epsilon: 0.99, Delta: 0.9},
+	{Epsilon: 0.999, Delta: 0.99},
+	{Epsilon: 0.9999, Delta: 0.99},
+	{Epsilon: 0.99999, Delta: 0.999},
+}
+
+// keys are the keys counted, drawn from more distinct keys than the largest
+// sketch has counters per row, so counting touches the whole sketch.
+var keys = func() []uint64 {
+	r := rand.New(rand.NewSource(1))
+	keys := make([]uint64, 1<<16)
+	for i := range keys {
+		keys[i] = r.Uint64() % (1 << 20)
+	}
+	return keys
+}()
+
+func benchmarkLayouts(b *testing.B, run func(b *testing.B, counter sketchy.RateSketch)) {
+	for _, p := range sizes {
+		// the dimensions NewSketch gives the parameters
+		width := math.Ceil(math.E / (1 - p.Epsilon))
+		depth := math.Ceil(math.Log(1 / (1 - p.Delta)))
+		for _, l := range layouts {
+			b.Run(fmt.Sprintf("%s/%.0fx%.0f", l, width, depth), func(b *testing.B) {
+				counter := sketchy.RollingParams{SketchParams: p, Interval: time.Hour, NumIntervals: 2}.New(sketchy.WithLayout(l))
+				run(b, counter)
+			})
+		}
+	}
+}
+
+func BenchmarkCount(b *testing.B) {
+	benchmarkLayouts(b, func(b *testing.B, counter sketchy.RateSketch) {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sketchy.CountUint64(counter, keys[i%len(keys)], 1, 0)
+		}
+	})
+}
+
+func BenchmarkQuery(b *testing.B) {
+	benchmarkLayouts(b, func(b *testing.B, counter sketchy.RateSketch) {
+		for _, key := range keys {
+			sketchy.CountUint64(counter, key, 1, 0)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sketchy.QueryUint64(counter, keys[i%len(keys)], time.Hour)
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package sketchy
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// A Limiter enforces a rate limit on every key independently, using a rate
+// counter to track each key's recent events. It offers a subset of the API
+// of golang.org/x/time/rate.Limiter, but a single Limiter can cover millions
+// of keys in the fixed space of the counter's sketches.
+//
+// A key may have at most limit*window events in any window, so window plays
+// the part of a token bucket's burst size. As with any count-min sketch,
+// collisions can only overestimate a key's rate, so keys are sometimes
+// limited early but never late. Concurrent calls for the same key may
+// together slightly exceed the limit.
+type Limiter struct {
+	counter RateSketch
+	limit   float64
+	window  time.Duration
+
+	denials    *decisionLog
+	dryRun     bool
+	wouldBlock CountSketch // of events refused or delayed in dry-run mode
+	tiers      []Tier      // for DecideN, by increasing Above
+	jitter     float64     // the largest fraction by which a key's burst varies
+	jitterSeed uint64
+	hysteresis *hysteresis
+	clock      func() time.Time
+
+	allowlist        *Allowlist
+	countAllowlisted bool
+}
+
+// A LimiterOption configures a Limiter.
+type LimiterOption func(*Limiter)
+
+// NewLimiter returns a Limiter that allows each key limit events per second,
+// measured over the given window, and records events in counter. The
+// counter's buckets should be a small fraction of the window, and it must
+// retain at least the whole window.
+func NewLimiter(counter RateSketch, limit float64, window time.Duration, opts ...LimiterOption) *Limiter {
+	l := &Limiter{counter: counter, limit: limit, window: window}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Limit returns the number of events per second allowed for each key.
+func (l *Limiter) Limit() float64 { return l.limit }
+
+// Allow reports whether an event for key may happen now, and records it if
+// so. It is shorthand for AllowN(key, 1).
+func (l *Limiter) Allow(key []byte) bool { return l.AllowN(key, 1) }
+
+// AllowN reports whether n events for key may happen now, and records them
+// if so. Events that aren't allowed aren't recorded.
+func (l *Limiter) AllowN(key []byte, n int) bool {
+	if l.bypass(key, n) {
+		return true
+	}
+	events, burst := l.events(key), l.burst(key)
+	refuse := float64(n) > burst-events
+	if l.hysteresis != nil {
+		refuse = l.hysteresis.hold(multihash(key), refuse, events, burst, l.now(), l.window)
+	}
+	if refuse {
+		l.deny(key, n, events, Deny)
+		if !l.dryRun {
+			return false
+		}
+	}
+	Add(l.counter, key, n)
+	return true
+}
+
+// Reserve records an event for key, and returns how long the caller must
+// wait before the event may happen. It is shorthand for ReserveN(key, 1).
+func (l *Limiter) Reserve(key []byte) (delay time.Duration, ok bool) {
+	return l.ReserveN(key, 1)
+}
+
+// ReserveN records n events for key, and returns how long the caller must
+// wait before they may happen. The events are recorded immediately, so that
+// later reservations queue behind them. The delay is estimated on the
+// assumption that the key's past events leave the window at the limit rate.
+// If n exceeds the number of events allowed in a window, nothing is recorded
+// and ok is false.
+func (l *Limiter) ReserveN(key []byte, n int) (delay time.Duration, ok bool) {
+	if l.bypass(key, n) {
+		return 0, true
+	}
+	delay, events, ok := l.delay(key, n)
+	if !ok || (l.dryRun && delay > 0) {
+		l.deny(key, n, events, Deny)
+		if !l.dryRun {
+			return 0, false
+		}
+		delay = 0
+	}
+	Add(l.counter, key, n)
+	return delay, true
+}
+
+// Wait blocks until an event for key may happen, and records it. It is
+// shorthand for WaitN(ctx, key, 1).
+func (l *Limiter) Wait(ctx context.Context, key []byte) error { return l.WaitN(ctx, key, 1) }
+
+// WaitN blocks until n events for key may happen, and records them. It
+// returns an error wrapping ErrLimitExceeded, without recording the events,
+// if n exceeds the number of events allowed in a window or ctx would expire
+// first. If ctx is canceled while waiting, ctx's error is returned, but the
+// events remain recorded.
+func (l *Limiter) WaitN(ctx context.Context, key []byte, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if l.bypass(key, n) {
+		return nil
+	}
+	delay, events, ok := l.delay(key, n)
+	if l.dryRun {
+		if !ok || delay > 0 {
+			l.deny(key, n, events, Deny)
+		}
+		Add(l.counter, key, n)
+		return nil
+	}
+	if !ok {
+		l.deny(key, n, events, Deny)
+		return fmt.Errorf("%w: %d events exceed the limit of %v per %s",
+			ErrLimitExceeded, n, l.burst(key), l.window)
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		l.deny(key, n, events, Deny)
+		return fmt.Errorf("%w: would wait %s, longer than the context allows", ErrLimitExceeded, delay)
+	}
+	Add(l.counter, key, n)
+	if delay == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ResetKey clears the key's recorded events, so that it is immediately
+// allowed its whole burst again, for unblocking a key that was limited in
+// error. It forgets the key in the counter, so keys that collide with it
+// may briefly be allowed slightly more than their limit.
+func (l *Limiter) ResetKey(key []byte) { Forget(l.counter, key) }
+
+// delay returns how long n events for key must wait before they may happen,
+// or false if they never may, along with the key's events in the last
+// window.
+func (l *Limiter) delay(key []byte, n int) (time.Duration, float64, bool) {
+	burst := l.burst(key)
+	events := l.events(key)
+	if float64(n) > burst {
+		return 0, events, false
+	}
+	excess := events + float64(n) - burst
+	if excess <= 0 {
+		return 0, events, true
+	}
+	return time.Duration(excess / l.limit * float64(time.Second)), events, true
+}
+
+// burst returns the number of events allowed for key in a window.
+func (l *Limiter) burst(key []byte) float64 {
+	burst := l.limit * l.window.Seconds()
+	if l.jitter != 0 {
+		burst *= 1 + l.jitter*l.jitterAt(key, l.now())
+	}
+	return burst
+}
+
+func (l *Limiter) now() time.Time {
+	if l.clock == nil {
+		return time.Now()
+	}
+	return l.clock()
+}
+
+// events returns the estimated number of events for key in the last window.
+func (l *Limiter) events(key []byte) float64 {
+	return QueryDetailed(l.counter, key, l.window).Events
+}
+
+// Key returns a facade over the limit for a single key, with the methods of
+// golang.org/x/time/rate.Limiter.
+func (l *Limiter) Key(key []byte) *KeyLimiter { return &KeyLimiter{l: l, key: key} }
+
+// A KeyLimiter applies a Limiter to a single key.
+type KeyLimiter struct {
+	l   *Limiter
+	key []byte
+}
+
+// Limit returns the number of events per second allowed for the key.
+func (k *KeyLimiter) Limit() float64 { return k.l.limit }
+
+// Allow reports whether an event may happen now, and records it if so.
+func (k *KeyLimiter) Allow() bool { return k.l.AllowN(k.key, 1) }
+
+// AllowN reports whether n events may happen now, and records them if so.
+func (k *KeyLimiter) AllowN(n int) bool { return k.l.AllowN(k.key, n) }
+
+// Reserve records an event, and returns how long the caller must wait
+// before it may happen.
+func (k *KeyLimiter) Reserve() (time.Duration, bool) { return k.l.ReserveN(k.key, 1) }
+
+// ReserveN records n events, and returns how long the caller must wait
+// before they may happen.
+func (k *KeyLimiter) ReserveN(n int) (time.Duration, bool) { return k.l.ReserveN(k.key, n) }
+
+// Wait blocks until an event may happen, and records it.
+func (k *KeyLimiter) Wait(ctx context.Context) error { return k.l.WaitN(ctx, k.key, 1) }
+
+// WaitN blocks until n events may happen, and records them.
+func (k *KeyLimiter) WaitN(ctx context.Context, n int) error { return k.l.WaitN(ctx, k.key, n) }
+
+// Reset clears the key's recorded events, as Limiter.ResetKey does.
+func (k *KeyLimiter) Reset() { k.l.ResetKey(k.key) }
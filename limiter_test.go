@@ -0,0 +1,134 @@
+package sketchy
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	newLimiter := func() *Limiter {
+		counter := RollingCounter(0, 0, time.Second, 11).(*rollingCounter)
+		counter.clock = func() time.Time {
+			now = now.Add(time.Millisecond)
+			return now
+		}
+		return NewLimiter(counter, 2, 10*time.Second)
+	}
+
+	Convey("Keys may have limit*window events in a window", t, func() {
+		limiter := newLimiter()
+		So(limiter.Limit(), ShouldEqual, 2)
+		for i := 0; i < 20; i++ {
+			So(limiter.Allow(key), ShouldBeTrue)
+		}
+		So(limiter.Allow(key), ShouldBeFalse)
+		So(limiter.Allow([]byte("other")), ShouldBeTrue)
+
+		now = now.Add(5 * time.Second)
+		So(limiter.Allow(key), ShouldBeFalse)
+		now = now.Add(6 * time.Second)
+		So(limiter.AllowN(key, 20), ShouldBeTrue)
+		So(limiter.AllowN(key, 1), ShouldBeFalse)
+	})
+
+	Convey("Denied events aren't recorded", t, func() {
+		limiter := newLimiter()
+		So(limiter.AllowN(key, 21), ShouldBeFalse)
+		So(limiter.AllowN(key, 20), ShouldBeTrue)
+	})
+
+	Convey("Key limiters apply the limit to a single key", t, func() {
+		limiter := newLimiter()
+		k := limiter.Key(key)
+		So(k.Limit(), ShouldEqual, 2)
+		So(k.AllowN(19), ShouldBeTrue)
+		So(k.Allow(), ShouldBeTrue)
+		So(k.Allow(), ShouldBeFalse)
+		So(limiter.Allow(key), ShouldBeFalse)
+	})
+
+	Convey("Resetting a key restores its whole burst", t, func() {
+		limiter := newLimiter()
+		So(limiter.AllowN(key, 20), ShouldBeTrue)
+		So(limiter.AllowN([]byte("other"), 20), ShouldBeTrue)
+		So(limiter.Allow(key), ShouldBeFalse)
+
+		limiter.ResetKey(key)
+		So(limiter.AllowN(key, 20), ShouldBeTrue)
+		So(limiter.Allow([]byte("other")), ShouldBeFalse)
+
+		k := limiter.Key(key)
+		So(k.Allow(), ShouldBeFalse)
+		k.Reset()
+		So(k.Allow(), ShouldBeTrue)
+	})
+
+	Convey("Reservations queue behind earlier events", t, func() {
+		limiter := newLimiter()
+		delay, ok := limiter.ReserveN(key, 20)
+		So(ok, ShouldBeTrue)
+		So(delay, ShouldEqual, 0)
+
+		delay, ok = limiter.Reserve(key)
+		So(ok, ShouldBeTrue)
+		So(delay, ShouldAlmostEqual, 500*time.Millisecond, float64(10*time.Millisecond))
+
+		delay, ok = limiter.Key(key).ReserveN(2)
+		So(ok, ShouldBeTrue)
+		So(delay, ShouldAlmostEqual, 1500*time.Millisecond, float64(10*time.Millisecond))
+
+		_, ok = limiter.ReserveN(key, 21)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Wait blocks until the event may happen", t, func() {
+		limiter := newLimiter()
+		So(limiter.Wait(context.Background(), key), ShouldBeNil)
+		So(limiter.Key(key).WaitN(context.Background(), 19), ShouldBeNil)
+
+		err := limiter.WaitN(context.Background(), key, 21)
+		So(errors.Is(err, ErrLimitExceeded), ShouldBeTrue)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err = limiter.Key(key).Wait(ctx)
+		So(errors.Is(err, ErrLimitExceeded), ShouldBeTrue)
+		So(limiter.events(key), ShouldAlmostEqual, 20, 0.1)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		So(limiter.Wait(ctx, key), ShouldEqual, context.Canceled)
+	})
+
+	Convey("Wait honors cancellation while blocked", t, func() {
+		// one event an hour, on a clock that only the test moves, so that a
+		// blocked Wait would block for an hour if it missed the cancellation
+		clock := func() time.Time { return now }
+		counter := RollingCounter(0, 0, time.Hour, 11).(*rollingCounter)
+		counter.clock = clock
+		limiter := NewLimiter(counter, 1.0/3600, 10*time.Hour)
+		limiter.clock = clock
+		So(limiter.AllowN(key, 10), ShouldBeTrue)
+		now = now.Add(time.Second)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- limiter.Wait(ctx, key) }()
+
+		// the event is recorded just before Wait starts to block
+		for limiter.events(key) < 11 {
+			runtime.Gosched()
+		}
+		cancel()
+		So(<-done, ShouldEqual, context.Canceled)
+		So(limiter.events(key), ShouldEqual, 11)
+	})
+}
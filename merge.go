@@ -0,0 +1,140 @@
+package sketchy
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// MergeAll merges the gob encodings of rolling counters read from rs, such
+// as snapshots of the same counter taken on many nodes, into one counter
+// that reports the rates of their combined traffic. The snapshots are
+// decoded and merged one at a time, so no more than one of them is held in
+// memory alongside the result, however many there are.
+//
+// The result is made with the given options and takes its parameters from
+// the first snapshot. The others must have the same parameters, or be
+// converted to them if the options include WithParamsPolicy(ConvertParams);
+// otherwise MergeAll fails with ErrIncompatibleSketch. Nodes start their
+// buckets at different times, so each bucket is merged into the result's
+// bucket that was current when it started, or becomes a bucket of its own
+// if there is none. Only the latest buckets the parameters retain are kept.
+func MergeAll(rs []io.Reader, opts ...Option) (RateSketch, error) {
+	if len(rs) == 0 {
+		return nil, errors.New("sketchy: no snapshots to merge")
+	}
+	merged := RollingParams{}.New(opts...).(*rollingCounter)
+	if err := gob.NewDecoder(rs[0]).Decode(merged); err != nil {
+		err = fmt.Errorf("snapshot 0: %w", err)
+		merged.merged(0, err)
+		return nil, err
+	}
+	// the first snapshot's buckets are merged into new ones, like every
+	// other's, so that the result's sketches can be added to in place
+	buckets, err := mergeBuckets(nil, merged.loadBuckets(), merged.Interval)
+	if err != nil {
+		err = fmt.Errorf("snapshot 0: %w: %s", ErrIncompatibleSketch, err)
+		merged.merged(0, err)
+		return nil, err
+	}
+	merged.merged(len(buckets), nil)
+	merged.storeBuckets(merged.retained(buckets))
+	for i, r := range rs[1:] {
+		snapshot := merged.blank()
+		if err := gob.NewDecoder(r).Decode(snapshot); err != nil {
+			err = fmt.Errorf("snapshot %d: %w", i+1, err)
+			merged.merged(0, err)
+			return nil, err
+		}
+		if err := merged.merge(snapshot); err != nil {
+			return nil, fmt.Errorf("snapshot %d: %w", i+1, err)
+		}
+	}
+	return merged, nil
+}
+
+// blank returns an empty counter with the parameters of rl, and the options
+// that decide how encodings are decoded into it.
+func (rl *rollingCounter) blank() *rollingCounter {
+	opts := []Option{WithParamsPolicy(rl.paramsPolicy)}
+	if rl.maxRestoredAge > 0 {
+		opts = append(opts, WithMaxRestoredAge(rl.maxRestoredAge))
+	}
+	if rl.clock != nil {
+		opts = append(opts, WithClock(rl.clock))
+	}
+	blank := RollingParams{SketchParams{rl.Epsilon, rl.Delta, rl.Variant}, rl.Interval, rl.NumIntervals}.New(opts...).(*rollingCounter)
+	blank.Exact = rl.Exact
+	return blank
+}
+
+// merge adds the buckets of o, which must have the parameters of rl, to
+// rl's, whose sketches must have been made by mergeBuckets, and reports
+// the merge to rl's hooks. It doesn't lock either counter, so neither may
+// be in use.
+func (rl *rollingCounter) merge(o *rollingCounter) error {
+	err := rl.mergeCounter(o)
+	if err != nil {
+		rl.merged(0, err)
+	} else {
+		rl.merged(len(o.loadBuckets()), nil)
+	}
+	return err
+}
+
+func (rl *rollingCounter) mergeCounter(o *rollingCounter) error {
+	have := RollingParams{SketchParams{rl.Epsilon, rl.Delta, rl.Variant}, rl.Interval, rl.NumIntervals}
+	got := RollingParams{SketchParams{o.Epsilon, o.Delta, o.Variant}, o.Interval, o.NumIntervals}
+	if have != got || rl.Exact != o.Exact {
+		return fmt.Errorf("%w: can't merge %s into %s", ErrIncompatibleSketch, got, have)
+	}
+	buckets, err := mergeBuckets(rl.loadBuckets(), o.loadBuckets(), rl.Interval)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrIncompatibleSketch, err)
+	}
+	rl.storeBuckets(rl.retained(buckets))
+	// the keys merged in were never added to the precheck
+	rl.precheck.reset()
+	return nil
+}
+
+// retained returns the buckets that the counter would still retain, were
+// it current in the latest of them: the latest NumIntervals, leaving out
+// those that ended before the latest was NumIntervals-1 intervals old.
+func (rl *rollingCounter) retained(buckets []sketchWithTime) []sketchWithTime {
+	if len(buckets) > rl.NumIntervals {
+		buckets = buckets[len(buckets)-rl.NumIntervals:]
+	}
+	if len(buckets) > 0 {
+		cutoff := buckets[len(buckets)-1].Time.Add(-time.Duration(rl.NumIntervals-1) * rl.Interval)
+		for !buckets[0].Time.Add(rl.Interval).After(cutoff) {
+			buckets = buckets[1:]
+		}
+	}
+	return buckets
+}
+
+// mergeBuckets merges each bucket of from into the bucket of into that was
+// current when it started, or into a new bucket inserted where there is
+// none, and returns the updated buckets. The buckets of into are updated in
+// place, and from's are only read.
+func mergeBuckets(into, from []sketchWithTime, interval time.Duration) ([]sketchWithTime, error) {
+	merged := into
+	for _, b := range from {
+		// the first bucket that starts after b, and the one before it
+		i := sort.Search(len(merged), func(i int) bool { return merged[i].Time.After(b.Time) })
+		if i == 0 || !b.Time.Before(merged[i-1].Time.Add(interval)) {
+			merged = append(merged, sketchWithTime{})
+			copy(merged[i+1:], merged[i:])
+			merged[i] = sketchWithTime{Time: b.Time}
+			i++
+		}
+		if err := merged[i-1].merge(b); err != nil {
+			return nil, fmt.Errorf("bucket at %s: %s", b.Time, err)
+		}
+	}
+	return merged, nil
+}
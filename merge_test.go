@@ -0,0 +1,99 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMergeAll(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	clock := func() time.Time { return now }
+	params := RollingParams{Interval: time.Minute, NumIntervals: 10}
+
+	snapshot := func(counter RateSketch) io.Reader {
+		buf := &bytes.Buffer{}
+		So(gob.NewEncoder(buf).Encode(counter), ShouldBeNil)
+		return buf
+	}
+
+	Convey("Snapshots of many nodes merge into one counter", t, func() {
+		start := now
+		nodes := make([]RateSketch, 5)
+		for i := range nodes {
+			nodes[i] = params.New(WithClock(clock))
+		}
+		// each node starts its buckets at a different time
+		for step := 0; step < 5*60; step++ {
+			if step%60 < len(nodes) {
+				Rollover(nodes[step%60])
+			}
+			for i, node := range nodes {
+				Add(node, []byte("shared"), 1)
+				Add(node, []byte(fmt.Sprint("node", i)), 1)
+			}
+			now = now.Add(time.Second)
+		}
+
+		readers := make([]io.Reader, len(nodes))
+		for i, node := range nodes {
+			readers[i] = snapshot(node)
+		}
+		merged, err := MergeAll(readers, WithClock(clock))
+		So(err, ShouldBeNil)
+		So(merged.Query([]byte("shared"), 5*time.Minute), ShouldAlmostEqual, 5, 0.1)
+		So(merged.Query([]byte("node3"), 5*time.Minute), ShouldAlmostEqual, 1, 0.1)
+
+		// buckets started in a minute already begun merge into it
+		buckets := StatsOf(merged).Buckets
+		So(len(buckets), ShouldBeLessThanOrEqualTo, 10)
+		So(buckets[0].Start, ShouldEqual, start)
+		for _, b := range buckets {
+			So(b.Duration, ShouldBeLessThanOrEqualTo, time.Minute)
+		}
+	})
+
+	Convey("Only the latest buckets are kept", t, func() {
+		a, b := params.New(WithClock(clock)), params.New(WithClock(clock))
+		Add(a, []byte("old"), 60)
+		now = now.Add(10 * time.Minute)
+		Add(b, []byte("new"), 60)
+		now = now.Add(time.Minute)
+
+		merged, err := MergeAll([]io.Reader{snapshot(a), snapshot(b)}, WithClock(clock))
+		So(err, ShouldBeNil)
+		So(merged.Query([]byte("new"), time.Minute), ShouldEqual, 1)
+		So(merged.Query([]byte("old"), time.Hour), ShouldEqual, 0)
+		So(len(StatsOf(merged).Buckets), ShouldEqual, 1)
+	})
+
+	Convey("Snapshots with other parameters are converted or refused", t, func() {
+		a := params.New(WithClock(clock))
+		b := RollingParams{Interval: 30 * time.Second, NumIntervals: 20}.New(WithClock(clock))
+		Add(a, []byte("key"), 60)
+		Add(b, []byte("key"), 60)
+		now = now.Add(time.Minute)
+
+		_, err := MergeAll([]io.Reader{snapshot(a), snapshot(b)})
+		So(errors.Is(err, ErrIncompatibleSketch), ShouldBeTrue)
+
+		merged, err := MergeAll([]io.Reader{snapshot(a), snapshot(b)}, WithClock(clock), WithParamsPolicy(ConvertParams))
+		So(err, ShouldBeNil)
+		So(merged.Query([]byte("key"), time.Minute), ShouldEqual, 2)
+	})
+
+	Convey("Bad input is reported", t, func() {
+		_, err := MergeAll(nil)
+		So(err, ShouldNotBeNil)
+
+		_, err = MergeAll([]io.Reader{snapshot(params.New()), bytes.NewReader([]byte("garbage"))})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "snapshot 1")
+	})
+}
@@ -0,0 +1,161 @@
+package sketchy
+
+import (
+	"fmt"
+	"time"
+)
+
+// A ParamsPolicy decides what GobDecode does with an encoding whose
+// parameters differ from those the counter was constructed with.
+type ParamsPolicy int
+
+const (
+	// AdoptParams replaces the counter's parameters with the encoding's.
+	// It is the default.
+	AdoptParams ParamsPolicy = iota
+
+	// RejectParams refuses the encoding with ErrIncompatibleSketch, leaving
+	// the counter unchanged.
+	RejectParams
+
+	// ConvertParams keeps the counter's parameters and converts the
+	// encoding's buckets to them, if they were hashed with the same variant.
+	// Consecutive buckets are merged into buckets of the counter's interval,
+	// which must therefore be a multiple of the encoding's, and only the
+	// counter's number of buckets are kept.
+	// Buckets keep their own sketch parameters, as they do when WithAutoTune
+	// changes them, so new buckets are made with the counter's while older
+	// ones age out. Buckets that must be merged need the same sketch
+	// parameters as each other. Encodings that can't be converted are
+	// refused with ErrIncompatibleSketch.
+	ConvertParams
+)
+
+// WithParamsPolicy sets what a counter does when it decodes an encoding
+// with different parameters from its own. Counters that weren't
+// constructed with parameters, such as a zero value decoded into, always
+// adopt the encoding's.
+func WithParamsPolicy(p ParamsPolicy) Option {
+	return func(o *options) { o.paramsPolicy = p }
+}
+
+// reconcile applies the counter's ParamsPolicy to a decoded state, either
+// adopting its parameters or converting its buckets to the counter's. It
+// leaves the counter unchanged if it returns an error. The caller must hold
+// rl.m.
+func (rl *rollingCounter) reconcile(state *rollingState) error {
+	have := RollingParams{SketchParams{rl.Epsilon, rl.Delta, rl.Variant}, rl.Interval, rl.NumIntervals}
+	got := RollingParams{SketchParams{state.Epsilon, state.Delta, state.Variant}, state.Interval, state.NumIntervals}
+	same := have.SketchParams.withDefaults() == got.SketchParams.withDefaults() &&
+		have.Interval == got.Interval && have.NumIntervals == got.NumIntervals
+	if rl.Interval == 0 || rl.paramsPolicy == AdoptParams || (same && rl.Exact == state.Exact) {
+		rl.Epsilon, rl.Delta, rl.Interval, rl.NumIntervals = got.Epsilon, got.Delta, got.Interval, got.NumIntervals
+		rl.Variant, rl.Exact = got.Hash, state.Exact
+		return nil
+	}
+	if rl.Exact != state.Exact {
+		return fmt.Errorf("%w: exact and estimated counts can't be mixed", ErrIncompatibleSketch)
+	}
+	if rl.paramsPolicy == RejectParams {
+		return fmt.Errorf("%w: encoded with %s, but the counter has %s", ErrIncompatibleSketch, got, have)
+	}
+	if have.Hash != got.Hash {
+		return fmt.Errorf("%w: can't rehash buckets hashed with %s", ErrIncompatibleSketch, got.Hash)
+	}
+
+	buckets, err := rebucket(state.Buckets, got.Interval, have.Interval)
+	if err != nil {
+		return fmt.Errorf("%w: can't convert %s to %s: %s", ErrIncompatibleSketch, got, have, err)
+	}
+	if len(buckets) > have.NumIntervals {
+		buckets = buckets[len(buckets)-have.NumIntervals:]
+	}
+	state.Buckets = buckets
+	return nil
+}
+
+// rebucket merges consecutive buckets of the given interval into buckets of
+// a longer interval, which must be a multiple of it. Each merged bucket
+// starts when the first bucket merged into it did.
+func rebucket(buckets []sketchWithTime, from, to time.Duration) ([]sketchWithTime, error) {
+	if to == from {
+		return buckets, nil
+	}
+	if to < from || to%from != 0 {
+		return nil, fmt.Errorf("interval %s isn't a multiple of %s", to, from)
+	}
+	var merged []sketchWithTime
+	for _, b := range buckets {
+		last := len(merged) - 1
+		if last < 0 || !b.Time.Before(merged[last].Time.Add(to)) {
+			merged = append(merged, sketchWithTime{Time: b.Time})
+			last++
+		}
+		if err := merged[last].merge(b); err != nil {
+			return nil, fmt.Errorf("bucket at %s: %s", b.Time, err)
+		}
+	}
+	return merged, nil
+}
+
+// merge adds the counts and registers of o to b. A bucket with no sketch
+// takes a copy of o's; otherwise the sketches must have the same
+// dimensions. Registers missing from either bucket are missing afterwards.
+func (b *sketchWithTime) merge(o sketchWithTime) error {
+	if o.CountSketch == nil {
+		return nil
+	}
+	if b.CountSketch == nil {
+		if o.CountSketch.Exact != nil {
+			b.CountSketch = ExactSketch().(*fnvSketch)
+		} else {
+			b.CountSketch = NewSketch(o.CountSketch.Epsilon, o.CountSketch.Delta).(*fnvSketch)
+		}
+		b.CountSketch.Variant = o.CountSketch.Variant
+		b.CountSketch.Layout = o.CountSketch.Layout
+		b.CountSketch.Conservative = o.CountSketch.Conservative
+		b.Distinct, b.Signature = newHLL(), newMinHash()
+	}
+	if err := b.CountSketch.merge(o.CountSketch); err != nil {
+		return err
+	}
+	if b.Distinct != nil && o.Distinct != nil {
+		b.Distinct = b.Distinct.union(o.Distinct)
+	} else {
+		b.Distinct = nil
+	}
+	if b.Signature != nil && o.Signature != nil {
+		b.Signature = b.Signature.union(o.Signature)
+	} else {
+		b.Signature = nil
+	}
+	return nil
+}
+
+// merge adds every counter of o to the corresponding counter of r, which
+// must have the same dimensions, no stamps and a single writer. The sketches
+// may have different layouts. Exact sketches merge only with each other.
+func (r *fnvSketch) merge(o *fnvSketch) error {
+	if (r.Exact == nil) != (o.Exact == nil) {
+		return fmt.Errorf("exact and estimated counts can't be merged")
+	}
+	if r.Exact != nil {
+		r.Exact.merge(o.Exact)
+		return nil
+	}
+	if r.Width != o.Width || r.Depth != o.Depth {
+		return fmt.Errorf("sketches of %dx%d and %dx%d can't be merged", r.Width, r.Depth, o.Width, o.Depth)
+	}
+	if r.Layout == o.Layout {
+		for k := range r.Matrix {
+			r.Matrix[k] += o.cell(uint(k))
+		}
+		return nil
+	}
+	for i := uint(0); i < r.Depth; i++ {
+		for j := uint(0); j < r.Width; j++ {
+			r.Matrix[r.offset(i, j)] += o.cell(o.offset(i, j))
+		}
+	}
+	return nil
+}
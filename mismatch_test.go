@@ -0,0 +1,154 @@
+package sketchy
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParamsPolicy(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	key := []byte("key")
+
+	// six minutes of one event per second, in one-minute buckets
+	src := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(WithClock(clock))
+	start := now
+	for i := 0; i < 6; i++ {
+		src.Count(key, 60, 0)
+		now = now.Add(time.Minute)
+	}
+	encoding, err := src.(*rollingCounter).GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("By default the encoding's parameters are adopted", t, func() {
+		dst := RollingParams{Interval: 2 * time.Minute, NumIntervals: 2}.New(WithClock(clock)).(*rollingCounter)
+		So(dst.GobDecode(encoding), ShouldBeNil)
+		So(dst.Interval, ShouldEqual, time.Minute)
+		So(dst.NumIntervals, ShouldEqual, 10)
+		So(len(dst.loadBuckets()), ShouldEqual, 6)
+	})
+
+	Convey("Mismatched parameters can be rejected", t, func() {
+		dst := RollingParams{Interval: 2 * time.Minute, NumIntervals: 2}.New(
+			WithClock(clock), WithParamsPolicy(RejectParams)).(*rollingCounter)
+		err := dst.GobDecode(encoding)
+		So(errors.Is(err, ErrIncompatibleSketch), ShouldBeTrue)
+		So(err.Error(), ShouldContainSubstring, "interval=1m,num=10")
+		So(dst.Interval, ShouldEqual, 2*time.Minute)
+		So(dst.loadBuckets(), ShouldBeNil)
+
+		same := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(
+			WithClock(clock), WithParamsPolicy(RejectParams)).(*rollingCounter)
+		So(same.GobDecode(encoding), ShouldBeNil)
+	})
+
+	Convey("Buckets can be converted to a longer interval", t, func() {
+		dst := RollingParams{Interval: 2 * time.Minute, NumIntervals: 2}.New(
+			WithClock(clock), WithParamsPolicy(ConvertParams)).(*rollingCounter)
+		So(dst.GobDecode(encoding), ShouldBeNil)
+		So(dst.Interval, ShouldEqual, 2*time.Minute)
+		So(dst.NumIntervals, ShouldEqual, 2)
+
+		buckets := dst.loadBuckets()
+		So(len(buckets), ShouldEqual, 2)
+		So(buckets[0].Time.Equal(start.Add(2*time.Minute)), ShouldBeTrue)
+		So(buckets[1].Time.Equal(start.Add(4*time.Minute)), ShouldBeTrue)
+		So(buckets[0].Query(key), ShouldEqual, 120)
+		So(buckets[1].Query(key), ShouldEqual, 120)
+		So(buckets[1].Distinct.estimate(), ShouldAlmostEqual, 1, 0.01)
+
+		So(dst.Query(key, 4*time.Minute), ShouldAlmostEqual, 1)
+		So(src.Query(key, 4*time.Minute), ShouldAlmostEqual, 1)
+	})
+
+	Convey("Buckets keep their sketch parameters when converted", t, func() {
+		dst := RollingParams{SketchParams: SketchParams{Epsilon: 0.9}, Interval: time.Minute, NumIntervals: 10}.New(
+			WithClock(clock), WithParamsPolicy(ConvertParams)).(*rollingCounter)
+		So(dst.GobDecode(encoding), ShouldBeNil)
+		So(dst.Epsilon, ShouldEqual, 0.9)
+		So(dst.loadBuckets()[0].CountSketch.Epsilon, ShouldEqual, DefaultEpsilon)
+
+		dst.Rollover()
+		buckets := dst.loadBuckets()
+		So(buckets[len(buckets)-1].CountSketch.Epsilon, ShouldEqual, 0.9)
+	})
+
+	Convey("Converted buckets keep their hash variant", t, func() {
+		fnv1a := RollingParams{SketchParams: SketchParams{Hash: FNV1a}, Interval: time.Minute, NumIntervals: 10}
+		src := fnv1a.New(WithClock(clock))
+		src.Count(key, 60, 0)
+		now = now.Add(time.Minute)
+		src.Count(key, 60, 0)
+		encoding, err := src.(*rollingCounter).GobEncode()
+		So(err, ShouldBeNil)
+
+		fnv1a.Interval = 2 * time.Minute
+		dst := fnv1a.New(WithClock(clock), WithParamsPolicy(ConvertParams))
+		So(dst.(*rollingCounter).GobDecode(encoding), ShouldBeNil)
+		buckets := dst.(*rollingCounter).loadBuckets()
+		So(len(buckets), ShouldEqual, 1)
+		So(buckets[0].CountSketch.Variant, ShouldEqual, FNV1a)
+		So(buckets[0].Query(key), ShouldEqual, 120)
+	})
+
+	Convey("Buckets can't be split into a shorter interval", t, func() {
+		dst := RollingParams{Interval: 30 * time.Second, NumIntervals: 10}.New(
+			WithClock(clock), WithParamsPolicy(ConvertParams)).(*rollingCounter)
+		So(errors.Is(dst.GobDecode(encoding), ErrIncompatibleSketch), ShouldBeTrue)
+		So(dst.loadBuckets(), ShouldBeNil)
+
+		dst = RollingParams{Interval: 90 * time.Second, NumIntervals: 10}.New(
+			WithClock(clock), WithParamsPolicy(ConvertParams)).(*rollingCounter)
+		So(errors.Is(dst.GobDecode(encoding), ErrIncompatibleSketch), ShouldBeTrue)
+	})
+
+	Convey("Counters that weren't constructed adopt the encoding's parameters", t, func() {
+		dst := &rollingCounter{}
+		dst.paramsPolicy = RejectParams
+		So(dst.GobDecode(encoding), ShouldBeNil)
+		So(dst.Interval, ShouldEqual, time.Minute)
+	})
+
+	Convey("Queries run concurrently with decoding new parameters", t, func() {
+		other := RollingParams{Interval: 2 * time.Minute, NumIntervals: 3}.New(WithClock(clock))
+		other.Count(key, 120, 0)
+		encodings := make([][]byte, 2)
+		encodings[0] = encoding
+		if encodings[1], err = other.(*rollingCounter).GobEncode(); err != nil {
+			t.Fatal(err)
+		}
+
+		later := func() time.Time { return now.Add(time.Minute) }
+		dst := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(WithClock(later)).(*rollingCounter)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if err := dst.GobDecode(encodings[i%2]); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		for i := 0; i < 200; i++ {
+			dst.Query(key, 3*time.Minute)
+			dst.QueryDetailed(key, 3*time.Minute)
+			dst.Forecast(key, time.Minute)
+		}
+		wg.Wait()
+		So(dst.Interval, ShouldEqual, 2*time.Minute)
+		So(dst.Query(key, 2*time.Minute), ShouldEqual, 2)
+	})
+
+	Convey("Rollup levels apply the policy", t, func() {
+		rollup := RollupParams{Durations: []time.Duration{2 * time.Minute, 4 * time.Minute}}.New(
+			WithParamsPolicy(RejectParams)).(*rollupCounter)
+		So(rollup.Levels[0].paramsPolicy, ShouldEqual, RejectParams)
+	})
+}
@@ -0,0 +1,60 @@
+package sketchy
+
+import "time"
+
+// An Event is one update applied by AddAll: delta occurrences of Key in
+// Counter.
+type Event struct {
+	Counter RateSketch
+	Key     []byte
+	Delta   int
+}
+
+// timedAdder is implemented by the counters that AddAll can give a
+// timestamp to.
+type timedAdder interface {
+	now() time.Time
+	addAt(key []byte, delta int, now time.Time)
+}
+
+// AddAll applies several events, such as a request's count, its bytes and
+// whether it failed, or the same request counted per IP and per ASN, with a
+// single timestamp taken from the first event's counter. Each event is
+// applied under its counter's lock, as Add applies it, so all of them land
+// in buckets covering the same moment and rates derived from pairs of the
+// counters, such as error ratios, stay consistent. Counters not made by this
+// package are given their events with Add.
+func AddAll(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	now := time.Now()
+	if t, ok := events[0].Counter.(timedAdder); ok {
+		now = t.now()
+	}
+	for _, e := range events {
+		if t, ok := e.Counter.(timedAdder); ok {
+			t.addAt(e.Key, e.Delta, now)
+		} else {
+			Add(e.Counter, e.Key, e.Delta)
+		}
+	}
+}
+
+// now returns the time according to the first shard.
+func (s *ShardedRateSketch) now() time.Time {
+	if t, ok := s.shards[0].(timedAdder); ok {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// addAt records delta occurrences of key in its shard at now.
+func (s *ShardedRateSketch) addAt(key []byte, delta int, now time.Time) {
+	shard := s.Shard(key)
+	if t, ok := shard.(timedAdder); ok {
+		t.addAt(key, delta, now)
+	} else {
+		Add(shard, key, delta)
+	}
+}
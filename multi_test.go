@@ -0,0 +1,41 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAddAll(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	key := []byte("client")
+
+	Convey("Every event is counted at the first counter's time", t, func() {
+		now := start
+		requests := RollingParams{Interval: time.Minute, NumIntervals: 3}.New(WithClock(func() time.Time { return now }))
+		// the failures counter's clock runs a minute behind
+		failures := RollupParams{Durations: []time.Duration{time.Minute, time.Hour}}.New(
+			WithClock(func() time.Time { return now.Add(-time.Minute) }))
+		sharded := NewShardedRateSketch(RollingParams{Interval: time.Minute, NumIntervals: 3}.New())
+
+		AddAll(Event{requests, key, 10}, Event{failures, key, 2}, Event{sharded, key, 10})
+		now = now.Add(time.Minute)
+		AddAll(Event{requests, key, 10}, Event{failures, key, 1}, Event{sharded, key, 10})
+
+		So(len(StatsOf(requests).Buckets), ShouldEqual, 2)
+		errorBuckets := StatsOf(failures).Buckets
+		So(len(errorBuckets), ShouldEqual, 2)
+		So(errorBuckets[0].Start.Equal(start), ShouldBeTrue)
+		So(errorBuckets[0].Events, ShouldEqual, 2)
+		So(errorBuckets[1].Start.Equal(start.Add(time.Minute)), ShouldBeTrue)
+
+		shardBuckets := sharded.Stats().Buckets
+		So(len(shardBuckets), ShouldEqual, 2)
+		So(shardBuckets[1].Start.Equal(start.Add(time.Minute)), ShouldBeTrue)
+	})
+
+	Convey("Nothing happens without events", t, func() {
+		So(func() { AddAll() }, ShouldNotPanic)
+	})
+}
@@ -0,0 +1,44 @@
+package sketchy
+
+import "time"
+
+// seen reports whether any retained bucket has a nonzero count for the key
+// with the given hash.
+// Since a count-min sketch never underestimates, a key that was counted is
+// always seen; a key that wasn't may be too, if it collides with others in
+// every row. It doesn't lock the counter.
+func (rl *rollingCounter) seen(k hashKernel) bool {
+	for _, b := range rl.loadBuckets() {
+		if b.query(k) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (rc *rollupCounter) seen(k hashKernel) bool {
+	for _, c := range rc.Levels {
+		if c.seen(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// CountAndCheckNew records delta occurrences of key as Count does, and also
+// reports whether the key was new: that is, it had not been counted in any
+// bucket the counter retains. A new key is occasionally reported as seen, if
+// it collides with keys that were, but a key that was seen is never
+// reported as new.
+func (rl *rollingCounter) CountAndCheckNew(key []byte, delta int, interval time.Duration) (float64, bool) {
+	return rl.countAndCheck(rl.prehash(key), delta, interval, true)
+}
+
+// CountAndCheckNew records delta occurrences of key as Count does, and also
+// reports whether the key was new: that is, it had not been counted in any
+// bucket of any level. A new key is occasionally reported as seen, if it
+// collides with keys that were, but a key that was seen is never reported
+// as new.
+func (rc *rollupCounter) CountAndCheckNew(key []byte, delta int, interval time.Duration) (float64, bool) {
+	return rc.countAndCheck(rc.prehash(key), delta, interval, true)
+}
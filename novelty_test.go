@@ -0,0 +1,78 @@
+package sketchy
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCountAndCheckNew(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	Convey("Rolling counters flag keys not seen in the retained buckets", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 3).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		_, isNew := counter.CountAndCheckNew(key, 60, 0)
+		So(isNew, ShouldBeTrue)
+		now = now.Add(time.Minute)
+
+		rate, isNew := counter.CountAndCheckNew(key, 60, time.Minute)
+		So(isNew, ShouldBeFalse)
+		So(rate, ShouldEqual, 1)
+		So(counter.Query(key, 2*time.Minute), ShouldEqual, 1)
+
+		// once every bucket holding the key has been forgotten, it's new again
+		for i := 0; i < 2; i++ {
+			counter.Rollover()
+		}
+		_, isNew = counter.CountAndCheckNew([]byte("other"), 1, 0)
+		So(isNew, ShouldBeTrue)
+		So(counter.seen(multihash(key)), ShouldBeTrue)
+		counter.Rollover()
+		_, isNew = counter.CountAndCheckNew(key, 1, 0)
+		So(isNew, ShouldBeTrue)
+	})
+
+	Convey("Rollup counters flag keys not seen in any level", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, 5*time.Minute, time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		_, isNew := rollup.CountAndCheckNew(key, 1, 0)
+		So(isNew, ShouldBeTrue)
+
+		// the key has expired from the finest level, but not the others
+		now = now.Add(10 * time.Minute)
+		rollup.Count([]byte("other"), 1, 0)
+		for i := 0; i < 5; i++ {
+			rollup.Levels[0].Rollover()
+		}
+		So(rollup.Levels[0].seen(multihash(key)), ShouldBeFalse)
+		_, isNew = rollup.CountAndCheckNew(key, 1, 0)
+		So(isNew, ShouldBeFalse)
+	})
+
+	Convey("Only one of several concurrent first counts is new", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, 5*time.Minute, time.Hour)
+		var (
+			wg    sync.WaitGroup
+			m     sync.Mutex
+			fresh int
+		)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, isNew := CountAndCheckNew(rollup, key, 1, 0); isNew {
+					m.Lock()
+					fresh++
+					m.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		So(fresh, ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,126 @@
+package sketchy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenMetricsOptions configures WriteOpenMetrics. Zero values take the
+// defaults noted.
+type OpenMetricsOptions struct {
+	// Name prefixes every metric name. The default is "sketchy".
+	Name string
+
+	// Interval is the interval that rates and distinct keys are measured
+	// over. The default is one minute.
+	Interval time.Duration
+
+	// Keys, if non-nil, supplies the keys whose rates are reported. Only
+	// the TopK keys with the highest rates are written.
+	Keys *KeyDictionary
+
+	// TopK is the number of keys whose rates are written. The default is 10.
+	TopK int
+}
+
+func (o OpenMetricsOptions) withDefaults() OpenMetricsOptions {
+	if o.Name == "" {
+		o.Name = "sketchy"
+	}
+	if o.Interval == 0 {
+		o.Interval = time.Minute
+	}
+	if o.TopK == 0 {
+		o.TopK = 10
+	}
+	return o
+}
+
+// WriteOpenMetrics writes the state of counter to w in the OpenMetrics text
+// format (https://openmetrics.io), which Prometheus also accepts, without
+// depending on a Prometheus client library. It writes the counter's overall
+// rate, the events and distinct keys it retains, the occupancy of the
+// current bucket of each level, and the rates of the busiest keys from
+// opts.Keys.
+func WriteOpenMetrics(w io.Writer, counter RateSketch, opts OpenMetricsOptions) error {
+	opts = opts.withDefaults()
+	stats := StatsOf(counter)
+	bw := bufio.NewWriter(w)
+
+	family := func(name, help string) {
+		fmt.Fprintf(bw, "# TYPE %s_%s gauge\n# HELP %s_%s %s\n", opts.Name, name, opts.Name, name, help)
+	}
+	sample := func(name, labels string, v float64) {
+		fmt.Fprintf(bw, "%s_%s%s %s\n", opts.Name, name, labels, formatFloat(v))
+	}
+
+	family("rate", "Events per second over all retained data.")
+	sample("rate", "", stats.Rate)
+
+	var events uint64
+	for _, b := range stats.Buckets {
+		events += b.Events
+	}
+	family("events", "Events counted in retained buckets.")
+	sample("events", "", float64(events))
+
+	family("buckets", "Retained buckets.")
+	sample("buckets", "", float64(len(stats.Buckets)))
+
+	family("distinct_keys", "Estimated distinct keys counted over the interval.")
+	sample("distinct_keys", fmt.Sprintf("{interval=%q}", formatDuration(opts.Interval)),
+		DistinctKeys(counter, opts.Interval))
+
+	family("occupancy", "Fraction of nonzero counters in the current bucket of each level.")
+	for i, b := range stats.Buckets {
+		if i == len(stats.Buckets)-1 || stats.Buckets[i+1].Interval != b.Interval {
+			sample("occupancy", fmt.Sprintf("{interval=%q}", formatDuration(b.Interval)), b.Occupancy)
+		}
+	}
+
+	if opts.Keys != nil {
+		family("key_rate", "Events per second of the busiest keys over the interval.")
+		for _, kr := range topKeys(counter, opts.Keys.Keys(), opts.Interval, opts.TopK) {
+			sample("key_rate", fmt.Sprintf("{key=\"%s\",interval=%q}",
+				escapeLabel(kr.key), formatDuration(opts.Interval)), kr.rate)
+		}
+	}
+
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+type keyRate struct {
+	key  []byte
+	rate float64
+}
+
+// topKeys returns up to k of the keys with the highest rates over interval,
+// busiest first.
+func topKeys(counter RateSketch, keys [][]byte, interval time.Duration, k int) []keyRate {
+	rates := make([]keyRate, len(keys))
+	for i, key := range keys {
+		rates[i] = keyRate{key: key, rate: counter.Query(key, interval)}
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].rate != rates[j].rate {
+			return rates[i].rate > rates[j].rate
+		}
+		return string(rates[i].key) < string(rates[j].key)
+	})
+	if len(rates) > k {
+		rates = rates[:k]
+	}
+	return rates
+}
+
+// escapeLabel escapes key for use as an OpenMetrics label value, replacing
+// invalid UTF-8.
+func escapeLabel(key []byte) string {
+	s := strings.ToValidUTF8(string(key), "�")
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
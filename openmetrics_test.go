@@ -0,0 +1,56 @@
+package sketchy
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
+
+func TestWriteOpenMetrics(t *testing.T) {
+	now := time.Now()
+
+	Convey("Counters are written in OpenMetrics text format", t, func() {
+		dict := NewKeyDictionary(10, 0)
+		rollup := RollupParams{Durations: []time.Duration{time.Minute, time.Hour, 24 * time.Hour}}.New(
+			WithKeyDictionary(dict)).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		rollup.Count([]byte("busy"), 120, 0)
+		rollup.Count([]byte("quiet"), 60, 0)
+		rollup.Count([]byte("we\"ird\n"), 6, 0)
+		now = now.Add(time.Minute)
+
+		buf := &bytes.Buffer{}
+		err := WriteOpenMetrics(buf, rollup, OpenMetricsOptions{Name: "requests", Keys: dict, TopK: 2})
+		So(err, ShouldBeNil)
+		out := buf.String()
+
+		So(out, ShouldContainSubstring, "# TYPE requests_rate gauge\n")
+		So(out, ShouldContainSubstring, "\nrequests_rate 3.1\n")
+		So(out, ShouldContainSubstring, "\nrequests_events 372\n")
+		So(out, ShouldContainSubstring, "\nrequests_buckets 2\n")
+		So(out, ShouldContainSubstring, "\nrequests_distinct_keys{interval=\"1m\"} 3")
+		So(out, ShouldContainSubstring, "\nrequests_occupancy{interval=\"1m\"} ")
+		So(out, ShouldContainSubstring, "\nrequests_occupancy{interval=\"1h\"} ")
+		So(out, ShouldContainSubstring, "\nrequests_key_rate{key=\"busy\",interval=\"1m\"} 2\n")
+		So(out, ShouldContainSubstring, "\nrequests_key_rate{key=\"quiet\",interval=\"1m\"} 1\n")
+		So(out, ShouldNotContainSubstring, "ird")
+		So(strings.HasSuffix(out, "# EOF\n"), ShouldBeTrue)
+	})
+
+	Convey("Label values are escaped", t, func() {
+		So(escapeLabel([]byte("a\"b\\c\nd\xff")), ShouldEqual, `a\"b\\c\nd`+"�")
+	})
+
+	Convey("Write errors are returned", t, func() {
+		err := WriteOpenMetrics(failingWriter{}, RollingCounter(0, 0, time.Minute, 2), OpenMetricsOptions{})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,298 @@
+package sketchy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// The interfaces below are implemented by the package's rate counters in
+// addition to RateSketch. A RateSketch from elsewhere may implement any of
+// them; the function of the same name as each method calls it if it does,
+// and otherwise falls back as described, so that every RateSketch can be
+// used wherever the package accepts one.
+
+// An Adder records occurrences without computing the updated rate.
+type Adder interface {
+	Add(key []byte, delta int)
+}
+
+// Add records delta occurrences of key in s, without computing the key's
+// updated rate if s is an Adder.
+func Add(s RateSketch, key []byte, delta int) {
+	if a, ok := s.(Adder); ok {
+		a.Add(key, delta)
+		return
+	}
+	s.Count(key, delta, 0)
+}
+
+// A HandleCounter counts and queries keys hashed in advance by Prehash.
+type HandleCounter interface {
+	CountHandle(h KeyHandle, delta int, interval time.Duration) float64
+	QueryHandle(h KeyHandle, interval time.Duration) float64
+}
+
+// CountHandle is Count for a key hashed in advance by Prehash. If s isn't a
+// HandleCounter, the handle's key is counted instead, so it must refer to
+// one: handles from CompositeKey don't.
+func CountHandle(s RateSketch, h KeyHandle, delta int, interval time.Duration) float64 {
+	if c, ok := s.(HandleCounter); ok {
+		return c.CountHandle(h, delta, interval)
+	}
+	return s.Count(handleKey(s, h), delta, interval)
+}
+
+// QueryHandle is Query for a key hashed in advance by Prehash. If s isn't a
+// HandleCounter, the handle's key is queried instead, as for CountHandle.
+func QueryHandle(s RateSketch, h KeyHandle, interval time.Duration) float64 {
+	if c, ok := s.(HandleCounter); ok {
+		return c.QueryHandle(h, interval)
+	}
+	return s.Query(handleKey(s, h), interval)
+}
+
+func handleKey(s RateSketch, h KeyHandle) []byte {
+	if h.key == nil {
+		panic(fmt.Sprintf("sketchy: %T can't count a handle without its key", s))
+	}
+	return h.key
+}
+
+// A Uint64Counter counts and queries numeric keys without encoding them.
+type Uint64Counter interface {
+	CountUint64(key uint64, delta int, interval time.Duration) float64
+	QueryUint64(key uint64, interval time.Duration) float64
+}
+
+// CountUint64 is Count for a numeric key. It is equivalent to counting the
+// key's 8-byte big-endian encoding, which it does if s isn't a
+// Uint64Counter.
+func CountUint64(s RateSketch, key uint64, delta int, interval time.Duration) float64 {
+	if c, ok := s.(Uint64Counter); ok {
+		return c.CountUint64(key, delta, interval)
+	}
+	return s.Count(binary.BigEndian.AppendUint64(nil, key), delta, interval)
+}
+
+// QueryUint64 is Query for a numeric key, as CountUint64 counts it.
+func QueryUint64(s RateSketch, key uint64, interval time.Duration) float64 {
+	if c, ok := s.(Uint64Counter); ok {
+		return c.QueryUint64(key, interval)
+	}
+	return s.Query(binary.BigEndian.AppendUint64(nil, key), interval)
+}
+
+// A SmoothedQuerier averages per-bucket rates.
+type SmoothedQuerier interface {
+	QuerySmoothed(key []byte, k int, sm Smoothing) float64
+}
+
+// QuerySmoothed returns the observed rate of the given key, averaged over
+// its rate in each of the last k buckets with the given weights, or NaN if
+// s isn't a SmoothedQuerier.
+func QuerySmoothed(s RateSketch, key []byte, k int, sm Smoothing) float64 {
+	if q, ok := s.(SmoothedQuerier); ok {
+		return q.QuerySmoothed(key, k, sm)
+	}
+	return math.NaN()
+}
+
+// A DetailedQuerier describes the data behind the rates it returns.
+type DetailedQuerier interface {
+	QueryDetailed(key []byte, interval time.Duration) QueryDetail
+}
+
+// QueryDetailed returns the observed rate of the given key over the given
+// interval, as Query does, along with a description of the data it was
+// computed from. If s isn't a DetailedQuerier, its rate is taken to cover
+// the whole interval, and Events is derived from it.
+func QueryDetailed(s RateSketch, key []byte, interval time.Duration) QueryDetail {
+	if q, ok := s.(DetailedQuerier); ok {
+		return q.QueryDetailed(key, interval)
+	}
+	rate := s.Query(key, interval)
+	detail := QueryDetail{Rate: rate, Events: rate * interval.Seconds()}
+	if rate != 0 {
+		detail.Covered = interval
+	}
+	return detail
+}
+
+// QueryChecked returns the observed rate of the given key over the given
+// interval, as Query does, along with an error wrapping ErrInsufficientData
+// if the data it was computed from covers less than the interval, as when
+// it reaches past the history retained or covers less than a second. The
+// rate is returned either way. If s isn't a DetailedQuerier, its coverage
+// can't be known, and no error is returned.
+func QueryChecked(s RateSketch, key []byte, interval time.Duration) (float64, error) {
+	q, ok := s.(DetailedQuerier)
+	if !ok {
+		return s.Query(key, interval), nil
+	}
+	detail := q.QueryDetailed(key, interval)
+	if detail.Covered < interval {
+		return detail.Rate, fmt.Errorf("%w: data covers %s of the %s asked for", ErrInsufficientData, detail.Covered, interval)
+	}
+	return detail.Rate, nil
+}
+
+// A RangeQuerier returns rates over windows in the past.
+type RangeQuerier interface {
+	QueryBetween(key []byte, from, to time.Time) float64
+	QueryOffset(key []byte, window, offset time.Duration) float64
+}
+
+// QueryBetween returns the observed rate of the given key between from and
+// to, which may lie wholly in the past, or NaN if s isn't a RangeQuerier.
+func QueryBetween(s RateSketch, key []byte, from, to time.Time) float64 {
+	if q, ok := s.(RangeQuerier); ok {
+		return q.QueryBetween(key, from, to)
+	}
+	return math.NaN()
+}
+
+// QueryOffset returns the observed rate of the given key over the window
+// that ended offset ago. If s isn't a RangeQuerier, it returns Query's rate
+// for an offset of 0, and NaN otherwise.
+func QueryOffset(s RateSketch, key []byte, window, offset time.Duration) float64 {
+	if q, ok := s.(RangeQuerier); ok {
+		return q.QueryOffset(key, window, offset)
+	}
+	if offset == 0 {
+		return s.Query(key, window)
+	}
+	return math.NaN()
+}
+
+// A BaselineQuerier compares rates with those a day and a week ago.
+type BaselineQuerier interface {
+	VsBaseline(key []byte, window time.Duration) float64
+}
+
+// VsBaseline returns the ratio of the key's rate over the last window to
+// its rate over the same window one day and one week ago, or NaN if s isn't
+// a BaselineQuerier.
+func VsBaseline(s RateSketch, key []byte, window time.Duration) float64 {
+	if q, ok := s.(BaselineQuerier); ok {
+		return q.VsBaseline(key, window)
+	}
+	return math.NaN()
+}
+
+// A Forecaster predicts rates.
+type Forecaster interface {
+	Forecast(key []byte, horizon time.Duration) float64
+}
+
+// Forecast predicts the key's rate horizon from now, by extrapolating the
+// trend of its rate in each retained bucket, or returns NaN if s isn't a
+// Forecaster.
+func Forecast(s RateSketch, key []byte, horizon time.Duration) float64 {
+	if f, ok := s.(Forecaster); ok {
+		return f.Forecast(key, horizon)
+	}
+	return math.NaN()
+}
+
+// A RateClasser maps rates into classes it was configured with.
+type RateClasser interface {
+	RateClass(key []byte, interval time.Duration) int
+}
+
+// RateClass returns the class of the key's rate over the given interval,
+// from RateIdle to RateExtreme (see WithRateClasses). If s isn't a
+// RateClasser, the rate is classed with the default classes.
+func RateClass(s RateSketch, key []byte, interval time.Duration) int {
+	if c, ok := s.(RateClasser); ok {
+		return c.RateClass(key, interval)
+	}
+	return (*rateClasses)(nil).class(s.Query(key, interval))
+}
+
+// A NoveltyCounter reports whether the keys it counts are new.
+type NoveltyCounter interface {
+	CountAndCheckNew(key []byte, delta int, interval time.Duration) (rate float64, isNew bool)
+}
+
+// CountAndCheckNew records delta occurrences of key as Count does, and also
+// reports whether the key had not been seen in any retained bucket. If s
+// isn't a NoveltyCounter, no key is reported as new.
+func CountAndCheckNew(s RateSketch, key []byte, delta int, interval time.Duration) (rate float64, isNew bool) {
+	if c, ok := s.(NoveltyCounter); ok {
+		return c.CountAndCheckNew(key, delta, interval)
+	}
+	return s.Count(key, delta, interval), false
+}
+
+// A Forgetter removes keys' counts.
+type Forgetter interface {
+	Forget(key []byte)
+}
+
+// Forget removes, as far as it can, every occurrence of the given key from
+// the retained buckets of s, so that its rate drops to 0. Keys that collide
+// with it may be underestimated afterwards. It does nothing if s isn't a
+// Forgetter.
+func Forget(s RateSketch, key []byte) {
+	if f, ok := s.(Forgetter); ok {
+		f.Forget(key)
+	}
+}
+
+// A Roller starts new buckets on demand.
+type Roller interface {
+	Rollover()
+}
+
+// Rollover closes the current bucket of s and starts a new one, even if the
+// current bucket's interval hasn't elapsed. It does nothing if s isn't a
+// Roller.
+func Rollover(s RateSketch) {
+	if r, ok := s.(Roller); ok {
+		r.Rollover()
+	}
+}
+
+// A StatsReporter describes its state.
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// StatsOf describes the current state of s, or returns zero Stats if s
+// isn't a StatsReporter.
+func StatsOf(s RateSketch) Stats {
+	if r, ok := s.(StatsReporter); ok {
+		return r.Stats()
+	}
+	return Stats{}
+}
+
+// A PopulationEstimator estimates the number and similarity of the keys it
+// has counted.
+type PopulationEstimator interface {
+	DistinctKeys(interval time.Duration) float64
+	Overlap(w1, w2 time.Duration) float64
+}
+
+// DistinctKeys returns the estimated number of distinct keys counted by s
+// over the given interval: that is, the number of keys active in the
+// interval, such as concurrent sessions. It returns NaN if s isn't a
+// PopulationEstimator.
+func DistinctKeys(s RateSketch, interval time.Duration) float64 {
+	if e, ok := s.(PopulationEstimator); ok {
+		return e.DistinctKeys(interval)
+	}
+	return math.NaN()
+}
+
+// Overlap estimates the similarity, between 0 and 1, of the sets of keys
+// counted by s over the last w1 and over the w2 before that. It returns NaN
+// if s isn't a PopulationEstimator.
+func Overlap(s RateSketch, w1, w2 time.Duration) float64 {
+	if e, ok := s.(PopulationEstimator); ok {
+		return e.Overlap(w1, w2)
+	}
+	return math.NaN()
+}
@@ -0,0 +1,93 @@
+package sketchy
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// minimalSketch implements RateSketch and none of the optional interfaces.
+type minimalSketch struct {
+	counts map[string]int
+}
+
+func (m *minimalSketch) Count(key []byte, delta int, interval time.Duration) float64 {
+	m.counts[string(key)] += delta
+	return m.Query(key, interval)
+}
+
+func (m *minimalSketch) Query(key []byte, interval time.Duration) float64 {
+	if interval < time.Second {
+		return 0
+	}
+	return float64(m.counts[string(key)]) / interval.Seconds()
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	Convey("The package's counters implement every optional interface", t, func() {
+		for _, counter := range []RateSketch{
+			RollingCounter(0, 0, time.Minute, 10),
+			RollupCounter(0, 0, time.Minute, time.Hour),
+			NewShardedRateSketch(RollingCounter(0, 0, time.Minute, 10)),
+		} {
+			So(counter, ShouldImplement, (*Adder)(nil))
+			So(counter, ShouldImplement, (*HandleCounter)(nil))
+			So(counter, ShouldImplement, (*Uint64Counter)(nil))
+			So(counter, ShouldImplement, (*SmoothedQuerier)(nil))
+			So(counter, ShouldImplement, (*DetailedQuerier)(nil))
+			So(counter, ShouldImplement, (*RangeQuerier)(nil))
+			So(counter, ShouldImplement, (*BaselineQuerier)(nil))
+			So(counter, ShouldImplement, (*Forecaster)(nil))
+			So(counter, ShouldImplement, (*RateClasser)(nil))
+			So(counter, ShouldImplement, (*NoveltyCounter)(nil))
+			So(counter, ShouldImplement, (*Forgetter)(nil))
+			So(counter, ShouldImplement, (*Roller)(nil))
+			So(counter, ShouldImplement, (*StatsReporter)(nil))
+			So(counter, ShouldImplement, (*PopulationEstimator)(nil))
+		}
+	})
+
+	Convey("Other RateSketches fall back to Count and Query", t, func() {
+		m := &minimalSketch{counts: map[string]int{}}
+		key := []byte("key")
+
+		Add(m, key, 60)
+		So(m.counts["key"], ShouldEqual, 60)
+		So(CountHandle(m, Prehash(key), 60, time.Minute), ShouldEqual, 2)
+		So(QueryHandle(m, Prehash(key), time.Minute), ShouldEqual, 2)
+		So(func() { CountHandle(m, CompositeKey(key), 1, time.Minute) }, ShouldPanic)
+
+		CountUint64(m, 7, 30, 0)
+		So(QueryUint64(m, 7, time.Minute), ShouldEqual, 0.5)
+		So(m.counts["\x00\x00\x00\x00\x00\x00\x00\x07"], ShouldEqual, 30)
+
+		So(QueryDetailed(m, key, time.Minute), ShouldResemble, QueryDetail{Rate: 2, Covered: time.Minute, Events: 120})
+		rate, err := QueryChecked(m, key, time.Minute)
+		So(rate, ShouldEqual, 2)
+		So(err, ShouldBeNil)
+		So(QueryOffset(m, key, time.Minute, 0), ShouldEqual, 2)
+		So(RateClass(m, key, time.Minute), ShouldEqual, RateLow)
+		rate, isNew := CountAndCheckNew(m, key, 0, time.Minute)
+		So(rate, ShouldEqual, 2)
+		So(isNew, ShouldBeFalse)
+
+		for _, v := range []float64{
+			QuerySmoothed(m, key, 3, Boxcar),
+			QueryBetween(m, key, time.Now().Add(-time.Minute), time.Now()),
+			QueryOffset(m, key, time.Minute, time.Minute),
+			VsBaseline(m, key, time.Minute),
+			Forecast(m, key, time.Minute),
+			DistinctKeys(m, time.Minute),
+			Overlap(m, time.Minute, time.Minute),
+		} {
+			So(math.IsNaN(v), ShouldBeTrue)
+		}
+
+		Forget(m, key)
+		Rollover(m)
+		So(m.counts["key"], ShouldEqual, 120)
+		So(StatsOf(m), ShouldResemble, Stats{})
+	})
+}
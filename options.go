@@ -0,0 +1,283 @@
+package sketchy
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An Option configures optional behavior of a rate counter. Options are
+// passed to the New methods of RollingParams and RollupParams, or to Build.
+type Option func(*options)
+
+type options struct {
+	hooks      *InstrumentationHooks
+	logger     *slog.Logger
+	sampleRate float64
+	sampler    *adaptiveSampler
+
+	maxRestoredAge  time.Duration
+	calendar        *time.Location
+	cache           *queryCache
+	precheck        *rollingBloom
+	tuning          *tuning
+	dict            *KeyDictionary
+	clock           func() time.Time
+	privacy         *privacy
+	pseudonyms      *Pseudonymizer
+	paramsPolicy    ParamsPolicy
+	layout          Layout
+	conservative    bool
+	random          *lockedRand
+	classes         *rateClasses
+	classChanges    *classWatch
+	lateness        time.Duration
+	completeWindows bool
+	onLate          func(key []byte, bucket time.Time, delta int)
+	dedupe          *rollingBloom
+	dedupeWindow    time.Duration
+	interpolation   Interpolation
+}
+
+// WithLogger makes a counter log significant events, such as bucket
+// rotations and rejected encodings, to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithSampleRate tells a counter that the events given to Count were sampled
+// upstream with probability p, which must be in (0, 1]. Each call to Count
+// records delta/p occurrences in expectation, rounding randomly to a whole
+// number, so that rates reflect the unsampled traffic.
+func WithSampleRate(p float64) Option {
+	if !(p > 0 && p <= 1) {
+		panic(fmt.Sprintf("sketchy: sample rate %v is not in (0, 1]", p))
+	}
+	return func(o *options) { o.sampleRate = p }
+}
+
+// WithAdaptiveSampling bounds the rate at which a counter applies calls to
+// Count. Once calls arrive faster than maxPerSecond, the counter samples them,
+// recording only a fraction and scaling those up to compensate (as with
+// WithSampleRate). Rates become noisier under overload, but the work done
+// per second stays bounded. Calls that aren't applied still return the
+// key's current rate.
+func WithAdaptiveSampling(maxPerSecond float64) Option {
+	if !(maxPerSecond > 0) {
+		panic(fmt.Sprintf("sketchy: adaptive sampling limit %v is not positive", maxPerSecond))
+	}
+	return func(o *options) {
+		o.sampler = &adaptiveSampler{limit: maxPerSecond, p: math.Float64bits(1)}
+	}
+}
+
+// WithSeed makes a counter draw the random choices of sampling, with
+// WithSampleRate and WithAdaptiveSampling, from seed rather than from the
+// shared random source, so that tests and simulations of sampled counters
+// are reproducible. Counters with the same seed, given the same calls in the
+// same order, count the same. Hashing is deterministic already, and noise
+// from WithPrivacy is drawn from its own seed.
+func WithSeed(seed int64) Option {
+	return func(o *options) { o.random = &lockedRand{r: rand.New(rand.NewSource(seed))} }
+}
+
+// lockedRand is a rand.Rand that is safe for concurrent use.
+type lockedRand struct {
+	m sync.Mutex
+	r *rand.Rand
+}
+
+// float64 returns a random number in [0, 1) from r, or from the shared
+// random source if r is nil.
+func (r *lockedRand) float64() float64 {
+	if r == nil {
+		return rand.Float64()
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.r.Float64()
+}
+
+// WithMaxRestoredAge makes a counter discard buckets that ended more than
+// age ago when it is restored with GobDecode, so that rates after restoring
+// an old snapshot aren't computed from stale data. The age must be positive.
+func WithMaxRestoredAge(age time.Duration) Option {
+	if age <= 0 {
+		panic(fmt.Sprintf("sketchy: max restored age %s is not positive", age))
+	}
+	return func(o *options) { o.maxRestoredAge = age }
+}
+
+// WithCalendar aligns a counter's daily and weekly buckets to the calendar
+// in loc. Buckets with an interval of 24 hours start at midnight, and
+// buckets with an interval of a week start at midnight on Monday, so that
+// they match daily and weekly reports even across daylight saving changes.
+// The first bucket starts at the preceding boundary. Buckets of other
+// intervals, such as the finer levels of a RollupCounter, are unaffected.
+func WithCalendar(loc *time.Location) Option {
+	return func(o *options) { o.calendar = loc }
+}
+
+// WithClock makes a counter read the time from clock rather than time.Now,
+// for simulations, replaying traces and tests.
+func WithClock(clock func() time.Time) Option {
+	return func(o *options) { o.clock = clock }
+}
+
+// adaptiveSampler chooses a sampling probability once per second, from the
+// rate of calls observed over the previous second. Calls within the current
+// second only count themselves and read the probability; the lock is taken
+// to choose the next one.
+type adaptiveSampler struct {
+	limit float64
+
+	p      uint64 // math.Float64bits of the probability
+	window int64  // start of the current second, in Unix nanoseconds
+	calls  uint64 // calls since window
+
+	m sync.Mutex // held to start a new window
+}
+
+func (s *adaptiveSampler) probability(now time.Time) float64 {
+	t := now.UnixNano()
+	if s.current(t - atomic.LoadInt64(&s.window)) {
+		atomic.AddUint64(&s.calls, 1)
+		return math.Float64frombits(atomic.LoadUint64(&s.p))
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	window := atomic.LoadInt64(&s.window)
+	if elapsed := t - window; !s.current(elapsed) {
+		if elapsed > 0 && window != 0 {
+			rate := float64(atomic.LoadUint64(&s.calls)) / time.Duration(elapsed).Seconds()
+			atomic.StoreUint64(&s.p, math.Float64bits(math.Min(1, s.limit/rate)))
+		}
+		atomic.StoreUint64(&s.calls, 0)
+		atomic.StoreInt64(&s.window, t)
+	}
+	atomic.AddUint64(&s.calls, 1)
+	return math.Float64frombits(atomic.LoadUint64(&s.p))
+}
+
+// current reports whether a call elapsed after the start of the window
+// falls within it. Concurrent callers may read the clock slightly out of
+// order, so a call up to a second before the window's start is taken to
+// belong to it too; one further back means the clock was set back.
+func (*adaptiveSampler) current(elapsed int64) bool {
+	return elapsed < int64(time.Second) && elapsed > -int64(time.Second)
+}
+
+// scale corrects delta for sampling, both upstream and by the adaptive
+// sampler. It returns false if this call shouldn't be applied at all.
+func (o *options) scale(delta int, now time.Time) (int, bool) {
+	p := 1.0
+	if o.sampleRate != 0 {
+		p = o.sampleRate
+	}
+	if o.sampler != nil {
+		q := o.sampler.probability(now)
+		if q < 1 && o.random.float64() >= q {
+			return 0, false
+		}
+		p *= q
+	}
+	if p == 1 {
+		return delta, true
+	}
+	n, frac := math.Modf(float64(delta) / p)
+	if o.random.float64() < math.Abs(frac) {
+		n += math.Copysign(1, frac)
+	}
+	return int(n), true
+}
+
+func (o *options) rotated(interval time.Duration, start time.Time) {
+	o.hooks.rotated(interval, start)
+	if o.logger != nil {
+		o.logger.Debug("sketchy: started new bucket", "interval", interval, "start", start)
+	}
+}
+
+func (o *options) snapshot(size int, err error) {
+	o.hooks.snapshot(size, err)
+	if o.logger != nil && err != nil {
+		o.logger.Error("sketchy: snapshot failed", "error", err)
+	}
+}
+
+func (o *options) merged(n int, err error) {
+	o.hooks.merged(n, err)
+	if o.logger != nil && err != nil {
+		o.logger.Error("sketchy: merge failed", "error", err)
+	}
+}
+
+func (o *options) decodeRejected(err error) {
+	if o.logger != nil {
+		o.logger.Warn("sketchy: rejected encoding", "error", err)
+	}
+}
+
+// lock acquires m, reporting the time spent waiting for it to the hooks.
+func (o *options) lock(m *sync.Mutex) {
+	if o.hooks == nil || o.hooks.OnLockWait == nil {
+		m.Lock()
+		return
+	}
+	start := time.Now()
+	m.Lock()
+	o.hooks.OnLockWait(time.Since(start))
+}
+
+// calendarDays returns the number of days in each calendar-aligned bucket of
+// the given interval, or 0 if such buckets aren't aligned to the calendar.
+func (o *options) calendarDays(interval time.Duration) int {
+	if o.calendar == nil {
+		return 0
+	}
+	switch interval {
+	case 24 * time.Hour:
+		return 1
+	case 7 * 24 * time.Hour:
+		return 7
+	}
+	return 0
+}
+
+// bucketStart returns the start of a bucket of the given interval that is
+// started at now.
+func (o *options) bucketStart(now time.Time, interval time.Duration) time.Time {
+	days := o.calendarDays(interval)
+	if days == 0 {
+		return now
+	}
+	t := now.In(o.calendar)
+	y, m, d := t.Date()
+	if days == 7 {
+		d -= (int(t.Weekday()) + 6) % 7
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, o.calendar)
+}
+
+// due reports whether a new bucket must be started at now, given the start
+// of the latest bucket.
+func (o *options) due(latest, now time.Time, interval time.Duration) bool {
+	if o.calendarDays(interval) == 0 {
+		return now.Sub(latest) >= interval
+	}
+	return o.bucketStart(now, interval).After(latest)
+}
@@ -0,0 +1,275 @@
+package sketchy
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithLogger(t *testing.T) {
+	Convey("Counters log rotations and rejected encodings", t, func() {
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		now := time.Now()
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 2}.New(
+			WithLogger(logger)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		counter.Count([]byte("key"), 1, 0)
+		So(buf.String(), ShouldContainSubstring, "started new bucket")
+		So(buf.String(), ShouldContainSubstring, "interval=1m0s")
+
+		buf.Reset()
+		So(counter.GobDecode([]byte("garbage")), ShouldNotBeNil)
+		So(buf.String(), ShouldContainSubstring, "level=WARN")
+		So(buf.String(), ShouldContainSubstring, "rejected encoding")
+	})
+}
+
+func TestWithSampleRate(t *testing.T) {
+	key := []byte("key")
+	now := time.Now()
+
+	Convey("Sampled counts are scaled up in expectation", t, func() {
+		counter := RollingParams{Interval: time.Hour, NumIntervals: 1}.New(
+			WithSampleRate(0.3)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		for i := 0; i < 3000; i++ {
+			counter.Count(key, 1, 0)
+		}
+		now = now.Add(100 * time.Second)
+		So(counter.Query(key, time.Hour), ShouldAlmostEqual, 100, 5)
+	})
+
+	Convey("Whole multiples are scaled exactly", t, func() {
+		counter := RollupParams{Durations: []time.Duration{time.Minute, time.Hour}}.New(
+			WithSampleRate(0.5)).(*rollupCounter)
+		counter.clock = func() time.Time { return now }
+		counter.Count(key, 3, 0)
+		So(counter.Levels[0].loadBuckets()[0].Query(key), ShouldEqual, 6)
+	})
+
+	Convey("Seeded counters sample the same way", t, func() {
+		counts := map[uint64]int{}
+		for i := 0; i < 10; i++ {
+			seed := int64(i % 2)
+			counter := RollingParams{Interval: time.Hour, NumIntervals: 1}.New(
+				WithSampleRate(0.3), WithSeed(seed), WithClock(func() time.Time { return now }))
+			for j := 0; j < 100; j++ {
+				counter.Count(key, 1, 0)
+			}
+			counts[counter.(*rollingCounter).loadBuckets()[0].Query(key)]++
+		}
+		// five counters with each seed
+		So(len(counts), ShouldEqual, 2)
+		for _, n := range counts {
+			So(n, ShouldEqual, 5)
+		}
+	})
+
+	Convey("Sample rates outside (0, 1] are rejected", t, func() {
+		So(func() { WithSampleRate(0) }, ShouldPanic)
+		So(func() { WithSampleRate(1.5) }, ShouldPanic)
+	})
+}
+
+func TestWithAdaptiveSampling(t *testing.T) {
+	key := []byte("key")
+	now := time.Now()
+
+	Convey("Counters sample calls beyond the configured rate", t, func() {
+		applied := 0
+		counter := RollingParams{Interval: time.Hour, NumIntervals: 2}.New(
+			WithAdaptiveSampling(100),
+			WithHooks(&InstrumentationHooks{OnLockWait: func(time.Duration) { applied++ }}),
+		).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		// 1000 calls per second for 10 seconds
+		for i := 0; i < 10000; i++ {
+			counter.Count(key, 1, 0)
+			now = now.Add(time.Millisecond)
+		}
+
+		// the first second is applied in full, the rest at about 10%
+		So(applied, ShouldAlmostEqual, 1000+900, 150)
+		So(counter.Query(key, time.Hour), ShouldAlmostEqual, 1000, 100)
+
+		Convey("and stop sampling when the load subsides", func() {
+			now = now.Add(time.Hour)
+			for i := 0; i < 200; i++ {
+				counter.Count(key, 1, 0)
+				now = now.Add(20 * time.Millisecond)
+			}
+			applied = 0
+			for i := 0; i < 50; i++ {
+				counter.Count(key, 1, 0)
+				now = now.Add(20 * time.Millisecond)
+			}
+			So(applied, ShouldEqual, 50)
+		})
+	})
+
+	Convey("Counters given the same option sample independently", t, func() {
+		applied := map[string]int{}
+		sampling := WithAdaptiveSampling(100)
+		newCounter := func(name string) RateSketch {
+			return RollingParams{Interval: time.Hour, NumIntervals: 2}.New(
+				sampling,
+				WithHooks(&InstrumentationHooks{OnLockWait: func(time.Duration) { applied[name]++ }}),
+				WithClock(func() time.Time { return now }),
+			)
+		}
+		busy, quiet := newCounter("busy"), newCounter("quiet")
+
+		for i := 0; i < 3000; i++ {
+			busy.Count(key, 1, 0)
+			if i%20 == 0 {
+				quiet.Count(key, 1, 0)
+			}
+			now = now.Add(time.Millisecond)
+		}
+
+		So(applied["busy"], ShouldBeLessThan, 1500)
+		So(applied["quiet"], ShouldEqual, 150)
+	})
+
+	Convey("Non-positive limits are rejected", t, func() {
+		So(func() { WithAdaptiveSampling(0) }, ShouldPanic)
+	})
+}
+
+func TestWithMaxRestoredAge(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	Convey("Restored counters discard stale buckets", t, func() {
+		src := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		src.clock = func() time.Time { return now }
+		for i := 0; i < 5; i++ {
+			src.Count(key, 60, 0)
+			now = now.Add(time.Minute)
+		}
+		snapshotTime := now
+		data, err := encode(src)
+		So(err, ShouldBeNil)
+
+		// two hours later, only the first bucket ended too long ago
+		now = now.Add(2 * time.Hour)
+		dst := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(
+			WithMaxRestoredAge(2*time.Hour + 3*time.Minute + 30*time.Second)).(*rollingCounter)
+		dst.clock = func() time.Time { return now }
+		So(decode(dst, data), ShouldBeNil)
+		So(len(dst.loadBuckets()), ShouldEqual, 4)
+		So(dst.Stats().Restored.Equal(snapshotTime), ShouldBeTrue)
+
+		// counters without the option keep everything
+		all := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		So(decode(all, data), ShouldBeNil)
+		So(len(all.loadBuckets()), ShouldEqual, 5)
+		So(StatsOf(RollingCounter(0, 0, time.Minute, 10)).Restored.IsZero(), ShouldBeTrue)
+	})
+
+	Convey("Rollup levels apply the policy as they are decoded", t, func() {
+		src := RollupCounter(0, 0, time.Minute, time.Hour, 24*time.Hour).(*rollupCounter)
+		src.clock = func() time.Time { return now }
+		src.Count(key, 60, 0)
+		data, err := encode(src)
+		So(err, ShouldBeNil)
+
+		now = now.Add(2 * time.Hour)
+		dst := RollupParams{Durations: []time.Duration{time.Minute, time.Hour, 24 * time.Hour}}.New(
+			WithMaxRestoredAge(90 * time.Minute)).(*rollupCounter)
+		for _, c := range dst.Levels {
+			c.clock = func() time.Time { return now }
+		}
+		So(decode(dst, data), ShouldBeNil)
+		So(len(dst.Levels[0].loadBuckets()), ShouldEqual, 0)
+		So(len(dst.Levels[1].loadBuckets()), ShouldEqual, 1)
+		So(dst.Stats().Restored.IsZero(), ShouldBeFalse)
+	})
+
+	Convey("Non-positive ages are rejected", t, func() {
+		So(func() { WithMaxRestoredAge(0) }, ShouldPanic)
+	})
+}
+
+func TestWithClock(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	Convey("Counters read the time from the given clock", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 2}.New(WithClock(clock))
+		rollup := RollupParams{Durations: []time.Duration{time.Minute, time.Hour}}.New(WithClock(clock))
+		for _, c := range []RateSketch{counter, rollup} {
+			c.Count([]byte("key"), 60, 0)
+			So(StatsOf(c).Buckets[0].Start, ShouldEqual, now)
+		}
+		now = now.Add(time.Minute)
+		So(counter.Query([]byte("key"), time.Minute), ShouldEqual, 1)
+		So(rollup.Query([]byte("key"), time.Minute), ShouldEqual, 1)
+	})
+}
+
+func TestWithCalendar(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	key := []byte("key")
+
+	Convey("Daily buckets start at local midnight across DST changes", t, func() {
+		// clocks go forward at 2am on 2017-03-12, so that day has 23 hours
+		now := time.Date(2017, 3, 11, 15, 0, 0, 0, loc)
+		counter := RollingParams{Interval: 24 * time.Hour, NumIntervals: 7}.New(
+			WithCalendar(loc)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		var starts []time.Time
+		for i := 0; i < 4; i++ {
+			counter.Count(key, 1, 0)
+			now = now.Add(12 * time.Hour)
+		}
+		for _, b := range counter.loadBuckets() {
+			starts = append(starts, b.Time)
+		}
+		So(starts, ShouldHaveLength, 3)
+		So(starts[0].Equal(time.Date(2017, 3, 11, 0, 0, 0, 0, loc)), ShouldBeTrue)
+		So(starts[1].Equal(time.Date(2017, 3, 12, 0, 0, 0, 0, loc)), ShouldBeTrue)
+		So(starts[2].Equal(time.Date(2017, 3, 13, 0, 0, 0, 0, loc)), ShouldBeTrue)
+		So(starts[2].Sub(starts[1]), ShouldEqual, 23*time.Hour)
+	})
+
+	Convey("Weekly buckets start at midnight on Monday", t, func() {
+		now := time.Date(2017, 3, 16, 9, 0, 0, 0, loc) // a Thursday
+		counter := RollingParams{Interval: 7 * 24 * time.Hour, NumIntervals: 4}.New(
+			WithCalendar(loc)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		counter.Count(key, 1, 0)
+		now = time.Date(2017, 3, 19, 23, 0, 0, 0, loc)
+		counter.Count(key, 1, 0)
+		now = time.Date(2017, 3, 20, 1, 0, 0, 0, loc)
+		counter.Count(key, 1, 0)
+
+		buckets := counter.loadBuckets()
+		So(buckets, ShouldHaveLength, 2)
+		So(buckets[0].Time.Equal(time.Date(2017, 3, 13, 0, 0, 0, 0, loc)), ShouldBeTrue)
+		So(buckets[1].Time.Equal(time.Date(2017, 3, 20, 0, 0, 0, 0, loc)), ShouldBeTrue)
+	})
+
+	Convey("Only daily and weekly rollup levels are aligned", t, func() {
+		now := time.Date(2017, 3, 11, 15, 30, 0, 0, loc)
+		rollup := RollupParams{Durations: []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}}.New(
+			WithCalendar(loc)).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		rollup.Count(key, 1, 0)
+
+		So(rollup.Levels[0].loadBuckets()[0].Time.Equal(now), ShouldBeTrue)
+		So(rollup.Levels[1].loadBuckets()[0].Time.Equal(time.Date(2017, 3, 11, 0, 0, 0, 0, loc)), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,122 @@
+package sketchy
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// minHashBins is the number of bins in a minHash signature. Similarities
+// estimated from 128 bins have a standard error of at most about 0.045.
+const minHashBins = 128
+
+// minHash is a one-permutation MinHash signature
+// (https://en.wikipedia.org/wiki/MinHash), keeping the minimum hash of the
+// keys that fall into each bin. An empty bin holds math.MaxUint64. Like an
+// hll, a minHash must have a single writer.
+type minHash []uint64
+
+func newMinHash() minHash {
+	h := make(minHash, minHashBins)
+	for i := range h {
+		h[i] = math.MaxUint64
+	}
+	return h
+}
+
+// add records an observation of the key with the given hash.
+func (h minHash) add(k hashKernel) {
+	x := mix64(uint64(k))
+	bin := &h[x%minHashBins]
+	if x < atomic.LoadUint64(bin) {
+		atomic.StoreUint64(bin, x)
+	}
+}
+
+// union returns a new signature of every key observed by h or o.
+func (h minHash) union(o minHash) minHash {
+	u := make(minHash, minHashBins)
+	for i := range u {
+		u[i] = atomic.LoadUint64(&h[i])
+		if o != nil {
+			if v := atomic.LoadUint64(&o[i]); v < u[i] {
+				u[i] = v
+			}
+		}
+	}
+	return u
+}
+
+// similarity estimates the Jaccard similarity of the keys observed by h and
+// o. It returns 0 if either is empty.
+func (h minHash) similarity(o minHash) float64 {
+	if h == nil || o == nil {
+		return 0
+	}
+	var (
+		same, used     int
+		hEmpty, oEmpty = true, true
+	)
+	for i := range h {
+		a, b := atomic.LoadUint64(&h[i]), atomic.LoadUint64(&o[i])
+		hEmpty = hEmpty && a == math.MaxUint64
+		oEmpty = oEmpty && b == math.MaxUint64
+		if a == math.MaxUint64 && b == math.MaxUint64 {
+			continue
+		}
+		used++
+		if a == b {
+			same++
+		}
+	}
+	if hEmpty || oEmpty {
+		return 0
+	}
+	return float64(same) / float64(used)
+}
+
+// signatures returns the signatures of the keys counted over the last w1
+// before now, and over the w2 before that. Buckets are assigned wholly to
+// one window or the other. It doesn't lock the counter.
+func (rl *rollingCounter) signatures(now time.Time, w1, w2 time.Duration) (recent, previous minHash) {
+	union := func(buckets []sketchWithTime) minHash {
+		var u minHash
+		for _, b := range buckets {
+			if b.Signature != nil {
+				u = b.Signature.union(u)
+			}
+		}
+		return u
+	}
+
+	buckets := rl.loadBuckets()
+	i := window(buckets, now, w1)
+	recent = union(buckets[i:])
+	if i < len(buckets) {
+		now = buckets[i].Time
+		buckets = buckets[:i]
+		previous = union(buckets[window(buckets, now, w2):])
+	}
+	return recent, previous
+}
+
+// Overlap estimates the Jaccard similarity, between 0 and 1, of the sets of
+// keys counted over the last w1 and over the w2 before that. Windows are
+// rounded out to whole buckets. A sudden drop indicates that the population
+// of keys has changed. If either window has no keys, 0 is returned.
+func (rl *rollingCounter) Overlap(w1, w2 time.Duration) float64 {
+	recent, previous := rl.signatures(rl.now(), w1, w2)
+	return recent.similarity(previous)
+}
+
+// Overlap estimates the Jaccard similarity, between 0 and 1, of the sets of
+// keys counted over the last w1 and over the w2 before that, using the
+// finest level that retains both windows. Windows are rounded out to whole
+// buckets. If either window has no keys, 0 is returned.
+func (rc *rollupCounter) Overlap(w1, w2 time.Duration) float64 {
+	if len(rc.Levels) == 0 {
+		return 0
+	}
+	recent, previous := rc.covering(w1+w2).signatures(rc.now(), w1, w2)
+	return recent.similarity(previous)
+}
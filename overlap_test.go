@@ -0,0 +1,63 @@
+package sketchy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOverlap(t *testing.T) {
+	now := time.Now()
+
+	Convey("MinHash signatures estimate Jaccard similarity", t, func() {
+		a, b := newMinHash(), newMinHash()
+		So(a.similarity(b), ShouldEqual, 0)
+		for i := 0; i < 10000; i++ {
+			a.add(multihash([]byte(fmt.Sprintf("key%d", i))))
+			b.add(multihash([]byte(fmt.Sprintf("key%d", i+5000))))
+		}
+		So(a.similarity(a), ShouldEqual, 1)
+		So(a.similarity(b), ShouldAlmostEqual, 1.0/3, 0.15)
+		So(a.similarity(newMinHash()), ShouldEqual, 0)
+		So(a.union(b).similarity(a), ShouldAlmostEqual, 2.0/3, 0.15)
+	})
+
+	Convey("Rolling counters compare adjacent windows", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		So(counter.Overlap(time.Minute, time.Minute), ShouldEqual, 0)
+
+		for m := 0; m < 6; m++ {
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key%d", i)
+				if m == 5 {
+					key = fmt.Sprintf("new%d", i)
+				}
+				counter.Count([]byte(key), 1, 0)
+			}
+			now = now.Add(time.Minute)
+		}
+
+		So(counter.Overlap(0, time.Minute), ShouldEqual, 0)
+		So(counter.Overlap(time.Minute, 0), ShouldEqual, 0)
+		So(counter.Overlap(time.Minute, time.Minute), ShouldBeLessThan, 0.1)
+		So(counter.Overlap(2*time.Minute, time.Minute), ShouldAlmostEqual, 0.5, 0.15)
+		So(counter.Overlap(2*time.Minute, 3*time.Minute), ShouldAlmostEqual, 0.5, 0.15)
+		So(counter.Overlap(time.Hour, time.Minute), ShouldEqual, 0)
+	})
+
+	Convey("Rollup counters use the finest level covering both windows", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, 5*time.Minute, time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		for m := 0; m < 20; m++ {
+			for i := 0; i < 100; i++ {
+				rollup.Count([]byte(fmt.Sprintf("key%d", i)), 1, 0)
+			}
+			now = now.Add(time.Minute)
+		}
+		So(rollup.Overlap(time.Minute, time.Minute), ShouldBeGreaterThan, 0.9)
+		So(rollup.Overlap(10*time.Minute, 10*time.Minute), ShouldBeGreaterThan, 0.9)
+	})
+}
@@ -0,0 +1,55 @@
+package sketchy
+
+import "time"
+
+// A PairTracker counts events by client and endpoint, for spotting the
+// common two-dimensional abuse pattern of one client hammering one endpoint,
+// or one endpoint drawing traffic from many clients. It keeps the rate of
+// each (client, endpoint) pair, of each client across all endpoints, and of
+// each endpoint across all clients, in three separate counters so that the
+// marginal rates don't collide with the pairs.
+type PairTracker struct {
+	pairs     RateSketch
+	clients   RateSketch
+	endpoints RateSketch
+}
+
+// NewPairTracker returns a PairTracker that records each pair in pairs, and
+// the totals of each client and each endpoint in clients and endpoints. The
+// three counters should normally have the same parameters.
+func NewPairTracker(pairs, clients, endpoints RateSketch) *PairTracker {
+	return &PairTracker{pairs: pairs, clients: clients, endpoints: endpoints}
+}
+
+// Count records delta events by client on endpoint, returning the pair's
+// updated observed rate over the given interval.
+func (t *PairTracker) Count(client, endpoint []byte, delta int, interval time.Duration) float64 {
+	Add(t.clients, client, delta)
+	Add(t.endpoints, endpoint, delta)
+	return CountHandle(t.pairs, CompositeKey(client, endpoint), delta, interval)
+}
+
+// Query returns the observed rate of events by client on endpoint over the
+// given interval.
+func (t *PairTracker) Query(client, endpoint []byte, interval time.Duration) float64 {
+	return QueryHandle(t.pairs, CompositeKey(client, endpoint), interval)
+}
+
+// QueryClient returns the observed rate of events by client on every
+// endpoint over the given interval.
+func (t *PairTracker) QueryClient(client []byte, interval time.Duration) float64 {
+	return t.clients.Query(client, interval)
+}
+
+// QueryEndpoint returns the observed rate of events on endpoint by every
+// client over the given interval.
+func (t *PairTracker) QueryEndpoint(endpoint []byte, interval time.Duration) float64 {
+	return t.endpoints.Query(endpoint, interval)
+}
+
+// Rollover closes the current bucket of every counter and starts new ones.
+func (t *PairTracker) Rollover() {
+	Rollover(t.pairs)
+	Rollover(t.clients)
+	Rollover(t.endpoints)
+}
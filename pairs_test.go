@@ -0,0 +1,38 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPairTracker(t *testing.T) {
+	now := time.Now()
+	newCounter := func() RateSketch {
+		rl := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		rl.clock = func() time.Time { return now }
+		return rl
+	}
+
+	Convey("Pairs are tracked along with each client and endpoint", t, func() {
+		tracker := NewPairTracker(newCounter(), newCounter(), newCounter())
+		alice, bob := []byte("alice"), []byte("bob")
+		login, search := []byte("/login"), []byte("/search")
+
+		tracker.Count(alice, login, 60, 0)
+		tracker.Count(alice, search, 120, 0)
+		tracker.Count(bob, login, 180, 0)
+		now = now.Add(time.Minute)
+
+		So(tracker.Query(alice, login, time.Minute), ShouldEqual, 1)
+		So(tracker.Query(alice, search, time.Minute), ShouldEqual, 2)
+		So(tracker.Query(bob, login, time.Minute), ShouldEqual, 3)
+		So(tracker.Query(bob, search, time.Minute), ShouldEqual, 0)
+
+		So(tracker.QueryClient(alice, time.Minute), ShouldEqual, 3)
+		So(tracker.QueryClient(bob, time.Minute), ShouldEqual, 3)
+		So(tracker.QueryEndpoint(login, time.Minute), ShouldEqual, 4)
+		So(tracker.QueryEndpoint(search, time.Minute), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,262 @@
+package sketchy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SketchParams holds the parameters of a count-min sketch. Its text form is
+// a comma-separated list of key=value pairs, e.g.
+// "epsilon=0.999,delta=0.99,hash=fnv1a". Omitted or zero values take the
+// package defaults.
+//
+// SketchParams implements encoding.TextMarshaler, encoding.TextUnmarshaler
+// and flag.Value, so it can be used directly in config files and flags.
+type SketchParams struct {
+	Epsilon float64
+	Delta   float64
+	Hash    HashVariant
+}
+
+// New returns a new, empty sketch with the given parameters.
+func (p SketchParams) New() CountSketch {
+	cs := NewSketch(p.Epsilon, p.Delta).(*fnvSketch)
+	cs.Variant = p.Hash
+	return cs
+}
+
+// String returns the text form of p.
+func (p SketchParams) String() string {
+	var fields []string
+	if p.Epsilon != 0 {
+		fields = append(fields, "epsilon="+formatFloat(p.Epsilon))
+	}
+	if p.Delta != 0 {
+		fields = append(fields, "delta="+formatFloat(p.Delta))
+	}
+	if p.Hash != FNV1 {
+		fields = append(fields, "hash="+p.Hash.String())
+	}
+	return strings.Join(fields, ",")
+}
+
+// MarshalText returns the text form of p.
+func (p SketchParams) MarshalText() ([]byte, error) { return []byte(p.String()), nil }
+
+// UnmarshalText parses the text form of p.
+func (p *SketchParams) UnmarshalText(text []byte) error { return p.Set(string(text)) }
+
+// Set parses the text form of p.
+func (p *SketchParams) Set(text string) error {
+	var q SketchParams
+	err := parseParams(text, func(k, v string) (bool, error) { return q.set(k, v) }, nil)
+	if err != nil {
+		return err
+	}
+	*p = q
+	return nil
+}
+
+// withDefaults returns p with zero values replaced by the package defaults.
+func (p SketchParams) withDefaults() SketchParams {
+	if p.Epsilon == 0 {
+		p.Epsilon = DefaultEpsilon
+	}
+	if p.Delta == 0 {
+		p.Delta = DefaultDelta
+	}
+	return p
+}
+
+func (p *SketchParams) set(k, v string) (bool, error) {
+	var err error
+	switch k {
+	case "epsilon":
+		p.Epsilon, err = strconv.ParseFloat(v, 64)
+	case "delta":
+		p.Delta, err = strconv.ParseFloat(v, 64)
+	case "hash":
+		p.Hash, err = parseHashVariant(v)
+		return true, err
+	default:
+		return false, nil
+	}
+	if err == nil && !(p.Epsilon >= 0 && p.Epsilon < 1 && p.Delta >= 0 && p.Delta < 1) {
+		err = fmt.Errorf("%s must be in [0, 1)", k)
+	}
+	return true, err
+}
+
+// RollingParams holds the parameters of a RollingCounter. Its text form is a
+// comma-separated list of key=value pairs, e.g. "interval=5m,num=12", which
+// may also include the sketch parameters epsilon, delta and hash.
+type RollingParams struct {
+	SketchParams
+	Interval     time.Duration
+	NumIntervals int
+}
+
+// New returns a new RollingCounter with the given parameters and options.
+func (p RollingParams) New(opts ...Option) RateSketch {
+	rl := RollingCounter(p.Epsilon, p.Delta, p.Interval, p.NumIntervals).(*rollingCounter)
+	rl.Variant = p.Hash
+	rl.options = newOptions(opts)
+	rl.clock = rl.options.clock
+	rl.storeBuckets(nil)
+	return rl
+}
+
+// String returns the text form of p.
+func (p RollingParams) String() string {
+	fields := []string{
+		"interval=" + formatDuration(p.Interval),
+		"num=" + strconv.Itoa(p.NumIntervals),
+	}
+	if s := p.SketchParams.String(); s != "" {
+		fields = append(fields, s)
+	}
+	return strings.Join(fields, ",")
+}
+
+// MarshalText returns the text form of p.
+func (p RollingParams) MarshalText() ([]byte, error) { return []byte(p.String()), nil }
+
+// UnmarshalText parses the text form of p.
+func (p *RollingParams) UnmarshalText(text []byte) error { return p.Set(string(text)) }
+
+// Set parses the text form of p.
+func (p *RollingParams) Set(text string) error {
+	var q RollingParams
+	set := func(k, v string) (bool, error) {
+		var err error
+		switch k {
+		case "interval":
+			q.Interval, err = time.ParseDuration(v)
+		case "num":
+			q.NumIntervals, err = strconv.Atoi(v)
+		default:
+			return q.SketchParams.set(k, v)
+		}
+		return true, err
+	}
+	if err := parseParams(text, set, nil); err != nil {
+		return err
+	}
+	if q.Interval <= 0 || q.NumIntervals <= 0 {
+		return fmt.Errorf("%w: rolling params %q: interval and num must be positive", ErrInvalidParams, text)
+	}
+	*p = q
+	return nil
+}
+
+// RollupParams holds the parameters of a RollupCounter. Its text form is a
+// comma-separated list of at least two durations, e.g. "15m,1h,4h,24h",
+// which may also include the sketch parameters as key=value pairs.
+type RollupParams struct {
+	SketchParams
+	Durations []time.Duration
+}
+
+// New returns a new RollupCounter with the given parameters and options.
+func (p RollupParams) New(opts ...Option) RateSketch {
+	rc := RollupCounter(p.Epsilon, p.Delta, p.Durations...).(*rollupCounter)
+	rc.options = newOptions(opts)
+	rc.clock = rc.options.clock
+	for _, c := range rc.Levels {
+		c.Variant = p.Hash
+		c.storeBuckets(nil)
+		c.clock = rc.clock
+		// levels are decoded individually, so they need the decoding policy
+		c.maxRestoredAge = rc.maxRestoredAge
+		c.paramsPolicy = rc.paramsPolicy
+		c.precheck = rc.precheck
+	}
+	return rc
+}
+
+// String returns the text form of p.
+func (p RollupParams) String() string {
+	fields := make([]string, 0, len(p.Durations)+1)
+	for _, d := range p.Durations {
+		fields = append(fields, formatDuration(d))
+	}
+	if s := p.SketchParams.String(); s != "" {
+		fields = append(fields, s)
+	}
+	return strings.Join(fields, ",")
+}
+
+// MarshalText returns the text form of p.
+func (p RollupParams) MarshalText() ([]byte, error) { return []byte(p.String()), nil }
+
+// UnmarshalText parses the text form of p.
+func (p *RollupParams) UnmarshalText(text []byte) error { return p.Set(string(text)) }
+
+// Set parses the text form of p.
+func (p *RollupParams) Set(text string) error {
+	var q RollupParams
+	bare := func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		if d <= 0 || (len(q.Durations) > 0 && d <= q.Durations[len(q.Durations)-1]) {
+			return fmt.Errorf("durations must be positive and increasing")
+		}
+		q.Durations = append(q.Durations, d)
+		return nil
+	}
+	if err := parseParams(text, q.SketchParams.set, bare); err != nil {
+		return err
+	}
+	if len(q.Durations) < 2 {
+		return fmt.Errorf("%w: rollup params %q: at least two durations are required", ErrInvalidParams, text)
+	}
+	*p = q
+	return nil
+}
+
+// parseParams splits text into comma-separated fields. Fields of the form
+// key=value are passed to set, which reports whether it recognized the key;
+// any other field is passed to bare, if given.
+func parseParams(text string, set func(k, v string) (bool, error), bare func(string) error) error {
+	for _, field := range strings.Split(text, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		var err error
+		if i := strings.IndexByte(field, '='); i >= 0 {
+			k, v := strings.TrimSpace(field[:i]), strings.TrimSpace(field[i+1:])
+			var ok bool
+			if ok, err = set(k, v); err == nil && !ok {
+				err = fmt.Errorf("unknown parameter")
+			}
+		} else if bare != nil {
+			err = bare(field)
+		} else {
+			err = fmt.Errorf("expected key=value")
+		}
+		if err != nil {
+			return fmt.Errorf("%w: parameter %q: %s", ErrInvalidParams, field, err)
+		}
+	}
+	return nil
+}
+
+func formatFloat(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+
+// formatDuration formats d like time.Duration.String, but without trailing
+// zero units ("15m" rather than "15m0s").
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
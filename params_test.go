@@ -0,0 +1,79 @@
+package sketchy
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	_ encoding.TextMarshaler   = SketchParams{}
+	_ encoding.TextUnmarshaler = &RollingParams{}
+	_ flag.Value               = &RollupParams{}
+)
+
+func TestParams(t *testing.T) {
+	Convey("Sketch params", t, func() {
+		var p SketchParams
+		So(p.Set("epsilon=0.99, delta=0.9"), ShouldBeNil)
+		So(p, ShouldResemble, SketchParams{Epsilon: 0.99, Delta: 0.9})
+		So(p.String(), ShouldEqual, "epsilon=0.99,delta=0.9")
+		So(p.New().(*fnvSketch).Width, ShouldEqual, 272)
+
+		So(p.Set("hash=fnv1a"), ShouldBeNil)
+		So(p, ShouldResemble, SketchParams{Hash: FNV1a})
+		So(p.String(), ShouldEqual, "hash=fnv1a")
+		So(p.New().(*fnvSketch).Variant, ShouldEqual, FNV1a)
+		So(p.Set("hash=md5"), ShouldNotBeNil)
+
+		So(p.Set(""), ShouldBeNil)
+		So(p, ShouldResemble, SketchParams{})
+
+		So(errors.Is(p.Set("epsilon=1"), ErrInvalidParams), ShouldBeTrue)
+		So(p.Set("delta=NaN"), ShouldNotBeNil)
+		So(p.Set("width=10"), ShouldNotBeNil)
+		So(p.Set("0.99"), ShouldNotBeNil)
+	})
+
+	Convey("Rolling params", t, func() {
+		var p RollingParams
+		So(p.UnmarshalText([]byte("interval=5m,num=12,delta=0.9")), ShouldBeNil)
+		So(p, ShouldResemble, RollingParams{
+			SketchParams: SketchParams{Delta: 0.9},
+			Interval:     5 * time.Minute,
+			NumIntervals: 12,
+		})
+		text, err := p.MarshalText()
+		So(err, ShouldBeNil)
+		So(string(text), ShouldEqual, "interval=5m,num=12,delta=0.9")
+
+		counter := p.New().(*rollingCounter)
+		So(counter.Interval, ShouldEqual, 5*time.Minute)
+		So(counter.NumIntervals, ShouldEqual, 12)
+
+		So(p.Set("interval=5m"), ShouldNotBeNil)
+		So(p.Set("interval=5m,num=x"), ShouldNotBeNil)
+	})
+
+	Convey("Rollup params", t, func() {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var p RollupParams
+		fs.Var(&p, "rollup", "rollup durations")
+		So(fs.Parse([]string{"-rollup", "15m,1h,4h,24h"}), ShouldBeNil)
+		So(p.Durations, ShouldResemble,
+			[]time.Duration{15 * time.Minute, time.Hour, 4 * time.Hour, 24 * time.Hour})
+		So(p.String(), ShouldEqual, "15m,1h,4h,24h")
+		So(len(p.New().(*rollupCounter).Levels), ShouldEqual, 3)
+
+		So(p.Set("1h30m,2h,epsilon=0.99"), ShouldBeNil)
+		So(p.String(), ShouldEqual, "1h30m,2h,epsilon=0.99")
+
+		So(p.Set("1h"), ShouldNotBeNil)
+		So(p.Set("1h,15m"), ShouldNotBeNil)
+		So(p.Set("1h,fortnight"), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,41 @@
+package sketchy
+
+import "fmt"
+
+// A PartialEmitter emits its counts in parts, for merging elsewhere. Rolling
+// counters are PartialEmitters.
+type PartialEmitter interface {
+	EmitPartial() ([]byte, error)
+}
+
+// EmitPartial returns the encoding of the counts made in s since the last
+// emission and clears them, so that each count is emitted exactly once. It
+// fails if s isn't a PartialEmitter.
+func EmitPartial(s RateSketch) ([]byte, error) {
+	if e, ok := s.(PartialEmitter); ok {
+		return e.EmitPartial()
+	}
+	return nil, fmt.Errorf("sketchy: %T can't emit partial counts", s)
+}
+
+// EmitPartial returns the gob encoding of the counts made since the last
+// emission, or since the counter was created, and clears them, for flushing
+// a worker's counts periodically into an aggregating counter with
+// CounterCombiner or MergeAll. The encoding is taken and the counter cleared
+// under the lock that serializes counting, so each count is in exactly one
+// emission: none is emitted twice, and none is lost between two.
+//
+// The counter then holds only the counts since the last emission, so its
+// own rates cover that time alone; it is the aggregator's rates that cover
+// the whole window. If encoding fails, nothing is cleared.
+func (rl *rollingCounter) EmitPartial() ([]byte, error) {
+	rl.lock(&rl.m)
+	defer rl.m.Unlock()
+
+	data, err := rl.encode(rl.loadBuckets())
+	if err != nil {
+		return nil, err
+	}
+	rl.storeBuckets(nil)
+	return data, nil
+}
@@ -0,0 +1,70 @@
+package sketchy
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEmitPartial(t *testing.T) {
+	Convey("Partial emissions count every event exactly once", t, func() {
+		now := time.Unix(1500000000, 0)
+		clock := func() time.Time { return now }
+		params := RollingParams{Interval: time.Minute, NumIntervals: 10}
+		worker := params.New(WithClock(clock))
+		c := CounterCombiner(params, WithClock(clock))
+		acc := c.CreateAccumulator()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					Add(worker, []byte("key"), 1)
+				}
+			}()
+		}
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		emissions := 0
+		for waiting := true; waiting; emissions++ {
+			select {
+			case <-done:
+				waiting = false
+			default:
+			}
+			data, err := EmitPartial(worker)
+			So(err, ShouldBeNil)
+			acc = c.AddInput(acc, data)
+		}
+		So(emissions, ShouldBeGreaterThan, 1)
+		So(worker.Query([]byte("key"), time.Hour), ShouldEqual, 0)
+
+		now = now.Add(time.Minute)
+		aggregate := c.ExtractOutput(acc).(RateSketch)
+		So(QueryDetailed(aggregate, []byte("key"), 10*time.Minute).Events, ShouldEqual, 4000)
+	})
+
+	Convey("A worker keeps counting after an emission", t, func() {
+		now := time.Unix(1500000000, 0)
+		worker := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(WithClock(func() time.Time { return now }))
+		Add(worker, []byte("key"), 60)
+		_, err := EmitPartial(worker)
+		So(err, ShouldBeNil)
+
+		Add(worker, []byte("key"), 30)
+		now = now.Add(time.Minute)
+		So(worker.Query([]byte("key"), time.Minute), ShouldEqual, 0.5)
+	})
+
+	Convey("Counters that can't emit partial counts say so", t, func() {
+		_, err := EmitPartial(RollupCounter(0, 0, time.Minute, time.Hour))
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,106 @@
+package sketchy
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A Decision is the action DecideN recommends for an event, from most to
+// least lenient.
+type Decision int
+
+const (
+	// Allowed means the event may go ahead.
+	Allowed Decision = iota
+
+	// Tarpit means the event may go ahead, but slowly, for example by
+	// delaying the response.
+	Tarpit
+
+	// Challenge means the event may go ahead if the client passes a
+	// challenge, such as a CAPTCHA.
+	Challenge
+
+	// Deny means the event must be refused.
+	Deny
+)
+
+func (d Decision) String() string {
+	switch d {
+	case Allowed:
+		return "allowed"
+	case Tarpit:
+		return "tarpit"
+	case Challenge:
+		return "challenge"
+	case Deny:
+		return "deny"
+	}
+	return "Decision(" + strconv.Itoa(int(d)) + ")"
+}
+
+// A Tier is a graduated response to keys over their limit.
+type Tier struct {
+	// Above is the multiple of the events allowed in a window that a key's
+	// events, including the ones being decided, must exceed for the tier to
+	// apply.
+	Above float64
+
+	Decision Decision
+}
+
+// defaultTiers deny every event over the limit, as AllowN does.
+var defaultTiers = []Tier{{Above: 1, Decision: Deny}}
+
+// WithTiers sets the tiers of responses that DecideN chooses between. Their
+// Above multiples must be positive and increasing. Keys below the lowest
+// tier are Allowed, so to respond to every event over the limit the lowest
+// tier should have Above 1. Without WithTiers, every event over the limit
+// is denied.
+func WithTiers(tiers ...Tier) LimiterOption {
+	for i, t := range tiers {
+		if t.Above <= 0 || (i > 0 && t.Above <= tiers[i-1].Above) {
+			panic(fmt.Sprintf("sketchy: tier multiples %v must be positive and increasing", tiers))
+		}
+	}
+	tiers = append([]Tier(nil), tiers...)
+	return func(l *Limiter) { l.tiers = tiers }
+}
+
+// Decide returns the action to take for an event for key, according to how
+// far over its limit the key is. It is shorthand for DecideN(key, 1).
+func (l *Limiter) Decide(key []byte) Decision { return l.DecideN(key, 1) }
+
+// DecideN returns the action to take for n events for key, according to how
+// far over its limit the key would be with them: the decision of the
+// highest tier it exceeds, or Allowed if it exceeds none. Unless the
+// decision is Deny, the events are recorded. Decisions other than Allowed
+// are logged as denials; in dry-run mode, they are logged but Allowed is
+// returned.
+func (l *Limiter) DecideN(key []byte, n int) Decision {
+	if l.bypass(key, n) {
+		return Allowed
+	}
+	tiers := l.tiers
+	if tiers == nil {
+		tiers = defaultTiers
+	}
+	events := l.events(key)
+	over := (events + float64(n)) / l.burst(key)
+	d := Allowed
+	for _, t := range tiers {
+		if over > t.Above {
+			d = t.Decision
+		}
+	}
+	if d != Allowed {
+		l.deny(key, n, events, d)
+		if l.dryRun {
+			d = Allowed
+		}
+	}
+	if d != Deny {
+		Add(l.counter, key, n)
+	}
+	return d
+}
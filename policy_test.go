@@ -0,0 +1,72 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithTiers(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	newLimiter := func(opts ...LimiterOption) *Limiter {
+		counter := RollingCounter(0, 0, time.Second, 11).(*rollingCounter)
+		counter.clock = func() time.Time {
+			now = now.Add(time.Millisecond)
+			return now
+		}
+		return NewLimiter(counter, 2, 10*time.Second, opts...)
+	}
+
+	Convey("Keys further over the limit get harsher decisions", t, func() {
+		limiter := newLimiter(WithDecisionLog(10), WithTiers(
+			Tier{Above: 1, Decision: Tarpit},
+			Tier{Above: 1.5, Decision: Challenge},
+			Tier{Above: 2, Decision: Deny},
+		))
+		So(limiter.DecideN(key, 20), ShouldEqual, Allowed)
+		So(limiter.Decide(key), ShouldEqual, Tarpit)
+		So(limiter.DecideN(key, 9), ShouldEqual, Tarpit)
+		So(limiter.Decide(key), ShouldEqual, Challenge)
+		So(limiter.DecideN(key, 10), ShouldEqual, Deny)
+		So(limiter.DecideN(key, 9), ShouldEqual, Challenge)
+		So(limiter.Decide(key), ShouldEqual, Deny)
+
+		denials := limiter.RecentDenials(10)
+		So(len(denials), ShouldEqual, 6)
+		So(denials[0].Decision, ShouldEqual, Deny)
+		So(denials[1].Decision, ShouldEqual, Challenge)
+		So(denials[5].Decision, ShouldEqual, Tarpit)
+
+		Convey("and denied events aren't recorded", func() {
+			So(limiter.events(key), ShouldAlmostEqual, 40, 0.1)
+		})
+	})
+
+	Convey("Without tiers, events over the limit are denied", t, func() {
+		limiter := newLimiter()
+		So(limiter.DecideN(key, 20), ShouldEqual, Allowed)
+		So(limiter.Decide(key), ShouldEqual, Deny)
+	})
+
+	Convey("Keys below the lowest tier are allowed", t, func() {
+		limiter := newLimiter(WithTiers(Tier{Above: 2, Decision: Deny}))
+		So(limiter.DecideN(key, 30), ShouldEqual, Allowed)
+		So(limiter.DecideN(key, 11), ShouldEqual, Deny)
+	})
+
+	Convey("Dry-run limiters allow everything", t, func() {
+		limiter := newLimiter(WithDryRun())
+		So(limiter.DecideN(key, 21), ShouldEqual, Allowed)
+		So(limiter.WouldBlock(key), ShouldEqual, 21)
+	})
+
+	Convey("Tiers must be increasing", t, func() {
+		So(func() { WithTiers(Tier{Above: 2}, Tier{Above: 1}) }, ShouldPanic)
+		So(func() { WithTiers(Tier{Above: 0}) }, ShouldPanic)
+		So(Challenge.String(), ShouldEqual, "challenge")
+		So(Decision(7).String(), ShouldEqual, "Decision(7)")
+	})
+}
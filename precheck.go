@@ -0,0 +1,138 @@
+package sketchy
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// precheckFPRate is the false positive rate each generation of a precheck's
+// filters is sized for.
+const precheckFPRate = 0.01
+
+// WithPrecheck gives a counter a Bloom filter
+// (https://en.wikipedia.org/wiki/Bloom_filter) of the keys counted within
+// its retention horizon, sized for the given number of distinct keys. Query
+// consults the filter first, and returns 0 immediately for keys that
+// haven't been counted, without visiting any buckets. This suits workloads
+// where most queries are for keys that are never counted.
+//
+// The filter is trusted only once it has tracked a full horizon, since keys
+// counted before then, for example in state restored with GobDecode, may be
+// missing from it.
+func WithPrecheck(expectedKeys int) Option {
+	if expectedKeys <= 0 {
+		panic(fmt.Sprintf("sketchy: precheck size %d is not positive", expectedKeys))
+	}
+	bits, hashes := bloomSize(uint(expectedKeys), precheckFPRate)
+	return func(o *options) { o.precheck = &rollingBloom{bits: bits, hashes: hashes} }
+}
+
+// A rollingBloom keeps two generations of Bloom filters, each covering a
+// horizon, so that every key added in the last horizon is in one of them.
+type rollingBloom struct {
+	bits, hashes uint // of each filter
+
+	m    sync.Mutex // serializes rotations
+	gens atomic.Value
+}
+
+type bloomGenerations struct {
+	origin   time.Time // when tracking started
+	start    time.Time // when current started
+	current  *Bloom
+	previous *Bloom // nil until the first rotation
+}
+
+func (f *rollingBloom) load() *bloomGenerations {
+	gens, _ := f.gens.Load().(*bloomGenerations)
+	return gens
+}
+
+// add records that the key with the given hash was added at now, starting
+// a new generation if the current one has covered the horizon.
+func (f *rollingBloom) add(k hashKernel, now time.Time, horizon time.Duration) {
+	if f == nil {
+		return
+	}
+	gens := f.load()
+	if gens == nil || now.Sub(gens.start) >= horizon {
+		f.m.Lock()
+		gens = f.rotate(now, horizon)
+		f.m.Unlock()
+	}
+	gens.current.add(k)
+}
+
+// addNew adds the key with the given hash as add does, and reports whether
+// it was new: that is, absent from both generations. Unlike add, it is
+// serialized with other calls to addNew, so that of two adding the same key
+// at once, only one finds it new.
+func (f *rollingBloom) addNew(k hashKernel, now time.Time, horizon time.Duration) bool {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	gens := f.rotate(now, horizon)
+	if gens.current.test(k) || gens.previous != nil && gens.previous.test(k) {
+		return false
+	}
+	gens.current.add(k)
+	return true
+}
+
+// rotate returns the current generations, starting a new one first if the
+// current one has covered the horizon. The caller must hold f.m.
+func (f *rollingBloom) rotate(now time.Time, horizon time.Duration) *bloomGenerations {
+	gens := f.load()
+	if gens == nil {
+		gens = &bloomGenerations{origin: now, start: now, current: newBloom(f.bits, f.hashes)}
+		f.gens.Store(gens)
+	} else if now.Sub(gens.start) >= horizon {
+		gens = &bloomGenerations{
+			origin:   gens.origin,
+			start:    now,
+			current:  newBloom(f.bits, f.hashes),
+			previous: gens.current,
+		}
+		f.gens.Store(gens)
+	}
+	return gens
+}
+
+// mayContain reports whether the key with the given hash may have been
+// counted within the horizon before now.
+func (f *rollingBloom) mayContain(k hashKernel, now time.Time, horizon time.Duration) bool {
+	if f == nil {
+		return true
+	}
+	gens := f.load()
+	if gens == nil || now.Sub(gens.origin) < horizon {
+		return true
+	}
+	return gens.current.test(k) || gens.previous != nil && gens.previous.test(k)
+}
+
+// reset forgets every key, so the filter isn't trusted until it has tracked
+// another full horizon.
+func (f *rollingBloom) reset() {
+	if f == nil {
+		return
+	}
+	f.m.Lock()
+	f.gens.Store((*bloomGenerations)(nil))
+	f.m.Unlock()
+}
+
+// horizon returns how far back the counter retains data.
+func (rl *rollingCounter) horizon() time.Duration {
+	v := rl.view()
+	return v.interval * time.Duration(v.num)
+}
+
+func (rc *rollupCounter) horizon() time.Duration {
+	if len(rc.Levels) == 0 {
+		return 0
+	}
+	return rc.Levels[len(rc.Levels)-1].horizon()
+}
@@ -0,0 +1,98 @@
+package sketchy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithPrecheck(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	Convey("Bloom filters have few false positives", t, func() {
+		f := WithPrecheck(1000)
+		var o options
+		f(&o)
+		So(o.precheck.hashes, ShouldEqual, 7)
+		b := newBloom(o.precheck.bits, o.precheck.hashes)
+		for i := 0; i < 1000; i++ {
+			b.add(multihash([]byte(fmt.Sprintf("key%d", i))))
+		}
+		positives := 0
+		for i := 0; i < 10000; i++ {
+			So(b.test(multihash([]byte(fmt.Sprintf("key%d", i%1000)))), ShouldBeTrue)
+			if b.test(multihash([]byte(fmt.Sprintf("miss%d", i)))) {
+				positives++
+			}
+		}
+		So(positives, ShouldBeLessThan, 300)
+	})
+
+	Convey("Counters given the same option have their own filters", t, func() {
+		precheck := WithPrecheck(100)
+		params := RollingParams{Interval: time.Minute, NumIntervals: 2}
+		a := params.New(precheck).(*rollingCounter)
+		b := params.New(precheck).(*rollingCounter)
+		So(a.precheck == b.precheck, ShouldBeFalse)
+	})
+
+	Convey("Queries for uncounted keys skip the buckets", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 2}.New(WithPrecheck(100)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		// a key counted before tracking began is still found, until the
+		// filter has covered a full horizon
+		counter.storeBuckets([]sketchWithTime{newBucket(NewSketch(0, 0).(*fnvSketch), now)})
+		counter.loadBuckets()[0].Count([]byte("restored"), 60)
+		counter.Count(key, 60, 0)
+		now = now.Add(time.Minute)
+		So(counter.Query([]byte("restored"), time.Minute), ShouldEqual, 1)
+
+		now = now.Add(time.Minute)
+		counter.Count(key, 60, 0)
+		now = now.Add(time.Second)
+		So(counter.precheck.mayContain(multihash([]byte("restored")), now, counter.horizon()), ShouldBeFalse)
+		So(counter.Query([]byte("restored"), time.Hour), ShouldEqual, 0)
+		So(counter.Query(key, time.Hour), ShouldBeGreaterThan, 0)
+
+		// keys remain in the filter for a full horizon after they're counted
+		now = now.Add(2*time.Minute - 2*time.Second)
+		counter.Count([]byte("other"), 1, 0)
+		So(counter.precheck.mayContain(multihash(key), now, counter.horizon()), ShouldBeTrue)
+	})
+
+	Convey("Decoding resets the filter", t, func() {
+		src := RollingCounter(0, 0, time.Minute, 2).(*rollingCounter)
+		src.clock = func() time.Time { return now }
+		src.Count([]byte("restored"), 60, 0)
+		data, err := encode(src)
+		So(err, ShouldBeNil)
+
+		dst := RollingParams{Interval: time.Minute, NumIntervals: 2}.New(WithPrecheck(100)).(*rollingCounter)
+		dst.clock = func() time.Time { return now }
+		dst.Count(key, 1, 0)
+		now = now.Add(3 * time.Minute)
+		So(dst.precheck.mayContain(multihash([]byte("restored")), now, dst.horizon()), ShouldBeFalse)
+		So(decode(dst, data), ShouldBeNil)
+		So(dst.precheck.mayContain(multihash([]byte("restored")), now, dst.horizon()), ShouldBeTrue)
+	})
+
+	Convey("Rollup counters check the filter once", t, func() {
+		rollup := RollupParams{Durations: []time.Duration{time.Minute, time.Hour}}.New(
+			WithPrecheck(100)).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		rollup.Count(key, 60, 0)
+		now = now.Add(time.Hour + time.Minute)
+		rollup.Count([]byte("other"), 60, 0)
+		So(rollup.precheck.mayContain(multihash(key), now, rollup.horizon()), ShouldBeTrue)
+		So(rollup.precheck.mayContain(multihash([]byte("missing")), now, rollup.horizon()), ShouldBeFalse)
+		So(rollup.Levels[0].precheck, ShouldEqual, rollup.precheck)
+	})
+
+	Convey("Sizes must be positive", t, func() {
+		So(func() { WithPrecheck(0) }, ShouldPanic)
+	})
+}
@@ -0,0 +1,110 @@
+package sketchy
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// WithPrivacy makes a counter report the rates and counts of keys with
+// Laplace noise calibrated for epsilon-differential privacy
+// (https://en.wikipedia.org/wiki/Differential_privacy), so that the rates of
+// keys derived from user identifiers can be shown more widely than the
+// counter itself. Sensitivity bounds the number of events any one
+// individual contributes to a key over an interval. Noise is added to the
+// key's event count, which is then clamped at zero and divided by the time
+// covered, as Query does.
+//
+// Each released rate spends epsilon of the privacy budget. To keep repeated
+// queries from averaging the noise away, it is drawn deterministically from
+// seed, the key, the interval and the start of the latest bucket, so the
+// budget is spent once per key and interval in each bucket. Query,
+// QueryDetailed, the rate returned by Count, RateClass and VsBaseline share
+// that noise, as does QueryBetween for ranges that run up to now; a range
+// that ended in the past has noise fixed by its end. QueryOffset and the
+// baselines of VsBaseline are noised as Query would have been offset
+// earlier. Forecast, QuerySmoothed and Export release the key's count in
+// each retained bucket instead, each with noise of its own.
+//
+// While the option is set, WithPrecheck no longer answers for keys that
+// haven't been counted, since an exact 0 would reveal their absence.
+//
+// Only those per-key results are private. The counter's encoding, its
+// Stats, DistinctKeys and Overlap, and whether CountAndCheckNew reports a
+// key as new, are exact, so the counter itself must not be exposed to
+// anyone the rates are protected from.
+func WithPrivacy(epsilon float64, sensitivity int, seed uint64) Option {
+	if !(epsilon > 0) || sensitivity <= 0 {
+		panic(fmt.Sprintf("sketchy: privacy epsilon %v and sensitivity %d must be positive", epsilon, sensitivity))
+	}
+	p := &privacy{scale: float64(sensitivity) / epsilon, seed: seed}
+	return func(o *options) { o.privacy = p }
+}
+
+// privacy adds Laplace noise with the given scale to the event counts behind
+// released rates.
+type privacy struct {
+	scale float64
+	seed  uint64
+}
+
+// rate returns the rate described by detail with noise added, or its rate
+// unchanged if p is nil. The noise is drawn for the key with the given hash
+// over interval, with the latest bucket started at latest.
+func (p *privacy) rate(detail QueryDetail, k hashKernel, interval time.Duration, latest time.Time) float64 {
+	return p.detail(detail, k, interval, latest).Rate
+}
+
+// detail returns detail with noise added to its events and rate, as for
+// rate.
+func (p *privacy) detail(detail QueryDetail, k hashKernel, interval time.Duration, latest time.Time) QueryDetail {
+	if p == nil {
+		return detail
+	}
+	detail.Events = math.Max(0, detail.Events+p.noise(k, interval, latest))
+	detail.Rate = 0
+	if detail.Covered != 0 {
+		detail.Rate = detail.Events / detail.Covered.Seconds()
+	}
+	return detail
+}
+
+// bucketNoise sets the noise of counts in single buckets apart from the
+// noise of rates over intervals as long as a bucket.
+const bucketNoise = 0x9e3779b97f4a7c15
+
+// count returns the count n of the key with the given hash in the bucket of
+// the given interval started at start, with noise added and clamped at
+// zero, or n unchanged if p is nil.
+func (p *privacy) count(n uint64, k hashKernel, interval time.Duration, start time.Time) float64 {
+	if p == nil {
+		return float64(n)
+	}
+	return math.Max(0, float64(n)+p.noise(k^bucketNoise, interval, start))
+}
+
+// noise returns a Laplace-distributed value with mean 0 and p's scale.
+func (p *privacy) noise(k hashKernel, interval time.Duration, latest time.Time) float64 {
+	x := mix64(uint64(k) ^ mix64(p.seed^mix64(uint64(interval)^mix64(uint64(latest.UnixNano())))))
+	u := (float64(x>>11)+0.5)/(1<<53) - 0.5 // in (-0.5, 0.5)
+	return p.scale * math.Copysign(math.Log(1-2*math.Abs(u)), u)
+}
+
+// latest returns the start of the counter's latest bucket, or the zero time
+// if it has none.
+func (rl *rollingCounter) latest() time.Time {
+	buckets := rl.loadBuckets()
+	if len(buckets) == 0 {
+		return time.Time{}
+	}
+	return buckets[len(buckets)-1].Time
+}
+
+// latest returns the start of the latest bucket of the finest level, or the
+// zero time if it has none.
+func (rc *rollupCounter) latest() time.Time {
+	if len(rc.Levels) == 0 {
+		return time.Time{}
+	}
+	return rc.Levels[0].latest()
+}
@@ -0,0 +1,113 @@
+package sketchy
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithPrivacy(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	Convey("Rates are noisy, but unbiased and never negative", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 3}.New(
+			WithPrivacy(1, 1, 42), WithClock(clock))
+		for i := 0; i < 200; i++ {
+			Add(counter, []byte(fmt.Sprint(i)), 100)
+		}
+		now = now.Add(10 * time.Second)
+
+		var sum, sq float64
+		exact := 0
+		for i := 0; i < 200; i++ {
+			rate := counter.Query([]byte(fmt.Sprint(i)), time.Minute)
+			So(rate, ShouldBeGreaterThanOrEqualTo, 0)
+			if rate == 10 {
+				exact++
+			}
+			sum += rate
+			sq += (rate - 10) * (rate - 10)
+		}
+		So(exact, ShouldBeLessThan, 10)
+		So(sum/200, ShouldAlmostEqual, 10, 0.05)
+		// Laplace noise of scale 1 on the count has variance 2.
+		So(math.Sqrt(sq/200), ShouldAlmostEqual, math.Sqrt(2)/10, 0.03)
+	})
+
+	Convey("Repeated queries see the same noise until the next bucket", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 3}.New(
+			WithPrivacy(0.1, 1, 42), WithClock(clock))
+		key := []byte("key")
+		Add(counter, key, 100)
+		now = now.Add(10 * time.Second)
+
+		first := counter.Query(key, time.Minute)
+		So(counter.Query(key, time.Minute), ShouldEqual, first)
+		So(first, ShouldNotEqual, 10)
+
+		now = now.Add(time.Minute)
+		Add(counter, key, 0)
+		So(counter.Query(key, time.Minute), ShouldNotEqual, first)
+	})
+
+	Convey("Uncounted keys get noise too, even with a precheck", t, func() {
+		counter := RollupParams{Durations: []time.Duration{time.Minute, time.Hour, 24 * time.Hour}}.New(
+			WithPrivacy(0.1, 1, 42), WithPrecheck(100), WithClock(clock))
+		Add(counter, []byte("key"), 1)
+		now = now.Add(10 * time.Second)
+
+		nonzero := 0
+		for i := 0; i < 100; i++ {
+			if counter.Query([]byte(fmt.Sprint(i)), time.Minute) != 0 {
+				nonzero++
+			}
+		}
+		// noise is clamped at zero for about half of them
+		So(nonzero, ShouldBeBetween, 25, 75)
+	})
+
+	Convey("Every per-key result has noise", t, func() {
+		params := RollupParams{Durations: []time.Duration{time.Minute, time.Hour, 24 * time.Hour}}
+		dict := NewKeyDictionary(10, 1)
+		counter := params.New(WithPrivacy(0.1, 1, 42), WithClock(clock), WithKeyDictionary(dict))
+		exact := params.New(WithClock(clock))
+		key := []byte("key")
+		for i := 0; i < 3; i++ {
+			Add(counter, key, 600)
+			Add(exact, key, 600)
+			now = now.Add(time.Minute)
+		}
+
+		rate := counter.Count(key, 0, time.Hour)
+		So(rate, ShouldNotEqual, 10)
+		So(counter.Query(key, time.Hour), ShouldEqual, rate)
+		detail := QueryDetailed(counter, key, time.Hour)
+		So(detail.Rate, ShouldEqual, rate)
+		So(detail.Events, ShouldNotEqual, 1800)
+		So(detail.Events, ShouldAlmostEqual, 1800, 200)
+
+		smoothed := QuerySmoothed(counter, key, 3, Boxcar)
+		So(smoothed, ShouldNotEqual, 10)
+		So(smoothed, ShouldAlmostEqual, 10, 2)
+		So(Forecast(counter, key, time.Minute), ShouldNotEqual, 10)
+
+		export := func(counter RateSketch) string {
+			var buf bytes.Buffer
+			w := NewCSVRowWriter(&buf)
+			So(Export(w, counter, dict), ShouldBeNil)
+			So(w.Flush(), ShouldBeNil)
+			return buf.String()
+		}
+		So(export(counter), ShouldNotEqual, export(exact))
+	})
+
+	Convey("The parameters must be positive", t, func() {
+		So(func() { WithPrivacy(0, 1, 0) }, ShouldPanic)
+		So(func() { WithPrivacy(1, 0, 0) }, ShouldPanic)
+	})
+}
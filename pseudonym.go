@@ -0,0 +1,69 @@
+package sketchy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+	"sync"
+)
+
+// A Pseudonymizer replaces keys with their HMAC-SHA256 under a secret, so
+// that counters never hold recoverable user identifiers: a KeyDictionary
+// records pseudonyms rather than keys, and so do the reports made from it.
+// The same key always has the same pseudonym, so rates are
+// unaffected, but only holders of the secret can tell which key a
+// pseudonym belongs to.
+type Pseudonymizer struct {
+	pool sync.Pool
+}
+
+// NewPseudonymizer returns a Pseudonymizer keyed by secret, which should be
+// at least 32 random bytes and kept out of the counter's snapshots.
+func NewPseudonymizer(secret []byte) *Pseudonymizer {
+	secret = append([]byte(nil), secret...)
+	p := &Pseudonymizer{}
+	p.pool.New = func() interface{} { return hmac.New(sha256.New, secret) }
+	return p
+}
+
+// Key returns the pseudonym of key.
+func (p *Pseudonymizer) Key(key []byte) []byte {
+	mac := p.pool.Get().(hash.Hash)
+	defer p.pool.Put(mac)
+	mac.Reset()
+	mac.Write(key)
+	return mac.Sum(nil)
+}
+
+// Prehash is Prehash for the pseudonym of key, giving handles that
+// CountHandle and QueryHandle treat as the key itself on counters
+// configured with WithPseudonymizer. Such handles are routed to a different
+// shard of a ShardedRateSketch than the key is, so a sharded counter should
+// be given either keys or handles, but not both.
+func (p *Pseudonymizer) Prehash(key []byte) KeyHandle { return Prehash(p.Key(key)) }
+
+// WithPseudonymizer makes a counter replace every key it is given with its
+// pseudonym under p before hashing or recording it. Handles and numeric keys
+// are counted as given; make handles with p.Prehash.
+func WithPseudonymizer(p *Pseudonymizer) Option {
+	return func(o *options) { o.pseudonyms = p }
+}
+
+// pseudonymize returns key, or its pseudonym if the counter has a
+// Pseudonymizer.
+func (o *options) pseudonymize(key []byte) []byte {
+	if o.pseudonyms == nil {
+		return key
+	}
+	return o.pseudonyms.Key(key)
+}
+
+// prehash returns a handle for key, or for its pseudonym if the counter has
+// a Pseudonymizer, hashed with the counter's variant.
+func (rl *rollingCounter) prehash(key []byte) KeyHandle {
+	return rl.view().variant.Prehash(rl.pseudonymize(key))
+}
+
+func (rc *rollupCounter) prehash(key []byte) KeyHandle {
+	return rc.variant().Prehash(rc.pseudonymize(key))
+}
@@ -0,0 +1,77 @@
+package sketchy
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPseudonymizer(t *testing.T) {
+	Convey("Pseudonyms are stable and depend on the secret", t, func() {
+		p := NewPseudonymizer([]byte("secret"))
+		key := []byte("alice@example.com")
+		So(p.Key(key), ShouldResemble, p.Key(key))
+		So(len(p.Key(key)), ShouldEqual, 32)
+		So(bytes.Equal(p.Key(key), p.Key([]byte("bob@example.com"))), ShouldBeFalse)
+		So(bytes.Equal(p.Key(key), NewPseudonymizer([]byte("other")).Key(key)), ShouldBeFalse)
+		So(p.Prehash(key).k, ShouldEqual, Prehash(p.Key(key)).k)
+	})
+}
+
+func TestWithPseudonymizer(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	key := []byte("alice@example.com")
+
+	test := func(durations ...time.Duration) {
+		p := NewPseudonymizer([]byte("secret"))
+		dict := NewKeyDictionary(10, 1)
+		counter := RollupParams{Durations: durations}.New(
+			WithPseudonymizer(p), WithKeyDictionary(dict), WithClock(clock))
+		counter.Count(key, 5, 0)
+		Add(counter, key, 5)
+		now = now.Add(10 * time.Second)
+
+		So(counter.Query(key, time.Minute), ShouldEqual, 1)
+		So(QueryHandle(counter, p.Prehash(key), time.Minute), ShouldEqual, 1)
+		So(QueryHandle(counter, Prehash(key), time.Minute), ShouldEqual, 0)
+		So(QueryDetailed(counter, key, time.Minute).Events, ShouldEqual, 10)
+		So(QuerySmoothed(counter, key, 1, Boxcar), ShouldEqual, 1)
+
+		So(dict.Keys(), ShouldResemble, [][]byte{p.Key(key)})
+		_, ok := dict.Lookup(Prehash(key))
+		So(ok, ShouldBeFalse)
+
+		Forget(counter, key)
+		So(counter.Query(key, time.Minute), ShouldEqual, 0)
+	}
+
+	Convey("Counters hash and record only pseudonyms", t, func() {
+		test(time.Minute, time.Hour)
+	})
+
+	Convey("Counters with several levels hash and record only pseudonyms", t, func() {
+		test(time.Minute, time.Hour, 24*time.Hour)
+	})
+
+	Convey("Rolling counters hash and record only pseudonyms", t, func() {
+		p := NewPseudonymizer([]byte("secret"))
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 3}.New(WithPseudonymizer(p), WithClock(clock))
+		counter.Count(key, 10, 0)
+		now = now.Add(10 * time.Second)
+		So(counter.Query(key, time.Minute), ShouldEqual, 1)
+		So(QueryHandle(counter, p.Prehash(key), time.Minute), ShouldEqual, 1)
+		So(QueryHandle(counter, Prehash(key), time.Minute), ShouldEqual, 0)
+		So(Forecast(counter, key, time.Minute), ShouldBeGreaterThan, 0)
+
+		data, err := counter.(*rollingCounter).GobEncode()
+		So(err, ShouldBeNil)
+		So(bytes.Contains(data, key), ShouldBeFalse)
+
+		rate, isNew := CountAndCheckNew(counter, key, 1, 0)
+		So(rate, ShouldEqual, 0)
+		So(isNew, ShouldBeFalse)
+	})
+}
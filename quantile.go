@@ -0,0 +1,278 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// maxQuantileBins bounds the bins of each sign a QuantileSketch keeps. With
+// an accuracy of 1%, they span values from the smallest to 10^17 times it.
+const maxQuantileBins = 2048
+
+// A QuantileSketch estimates quantiles of the values added to it, such as
+// latencies, with bounded relative error: it is a DDSketch
+// (https://arxiv.org/abs/1908.10693). Each value is counted in a bin of
+// values within a factor of (1+alpha)/(1-alpha) of each other, and a
+// quantile is estimated from the bin it falls in, so the estimate is within
+// a factor of alpha of the true quantile, however the values are
+// distributed. Sketches with the same accuracy merge exactly, as if every
+// value had been added to one of them.
+//
+// At most maxQuantileBins bins of each sign are kept. Should values span a
+// wider range, the bins of the smallest magnitudes are collapsed together,
+// and the lowest quantiles lose their accuracy first.
+type QuantileSketch struct {
+	alpha, gamma float64
+
+	m                  sync.Mutex
+	positive, negative quantileBins
+	zeros              uint64
+	min, max           float64
+}
+
+// NewQuantileSketch returns a new, empty QuantileSketch whose quantiles are
+// within a factor of alpha of the true quantiles: for alpha=0.01, within 1%.
+// The value of alpha must be between 0 and 1.
+func NewQuantileSketch(alpha float64) *QuantileSketch {
+	if !(alpha > 0 && alpha < 1) {
+		panic(fmt.Sprintf("sketchy: quantile sketch accuracy %v must be between 0 and 1", alpha))
+	}
+	return &QuantileSketch{
+		alpha: alpha,
+		gamma: (1 + alpha) / (1 - alpha),
+		min:   math.Inf(1),
+		max:   math.Inf(-1),
+	}
+}
+
+// Add adds the value v, which must be finite.
+func (s *QuantileSketch) Add(v float64) { s.AddN(v, 1) }
+
+// AddN adds n occurrences of the value v, which must be finite.
+func (s *QuantileSketch) AddN(v float64, n uint64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		panic(fmt.Sprintf("sketchy: quantile sketch can't add %v", v))
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	switch {
+	case v > 0:
+		*s.positive.bin(s.index(v)) += n
+	case v < 0:
+		*s.negative.bin(s.index(-v)) += n
+	default:
+		s.zeros += n
+	}
+	s.min, s.max = math.Min(s.min, v), math.Max(s.max, v)
+}
+
+// Count returns the number of values added.
+func (s *QuantileSketch) Count() uint64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.count()
+}
+
+func (s *QuantileSketch) count() uint64 {
+	return s.negative.total() + s.zeros + s.positive.total()
+}
+
+// Quantile returns the estimated q-quantile of the values added, for q
+// between 0 and 1: for q=0.99, the value that 99% of them are at most. The
+// 0-quantile and 1-quantile are the exact minimum and maximum. It returns
+// NaN if no values have been added, or q is out of range.
+func (s *QuantileSketch) Quantile(q float64) float64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	n := s.count()
+	if n == 0 || !(q >= 0 && q <= 1) {
+		return math.NaN()
+	}
+	switch q {
+	case 0:
+		return s.min
+	case 1:
+		return s.max
+	}
+	rank, seen := uint64(q*float64(n-1)), uint64(0)
+	// values ascend from the negative bins of the largest magnitude, through
+	// zero, to the positive bins of the largest magnitude
+	for j := len(s.negative.counts) - 1; j >= 0; j-- {
+		if seen += s.negative.counts[j]; seen > rank {
+			return s.clamp(-s.value(s.negative.offset + j))
+		}
+	}
+	if seen += s.zeros; seen > rank {
+		return 0
+	}
+	for j, c := range s.positive.counts {
+		if seen += c; seen > rank {
+			return s.clamp(s.value(s.positive.offset + j))
+		}
+	}
+	return s.max
+}
+
+// Merge adds every value of o to s, so that s holds the values of both. The
+// sketches must have the same accuracy.
+func (s *QuantileSketch) Merge(o *QuantileSketch) error {
+	if s.alpha != o.alpha {
+		return fmt.Errorf("%w: quantile sketches of accuracy %v and %v can't be merged", ErrIncompatibleSketch, s.alpha, o.alpha)
+	}
+	o.m.Lock()
+	other := o.state()
+	o.m.Unlock()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.positive.merge(quantileBins{other.PositiveOffset, other.Positive})
+	s.negative.merge(quantileBins{other.NegativeOffset, other.Negative})
+	s.zeros += other.Zeros
+	s.min, s.max = math.Min(s.min, other.Min), math.Max(s.max, other.Max)
+	return nil
+}
+
+// index returns the index of the bin holding the positive value v: the bin
+// i holds values in (gamma^(i-1), gamma^i].
+func (s *QuantileSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma)))
+}
+
+// value returns the estimate of the values in bin i, which is within a
+// factor of alpha of each of them.
+func (s *QuantileSketch) value(i int) float64 {
+	return 2 * math.Pow(s.gamma, float64(i)) / (1 + s.gamma)
+}
+
+// clamp limits v to the range of the values added, which the estimate of
+// the bins at either end may overstep.
+func (s *QuantileSketch) clamp(v float64) float64 { return math.Max(s.min, math.Min(v, s.max)) }
+
+// quantileBins counts values in a contiguous range of bins, of which counts
+// holds bins offset and above.
+type quantileBins struct {
+	offset int
+	counts []uint64
+}
+
+func (b *quantileBins) total() uint64 {
+	var n uint64
+	for _, c := range b.counts {
+		n += c
+	}
+	return n
+}
+
+// bin returns the counter of bin i, extending the range of bins to include
+// it. If the range would span more than maxQuantileBins, its lowest bins
+// are collapsed into the lowest kept.
+func (b *quantileBins) bin(i int) *uint64 {
+	if len(b.counts) == 0 {
+		b.offset, b.counts = i, make([]uint64, 1)
+		return &b.counts[0]
+	}
+	hi := b.offset + len(b.counts) - 1
+	if i > hi {
+		b.counts = append(b.counts, make([]uint64, i-hi)...)
+		hi = i
+		if n := len(b.counts) - maxQuantileBins; n > 0 {
+			for _, c := range b.counts[:n] {
+				b.counts[n] += c
+			}
+			b.counts = append([]uint64(nil), b.counts[n:]...)
+			b.offset += n
+		}
+	}
+	if hi-i >= maxQuantileBins {
+		i = hi - maxQuantileBins + 1
+	}
+	if i < b.offset {
+		grown := make([]uint64, hi-i+1)
+		copy(grown[b.offset-i:], b.counts)
+		b.offset, b.counts = i, grown
+	}
+	return &b.counts[i-b.offset]
+}
+
+// merge adds the counts of o to b's.
+func (b *quantileBins) merge(o quantileBins) {
+	for j, c := range o.counts {
+		if c != 0 {
+			*b.bin(o.offset + j) += c
+		}
+	}
+}
+
+// quantileState is the gob encoding of a QuantileSketch.
+type quantileState struct {
+	Alpha          float64
+	PositiveOffset int
+	Positive       []uint64
+	NegativeOffset int
+	Negative       []uint64
+	Zeros          uint64
+	Min, Max       float64
+}
+
+// state returns a copy of the sketch's state. The caller must hold s.m.
+func (s *QuantileSketch) state() quantileState {
+	return quantileState{
+		Alpha:          s.alpha,
+		PositiveOffset: s.positive.offset,
+		Positive:       append([]uint64(nil), s.positive.counts...),
+		NegativeOffset: s.negative.offset,
+		Negative:       append([]uint64(nil), s.negative.counts...),
+		Zeros:          s.zeros,
+		Min:            s.min,
+		Max:            s.max,
+	}
+}
+
+// GobEncode returns the gob encoding of the sketch.
+func (s *QuantileSketch) GobEncode() ([]byte, error) {
+	s.m.Lock()
+	state := s.state()
+	s.m.Unlock()
+
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode replaces the sketch with the one encoded in data.
+func (s *QuantileSketch) GobDecode(data []byte) error {
+	var state quantileState
+	if err := decodeAll(data, &state); err != nil {
+		return fmt.Errorf("%w: %s", ErrCorruptEncoding, err)
+	}
+	if !(state.Alpha > 0 && state.Alpha < 1) {
+		return fmt.Errorf("%w: quantile sketch accuracy %v", ErrCorruptEncoding, state.Alpha)
+	}
+	if len(state.Positive) > maxQuantileBins || len(state.Negative) > maxQuantileBins {
+		return fmt.Errorf("%w: quantile sketch has too many bins", ErrCorruptEncoding)
+	}
+	decoded := NewQuantileSketch(state.Alpha)
+	decoded.positive = quantileBins{state.PositiveOffset, state.Positive}
+	decoded.negative = quantileBins{state.NegativeOffset, state.Negative}
+	decoded.zeros = state.Zeros
+	if decoded.count() != 0 {
+		if math.IsNaN(state.Min) || math.IsNaN(state.Max) || state.Min > state.Max {
+			return fmt.Errorf("%w: quantile sketch range [%v, %v]", ErrCorruptEncoding, state.Min, state.Max)
+		}
+		decoded.min, decoded.max = state.Min, state.Max
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.alpha, s.gamma = decoded.alpha, decoded.gamma
+	s.positive, s.negative, s.zeros = decoded.positive, decoded.negative, decoded.zeros
+	s.min, s.max = decoded.min, decoded.max
+	return nil
+}
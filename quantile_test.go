@@ -0,0 +1,137 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQuantileSketch(t *testing.T) {
+	// relativeError returns how far the sketch's q-quantile is from sorted's,
+	// relative to the latter
+	relativeError := func(s *QuantileSketch, sorted []float64, q float64) float64 {
+		want := sorted[int(q*float64(len(sorted)-1))]
+		return math.Abs(s.Quantile(q)-want) / math.Abs(want)
+	}
+
+	Convey("Quantiles are within the sketch's relative accuracy", t, func() {
+		rnd := rand.New(rand.NewSource(1))
+		s := NewQuantileSketch(0.01)
+		values := make([]float64, 10000)
+		for i := range values {
+			// latencies of a few milliseconds, with a long tail
+			values[i] = math.Exp(rnd.NormFloat64()*2) / 1000
+			s.Add(values[i])
+		}
+		sort.Float64s(values)
+		So(s.Count(), ShouldEqual, 10000)
+		for _, q := range []float64{0.01, 0.1, 0.5, 0.9, 0.99, 0.999} {
+			So(relativeError(s, values, q), ShouldBeLessThanOrEqualTo, 0.01)
+		}
+		So(s.Quantile(0), ShouldEqual, values[0])
+		So(s.Quantile(1), ShouldEqual, values[len(values)-1])
+	})
+
+	Convey("Negative values and zeros are ordered below positive ones", t, func() {
+		s := NewQuantileSketch(0.01)
+		for _, v := range []float64{-100, -10, 0, 0, 10, 100} {
+			s.Add(v)
+		}
+		So(s.Quantile(0), ShouldEqual, -100)
+		So(s.Quantile(0.2), ShouldAlmostEqual, -10, 0.1)
+		So(s.Quantile(0.5), ShouldEqual, 0)
+		So(s.Quantile(0.8), ShouldAlmostEqual, 10, 0.1)
+		So(s.Quantile(0.99), ShouldAlmostEqual, 10, 0.1)
+	})
+
+	Convey("Merged sketches hold the values of both", t, func() {
+		a, b, both := NewQuantileSketch(0.02), NewQuantileSketch(0.02), NewQuantileSketch(0.02)
+		for i := 1; i <= 1000; i++ {
+			a.Add(float64(i))
+			both.Add(float64(i))
+			b.AddN(float64(i)*1000, 2)
+			both.AddN(float64(i)*1000, 2)
+		}
+		So(a.Merge(b), ShouldBeNil)
+		So(a.Count(), ShouldEqual, 3000)
+		for _, q := range []float64{0, 0.1, 0.3, 0.5, 0.9, 1} {
+			So(a.Quantile(q), ShouldEqual, both.Quantile(q))
+		}
+
+		err := a.Merge(NewQuantileSketch(0.01))
+		So(errors.Is(err, ErrIncompatibleSketch), ShouldBeTrue)
+	})
+
+	Convey("Bins of the smallest values collapse beyond the limit", t, func() {
+		s := NewQuantileSketch(0.01)
+		s.Add(1e-300)
+		s.Add(1)
+		s.Add(1e300)
+		So(len(s.positive.counts), ShouldEqual, maxQuantileBins)
+		So(s.Count(), ShouldEqual, 3)
+		So(s.Quantile(0.5), ShouldBeLessThan, 1e300)
+		So(s.Quantile(1), ShouldEqual, 1e300)
+
+		s.Add(1e-200)
+		So(len(s.positive.counts), ShouldEqual, maxQuantileBins)
+		So(s.Count(), ShouldEqual, 4)
+	})
+
+	Convey("Quantiles of nothing are NaN", t, func() {
+		s := NewQuantileSketch(0.01)
+		So(math.IsNaN(s.Quantile(0.5)), ShouldBeTrue)
+		s.Add(1)
+		So(math.IsNaN(s.Quantile(-0.1)), ShouldBeTrue)
+		So(math.IsNaN(s.Quantile(1.1)), ShouldBeTrue)
+		So(math.IsNaN(s.Quantile(math.NaN())), ShouldBeTrue)
+	})
+
+	Convey("Bad accuracies and values are refused", t, func() {
+		So(func() { NewQuantileSketch(0) }, ShouldPanic)
+		So(func() { NewQuantileSketch(1) }, ShouldPanic)
+		s := NewQuantileSketch(0.01)
+		So(func() { s.Add(math.NaN()) }, ShouldPanic)
+		So(func() { s.Add(math.Inf(1)) }, ShouldPanic)
+	})
+
+	Convey("Quantile sketches round-trip through gob", t, func() {
+		s := NewQuantileSketch(0.01)
+		for i := 0; i < 100; i++ {
+			s.Add(float64(i - 20))
+		}
+		buf := &bytes.Buffer{}
+		So(gob.NewEncoder(buf).Encode(s), ShouldBeNil)
+
+		var decoded QuantileSketch
+		So(gob.NewDecoder(buf).Decode(&decoded), ShouldBeNil)
+		So(decoded.Count(), ShouldEqual, 100)
+		for _, q := range []float64{0, 0.1, 0.5, 0.9, 1} {
+			So(decoded.Quantile(q), ShouldEqual, s.Quantile(q))
+		}
+		So(decoded.Merge(s), ShouldBeNil)
+
+		buf.Reset()
+		So(gob.NewEncoder(buf).Encode(NewQuantileSketch(0.01)), ShouldBeNil)
+		So(gob.NewDecoder(buf).Decode(&decoded), ShouldBeNil)
+		So(decoded.Count(), ShouldEqual, 0)
+	})
+
+	Convey("Corrupt encodings are rejected", t, func() {
+		for _, state := range []quantileState{
+			{Alpha: 0},
+			{Alpha: 0.01, Positive: make([]uint64, maxQuantileBins+1)},
+			{Alpha: 0.01, Zeros: 1, Min: 1, Max: 0},
+		} {
+			buf := &bytes.Buffer{}
+			So(gob.NewEncoder(buf).Encode(state), ShouldBeNil)
+			var s QuantileSketch
+			So(errors.Is(s.GobDecode(buf.Bytes()), ErrCorruptEncoding), ShouldBeTrue)
+		}
+	})
+}
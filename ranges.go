@@ -0,0 +1,107 @@
+package sketchy
+
+import "time"
+
+// QueryBetween returns the observed rate of the given key between from and
+// to, which may lie wholly in the past, such as the previous hour. Buckets
+// that straddle either end are interpolated, as with Query. The range is
+// cut off at now; if it is empty, or the available data covers less than a
+// second of it, 0 is returned. If the counter measures complete windows
+// (see WithCompleteWindows), the range is cut off where Query's windows
+// end instead.
+func (rl *rollingCounter) QueryBetween(key []byte, from, to time.Time) float64 {
+	k, now := rl.prehash(key).k, rl.now()
+	if rl.privacy == nil && !rl.precheck.mayContain(k, now, rl.horizon()) {
+		return 0
+	}
+	cutoff, latest := rl.complete(now)
+	end, interval := between(cutoff, from, to)
+	noiseKey, noiseAt := betweenNoise(k, cutoff, end, latest)
+	return rl.privacy.rate(rl.queryAt(k, end, interval), noiseKey, interval, noiseAt)
+}
+
+// QueryBetween returns the observed rate of the given key between from and
+// to, which may lie wholly in the past, such as the previous hour. Older
+// parts of the range are answered by coarser levels, and buckets that
+// straddle either end are interpolated, as with Query. The range is cut off
+// at now; if it is empty, or the available data covers less than a second
+// of it, 0 is returned.
+func (rc *rollupCounter) QueryBetween(key []byte, from, to time.Time) float64 {
+	k, now := rc.prehash(key).k, rc.now()
+	if rc.privacy == nil && !rc.precheck.mayContain(k, now, rc.horizon()) {
+		return 0
+	}
+	end, interval := between(now, from, to)
+	noiseKey, noiseAt := betweenNoise(k, now, end, rc.latest())
+	return rc.privacy.rate(rc.queryAt(k, end, interval), noiseKey, interval, noiseAt)
+}
+
+// QueryOffset returns the observed rate of the given key over the window
+// that ended offset ago, such as the same ten minutes yesterday. Negative
+// offsets are treated as 0. If the available data covers less than a
+// second of the window, 0 is returned. If the counter measures complete
+// windows, the offset is from where Query's windows end rather than now.
+func (rl *rollingCounter) QueryOffset(key []byte, window, offset time.Duration) float64 {
+	k, now, offset := rl.prehash(key).k, rl.now(), nonNegative(offset)
+	if rl.privacy == nil && !rl.precheck.mayContain(k, now, rl.horizon()) {
+		return 0
+	}
+	end, latest := rl.complete(now)
+	return rl.privacy.rate(rl.queryAt(k, end.Add(-offset), window), k, window, latest.Add(-offset))
+}
+
+// QueryOffset returns the observed rate of the given key over the window
+// that ended offset ago, such as the same ten minutes yesterday, answered
+// by the level that retains it. Negative offsets are treated as 0. If the
+// available data covers less than a second of the window, 0 is returned.
+func (rc *rollupCounter) QueryOffset(key []byte, window, offset time.Duration) float64 {
+	k, now, offset := rc.prehash(key).k, rc.now(), nonNegative(offset)
+	if rc.privacy == nil && !rc.precheck.mayContain(k, now, rc.horizon()) {
+		return 0
+	}
+	return rc.privacy.rate(rc.queryAt(k, now.Add(-offset), window), k, window, rc.latest().Add(-offset))
+}
+
+// QueryBetween returns the observed rate of the given key between from and
+// to, from its shard.
+func (s *ShardedRateSketch) QueryBetween(key []byte, from, to time.Time) float64 {
+	return QueryBetween(s.Shard(key), key, from, to)
+}
+
+// QueryOffset returns the observed rate of the given key over the window
+// that ended offset ago, from its shard.
+func (s *ShardedRateSketch) QueryOffset(key []byte, window, offset time.Duration) float64 {
+	return QueryOffset(s.Shard(key), key, window, offset)
+}
+
+// between returns the end and duration of the range from from to to, cut
+// off at now. The duration is not positive if the range is empty.
+func between(now, from, to time.Time) (time.Time, time.Duration) {
+	if to.After(now) {
+		to = now
+	}
+	return to, to.Sub(from)
+}
+
+// rangeNoise sets the noise of rates over ranges that ended in the past
+// apart from the noise of rates over intervals ending now.
+const rangeNoise = 0xbf58476d1ce4e5b9
+
+// betweenNoise returns the key hash and time to draw privacy noise for, for
+// the rate of the key with hash k over a range ending at end, as of now. A
+// range that runs up to now is noised as Query is, with the latest bucket
+// it ends in; a range that ended in the past has noise fixed by its end, so
+// that repeated queries for it can't average the noise away.
+func betweenNoise(k hashKernel, now, end, latest time.Time) (hashKernel, time.Time) {
+	if end.Before(now) {
+		return k ^ rangeNoise, end
+	}
+	return k, latest
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,112 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueryBetween(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	now := start
+	clock := func() time.Time { return now }
+	key := []byte("key")
+
+	Convey("Rates can be queried over a range in the past", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(WithClock(clock))
+		for i := 0; i < 10; i++ {
+			Add(counter, key, 60*(i+1))
+			now = now.Add(time.Minute)
+		}
+
+		So(QueryBetween(counter, key, start.Add(2*time.Minute), start.Add(3*time.Minute)), ShouldAlmostEqual, 3)
+		So(QueryBetween(counter, key, start.Add(2*time.Minute), start.Add(4*time.Minute)), ShouldAlmostEqual, 3.5)
+		So(QueryBetween(counter, key, start.Add(150*time.Second), start.Add(210*time.Second)), ShouldAlmostEqual, 3.5)
+		So(QueryBetween(counter, key, now.Add(-time.Minute), now), ShouldAlmostEqual, counter.Query(key, time.Minute))
+	})
+
+	Convey("Ranges are cut off at now", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(WithClock(clock))
+		Add(counter, key, 60)
+		now = now.Add(time.Minute)
+		So(QueryBetween(counter, key, now.Add(-time.Minute), now.Add(time.Hour)), ShouldAlmostEqual, 1)
+		So(QueryBetween(counter, key, now, now.Add(time.Hour)), ShouldEqual, 0)
+		So(QueryBetween(counter, key, now, now.Add(-time.Minute)), ShouldEqual, 0)
+	})
+
+	Convey("Rollups answer older ranges from coarser levels", t, func() {
+		now = start
+		counter := RollupParams{Durations: []time.Duration{time.Minute, time.Hour, 24 * time.Hour}}.New(WithClock(clock))
+		for i := 0; i < 120; i++ {
+			Add(counter, key, 60*(1+i/60))
+			now = now.Add(time.Minute)
+		}
+		So(QueryBetween(counter, key, start, start.Add(time.Hour)), ShouldAlmostEqual, 1)
+		So(QueryBetween(counter, key, start.Add(time.Hour), start.Add(2*time.Hour)), ShouldAlmostEqual, 2)
+	})
+
+	Convey("Private counters add noise, as Query does", t, func() {
+		now = start
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(
+			WithClock(clock), WithPrivacy(0.1, 1, 42))
+		for i := 0; i < 10; i++ {
+			Add(counter, key, 60*(i+1))
+			now = now.Add(time.Minute)
+		}
+
+		past := QueryBetween(counter, key, start.Add(2*time.Minute), start.Add(3*time.Minute))
+		So(past, ShouldNotEqual, 3)
+		So(past, ShouldAlmostEqual, 3, 1)
+		now = now.Add(time.Second)
+		So(QueryBetween(counter, key, start.Add(2*time.Minute), start.Add(3*time.Minute)), ShouldEqual, past)
+		So(QueryBetween(counter, key, now.Add(-time.Minute), now), ShouldEqual, counter.Query(key, time.Minute))
+	})
+}
+
+func TestQueryOffset(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	now := start
+	clock := func() time.Time { return now }
+	key := []byte("key")
+
+	Convey("Rates can be queried over a window that ended in the past", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(WithClock(clock))
+		for i := 0; i < 10; i++ {
+			Add(counter, key, 60*(i+1))
+			now = now.Add(time.Minute)
+		}
+		So(QueryOffset(counter, key, time.Minute, 0), ShouldAlmostEqual, counter.Query(key, time.Minute))
+		So(QueryOffset(counter, key, time.Minute, -time.Hour), ShouldAlmostEqual, counter.Query(key, time.Minute))
+		So(QueryOffset(counter, key, time.Minute, time.Minute), ShouldAlmostEqual, 9)
+		So(QueryOffset(counter, key, 2*time.Minute, 5*time.Minute), ShouldAlmostEqual, 4.5)
+		So(QueryOffset(counter, key, time.Minute, time.Hour), ShouldEqual, 0)
+	})
+
+	Convey("Rollups compare with the same window yesterday", t, func() {
+		now = start
+		counter := RollupParams{Durations: []time.Duration{10 * time.Minute, time.Hour, 48 * time.Hour}}.New(WithClock(clock))
+		for i := 0; i < 48*60; i++ {
+			Add(counter, key, 60*(1+i/(24*60)))
+			now = now.Add(time.Minute)
+		}
+		So(QueryOffset(counter, key, 10*time.Minute, 0), ShouldAlmostEqual, 2)
+		So(QueryOffset(counter, key, 10*time.Minute, 24*time.Hour), ShouldAlmostEqual, 1)
+	})
+
+	Convey("Private counters add noise, as Query does", t, func() {
+		now = start
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(
+			WithClock(clock), WithPrivacy(0.1, 1, 42))
+		for i := 0; i < 10; i++ {
+			Add(counter, key, 60*(i+1))
+			now = now.Add(time.Minute)
+		}
+
+		past := QueryOffset(counter, key, time.Minute, time.Minute)
+		So(past, ShouldNotEqual, 9)
+		So(past, ShouldAlmostEqual, 9, 1)
+		So(QueryOffset(counter, key, time.Minute, time.Minute), ShouldEqual, past)
+		So(QueryOffset(counter, key, time.Minute, 0), ShouldEqual, counter.Query(key, time.Minute))
+	})
+}
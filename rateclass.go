@@ -0,0 +1,136 @@
+package sketchy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Rate classes, from RateClass. Each class above RateLow covers rates a
+// constant factor higher than the one below it (see WithRateClasses).
+const (
+	RateIdle    = iota // Below the low rate, including 0.
+	RateLow            // At least the low rate.
+	RateMedium         // At least factor times the low rate.
+	RateHigh           // At least factor² times the low rate.
+	RateExtreme        // At least factor³ times the low rate.
+)
+
+// Default rate classes: low from 1 event per second, and each class ten
+// times the one below it.
+const (
+	DefaultRateClassLow    = 1.0
+	DefaultRateClassFactor = 10.0
+)
+
+var rateClassNames = [...]string{"idle", "low", "medium", "high", "extreme"}
+
+// RateClassName returns the name of the given rate class, e.g. "medium".
+func RateClassName(class int) string {
+	if class < 0 || class >= len(rateClassNames) {
+		return fmt.Sprintf("RateClass(%d)", class)
+	}
+	return rateClassNames[class]
+}
+
+// WithRateClasses sets the classes RateClass maps rates into: a rate of
+// at least low events per second is RateLow, and each class from there
+// starts at factor times the rate of the one before, so that with the
+// defaults of 1 and 10, 150 events per second is RateHigh. Low must be
+// positive and factor greater than 1.
+func WithRateClasses(low, factor float64) Option {
+	if !(low > 0) || !(factor > 1) {
+		panic(fmt.Sprintf("sketchy: rate classes from %v by %v need a positive low rate and a factor above 1", low, factor))
+	}
+	return func(o *options) { o.classes = &rateClasses{low: low, factor: factor} }
+}
+
+type rateClasses struct {
+	low, factor float64
+}
+
+// class returns the class of rate, using the default classes if c is nil.
+func (c *rateClasses) class(rate float64) int {
+	low, factor := DefaultRateClassLow, DefaultRateClassFactor
+	if c != nil {
+		low, factor = c.low, c.factor
+	}
+	class := RateIdle
+	for threshold := low; class < RateExtreme && rate >= threshold; threshold *= factor {
+		class++
+	}
+	return class
+}
+
+// WithOnClassChange makes RateClass call f when the class it finds for a
+// key and interval differs from the one it last found for them, starting
+// from RateIdle, so that changes of class can be acted on. The keys are
+// those given to RateClass, and f is called synchronously, after RateClass
+// has recorded the new class, so it may call the counter's methods.
+//
+// Changes are only seen by calls to RateClass: a key that drifts between
+// classes without being classed triggers nothing, and two calls see one
+// change however many classes lie between them. The last class is kept for
+// each key and interval that is classed above RateIdle, and dropped once it
+// is RateIdle again, so keys that stop being classed while above RateIdle
+// are kept until they are.
+func WithOnClassChange(f func(key []byte, interval time.Duration, from, to int)) Option {
+	return func(o *options) { o.classChanges = &classWatch{f: f, last: map[classKey]int{}} }
+}
+
+// classWatch remembers the last class of each key and interval classed
+// above RateIdle.
+type classWatch struct {
+	f func(key []byte, interval time.Duration, from, to int)
+
+	m    sync.Mutex
+	last map[classKey]int
+}
+
+type classKey struct {
+	k        hashKernel
+	interval time.Duration
+}
+
+// observe records that the key with hash k is in class over interval,
+// calling w.f if that is a change. It does nothing if w is nil.
+func (w *classWatch) observe(key []byte, k hashKernel, interval time.Duration, class int) {
+	if w == nil {
+		return
+	}
+	ck := classKey{k: k, interval: interval}
+	w.m.Lock()
+	from := w.last[ck] // RateIdle if absent
+	if class == RateIdle {
+		delete(w.last, ck)
+	} else {
+		w.last[ck] = class
+	}
+	w.m.Unlock()
+
+	if class != from {
+		w.f(key, interval, from, class)
+	}
+}
+
+// RateClass returns the class of the key's rate over the given interval,
+// from RateIdle to RateExtreme, so that log lines can carry a small
+// classification rather than a rate, and changes of class can be acted on
+// (see WithOnClassChange).
+func (rl *rollingCounter) RateClass(key []byte, interval time.Duration) int {
+	h := rl.prehash(key)
+	class := rl.classes.class(rl.QueryHandle(h, interval))
+	rl.classChanges.observe(key, h.k, interval, class)
+	return class
+}
+
+// RateClass returns the class of the key's rate over the given interval,
+// from RateIdle to RateExtreme, so that log lines can carry a small
+// classification rather than a rate, and changes of class can be acted on
+// (see WithOnClassChange).
+func (rc *rollupCounter) RateClass(key []byte, interval time.Duration) int {
+	h := rc.prehash(key)
+	class := rc.classes.class(rc.QueryHandle(h, interval))
+	rc.classChanges.observe(key, h.k, interval, class)
+	return class
+}
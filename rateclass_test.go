@@ -0,0 +1,93 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateClass(t *testing.T) {
+	Convey("Rates are classed logarithmically", t, func() {
+		var defaults *rateClasses
+		So(defaults.class(0), ShouldEqual, RateIdle)
+		So(defaults.class(0.99), ShouldEqual, RateIdle)
+		So(defaults.class(1), ShouldEqual, RateLow)
+		So(defaults.class(9.9), ShouldEqual, RateLow)
+		So(defaults.class(10), ShouldEqual, RateMedium)
+		So(defaults.class(150), ShouldEqual, RateHigh)
+		So(defaults.class(1000), ShouldEqual, RateExtreme)
+		So(defaults.class(1e12), ShouldEqual, RateExtreme)
+
+		custom := &rateClasses{low: 0.5, factor: 4}
+		So(custom.class(0.4), ShouldEqual, RateIdle)
+		So(custom.class(1.9), ShouldEqual, RateLow)
+		So(custom.class(2), ShouldEqual, RateMedium)
+		So(custom.class(8), ShouldEqual, RateHigh)
+		So(custom.class(32), ShouldEqual, RateExtreme)
+	})
+
+	Convey("Classes have names", t, func() {
+		So(RateClassName(RateIdle), ShouldEqual, "idle")
+		So(RateClassName(RateExtreme), ShouldEqual, "extreme")
+		So(RateClassName(7), ShouldEqual, "RateClass(7)")
+	})
+
+	Convey("Counters class their rates", t, func() {
+		now := time.Now()
+		clock := func() time.Time { return now }
+		key := []byte("key")
+		for _, counter := range []RateSketch{
+			RollingParams{Interval: time.Minute, NumIntervals: 10}.New(WithClock(clock), WithRateClasses(0.5, 4)),
+			RollupParams{Durations: []time.Duration{time.Minute, time.Hour}}.New(WithClock(clock), WithRateClasses(0.5, 4)),
+		} {
+			So(RateClass(counter, key, time.Minute), ShouldEqual, RateIdle)
+			Add(counter, key, 60)
+			now = now.Add(time.Minute)
+			So(RateClass(counter, key, time.Minute), ShouldEqual, RateLow)
+			Add(counter, key, 600)
+			now = now.Add(time.Minute)
+			So(RateClass(counter, key, time.Minute), ShouldEqual, RateHigh)
+		}
+	})
+
+	Convey("Changes of class call the hook", t, func() {
+		now := time.Now()
+		type change struct {
+			key      string
+			from, to int
+		}
+		var changes []change
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(
+			WithClock(func() time.Time { return now }),
+			WithOnClassChange(func(key []byte, interval time.Duration, from, to int) {
+				So(interval, ShouldEqual, time.Minute)
+				changes = append(changes, change{string(key), from, to})
+			}))
+		key := []byte("key")
+
+		So(RateClass(counter, key, time.Minute), ShouldEqual, RateIdle)
+		So(changes, ShouldBeEmpty)
+		Add(counter, key, 60)
+		now = now.Add(time.Minute)
+		So(RateClass(counter, key, time.Minute), ShouldEqual, RateLow)
+		So(RateClass(counter, key, time.Minute), ShouldEqual, RateLow)
+		Add(counter, key, 6000)
+		now = now.Add(time.Minute)
+		So(RateClass(counter, key, time.Minute), ShouldEqual, RateHigh)
+		now = now.Add(time.Hour)
+		So(RateClass(counter, key, time.Minute), ShouldEqual, RateIdle)
+
+		So(changes, ShouldResemble, []change{
+			{"key", RateIdle, RateLow},
+			{"key", RateLow, RateHigh},
+			{"key", RateHigh, RateIdle},
+		})
+		So(counter.(*rollingCounter).classChanges.last, ShouldBeEmpty)
+	})
+
+	Convey("Rate classes must be increasing", t, func() {
+		So(func() { WithRateClasses(0, 10) }, ShouldPanic)
+		So(func() { WithRateClasses(1, 1) }, ShouldPanic)
+	})
+}
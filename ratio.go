@@ -0,0 +1,51 @@
+package sketchy
+
+import "time"
+
+// A Ratio divides the rates of keys in one counter by their rates in
+// another, such as errors by requests, for alerting on error ratios per
+// client. Both rates are measured over the same range, so the counters
+// should cover the same events, for example by counting them with AddAll.
+type Ratio struct {
+	numerator, denominator RateSketch
+}
+
+// NewRatio returns a Ratio of the rates in numerator to those in
+// denominator.
+func NewRatio(numerator, denominator RateSketch) *Ratio {
+	return &Ratio{numerator: numerator, denominator: denominator}
+}
+
+// Query returns the ratio of the key's rate in the numerator to its rate in
+// the denominator over the given interval, ending at the same moment in
+// both: now, according to the denominator. If the denominator's rate is 0,
+// 0 is returned. Counters that aren't RangeQueriers are queried as of their
+// own now instead.
+func (r *Ratio) Query(key []byte, interval time.Duration) float64 {
+	_, num := r.numerator.(RangeQuerier)
+	_, den := r.denominator.(RangeQuerier)
+	if !num || !den {
+		d := r.denominator.Query(key, interval)
+		if d == 0 {
+			return 0
+		}
+		return r.numerator.Query(key, interval) / d
+	}
+	now := time.Now()
+	if t, ok := r.denominator.(timedAdder); ok {
+		now = t.now()
+	}
+	return r.QueryBetween(key, now.Add(-interval), now)
+}
+
+// QueryBetween returns the ratio of the key's rate in the numerator to its
+// rate in the denominator between from and to. If the denominator's rate is
+// 0, 0 is returned. If either counter isn't a RangeQuerier, NaN is
+// returned.
+func (r *Ratio) QueryBetween(key []byte, from, to time.Time) float64 {
+	d := QueryBetween(r.denominator, key, from, to)
+	if d == 0 {
+		return 0
+	}
+	return QueryBetween(r.numerator, key, from, to) / d
+}
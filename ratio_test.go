@@ -0,0 +1,32 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRatio(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	now := start
+	clock := func() time.Time { return now }
+	key := []byte("client")
+
+	Convey("Ratios divide the rates of the same range", t, func() {
+		requests := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(WithClock(clock))
+		failures := RollingParams{Interval: time.Minute, NumIntervals: 10}.New(WithClock(clock))
+		ratio := NewRatio(failures, requests)
+		So(ratio.Query(key, time.Minute), ShouldEqual, 0)
+
+		for i := 0; i < 5; i++ {
+			AddAll(Event{requests, key, 100}, Event{failures, key, i * 10})
+			now = now.Add(time.Minute)
+		}
+		So(ratio.Query(key, time.Minute), ShouldAlmostEqual, 0.4)
+		So(ratio.Query(key, 2*time.Minute), ShouldAlmostEqual, 0.35)
+		So(ratio.QueryBetween(key, start, start.Add(time.Minute)), ShouldEqual, 0)
+		So(ratio.QueryBetween(key, start.Add(time.Minute), start.Add(2*time.Minute)), ShouldAlmostEqual, 0.1)
+		So(ratio.Query([]byte("other"), time.Minute), ShouldEqual, 0)
+	})
+}
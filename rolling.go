@@ -3,12 +3,15 @@ package sketchy
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Counter provides an interface for tracking the rate at which keys are
-// observed.
+// observed. The package's counters also implement the optional interfaces
+// declared with the functions that use them, such as Adder and Forecaster.
 type RateSketch interface {
 	// Count records delta occurrences of key, returning the updated observed
 	// rate over the given interval. If interval is smaller than time.Second,
@@ -24,25 +27,57 @@ type RateSketch interface {
 type sketchWithTime struct {
 	CountSketch *fnvSketch
 	Time        time.Time
+
+	// Registers summarizing the bucket's keys. They are nil in buckets
+	// decoded from older encodings.
+	Distinct  hll
+	Signature minHash
+}
+
+func newBucket(cs *fnvSketch, now time.Time) sketchWithTime {
+	return sketchWithTime{CountSketch: cs, Time: now, Distinct: newHLL(), Signature: newMinHash()}
 }
 
 func (b *sketchWithTime) Count(key []byte, delta int) uint64 {
 	if b.CountSketch == nil {
 		return 0
 	}
-	return b.CountSketch.Count(key, delta)
+	min, _ := b.count(b.CountSketch.Variant.hash(key), delta)
+	return min
+}
+
+// count is Count for the key with the given hash, also returning the largest
+// of the key's counters.
+func (b *sketchWithTime) count(k hashKernel, delta int) (min, max uint64) {
+	if b.CountSketch == nil {
+		return 0, 0
+	}
+	if b.Distinct != nil {
+		b.Distinct.add(k)
+	}
+	if b.Signature != nil {
+		b.Signature.add(k)
+	}
+	return b.CountSketch.count(k, delta)
 }
 
 func (b *sketchWithTime) Query(key []byte) uint64 {
 	if b.CountSketch == nil {
 		return 0
 	}
-	return b.CountSketch.Query(key)
+	return b.query(b.CountSketch.Variant.hash(key))
+}
+
+func (b *sketchWithTime) query(k hashKernel) uint64 {
+	if b.CountSketch == nil {
+		return 0
+	}
+	return b.CountSketch.query(k)
 }
 
 // RollingCounter maintains a series of count-min sketches to count events in
 // time-based buckets. Counts are always applied to the "current" bucket
-// (which is reinitialized as needed). Rate queries can use multiple buckets
+// (which is reinitialized as needed), except by CountAt. Rate queries can use multiple buckets
 // to account for the interval of the query.
 //
 // The interval given to this constructor specifies the maximum duration of
@@ -50,12 +85,14 @@ func (b *sketchWithTime) Query(key []byte) uint64 {
 // then a new bucket is created. If the maximum number of buckets (given
 // by num) is exceeded, then the oldest bucket is forgotten.
 func RollingCounter(epsilon, delta float64, interval time.Duration, num int) RateSketch {
-	return &rollingCounter{
+	rl := &rollingCounter{
 		Epsilon:      epsilon,
 		Delta:        delta,
 		Interval:     interval,
 		NumIntervals: num,
 	}
+	rl.storeBuckets(nil)
+	return rl
 }
 
 type rollingCounter struct {
@@ -63,10 +100,54 @@ type rollingCounter struct {
 	Delta        float64       // Delta parameter for new buckets.
 	Interval     time.Duration // The duration covered by each bucket.
 	NumIntervals int           // The maximum number of buckets.
+	Variant      HashVariant   // The hash of every bucket.
+	Exact        bool          // Whether buckets count exactly.
+
+	options
+	clock    func() time.Time
+	m        sync.Mutex   // serializes writers
+	buckets  atomic.Value // bucketState, replaced wholesale by writers
+	restored time.Time    // when the state restored by GobDecode was encoded
+
+	latestEvent int64            // Unix time in ns of the latest event counted, for the watermark
+	late        map[int64]uint64 // late occurrences by bucket start in Unix ns
+
+	spread      spreadStats  // of counts into the current bucket, for tuning
+	recommended SketchParams // by tuning at the last rotation
+}
+
+// bucketState is what readers see of a counter: its buckets, and the
+// parameters they were made with, which GobDecode may change along with
+// them. It is never modified; writers holding rl.m replace it with
+// storeBuckets instead, so readers may use it without locking, and always
+// see buckets together with their parameters.
+type bucketState struct {
+	buckets  []sketchWithTime
+	interval time.Duration
+	num      int
+	variant  HashVariant
+}
 
-	clock   func() time.Time
-	m       sync.Mutex
-	buckets []sketchWithTime
+// view returns the counter's current bucketState. Readers that don't hold
+// rl.m must take the parameters from it rather than the counter's fields.
+// A counter that has never stored any, such as a zero value, is viewed
+// with no buckets and the parameters of its fields.
+func (rl *rollingCounter) view() bucketState {
+	if v, ok := rl.buckets.Load().(bucketState); ok {
+		return v
+	}
+	return bucketState{interval: rl.Interval, num: rl.NumIntervals, variant: rl.Variant}
+}
+
+// loadBuckets returns the current list of buckets. The returned slice is
+// never modified, so readers may use it without locking.
+func (rl *rollingCounter) loadBuckets() []sketchWithTime { return rl.view().buckets }
+
+// storeBuckets replaces the counter's buckets, publishing them with its
+// current parameters. The caller must hold rl.m, or be constructing the
+// counter.
+func (rl *rollingCounter) storeBuckets(buckets []sketchWithTime) {
+	rl.buckets.Store(bucketState{buckets: buckets, interval: rl.Interval, num: rl.NumIntervals, variant: rl.Variant})
 }
 
 func (rl *rollingCounter) now() time.Time {
@@ -78,17 +159,30 @@ func (rl *rollingCounter) now() time.Time {
 }
 
 func (rl *rollingCounter) query(
-	key []byte, now time.Time, interval time.Duration, latest uint64) (float64, time.Duration) {
+	k hashKernel, now time.Time, interval time.Duration, latest uint64, o *options) (float64, time.Duration) {
+
+	return rl.queryDetail(k, now, interval, latest, o, nil)
+}
+
+// queryDetail is query, additionally accumulating a description of the
+// buckets it consulted into detail if it's non-nil.
+func (rl *rollingCounter) queryDetail(k hashKernel, now time.Time, interval time.Duration, latest uint64,
+	o *options, detail *QueryDetail) (float64, time.Duration) {
 
 	var (
-		tc float64
-		td time.Duration
+		tc   float64
+		td   time.Duration
+		nb   int
+		ip   bool
+		rate float64 // of the last bucket counted, for ExponentialInterpolation
 	)
 
+	v := rl.view()
+	buckets := v.buckets
 	intervalStart := now.Add(-interval)
-	for i := len(rl.buckets) - 1; interval > 0 && i >= 0; i-- {
+	for i := len(buckets) - 1; interval > 0 && i >= 0; i-- {
 		// figure out how much time the bucket accounts for
-		d := now.Sub(rl.buckets[i].Time)
+		d := now.Sub(buckets[i].Time)
 		if d <= 0 {
 			continue
 		}
@@ -96,103 +190,278 @@ func (rl *rollingCounter) query(
 
 		// determine number of counts in bucket
 		var n float64
-		if i == len(rl.buckets)-1 && latest != 0 {
+		if i == len(buckets)-1 && latest != 0 {
 			n = float64(latest)
 		} else {
-			n = float64(rl.buckets[i].Query(key))
+			n = float64(buckets[i].query(k))
+		}
+		newer := rate
+		rate = n / float64(d)
+
+		// if the bucket was closed after now, only count the part before now
+		if i < len(buckets)-1 {
+			if end := v.closes(i); now.Before(end) {
+				full := end.Sub(buckets[i].Time)
+				if o.interpolation == NoInterpolation {
+					d = full
+				} else {
+					rate = n / float64(full)
+					n = n * o.interpolation.share(float64(d)/float64(full), rate, v.closedRate(i-1, k))
+				}
+			}
 		}
 
 		// if our interval begins after this bucket's start time, scale the count
-		if intervalStart.After(rl.buckets[i].Time) {
+		if intervalStart.After(buckets[i].Time) {
 			// d2 is amount of time between interval start and now that is covered
-			end := rl.buckets[i].Time.Add(rl.Interval)
+			end := buckets[i].Time.Add(v.interval)
 			if end.After(now) {
 				end = now
 			}
 			d2 := end.Sub(intervalStart)
-			if d-d2 > rl.Interval {
+			if d-d2 > v.interval {
 				break
 			}
-			n = n * float64(d2) / float64(d)
-			d = now.Sub(intervalStart)
+			if o.interpolation != NoInterpolation {
+				n = n * o.interpolation.share(float64(d2)/float64(d), rate, newer)
+				d = now.Sub(intervalStart)
+				ip = true
+			}
 		}
 
 		tc += n
 		td += d
-		now = rl.buckets[i].Time
+		nb++
+		now = buckets[i].Time
+	}
+	if detail != nil {
+		detail.Events += tc
 	}
 	if td < time.Second {
 		return 0, 0
 	}
+	if detail != nil {
+		detail.Covered += td
+		detail.Buckets += nb
+		detail.Interpolated = detail.Interpolated || ip
+	}
 	return tc, td
 }
 
-func (rl *rollingCounter) count(key []byte, delta int, now time.Time, interval time.Duration) (
-	float64, time.Duration) {
+func (rl *rollingCounter) count(
+	h KeyHandle, delta int, now time.Time, interval time.Duration, o *options) (float64, time.Duration) {
+
+	latest := rl.add(h.k, delta, now, o)
+	o.dict.observe(h, latest)
+	return rl.query(h.k, now, interval, latest, o)
+}
 
+// add records delta occurrences of the key with the given hash in the current bucket, starting a new
+// bucket first if necessary, and returns the key's updated count in that
+// bucket. The caller must hold rl.m.
+func (rl *rollingCounter) add(k hashKernel, delta int, now time.Time, o *options) uint64 {
+	buckets := rl.loadBuckets()
+	if len(buckets) == 0 || o.due(buckets[len(buckets)-1].Time, now, rl.Interval) {
+		buckets = rl.rotate(o.bucketStart(now, rl.Interval), o)
+	}
+	min, max := buckets[len(buckets)-1].count(k, delta)
+	rl.observeEvent(now)
+	if o.tuning != nil {
+		rl.spread.observe(min, max)
+	}
+	return min
+}
+
+// rotate starts a new bucket at start, forgetting the oldest bucket if the
+// maximum number of buckets has been reached, and returns the new list of
+// buckets. The caller must hold rl.m.
+func (rl *rollingCounter) rotate(start time.Time, o *options) []sketchWithTime {
 	getWithDefault := func(v, def float64) float64 {
 		if v == 0 {
 			return def
 		}
 		return v
 	}
+	if o.tuning != nil {
+		rl.retune(o.tuning)
+	}
 	epsilon := getWithDefault(rl.Epsilon, DefaultEpsilon)
 	d := getWithDefault(rl.Delta, DefaultDelta)
 
-	if len(rl.buckets) == 0 {
-		rl.buckets = []sketchWithTime{
-			{
-				CountSketch: NewSketch(epsilon, d).(*fnvSketch),
-				Time:        now,
-			},
-		}
-	} else if diff := now.Sub(rl.buckets[len(rl.buckets)-1].Time); diff >= rl.Interval {
-		newSketch := sketchWithTime{
-			CountSketch: NewSketch(epsilon, d).(*fnvSketch),
-			Time:        now,
+	newSketch := func() *fnvSketch {
+		var cs *fnvSketch
+		if rl.Exact {
+			cs = ExactSketch().(*fnvSketch)
+		} else {
+			cs = NewSketch(epsilon, d).(*fnvSketch)
 		}
-		if len(rl.buckets) >= rl.NumIntervals {
-			// shift buckets over by one
-			copy(rl.buckets, rl.buckets[1:])
-			rl.buckets[len(rl.buckets)-1] = newSketch
+		cs.Variant = rl.Variant
+		cs.Layout = o.layout
+		cs.Conservative = o.conservative
+		return cs
+	}
+
+	buckets := rl.loadBuckets()
+	var next []sketchWithTime
+	if len(buckets) > 0 && len(buckets) >= rl.NumIntervals {
+		// recycle the oldest bucket's matrix, then shift buckets over by one
+		cs := buckets[0].CountSketch
+		if cs != nil && cs.Exact != nil && rl.Exact {
+			cs = cs.reset()
+		} else if cs != nil && cs.Exact == nil && !rl.Exact && cs.Epsilon == epsilon && cs.Delta == d &&
+			cs.Variant == rl.Variant && cs.Layout == o.layout && cs.Conservative == o.conservative {
+			cs = cs.reset()
 		} else {
-			rl.buckets = append(rl.buckets, newSketch)
+			cs = newSketch()
 		}
+		next = make([]sketchWithTime, len(buckets))
+		copy(next, buckets[1:])
+		next[len(next)-1] = newBucket(cs, start)
+	} else {
+		next = make([]sketchWithTime, len(buckets)+1)
+		copy(next, buckets)
+		next[len(buckets)] = newBucket(newSketch(), start)
 	}
+	rl.storeBuckets(next)
+	rl.pruneLate(next)
+	o.rotated(rl.Interval, start)
+	return next
+}
 
-	return rl.query(key, now, interval, rl.buckets[len(rl.buckets)-1].Count(key, delta))
+// Rollover closes the current bucket and starts a new one, even if the
+// current bucket's interval hasn't elapsed.
+func (rl *rollingCounter) Rollover() {
+	rl.lock(&rl.m)
+	defer rl.m.Unlock()
+
+	rl.rotate(rl.now(), &rl.options)
 }
 
 // Query returns the observed rate of the given key over the given interval.
 // If interval is smaller than time.Second, or the available data covers
 // less than a second, then 0 is returned.
+//
+// Query does not take the counter's lock, so it never waits on Count.
 func (rl *rollingCounter) Query(key []byte, interval time.Duration) float64 {
-	rl.m.Lock()
-	defer rl.m.Unlock()
+	return rl.QueryHandle(rl.prehash(key), interval)
+}
 
-	if len(rl.buckets) == 0 {
+// QueryHandle is Query for a key hashed in advance by Prehash.
+func (rl *rollingCounter) QueryHandle(h KeyHandle, interval time.Duration) float64 {
+	h = rl.view().variant.handle(h)
+	now := rl.now()
+	if rl.privacy == nil && !rl.precheck.mayContain(h.k, now, rl.horizon()) {
 		return 0
 	}
-
-	tc, d := rl.query(key, rl.now(), interval, 0)
-	if d == 0 {
-		return 0
+	if rate, ok := rl.cache.get(h.k, interval, now); ok {
+		return rate
 	}
-	return (tc / float64(d)) * float64(time.Second)
+	end, latest := rl.complete(now)
+	rate := rl.privacy.rate(rl.queryAt(h.k, end, interval), h.k, interval, latest)
+	rl.cache.put(h.k, interval, now, rate)
+	return rate
 }
 
 // Count records delta occurrences of key, returning the updated observed
 // rate over the given interval. If interval is smaller than time.Second,
 // or the available data covers less than a second, then 0 is returned.
 func (rl *rollingCounter) Count(key []byte, delta int, interval time.Duration) float64 {
-	rl.m.Lock()
+	return rl.CountHandle(rl.prehash(key), delta, interval)
+}
+
+// CountHandle is Count for a key hashed in advance by Prehash.
+func (rl *rollingCounter) CountHandle(h KeyHandle, delta int, interval time.Duration) float64 {
+	rate, _ := rl.countAndCheck(rl.view().variant.handle(h), delta, interval, false)
+	return rate
+}
+
+// CountUint64 is Count for the 8-byte big-endian encoding of key.
+func (rl *rollingCounter) CountUint64(key uint64, delta int, interval time.Duration) float64 {
+	v := rl.view().variant
+	return rl.CountHandle(KeyHandle{k: v.hashUint64(key), v: v}, delta, interval)
+}
+
+// QueryUint64 is Query for the 8-byte big-endian encoding of key.
+func (rl *rollingCounter) QueryUint64(key uint64, interval time.Duration) float64 {
+	v := rl.view().variant
+	return rl.QueryHandle(KeyHandle{k: v.hashUint64(key), v: v}, interval)
+}
+
+// Add records delta occurrences of key, without computing its updated rate.
+func (rl *rollingCounter) Add(key []byte, delta int) {
+	rl.addAt(key, delta, rl.now())
+}
+
+// addAt is Add for an event that happened at now.
+func (rl *rollingCounter) addAt(key []byte, delta int, now time.Time) {
+	start := rl.hooks.countStarted()
+	defer rl.hooks.counted(start)
+
+	delta, ok := rl.scale(delta, now)
+	if !ok {
+		return
+	}
+
+	rl.lock(&rl.m)
 	defer rl.m.Unlock()
 
-	tc, d := rl.count(key, delta, rl.now(), interval)
-	if d == 0 {
-		return 0
+	h := rl.prehash(key)
+	rl.precheck.add(h.k, now, rl.horizon())
+	rl.dict.observe(h, rl.add(h.k, delta, now, &rl.options))
+}
+
+// countAndCheck implements Count for a prehashed key. If check is true, it
+// also reports whether the key was absent from every bucket before it was
+// counted.
+func (rl *rollingCounter) countAndCheck(h KeyHandle, delta int, interval time.Duration, check bool) (float64, bool) {
+	start := rl.hooks.countStarted()
+	defer rl.hooks.counted(start)
+
+	delta, ok := rl.scale(delta, rl.now())
+	if !ok {
+		return rl.QueryHandle(h, interval), check && !rl.seen(h.k)
+	}
+
+	rl.lock(&rl.m)
+	defer rl.m.Unlock()
+
+	isNew := check && !rl.seen(h.k)
+	now := rl.now()
+	rl.precheck.add(h.k, now, rl.horizon())
+	tc, d := rl.count(h, delta, now, interval, &rl.options)
+	return rl.countRate(h.k, tc, d, interval, rl.latest()), isNew
+}
+
+// countRate returns the rate of tc events counted by Count over d, with
+// noise if the counter is private.
+func (o *options) countRate(k hashKernel, tc float64, d, interval time.Duration, latest time.Time) float64 {
+	detail := QueryDetail{Covered: d, Events: tc}
+	if d != 0 {
+		detail.Rate = (tc / float64(d)) * float64(time.Second)
 	}
-	return (tc / float64(d)) * float64(time.Second)
+	return o.privacy.rate(detail, k, interval, latest)
+}
+
+// rollingVersion is the version of the encoding written by
+// rollingCounter.GobEncode. Version 0 encodings, written before the version
+// was recorded, are a sequence of separate gob values rather than a single
+// rollingState, and version 1 encodings are a bare rollingState. From
+// version 2 on the rollingState is framed with its length and checksum.
+// GobDecode accepts them all.
+const rollingVersion = 2
+
+// rollingState is the encoded form of a rollingCounter. Fields may be added,
+// but never removed or reinterpreted, without bumping rollingVersion.
+type rollingState struct {
+	Version      int
+	Epsilon      float64
+	Delta        float64
+	Interval     time.Duration
+	NumIntervals int
+	Buckets      []sketchWithTime
+	Time         time.Time   // when the state was encoded; zero before this was recorded
+	Variant      HashVariant // of every bucket; FNV1 before this was recorded
+	Exact        bool        // whether buckets count exactly
 }
 
 // GobEncode returns the gob encoding of the current state of the counter.
@@ -200,23 +469,159 @@ func (rl *rollingCounter) GobEncode() ([]byte, error) {
 	rl.m.Lock()
 	defer rl.m.Unlock()
 
+	return rl.encode(rl.loadBuckets())
+}
+
+// encode returns the gob encoding of the counter with the given buckets.
+// The caller must hold rl.m.
+func (rl *rollingCounter) encode(buckets []sketchWithTime) ([]byte, error) {
 	buf := &bytes.Buffer{}
-	encoder := gob.NewEncoder(buf)
-	for _, v := range []interface{}{rl.Epsilon, rl.Delta, rl.Interval, rl.NumIntervals, rl.buckets} {
-		if err := encoder.Encode(v); err != nil {
-			return nil, err
-		}
+	err := gob.NewEncoder(buf).Encode(rollingState{
+		Version:      rollingVersion,
+		Epsilon:      rl.Epsilon,
+		Delta:        rl.Delta,
+		Interval:     rl.Interval,
+		NumIntervals: rl.NumIntervals,
+		Buckets:      buckets,
+		Time:         rl.now(),
+		Variant:      rl.Variant,
+		Exact:        rl.Exact,
+	})
+	if err != nil {
+		rl.snapshot(0, err)
+		return nil, err
 	}
-	return buf.Bytes(), nil
+	data := frame(buf.Bytes())
+	rl.snapshot(len(data), nil)
+	return data, nil
 }
 
-// GobDecode resets the counter to the gob-encoded state provided in data.
+// GobDecode resets the counter to the gob-encoded state provided in data,
+// which may have been written by any version of the package. The state is
+// validated in full before any of it is applied, so the counter is left
+// unchanged if data is corrupt. Encodings that are truncated or fail their
+// checksum are rejected with ErrChecksum.
+//
+// If the counter was created with WithMaxRestoredAge, buckets that ended too
+// long ago are discarded. If the encoding's parameters differ from the
+// counter's, WithParamsPolicy decides whether they are adopted.
 func (rl *rollingCounter) GobDecode(data []byte) error {
 	rl.m.Lock()
 	defer rl.m.Unlock()
 
+	state, err := decodeRolling(data)
+	if err == nil {
+		err = validateRolling(state.Epsilon, state.Delta, state.Interval, state.NumIntervals, state.Variant, state.Buckets)
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrCorruptEncoding, err)
+		rl.decodeRejected(err)
+		return err
+	}
+	if err := rl.reconcile(state); err != nil {
+		rl.decodeRejected(err)
+		return err
+	}
+
+	rl.restored = state.Time
+	rl.precheck.reset()
+	buckets := state.Buckets
+	if rl.maxRestoredAge > 0 {
+		cutoff := rl.now().Add(-rl.maxRestoredAge)
+		for len(buckets) > 0 && !buckets[0].Time.Add(rl.Interval).After(cutoff) {
+			buckets = buckets[1:]
+		}
+	}
+	rl.storeBuckets(buckets)
+	return nil
+}
+
+// rollingHeader is the part of a rollingState that bounds what decoding the
+// rest may allocate. Decoding into it skips the buckets' matrices and
+// registers, reading only their dimensions.
+type rollingHeader struct {
+	Version      int
+	Epsilon      float64
+	Delta        float64
+	Interval     time.Duration
+	NumIntervals int
+	Variant      HashVariant
+	Buckets      []bucketHeader
+}
+
+type bucketHeader struct {
+	CountSketch *struct{ Width, Depth uint }
+}
+
+// check validates the header, so that decoding the state it describes
+// allocates no more buckets, and no larger sketches, than a valid state
+// would have.
+func (h *rollingHeader) check() error {
+	if err := validateRolling(h.Epsilon, h.Delta, h.Interval, h.NumIntervals, h.Variant, nil); err != nil {
+		return err
+	}
+	if len(h.Buckets) > h.NumIntervals {
+		return fmt.Errorf("%d buckets exceed the %d intervals", len(h.Buckets), h.NumIntervals)
+	}
+	for i, b := range h.Buckets {
+		if cs := b.CountSketch; cs != nil && cs.Width*cs.Depth > maxDecodedCells {
+			return fmt.Errorf("bucket %d: sketch of %dx%d is too large", i, cs.Width, cs.Depth)
+		}
+	}
+	return nil
+}
+
+// decodeRolling decodes a rollingState of any version. It decodes and checks
+// the header first, and decodes the buckets in full only if it passes.
+func decodeRolling(data []byte) (*rollingState, error) {
+	data, framed, err := unframe(data)
+	if err != nil {
+		return nil, err
+	}
+	header := &rollingHeader{}
+	if err = decodeAll(data, header); err != nil {
+		if framed {
+			return nil, err
+		}
+		return decodeRollingV0(data, err)
+	}
+	if header.Version < 1 || header.Version > rollingVersion {
+		return nil, fmt.Errorf("unsupported version %d", header.Version)
+	}
+	if framed != (header.Version >= 2) {
+		return nil, fmt.Errorf("version %d encoding is wrongly framed", header.Version)
+	}
+	if err := header.check(); err != nil {
+		return nil, err
+	}
+	state := &rollingState{}
+	if err := decodeAll(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// decodeRollingV0 decodes a version 0 encoding, returning err, the error
+// from decoding it as a later version, if it isn't one either.
+func decodeRollingV0(data []byte, err error) (*rollingState, error) {
+	header := &rollingHeader{}
+	if decodeAll(data, &header.Epsilon, &header.Delta, &header.Interval, &header.NumIntervals, &header.Buckets) != nil {
+		return nil, err
+	}
+	if err := header.check(); err != nil {
+		return nil, err
+	}
+	v0 := &rollingState{}
+	if err := decodeAll(data, &v0.Epsilon, &v0.Delta, &v0.Interval, &v0.NumIntervals, &v0.Buckets); err != nil {
+		return nil, err
+	}
+	return v0, nil
+}
+
+// decodeAll decodes consecutive gob values from data into vs.
+func decodeAll(data []byte, vs ...interface{}) error {
 	decoder := gob.NewDecoder(bytes.NewReader(data))
-	for _, v := range []interface{}{&rl.Epsilon, &rl.Delta, &rl.Interval, &rl.NumIntervals, &rl.buckets} {
+	for _, v := range vs {
 		if err := decoder.Decode(v); err != nil {
 			return err
 		}
@@ -224,27 +629,74 @@ func (rl *rollingCounter) GobDecode(data []byte) error {
 	return nil
 }
 
+// maxDecodedCells bounds the size of the sketches a decoded counter may
+// allocate, so that a small encoding can't demand an enormous matrix.
+const maxDecodedCells = 1 << 24
+
+func validateRolling(epsilon, delta float64, interval time.Duration, num int, variant HashVariant,
+	buckets []sketchWithTime) error {
+
+	if !(epsilon >= 0 && epsilon < 1 && delta >= 0 && delta < 1) {
+		return fmt.Errorf("epsilon and delta must be in [0, 1)")
+	}
+	if !variant.valid() {
+		return fmt.Errorf("unknown hash variant %d", variant)
+	}
+	if epsilon != 0 || delta != 0 {
+		params := SketchParams{Epsilon: epsilon, Delta: delta}.withDefaults()
+		if width, depth := sketchSize(params.Epsilon, params.Delta); width*depth > maxDecodedCells {
+			return fmt.Errorf("sketches of %dx%d are too large", width, depth)
+		}
+	}
+	if interval <= 0 || num < 0 {
+		return fmt.Errorf("invalid interval %s or number of intervals %d", interval, num)
+	}
+	for i, b := range buckets {
+		if b.CountSketch == nil {
+			continue
+		}
+		if err := b.CountSketch.validate(); err != nil {
+			return fmt.Errorf("bucket %d: %s", i, err)
+		}
+		if b.CountSketch.Variant != variant {
+			return fmt.Errorf("bucket %d: hashed with %s, not %s", i, b.CountSketch.Variant, variant)
+		}
+		if b.Distinct != nil && len(b.Distinct) != hllWords {
+			return fmt.Errorf("bucket %d: distinct keys register has wrong size", i)
+		}
+		if b.Signature != nil && len(b.Signature) != minHashBins {
+			return fmt.Errorf("bucket %d: signature has wrong size", i)
+		}
+	}
+	return nil
+}
+
 func RollupCounter(epsilon, delta float64, durations ...time.Duration) RateSketch {
 	rc := &rollupCounter{Levels: make([]*rollingCounter, len(durations)-1)}
 	for i := 1; i < len(durations); i++ {
 		from := durations[i-1]
 		to := durations[i]
-		rc.Levels[i-1] = &rollingCounter{
-			Epsilon:      epsilon,
-			Delta:        delta,
-			Interval:     from,
-			NumIntervals: int(to / from),
-		}
+		num := int(to / from)
 		if to%from > 0 {
-			rc.Levels[i-1].NumIntervals++
+			num++
 		}
+		rc.Levels[i-1] = RollingCounter(epsilon, delta, from, num).(*rollingCounter)
 	}
 	return rc
 }
 
 type rollupCounter struct {
 	Levels []*rollingCounter
-	clock  func() time.Time
+	options
+	clock func() time.Time
+}
+
+// variant returns the hash the counter's levels use.
+func (rc *rollupCounter) variant() HashVariant {
+	if len(rc.Levels) == 0 {
+		return FNV1
+	}
+	return rc.Levels[0].view().variant
 }
 
 func (rc *rollupCounter) now() time.Time {
@@ -259,43 +711,131 @@ func (rc *rollupCounter) now() time.Time {
 // If interval is smaller than time.Second, or the available data covers
 // less than a second, then 0 is returned.
 func (rc *rollupCounter) Query(key []byte, interval time.Duration) float64 {
+	return rc.QueryHandle(rc.prehash(key), interval)
+}
+
+// QueryHandle is Query for a key hashed in advance by Prehash.
+func (rc *rollupCounter) QueryHandle(h KeyHandle, interval time.Duration) float64 {
+	h = rc.variant().handle(h)
 	now := rc.now()
-	tc := float64(0)
-	td := time.Duration(0)
-	for _, c := range rc.Levels {
-		if interval <= 0 {
-			break
-		}
-		n, d := c.query(key, now, interval, 0)
-		tc += n
-		td += d
-		now = now.Add(-d)
-		interval -= d
-	}
-	if td == 0 {
+	if rc.privacy == nil && !rc.precheck.mayContain(h.k, now, rc.horizon()) {
 		return 0
 	}
-	return (tc / float64(td)) * float64(time.Second)
+	if rate, ok := rc.cache.get(h.k, interval, now); ok {
+		return rate
+	}
+	rate := rc.privacy.rate(rc.queryAt(h.k, now, interval), h.k, interval, rc.latest())
+	rc.cache.put(h.k, interval, now, rate)
+	return rate
+}
+
+// Rollover closes the current bucket of every level and starts new ones.
+func (rc *rollupCounter) Rollover() {
+	now := rc.now()
+	for _, c := range rc.Levels {
+		rc.lock(&c.m)
+		c.rotate(now, &rc.options)
+		c.m.Unlock()
+	}
 }
 
 // Count records delta occurrences of key, returning the updated observed
 // rate over the given interval. If interval is smaller than time.Second,
 // or the available data covers less than a second, then 0 is returned.
 func (rc *rollupCounter) Count(key []byte, delta int, interval time.Duration) float64 {
+	return rc.CountHandle(rc.prehash(key), delta, interval)
+}
+
+// CountHandle is Count for a key hashed in advance by Prehash.
+func (rc *rollupCounter) CountHandle(h KeyHandle, delta int, interval time.Duration) float64 {
+	rate, _ := rc.countAndCheck(rc.variant().handle(h), delta, interval, false)
+	return rate
+}
+
+// CountUint64 is Count for the 8-byte big-endian encoding of key.
+func (rc *rollupCounter) CountUint64(key uint64, delta int, interval time.Duration) float64 {
+	v := rc.variant()
+	return rc.CountHandle(KeyHandle{k: v.hashUint64(key), v: v}, delta, interval)
+}
+
+// QueryUint64 is Query for the 8-byte big-endian encoding of key.
+func (rc *rollupCounter) QueryUint64(key uint64, interval time.Duration) float64 {
+	v := rc.variant()
+	return rc.QueryHandle(KeyHandle{k: v.hashUint64(key), v: v}, interval)
+}
+
+// Add records delta occurrences of key in every level, without computing its
+// updated rate.
+func (rc *rollupCounter) Add(key []byte, delta int) {
+	rc.addAt(key, delta, rc.now())
+}
+
+// addAt is Add for an event that happened at now.
+func (rc *rollupCounter) addAt(key []byte, delta int, now time.Time) {
+	start := rc.hooks.countStarted()
+	defer rc.hooks.counted(start)
+
+	delta, ok := rc.scale(delta, now)
+	if !ok {
+		return
+	}
+
+	h := rc.prehash(key)
+	rc.precheck.add(h.k, now, rc.horizon())
+	for i, c := range rc.Levels {
+		rc.lock(&c.m)
+		latest := c.add(h.k, delta, now, &rc.options)
+		c.m.Unlock()
+		if i == 0 {
+			rc.dict.observe(h, latest)
+		}
+	}
+}
+
+// countAndCheck implements Count for a prehashed key. If check is true, it
+// also reports whether the key was absent from every level before it was
+// counted. Each level is checked under the same lock as it is counted into,
+// so of several concurrent first counts of a key only one can be reported
+// as new.
+func (rc *rollupCounter) countAndCheck(h KeyHandle, delta int, interval time.Duration, check bool) (float64, bool) {
+	start := rc.hooks.countStarted()
+	defer rc.hooks.counted(start)
+
 	now := rc.now()
+	delta, ok := rc.scale(delta, now)
+	if !ok {
+		return rc.QueryHandle(h, interval), check && !rc.seen(h.k)
+	}
+
+	rc.precheck.add(h.k, now, rc.horizon())
 	tc := float64(0)
 	td := time.Duration(0)
-	for _, c := range rc.Levels {
-		if interval < 0 {
-			interval = 0
+	rest, end := interval, now
+	isNew := check
+	for i, c := range rc.Levels {
+		// Every level must record the event, but once the interval has been
+		// covered the remaining levels needn't be queried. As in queryAt,
+		// each level answers for the part of the interval before the finer
+		// levels', so that no event is counted twice.
+		rc.lock(&c.m)
+		if isNew && c.seen(h.k) {
+			isNew = false
 		}
-		n, d := c.count(key, delta, now, interval)
-		tc += n
-		td += d
-		interval -= d
-	}
-	if td == 0 {
-		return 0
+		latest := c.add(h.k, delta, now, &rc.options)
+		if i == 0 {
+			rc.dict.observe(h, latest)
+		}
+		if rest > 0 {
+			if !end.Equal(now) {
+				latest = 0
+			}
+			n, d := c.query(h.k, end, rest, latest, &rc.options)
+			tc += n
+			td += d
+			rest -= d
+			end = end.Add(-d)
+		}
+		c.m.Unlock()
 	}
-	return (tc / float64(td)) * float64(time.Second)
+	return rc.countRate(h.k, tc, td, interval, rc.latest()), isNew
 }
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"math/rand"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,26 +36,26 @@ func TestRollingCounter(t *testing.T) {
 
 		So(counter.Query(key, 90*time.Second), ShouldEqual, 0)
 
-		counter.buckets = []sketchWithTime{
+		counter.storeBuckets([]sketchWithTime{
 			{
 				CountSketch: NewSketch(0, 0).(*fnvSketch),
 				Time:        now,
 			},
-		}
+		})
 
 		now = now.Add(30 * time.Second)
 		So(counter.Query(key, 15*time.Second), ShouldEqual, 0)
-		counter.buckets[0].Count(key, 60)
+		counter.loadBuckets()[0].Count(key, 60)
 		So(counter.Query(key, 15*time.Second), ShouldEqual, 2.0)
 		now = now.Add(30 * time.Second)
 		So(counter.Query(key, 90*time.Second), ShouldEqual, 1.0)
 
-		counter.buckets = append(counter.buckets, sketchWithTime{
+		counter.storeBuckets(append(counter.loadBuckets(), sketchWithTime{
 			CountSketch: NewSketch(0, 0).(*fnvSketch),
 			Time:        now,
-		})
+		}))
 		So(counter.Query(key, 90*time.Second), ShouldEqual, 1.0)
-		counter.buckets[1].Count(key, 30)
+		counter.loadBuckets()[1].Count(key, 30)
 		So(counter.Query(key, 90*time.Second), ShouldEqual, 1.0)
 		now = now.Add(time.Second)
 		So(counter.Query(key, 90*time.Second), ShouldEqual, 90.0/61)
@@ -134,6 +136,86 @@ func TestRollingCounter(t *testing.T) {
 		So(counter.Query(key, 600*time.Second), ShouldAlmostEqual, 1./419.0)
 	})
 
+	Convey("Add records without querying", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 3).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		counter.Add(key, 60)
+		now = now.Add(time.Minute)
+		counter.Add(key, 120)
+		So(len(counter.loadBuckets()), ShouldEqual, 2)
+		So(counter.Query(key, time.Minute), ShouldEqual, 1)
+	})
+
+	Convey("Rollover starts a new bucket early", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 3).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		counter.Count(key, 30, 0)
+		now = now.Add(30 * time.Second)
+		counter.Rollover()
+		counter.Count(key, 10, 0)
+		So(len(counter.loadBuckets()), ShouldEqual, 2)
+		So(counter.loadBuckets()[1].Query(key), ShouldEqual, 10)
+
+		now = now.Add(10 * time.Second)
+		So(counter.Query(key, 10*time.Second), ShouldEqual, 1)
+		So(counter.Query(key, 40*time.Second), ShouldEqual, 1)
+
+		// the new bucket lasts a full interval from the rollover
+		now = now.Add(45 * time.Second)
+		counter.Count(key, 1, 0)
+		So(len(counter.loadBuckets()), ShouldEqual, 2)
+	})
+
+	Convey("Recycled buckets start empty", t, func() {
+		counter := RollingCounter(0, 0, 60*time.Second, 2).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		counter.Count(key, 100, 0)
+		oldest := counter.loadBuckets()[0].CountSketch
+		now = now.Add(time.Minute)
+		counter.Count(key, 1, 0)
+		now = now.Add(time.Minute)
+		counter.Count(key, 2, 0)
+
+		buckets := counter.loadBuckets()
+		So(len(buckets), ShouldEqual, 2)
+		So(&buckets[1].CountSketch.Matrix[0], ShouldEqual, &oldest.Matrix[0])
+		So(buckets[1].Query(key), ShouldEqual, 2)
+		So(oldest.Epoch, ShouldEqual, 0)
+		now = now.Add(time.Minute)
+		So(counter.Query(key, 2*time.Minute), ShouldAlmostEqual, 3.0/120)
+	})
+
+	Convey("Query runs concurrently with Count", t, func() {
+		var (
+			m  sync.Mutex
+			ts = now
+		)
+		counter := RollingCounter(0, 0, time.Second, 4).(*rollingCounter)
+		counter.clock = func() time.Time {
+			m.Lock()
+			defer m.Unlock()
+			return ts
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				m.Lock()
+				ts = ts.Add(100 * time.Millisecond)
+				m.Unlock()
+				counter.Count(key, 1, 0)
+			}
+		}()
+		for i := 0; i < 1000; i++ {
+			counter.Query(key, 2*time.Second)
+		}
+		<-done
+		So(counter.Query(key, 2*time.Second), ShouldAlmostEqual, 10, 0.5)
+	})
+
 	Convey("Gob encoding/decoding should result in the same rates", t, func() {
 		n := 500
 		events := make([][]byte, 0, (n*n+n)/2)
@@ -193,6 +275,50 @@ func TestRollingCounter(t *testing.T) {
 		So(counter.Query(firstIP, 10*time.Minute), ShouldEqual, lightestRate10m)
 	})
 
+	Convey("Decoding garbage reports a corrupt encoding", t, func() {
+		err := (&rollingCounter{}).GobDecode([]byte("garbage"))
+		So(errors.Is(err, ErrCorruptEncoding), ShouldBeTrue)
+	})
+
+	Convey("Inconsistent encodings are rejected without changing the counter", t, func() {
+		bad := RollingCounter(0, 0, time.Minute, 3).(*rollingCounter)
+		cs := NewSketch(0, 0).(*fnvSketch)
+		cs.Matrix = cs.Matrix[:10]
+		bad.storeBuckets([]sketchWithTime{{CountSketch: cs, Time: now}})
+		encoding, err := bad.GobEncode()
+		So(err, ShouldBeNil)
+
+		counter := RollingCounter(0, 0, time.Hour, 5).(*rollingCounter)
+		So(errors.Is(counter.GobDecode(encoding), ErrCorruptEncoding), ShouldBeTrue)
+		So(counter.Interval, ShouldEqual, time.Hour)
+		So(counter.loadBuckets(), ShouldBeNil)
+	})
+
+	Convey("Headers are checked before buckets are decoded", t, func() {
+		encodeState := func(state rollingState) []byte {
+			buf := &bytes.Buffer{}
+			So(gob.NewEncoder(buf).Encode(state), ShouldBeNil)
+			return frame(buf.Bytes())
+		}
+		state := rollingState{Version: rollingVersion, Interval: time.Minute, NumIntervals: 1}
+		huge := &fnvSketch{Epsilon: 0.5, Delta: 0.5, Width: 1 << 20, Depth: 1 << 10, Matrix: make([]uint64, 10)}
+		state.Buckets = []sketchWithTime{{CountSketch: huge, Time: now}}
+		_, err := decodeRolling(encodeState(state))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "too large")
+
+		cs := NewSketch(0, 0).(*fnvSketch)
+		state.Buckets = []sketchWithTime{{CountSketch: cs, Time: now}, {CountSketch: cs, Time: now}}
+		_, err = decodeRolling(encodeState(state))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "exceed")
+
+		state.Buckets = state.Buckets[:1]
+		decoded, err := decodeRolling(encodeState(state))
+		So(err, ShouldBeNil)
+		So(len(decoded.Buckets), ShouldEqual, 1)
+	})
+
 	Convey("Going back in time", t, func() {
 		counter := RollingCounter(0, 0, 60*time.Second, 10).(*rollingCounter)
 		counter.clock = func() time.Time { return now }
@@ -200,7 +326,7 @@ func TestRollingCounter(t *testing.T) {
 			now = now.Add(time.Minute)
 			counter.Count(key, i+1, 0)
 		}
-		n, d := counter.query(key, now.Add(-4*time.Minute), 90*time.Second, 0)
+		n, d := counter.query(multihash(key), now.Add(-4*time.Minute), 90*time.Second, 0, &counter.options)
 		So(n, ShouldEqual, 7)
 		So(d, ShouldEqual, 90*time.Second)
 	})
@@ -230,6 +356,82 @@ func TestRollupCounter(t *testing.T) {
 		So(rollup.Count(key, 1, time.Hour), ShouldAlmostEqual, (3*(7200.0-4502.0)/4502)/3600)
 	})
 
+	Convey("Count's rate agrees with Query's across levels", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, 5*time.Minute, time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		// traffic rises, so levels answering for the same minutes would
+		// overstate the rate
+		for i := 0; i < 10; i++ {
+			rollup.Count(key, 60*(i+1), 0)
+			now = now.Add(time.Minute)
+		}
+		rate := rollup.Count(key, 0, 7*time.Minute)
+		So(rate, ShouldAlmostEqual, rollup.Query(key, 7*time.Minute))
+	})
+
+	Convey("Add records into every level", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, time.Hour, 24*time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		rollup.Add(key, 60)
+		now = now.Add(time.Minute)
+		So(rollup.Query(key, time.Minute), ShouldEqual, 1)
+		for _, level := range rollup.Levels {
+			So(level.loadBuckets()[0].Query(key), ShouldEqual, 60)
+		}
+	})
+
+	Convey("Rollover cascades to every level", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, time.Hour, 24*time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		rollup.Count(key, 1, 0)
+		now = now.Add(time.Second)
+		rollup.Rollover()
+		for _, level := range rollup.Levels {
+			So(len(level.loadBuckets()), ShouldEqual, 2)
+		}
+	})
+
+	Convey("Count records into every level even when only the first is queried", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, time.Hour, 24*time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		rollup.Count(key, 5, time.Second)
+		now = now.Add(10 * time.Second)
+		So(rollup.Count(key, 5, 10*time.Second), ShouldEqual, 1)
+		for _, level := range rollup.Levels {
+			buckets := level.loadBuckets()
+			So(buckets[len(buckets)-1].Query(key), ShouldEqual, 10)
+		}
+	})
+
+	Convey("Query runs concurrently with Count", t, func() {
+		var (
+			m  sync.Mutex
+			ts = now
+		)
+		counter := RollupCounter(0, 0, time.Second, 4*time.Second).(*rollupCounter)
+		counter.clock = func() time.Time {
+			m.Lock()
+			defer m.Unlock()
+			return ts
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				m.Lock()
+				ts = ts.Add(100 * time.Millisecond)
+				m.Unlock()
+				counter.Count(key, 1, 0)
+			}
+		}()
+		for i := 0; i < 1000; i++ {
+			counter.Query(key, 2*time.Second)
+		}
+		<-done
+		So(counter.Query(key, 2*time.Second), ShouldAlmostEqual, 10, 0.5)
+	})
+
 	Convey("Gob encoding/decoding should result in the same rates", t, func() {
 		n := 500
 		events := make([][]byte, 0, (n*n+n)/2)
@@ -0,0 +1,232 @@
+package sketchy
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// ShadowStats summarizes how far a shadow's estimates have diverged from
+// its primary's.
+type ShadowStats struct {
+	// Compared is the number of estimates compared.
+	Compared int64
+
+	// Differed is the number of them in which the shadow's estimate wasn't
+	// the primary's.
+	Differed int64
+
+	// MeanAbsDiff and MaxAbsDiff are the mean and greatest absolute
+	// difference between the estimates.
+	MeanAbsDiff float64
+	MaxAbsDiff  float64
+
+	// MeanRelDiff is the mean absolute difference relative to the primary's
+	// estimate, over the estimates in which the primary's wasn't 0.
+	MeanRelDiff float64
+}
+
+// divergence accumulates ShadowStats.
+type divergence struct {
+	m                  sync.Mutex
+	compared, differed int64
+	relative           int64
+	sumAbs, maxAbs     float64
+	sumRel             float64
+}
+
+func (d *divergence) observe(primary, shadow float64) {
+	diff := math.Abs(shadow - primary)
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.compared++
+	if diff != 0 {
+		d.differed++
+	}
+	d.sumAbs += diff
+	d.maxAbs = math.Max(d.maxAbs, diff)
+	if primary != 0 {
+		d.relative++
+		d.sumRel += diff / math.Abs(primary)
+	}
+}
+
+func (d *divergence) stats() ShadowStats {
+	d.m.Lock()
+	defer d.m.Unlock()
+	s := ShadowStats{Compared: d.compared, Differed: d.differed, MaxAbsDiff: d.maxAbs}
+	if d.compared > 0 {
+		s.MeanAbsDiff = d.sumAbs / float64(d.compared)
+	}
+	if d.relative > 0 {
+		s.MeanRelDiff = d.sumRel / float64(d.relative)
+	}
+	return s
+}
+
+// A ShadowSketch counts every key into two sketches: a primary, whose
+// estimates it returns, and a shadow, whose estimates it only compares with
+// the primary's. It is for validating a new kind of sketch, such as one
+// from NewSketchConservative, on production traffic before switching to it.
+type ShadowSketch struct {
+	CountSketch
+	shadow CountSketch
+	d      divergence
+}
+
+// NewShadowSketch returns a ShadowSketch that answers from primary and
+// compares shadow with it.
+func NewShadowSketch(primary, shadow CountSketch) *ShadowSketch {
+	return &ShadowSketch{CountSketch: primary, shadow: shadow}
+}
+
+// Divergence summarizes the estimates compared so far.
+func (s *ShadowSketch) Divergence() ShadowStats { return s.d.stats() }
+
+func (s *ShadowSketch) compare(primary, shadow uint64) uint64 {
+	s.d.observe(float64(primary), float64(shadow))
+	return primary
+}
+
+// Count counts key into both sketches, and returns the primary's estimate.
+func (s *ShadowSketch) Count(key []byte, delta int) uint64 {
+	return s.compare(s.CountSketch.Count(key, delta), s.shadow.Count(key, delta))
+}
+
+// Add counts key into both sketches.
+func (s *ShadowSketch) Add(key []byte, delta int) {
+	s.CountSketch.Add(key, delta)
+	s.shadow.Add(key, delta)
+}
+
+// Query returns the primary's estimate of key.
+func (s *ShadowSketch) Query(key []byte) uint64 {
+	return s.compare(s.CountSketch.Query(key), s.shadow.Query(key))
+}
+
+// CountHandle is Count for a key hashed in advance by Prehash.
+func (s *ShadowSketch) CountHandle(h KeyHandle, delta int) uint64 {
+	return s.compare(s.CountSketch.CountHandle(h, delta), s.shadow.CountHandle(h, delta))
+}
+
+// QueryHandle is Query for a key hashed in advance by Prehash.
+func (s *ShadowSketch) QueryHandle(h KeyHandle) uint64 {
+	return s.compare(s.CountSketch.QueryHandle(h), s.shadow.QueryHandle(h))
+}
+
+// CountUint64 is Count for the 8-byte big-endian encoding of key.
+func (s *ShadowSketch) CountUint64(key uint64, delta int) uint64 {
+	return s.compare(s.CountSketch.CountUint64(key, delta), s.shadow.CountUint64(key, delta))
+}
+
+// QueryUint64 is Query for the 8-byte big-endian encoding of key.
+func (s *ShadowSketch) QueryUint64(key uint64) uint64 {
+	return s.compare(s.CountSketch.QueryUint64(key), s.shadow.QueryUint64(key))
+}
+
+// Forget forgets key in both sketches.
+func (s *ShadowSketch) Forget(key []byte) {
+	s.CountSketch.Forget(key)
+	s.shadow.Forget(key)
+}
+
+// A ShadowCounter is a ShadowSketch for rate counters: it counts every key
+// into a primary and a shadow, and compares the rates they report. Count,
+// Query and their Handle and Uint64 forms are compared. Other queries, such
+// as QueryDetailed, should be made of the primary directly. The counters should read the same clock (see
+// WithClock), or their rates will differ by the time between them.
+type ShadowCounter struct {
+	RateSketch
+	shadow RateSketch
+	d      divergence
+}
+
+// NewShadowCounter returns a ShadowCounter that answers from primary and
+// compares shadow with it.
+func NewShadowCounter(primary, shadow RateSketch) *ShadowCounter {
+	return &ShadowCounter{RateSketch: primary, shadow: shadow}
+}
+
+// Divergence summarizes the rates compared so far.
+func (c *ShadowCounter) Divergence() ShadowStats { return c.d.stats() }
+
+func (c *ShadowCounter) compare(primary, shadow float64) float64 {
+	c.d.observe(primary, shadow)
+	return primary
+}
+
+// Count counts key into both counters, and returns the primary's rate.
+func (c *ShadowCounter) Count(key []byte, delta int, interval time.Duration) float64 {
+	return c.compare(c.RateSketch.Count(key, delta, interval), c.shadow.Count(key, delta, interval))
+}
+
+// Add counts key into both counters.
+func (c *ShadowCounter) Add(key []byte, delta int) {
+	Add(c.RateSketch, key, delta)
+	Add(c.shadow, key, delta)
+}
+
+// Query returns the primary's rate of key.
+func (c *ShadowCounter) Query(key []byte, interval time.Duration) float64 {
+	return c.compare(c.RateSketch.Query(key, interval), c.shadow.Query(key, interval))
+}
+
+// CountHandle is Count for a key hashed in advance by Prehash.
+func (c *ShadowCounter) CountHandle(h KeyHandle, delta int, interval time.Duration) float64 {
+	return c.compare(CountHandle(c.RateSketch, h, delta, interval), CountHandle(c.shadow, h, delta, interval))
+}
+
+// QueryHandle is Query for a key hashed in advance by Prehash.
+func (c *ShadowCounter) QueryHandle(h KeyHandle, interval time.Duration) float64 {
+	return c.compare(QueryHandle(c.RateSketch, h, interval), QueryHandle(c.shadow, h, interval))
+}
+
+// CountUint64 is Count for the 8-byte big-endian encoding of key.
+func (c *ShadowCounter) CountUint64(key uint64, delta int, interval time.Duration) float64 {
+	return c.compare(CountUint64(c.RateSketch, key, delta, interval), CountUint64(c.shadow, key, delta, interval))
+}
+
+// QueryUint64 is Query for the 8-byte big-endian encoding of key.
+func (c *ShadowCounter) QueryUint64(key uint64, interval time.Duration) float64 {
+	return c.compare(QueryUint64(c.RateSketch, key, interval), QueryUint64(c.shadow, key, interval))
+}
+
+// CountAndCheckNew counts key into both counters, and returns the primary's
+// rate and whether the primary hadn't seen it.
+func (c *ShadowCounter) CountAndCheckNew(key []byte, delta int, interval time.Duration) (float64, bool) {
+	rate, isNew := CountAndCheckNew(c.RateSketch, key, delta, interval)
+	shadow, _ := CountAndCheckNew(c.shadow, key, delta, interval)
+	return c.compare(rate, shadow), isNew
+}
+
+// Forget forgets key in both counters.
+func (c *ShadowCounter) Forget(key []byte) {
+	Forget(c.RateSketch, key)
+	Forget(c.shadow, key)
+}
+
+// Rollover starts a new bucket in both counters.
+func (c *ShadowCounter) Rollover() {
+	Rollover(c.RateSketch)
+	Rollover(c.shadow)
+}
+
+// now returns the time according to the primary.
+func (c *ShadowCounter) now() time.Time {
+	if t, ok := c.RateSketch.(timedAdder); ok {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// addAt records delta occurrences of key at now in both counters, so AddAll
+// gives them the same timestamp.
+func (c *ShadowCounter) addAt(key []byte, delta int, now time.Time) {
+	for _, counter := range []RateSketch{c.RateSketch, c.shadow} {
+		if t, ok := counter.(timedAdder); ok {
+			t.addAt(key, delta, now)
+		} else {
+			Add(counter, key, delta)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package sketchy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShadowSketch(t *testing.T) {
+	Convey("Shadows are counted into, but the primary answers", t, func() {
+		primary, shadow := NewSketch(0.9, 0.9), NewSketchConservative(0.9, 0.9)
+		s := NewShadowSketch(primary, shadow)
+		for i := 0; i < 5000; i++ {
+			s.Count([]byte(fmt.Sprint(i%500)), 1)
+		}
+		for i := 0; i < 500; i++ {
+			key := []byte(fmt.Sprint(i))
+			So(s.Query(key), ShouldEqual, primary.Query(key))
+		}
+		So(shadow.Query([]byte("0")), ShouldBeGreaterThanOrEqualTo, 10)
+
+		stats := s.Divergence()
+		So(stats.Compared, ShouldEqual, 5500)
+		So(stats.Differed, ShouldBeGreaterThan, 0)
+		So(stats.MaxAbsDiff, ShouldBeGreaterThanOrEqualTo, stats.MeanAbsDiff)
+		So(stats.MeanRelDiff, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("Identical sketches don't diverge", t, func() {
+		s := NewShadowSketch(NewSketch(0, 0), NewSketch(0, 0))
+		s.Add([]byte("key"), 3)
+		So(s.CountUint64(1, 1), ShouldEqual, 1)
+		So(s.QueryHandle(Prehash([]byte("key"))), ShouldEqual, 3)
+		So(s.Divergence(), ShouldResemble, ShadowStats{Compared: 2, MeanRelDiff: 0})
+	})
+}
+
+func TestShadowCounter(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	Convey("Estimated rates can be compared with exact ones", t, func() {
+		p := RollingParams{SketchParams: SketchParams{Epsilon: 0.9, Delta: 0.9}, Interval: time.Minute, NumIntervals: 5}
+		exact := ExactCounter(time.Minute, 5).(*rollingCounter)
+		exact.clock = clock
+		c := NewShadowCounter(p.New(WithClock(clock)), exact)
+		for i := 0; i < 3000; i++ {
+			c.Count([]byte(fmt.Sprint(i%300)), 1, 0)
+			AddAll(Event{Counter: c, Key: []byte("all"), Delta: 1})
+			now = now.Add(100 * time.Millisecond)
+		}
+		So(exact.Query([]byte("all"), 5*time.Minute), ShouldAlmostEqual, 10)
+		So(c.Query([]byte("all"), 5*time.Minute), ShouldBeGreaterThanOrEqualTo, 10)
+
+		stats := c.Divergence()
+		So(stats.Compared, ShouldEqual, 3001)
+		So(stats.Differed, ShouldBeGreaterThan, 0)
+	})
+}
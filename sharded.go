@@ -0,0 +1,172 @@
+package sketchy
+
+import "time"
+
+// ShardedRateSketch partitions keys among several rate counters, so that
+// writers to different keys rarely contend for the same lock. Each key is
+// routed to one shard by jump consistent hashing
+// (https://arxiv.org/abs/1406.2294), so adding a shard to the end of the
+// list moves only 1/n of the keys.
+//
+// A ShardedRateSketch is itself a RateSketch. Queries about a single key
+// consult its shard; queries about the whole population combine every shard.
+type ShardedRateSketch struct {
+	shards []RateSketch
+}
+
+// NewShardedRateSketch returns a ShardedRateSketch over the given counters,
+// which must be non-empty. Every counter should have the same parameters.
+func NewShardedRateSketch(shards ...RateSketch) *ShardedRateSketch {
+	if len(shards) == 0 {
+		panic("sketchy: sharded rate sketch needs at least one shard")
+	}
+	return &ShardedRateSketch{shards: shards}
+}
+
+// Shard returns the counter that key is routed to.
+func (s *ShardedRateSketch) Shard(key []byte) RateSketch { return s.shard(multihash(key)) }
+
+// shard returns the counter that the key with the given FNV1 hash is routed
+// to, whatever hash the counters use.
+func (s *ShardedRateSketch) shard(k hashKernel) RateSketch {
+	return s.shards[jumpHash(mix64(uint64(k)), len(s.shards))]
+}
+
+// jumpHash maps x to one of n buckets.
+func jumpHash(x uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		x = x*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((x>>33)+1)))
+	}
+	return int(b)
+}
+
+// Count records delta occurrences of key in its shard, returning the updated
+// observed rate over the given interval.
+func (s *ShardedRateSketch) Count(key []byte, delta int, interval time.Duration) float64 {
+	return s.Shard(key).Count(key, delta, interval)
+}
+
+// Add records delta occurrences of key in its shard.
+func (s *ShardedRateSketch) Add(key []byte, delta int) {
+	Add(s.Shard(key), key, delta)
+}
+
+// CountHandle is Count for a key hashed in advance by Prehash.
+func (s *ShardedRateSketch) CountHandle(h KeyHandle, delta int, interval time.Duration) float64 {
+	return CountHandle(s.shard(FNV1.handle(h).k), h, delta, interval)
+}
+
+// QueryHandle is Query for a key hashed in advance by Prehash.
+func (s *ShardedRateSketch) QueryHandle(h KeyHandle, interval time.Duration) float64 {
+	return QueryHandle(s.shard(FNV1.handle(h).k), h, interval)
+}
+
+// CountUint64 is Count for the 8-byte big-endian encoding of key.
+func (s *ShardedRateSketch) CountUint64(key uint64, delta int, interval time.Duration) float64 {
+	return CountUint64(s.shard(uint64hash(key)), key, delta, interval)
+}
+
+// QueryUint64 is Query for the 8-byte big-endian encoding of key.
+func (s *ShardedRateSketch) QueryUint64(key uint64, interval time.Duration) float64 {
+	return QueryUint64(s.shard(uint64hash(key)), key, interval)
+}
+
+// Query returns the observed rate of the given key over the given interval,
+// from its shard.
+func (s *ShardedRateSketch) Query(key []byte, interval time.Duration) float64 {
+	return s.Shard(key).Query(key, interval)
+}
+
+// QueryAll returns the sum of the observed rates of the given key over the
+// given interval in every shard. It differs from Query only if the key has
+// been counted in more than one shard, as happens after shards are added.
+func (s *ShardedRateSketch) QueryAll(key []byte, interval time.Duration) float64 {
+	var rate float64
+	for _, shard := range s.shards {
+		rate += shard.Query(key, interval)
+	}
+	return rate
+}
+
+// QuerySmoothed returns the smoothed rate of the given key from its shard.
+func (s *ShardedRateSketch) QuerySmoothed(key []byte, k int, sm Smoothing) float64 {
+	return QuerySmoothed(s.Shard(key), key, k, sm)
+}
+
+// QueryDetailed returns the observed rate of the given key over the given
+// interval, and a description of the data behind it, from its shard.
+func (s *ShardedRateSketch) QueryDetailed(key []byte, interval time.Duration) QueryDetail {
+	return QueryDetailed(s.Shard(key), key, interval)
+}
+
+// VsBaseline compares the key's rate over the last window with its rate over
+// the same window one day and one week ago, from its shard.
+func (s *ShardedRateSketch) VsBaseline(key []byte, window time.Duration) float64 {
+	return VsBaseline(s.Shard(key), key, window)
+}
+
+// Forecast predicts the key's rate horizon from now, from its shard.
+func (s *ShardedRateSketch) Forecast(key []byte, horizon time.Duration) float64 {
+	return Forecast(s.Shard(key), key, horizon)
+}
+
+// RateClass returns the class of the key's rate over the given interval,
+// from its shard.
+func (s *ShardedRateSketch) RateClass(key []byte, interval time.Duration) int {
+	return RateClass(s.Shard(key), key, interval)
+}
+
+// CountAndCheckNew records delta occurrences of key in its shard, and
+// reports whether the shard had not seen the key.
+func (s *ShardedRateSketch) CountAndCheckNew(key []byte, delta int, interval time.Duration) (float64, bool) {
+	return CountAndCheckNew(s.Shard(key), key, delta, interval)
+}
+
+// Rollover starts a new bucket in every shard.
+func (s *ShardedRateSketch) Rollover() {
+	for _, shard := range s.shards {
+		Rollover(shard)
+	}
+}
+
+// Stats describes every shard. Rate is the total over all shards, and
+// Buckets lists the buckets of each shard in turn.
+func (s *ShardedRateSketch) Stats() Stats {
+	var stats Stats
+	for _, shard := range s.shards {
+		st := StatsOf(shard)
+		stats.Rate += st.Rate
+		stats.Buckets = append(stats.Buckets, st.Buckets...)
+	}
+	return stats
+}
+
+// DistinctKeys returns the estimated number of distinct keys counted over
+// the given interval in all shards. Since each key is counted in only one
+// shard, this is the sum of the shards' estimates.
+func (s *ShardedRateSketch) DistinctKeys(interval time.Duration) float64 {
+	var n float64
+	for _, shard := range s.shards {
+		n += DistinctKeys(shard, interval)
+	}
+	return n
+}
+
+// Overlap estimates the similarity of the sets of keys counted over the last
+// w1 and the w2 before that, in all shards. It is the average of the shards'
+// similarities, weighted by the number of distinct keys in each.
+func (s *ShardedRateSketch) Overlap(w1, w2 time.Duration) float64 {
+	var sum, weights float64
+	for _, shard := range s.shards {
+		n := DistinctKeys(shard, w1+w2)
+		sum += n * Overlap(shard, w1, w2)
+		weights += n
+	}
+	if weights == 0 {
+		return 0
+	}
+	return sum / weights
+}
@@ -0,0 +1,90 @@
+package sketchy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShardedRateSketch(t *testing.T) {
+	now := time.Now()
+
+	newShards := func(n int) []RateSketch {
+		shards := make([]RateSketch, n)
+		for i := range shards {
+			rl := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+			rl.clock = func() time.Time { return now }
+			shards[i] = rl
+		}
+		return shards
+	}
+
+	Convey("Jump hashing spreads keys evenly and moves few on growth", t, func() {
+		counts := make([]int, 10)
+		moved := 0
+		for i := 0; i < 10000; i++ {
+			x := mix64(uint64(multihash([]byte(fmt.Sprintf("key%d", i)))))
+			b := jumpHash(x, 10)
+			counts[b]++
+			if jumpHash(x, 11) != b {
+				moved++
+			}
+		}
+		for _, c := range counts {
+			So(c, ShouldAlmostEqual, 1000, 150)
+		}
+		So(moved, ShouldAlmostEqual, 10000/11, 150)
+		So(jumpHash(12345, 1), ShouldEqual, 0)
+	})
+
+	Convey("Keys are counted and queried in their own shard", t, func() {
+		shards := newShards(4)
+		sharded := NewShardedRateSketch(shards...)
+		key := []byte("key")
+		sharded.Count(key, 60, 0)
+		now = now.Add(time.Minute)
+
+		So(sharded.Query(key, time.Minute), ShouldEqual, 1)
+		So(sharded.QueryAll(key, time.Minute), ShouldEqual, 1)
+		So(sharded.Shard(key).Query(key, time.Minute), ShouldEqual, 1)
+		So(sharded.QueryDetailed(key, time.Minute).Events, ShouldEqual, 60)
+		So(sharded.QuerySmoothed(key, 1, Boxcar), ShouldEqual, 1)
+		_, isNew := sharded.CountAndCheckNew(key, 1, 0)
+		So(isNew, ShouldBeFalse)
+
+		// the key moves to a new shard if it's chosen differently
+		for _, shard := range shards {
+			if shard != sharded.Shard(key) {
+				shard.Count(key, 60, 0)
+				break
+			}
+		}
+		now = now.Add(time.Minute)
+		So(sharded.QueryAll(key, time.Minute), ShouldAlmostEqual, sharded.Query(key, time.Minute)+1)
+	})
+
+	Convey("Population queries combine every shard", t, func() {
+		sharded := NewShardedRateSketch(newShards(4)...)
+		for i := 0; i < 1000; i++ {
+			sharded.Count([]byte(fmt.Sprintf("key%d", i)), 1, 0)
+		}
+		now = now.Add(time.Minute)
+		for i := 0; i < 1000; i++ {
+			sharded.Count([]byte(fmt.Sprintf("key%d", i)), 1, 0)
+		}
+		now = now.Add(time.Minute)
+
+		So(sharded.DistinctKeys(2*time.Minute), ShouldAlmostEqual, 1000, 60)
+		So(sharded.Overlap(time.Minute, time.Minute), ShouldBeGreaterThan, 0.9)
+		So(sharded.Stats().Rate, ShouldAlmostEqual, 2000.0/120, 0.01)
+
+		sharded.Rollover()
+		So(len(sharded.Stats().Buckets), ShouldEqual, 12)
+	})
+
+	Convey("At least one shard is required", t, func() {
+		So(func() { NewShardedRateSketch() }, ShouldPanic)
+	})
+}
@@ -0,0 +1,243 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package sketchy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	shmMagic      = 0x736b6368 // "skch"
+	shmVersion    = 1
+	shmHeaderSize = 64
+)
+
+// A SharedSketch is a CountSketch whose counters live in memory shared
+// between processes. It must be closed when no longer needed.
+type SharedSketch interface {
+	CountSketch
+	io.Closer
+}
+
+// NewSharedSketch opens the count-min sketch stored in the file at path,
+// creating it with the given parameters if it doesn't exist. The file is
+// mapped into memory, so every process that opens the same path counts into
+// the same matrix. On Linux, a path under /dev/shm gives a POSIX
+// shared-memory segment that is never written to disk.
+//
+// If the file already exists, its parameters must match epsilon and delta
+// (subject to the same defaults as NewSketch).
+func NewSharedSketch(path string, epsilon, delta float64) (SharedSketch, error) {
+	params := NewSketch(epsilon, delta).(*fnvSketch)
+	params.Matrix = nil
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		f, err = createSharedSketch(path, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < shmHeaderSize {
+		return nil, fmt.Errorf("%w: %s: file too small for shared sketch", ErrCorruptEncoding, path)
+	}
+
+	data, err := syscall.Mmap(
+		int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &shmSketch{data: data}
+	if err := s.load(params, fi.Size()); err != nil {
+		syscall.Munmap(data)
+		return nil, fmt.Errorf("%w (%s)", err, path)
+	}
+	return s, nil
+}
+
+// createSharedSketch initializes a new segment under a temporary name and
+// links it into place, so other processes never observe a partial header.
+// If another process wins the race, its segment is opened instead.
+func createSharedSketch(path string, params *fnvSketch) (*os.File, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	header := make([]byte, shmHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], shmMagic)
+	binary.LittleEndian.PutUint32(header[4:], shmVersion)
+	binary.LittleEndian.PutUint64(header[8:], uint64(params.Width))
+	binary.LittleEndian.PutUint64(header[16:], uint64(params.Depth))
+	binary.LittleEndian.PutUint64(header[24:], math.Float64bits(params.Epsilon))
+	binary.LittleEndian.PutUint64(header[32:], math.Float64bits(params.Delta))
+
+	size := int64(shmHeaderSize) + 8*int64(params.Width*params.Depth)
+	err = tmp.Truncate(size)
+	if err == nil {
+		_, err = tmp.WriteAt(header, 0)
+	}
+	if err == nil {
+		err = os.Link(tmp.Name(), path)
+	}
+	if err != nil && !os.IsExist(err) {
+		tmp.Close()
+		return nil, err
+	}
+	if err == nil {
+		return tmp, nil
+	}
+	tmp.Close()
+	return os.OpenFile(path, os.O_RDWR, 0)
+}
+
+type shmSketch struct {
+	data   []byte
+	width  uint
+	depth  uint
+	matrix []uint64
+}
+
+func (s *shmSketch) load(params *fnvSketch, size int64) error {
+	if binary.LittleEndian.Uint32(s.data[0:]) != shmMagic {
+		return fmt.Errorf("%w: not a shared sketch", ErrCorruptEncoding)
+	}
+	if v := binary.LittleEndian.Uint32(s.data[4:]); v != shmVersion {
+		return fmt.Errorf("%w: unsupported shared sketch version %d", ErrCorruptEncoding, v)
+	}
+	s.width = uint(binary.LittleEndian.Uint64(s.data[8:]))
+	s.depth = uint(binary.LittleEndian.Uint64(s.data[16:]))
+	epsilon := math.Float64frombits(binary.LittleEndian.Uint64(s.data[24:]))
+	delta := math.Float64frombits(binary.LittleEndian.Uint64(s.data[32:]))
+	if epsilon != params.Epsilon || delta != params.Delta ||
+		s.width != params.Width || s.depth != params.Depth {
+		return fmt.Errorf("%w: shared sketch has epsilon=%v delta=%v, want epsilon=%v delta=%v",
+			ErrIncompatibleSketch, epsilon, delta, params.Epsilon, params.Delta)
+	}
+	if size != int64(shmHeaderSize)+8*int64(s.width*s.depth) {
+		return fmt.Errorf("%w: shared sketch size doesn't match its parameters", ErrCorruptEncoding)
+	}
+	if s.width*s.depth > 0 {
+		s.matrix = unsafe.Slice((*uint64)(unsafe.Pointer(&s.data[shmHeaderSize])), s.width*s.depth)
+	}
+	return nil
+}
+
+// Count adds delta to the count of occurrences of the given key.
+// Returns the updated estimated count.
+func (s *shmSketch) Count(key []byte, delta int) uint64 { return s.count(multihash(key), delta) }
+
+// CountHandle is Count for a key hashed in advance by Prehash.
+func (s *shmSketch) CountHandle(h KeyHandle, delta int) uint64 {
+	return s.count(FNV1.handle(h).k, delta)
+}
+
+// CountUint64 is Count for the 8-byte big-endian encoding of key.
+func (s *shmSketch) CountUint64(key uint64, delta int) uint64 { return s.count(uint64hash(key), delta) }
+
+func (s *shmSketch) count(k hashKernel, delta int) uint64 {
+	if s.depth == 0 {
+		return 0
+	}
+	min := uint64(math.MaxUint64)
+
+	for i := uint(0); i < s.depth; i++ {
+		j := k.index(i, s.width)
+		if v := atomic.AddUint64(&s.matrix[i*s.width+j], uint64(delta)); v < min {
+			min = v
+		}
+	}
+
+	return min
+}
+
+// Add adds delta to the count of occurrences of the given key, without
+// computing the updated estimate.
+func (s *shmSketch) Add(key []byte, delta int) {
+	k := multihash(key)
+	for i := uint(0); i < s.depth; i++ {
+		j := k.index(i, s.width)
+		atomic.AddUint64(&s.matrix[i*s.width+j], uint64(delta))
+	}
+}
+
+// Query returns the estimated count of the given key.
+func (s *shmSketch) Query(key []byte) uint64 { return s.query(multihash(key)) }
+
+// QueryHandle is Query for a key hashed in advance by Prehash.
+func (s *shmSketch) QueryHandle(h KeyHandle) uint64 { return s.query(FNV1.handle(h).k) }
+
+// QueryUint64 is Query for the 8-byte big-endian encoding of key.
+func (s *shmSketch) QueryUint64(key uint64) uint64 { return s.query(uint64hash(key)) }
+
+func (s *shmSketch) query(k hashKernel) uint64 {
+	if s.depth == 0 {
+		return 0
+	}
+	min := uint64(math.MaxUint64)
+
+	for i := uint(0); i < s.depth; i++ {
+		j := k.index(i, s.width)
+		if v := atomic.LoadUint64(&s.matrix[i*s.width+j]); v < min {
+			min = v
+		}
+	}
+
+	return min
+}
+
+// Dimensions returns the width and depth of the shared matrix.
+func (s *shmSketch) Dimensions() (width, depth uint) { return s.width, s.depth }
+
+// Params returns the effective parameters of the sketch.
+func (s *shmSketch) Params() SketchParams {
+	var p SketchParams
+	p.Epsilon, p.Delta, _ = sizeParams(s.width, s.depth)
+	return p
+}
+
+// Forget removes, as far as it can, the key's counts from the sketch, so
+// that its estimate drops to 0. Keys that share its counters may be
+// underestimated afterwards.
+func (s *shmSketch) Forget(key []byte) {
+	k := multihash(key)
+	n := s.query(k)
+	if n == 0 {
+		return
+	}
+	for i := uint(0); i < s.depth; i++ {
+		j := k.index(i, s.width)
+		subtractCounter(&s.matrix[i*s.width+j], n)
+	}
+}
+
+// Close unmaps the shared segment. The segment itself persists until its
+// file is removed. A closed sketch has no counters: it counts nothing, and
+// every estimate from it is 0. Close must not be called concurrently with
+// other methods.
+func (s *shmSketch) Close() error {
+	if s.data == nil {
+		return nil
+	}
+	data := s.data
+	s.data, s.matrix = nil, nil
+	s.width, s.depth = 0, 0
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,95 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package sketchy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSharedSketch(t *testing.T) {
+	dir, err := os.MkdirTemp("", "sketchy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("Handles on the same path share counts", t, func() {
+		path := filepath.Join(dir, "shared")
+		a, err := NewSharedSketch(path, 0, 0)
+		So(err, ShouldBeNil)
+		defer a.Close()
+		b, err := NewSharedSketch(path, 0, 0)
+		So(err, ShouldBeNil)
+		defer b.Close()
+
+		So(a.Count([]byte("key"), 3), ShouldEqual, 3)
+		So(b.Count([]byte("key"), 4), ShouldEqual, 7)
+		So(a.Query([]byte("key")), ShouldEqual, 7)
+		So(a.Query([]byte("other")), ShouldEqual, 0)
+		b.Add([]byte("added"), 2)
+		So(a.Query([]byte("added")), ShouldEqual, 2)
+		b.Forget([]byte("added"))
+		So(a.Query([]byte("added")), ShouldEqual, 0)
+
+		Convey("and the counts outlive every handle", func() {
+			So(a.Close(), ShouldBeNil)
+			So(b.Close(), ShouldBeNil)
+			So(a.Close(), ShouldBeNil)
+
+			So(a.Count([]byte("key"), 1), ShouldEqual, 0)
+			So(a.Query([]byte("key")), ShouldEqual, 0)
+			So(a.QueryUint64(1), ShouldEqual, 0)
+			a.Add([]byte("key"), 1)
+			a.Forget([]byte("key"))
+			width, depth := a.Dimensions()
+			So(width, ShouldEqual, 0)
+			So(depth, ShouldEqual, 0)
+
+			c, err := NewSharedSketch(path, DefaultEpsilon, DefaultDelta)
+			So(err, ShouldBeNil)
+			defer c.Close()
+			So(c.Query([]byte("key")), ShouldEqual, 7)
+		})
+	})
+
+	Convey("Mismatched parameters are rejected", t, func() {
+		path := filepath.Join(dir, "mismatch")
+		a, err := NewSharedSketch(path, 0.99, 0.9)
+		So(err, ShouldBeNil)
+		defer a.Close()
+		_, err = NewSharedSketch(path, 0.999, 0.9)
+		So(errors.Is(err, ErrIncompatibleSketch), ShouldBeTrue)
+	})
+
+	Convey("Files that aren't shared sketches are rejected", t, func() {
+		path := filepath.Join(dir, "garbage")
+		So(os.WriteFile(path, make([]byte, 4096), 0600), ShouldBeNil)
+		_, err := NewSharedSketch(path, 0, 0)
+		So(errors.Is(err, ErrCorruptEncoding), ShouldBeTrue)
+	})
+}
+
+func FuzzSharedSketchHeader(f *testing.F) {
+	params := NewSketch(0.9, 0.9).(*fnvSketch)
+	header := make([]byte, shmHeaderSize+8*params.Width*params.Depth)
+	copy(header, []byte{0x68, 0x63, 0x6b, 0x73, 1, 0, 0, 0})
+	f.Add(header)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) < shmHeaderSize {
+			return
+		}
+		s := &shmSketch{data: data}
+		if err := s.load(params, int64(len(data))); err != nil {
+			return
+		}
+		s.Count([]byte("key"), 1)
+		s.Query([]byte("key"))
+	})
+}
@@ -0,0 +1,219 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sync/atomic"
+)
+
+// A SignedSketch is a Count Sketch (https://en.wikipedia.org/wiki/Count_sketch):
+// like a count-min sketch, it counts each key into one counter in each of
+// several rows, but adds or subtracts the count according to a second hash
+// of the key, so that the counts of colliding keys cancel out on average
+// instead of piling up. Its estimate of a key's count, the median of the
+// key's counters with their signs undone, is unbiased: it is as likely to
+// fall short of the true count as to exceed it.
+//
+// A count-min sketch never underestimates, which suits limits and
+// thresholds; a SignedSketch suits workloads where unbiased estimates
+// matter more, such as totals or averages over many keys' estimates, whose
+// errors cancel rather than add up. Counters are accessed atomically, so
+// Query may run concurrently with Count.
+type SignedSketch struct {
+	width, depth uint
+	variant      HashVariant
+	matrix       []int64
+}
+
+// NewSketchSigned returns a new, empty SignedSketch with the dimensions of a
+// count-min sketch with the given parameters (see NewSketch). Its errors
+// are of the same size, but fall either side of the true counts.
+func NewSketchSigned(epsilon, delta float64) *SignedSketch {
+	if epsilon == 0 {
+		epsilon = DefaultEpsilon
+	}
+	if delta == 0 {
+		delta = DefaultDelta
+	}
+	width, depth := sketchSize(epsilon, delta)
+	return &SignedSketch{width: width, depth: depth, matrix: make([]int64, width*depth)}
+}
+
+// Count adds delta to the count of occurrences of the given key, and returns
+// its updated estimate, as Query does.
+func (s *SignedSketch) Count(key []byte, delta int) uint64 {
+	return clampEstimate(s.count(s.variant.hash(key), delta))
+}
+
+// Add adds delta to the count of occurrences of the given key, without
+// computing the updated estimate.
+func (s *SignedSketch) Add(key []byte, delta int) { s.add(s.variant.hash(key), int64(delta)) }
+
+// Query returns the estimated count of the given key. An estimate below 0,
+// which collisions may cause for rare keys, is returned as 0; Estimate
+// returns it as it is.
+func (s *SignedSketch) Query(key []byte) uint64 {
+	return clampEstimate(s.estimate(s.variant.hash(key)))
+}
+
+// Estimate returns the unbiased estimate of the given key's count, which may
+// be negative.
+func (s *SignedSketch) Estimate(key []byte) int64 { return s.estimate(s.variant.hash(key)) }
+
+// CountHandle is Count for a key hashed in advance by Prehash.
+func (s *SignedSketch) CountHandle(h KeyHandle, delta int) uint64 {
+	return clampEstimate(s.count(s.variant.handle(h).k, delta))
+}
+
+// QueryHandle is Query for a key hashed in advance by Prehash.
+func (s *SignedSketch) QueryHandle(h KeyHandle) uint64 {
+	return clampEstimate(s.estimate(s.variant.handle(h).k))
+}
+
+// CountUint64 is Count for the 8-byte big-endian encoding of key.
+func (s *SignedSketch) CountUint64(key uint64, delta int) uint64 {
+	return clampEstimate(s.count(s.variant.hashUint64(key), delta))
+}
+
+// QueryUint64 is Query for the 8-byte big-endian encoding of key.
+func (s *SignedSketch) QueryUint64(key uint64) uint64 {
+	return clampEstimate(s.estimate(s.variant.hashUint64(key)))
+}
+
+// Forget removes the key's estimated count from each of its counters, so
+// that its estimate drops to 0. Since the estimate includes collisions
+// either way, keys that share those counters may be over- or
+// underestimated afterwards.
+func (s *SignedSketch) Forget(key []byte) {
+	k := s.variant.hash(key)
+	if n := s.estimate(k); n != 0 {
+		s.add(k, -n)
+	}
+}
+
+// Dimensions returns the width and depth of the sketch's matrix of counters.
+func (s *SignedSketch) Dimensions() (width, depth uint) { return s.width, s.depth }
+
+// Params returns the parameters of the count-min sketch of the same
+// dimensions.
+func (s *SignedSketch) Params() SketchParams {
+	p := SketchParams{Hash: s.variant}
+	p.Epsilon, p.Delta, _ = sizeParams(s.width, s.depth)
+	return p
+}
+
+// Merge adds every counter of o to the corresponding counter of s, so that s
+// holds the counts of both. The sketches must have the same dimensions and
+// hash variant. It doesn't lock o, which may be counted into meanwhile.
+func (s *SignedSketch) Merge(o *SignedSketch) error {
+	if s.width != o.width || s.depth != o.depth || s.variant != o.variant {
+		return fmt.Errorf("%w: signed sketches of %dx%d (%s) and %dx%d (%s) can't be merged",
+			ErrIncompatibleSketch, s.width, s.depth, s.variant, o.width, o.depth, o.variant)
+	}
+	for i := range s.matrix {
+		atomic.AddInt64(&s.matrix[i], atomic.LoadInt64(&o.matrix[i]))
+	}
+	return nil
+}
+
+// cell returns the index in the matrix of the key's counter in row i, and
+// the sign its counts are added with there. The sign is taken from a hash
+// independent of the index, so that keys sharing a counter are as likely
+// to cancel as to add up.
+func (s *SignedSketch) cell(k hashKernel, i uint) (uint, int64) {
+	sign := int64(1)
+	if mix64(uint64(k)+uint64(i)*0x9e3779b97f4a7c15)>>63 != 0 {
+		sign = -1
+	}
+	return i*s.width + k.index(i, s.width), sign
+}
+
+func (s *SignedSketch) add(k hashKernel, delta int64) {
+	for i := uint(0); i < s.depth; i++ {
+		j, sign := s.cell(k, i)
+		atomic.AddInt64(&s.matrix[j], sign*delta)
+	}
+}
+
+// count adds delta to the count of the key with the given hash and returns
+// its updated estimate.
+func (s *SignedSketch) count(k hashKernel, delta int) int64 {
+	var rows [36]int64
+	for i := uint(0); i < s.depth; i++ {
+		j, sign := s.cell(k, i)
+		rows[i] = sign * atomic.AddInt64(&s.matrix[j], sign*int64(delta))
+	}
+	return median(rows[:s.depth])
+}
+
+// estimate returns the estimated count of the key with the given hash.
+func (s *SignedSketch) estimate(k hashKernel) int64 {
+	var rows [36]int64
+	for i := uint(0); i < s.depth; i++ {
+		j, sign := s.cell(k, i)
+		rows[i] = sign * atomic.LoadInt64(&s.matrix[j])
+	}
+	return median(rows[:s.depth])
+}
+
+// median returns the median of vs, or the mean of the middle two if there
+// are an even number of them, reordering vs in the process. There are at
+// most 36, so an insertion sort serves.
+func median(vs []int64) int64 {
+	for i := 1; i < len(vs); i++ {
+		for j := i; j > 0 && vs[j] < vs[j-1]; j-- {
+			vs[j], vs[j-1] = vs[j-1], vs[j]
+		}
+	}
+	n := len(vs)
+	if n%2 == 1 {
+		return vs[n/2]
+	}
+	// halve each first, so the sum can't overflow
+	a, b := vs[n/2-1], vs[n/2]
+	return a/2 + b/2 + (a%2+b%2)/2
+}
+
+func clampEstimate(n int64) uint64 {
+	if n < 0 {
+		return 0
+	}
+	return uint64(n)
+}
+
+// signedState is the gob encoding of a SignedSketch.
+type signedState struct {
+	Width, Depth uint
+	Variant      HashVariant
+	Matrix       []int64
+}
+
+// GobEncode returns the gob encoding of the sketch.
+func (s *SignedSketch) GobEncode() ([]byte, error) {
+	state := signedState{Width: s.width, Depth: s.depth, Variant: s.variant, Matrix: make([]int64, len(s.matrix))}
+	for i := range s.matrix {
+		state.Matrix[i] = atomic.LoadInt64(&s.matrix[i])
+	}
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode replaces the sketch with the one encoded in data.
+func (s *SignedSketch) GobDecode(data []byte) error {
+	var state signedState
+	if err := decodeAll(data, &state); err != nil {
+		return fmt.Errorf("%w: %s", ErrCorruptEncoding, err)
+	}
+	if _, _, ok := sizeParams(state.Width, state.Depth); !ok || !state.Variant.valid() {
+		return fmt.Errorf("%w: signed sketch of %dx%d counters (%s)", ErrCorruptEncoding, state.Width, state.Depth, state.Variant)
+	}
+	if uint(len(state.Matrix)) != state.Width*state.Depth {
+		return fmt.Errorf("%w: signed sketch matrix size doesn't match its dimensions", ErrCorruptEncoding)
+	}
+	*s = SignedSketch{width: state.Width, depth: state.Depth, variant: state.Variant, matrix: state.Matrix}
+	return nil
+}
@@ -0,0 +1,127 @@
+package sketchy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSignedSketch(t *testing.T) {
+	Convey("Signed sketches are count sketches", t, func() {
+		var s CountSketch = NewSketchSigned(0, 0)
+		width, depth := s.Dimensions()
+		So(width, ShouldEqual, 2719)
+		So(depth, ShouldEqual, 5)
+		So(s.Params(), ShouldResemble, NewSketch(0, 0).Params())
+	})
+
+	Convey("Estimates err either way, where count-min's only overestimate", t, func() {
+		signed, cm := NewSketchSigned(0.9, 0.99), NewSketch(0.9, 0.99)
+		for i := 0; i < 2000; i++ {
+			key := []byte(fmt.Sprint("key", i))
+			signed.Add(key, 10)
+			cm.Add(key, 10)
+		}
+		var signedErr, cmErr float64
+		under := 0
+		for i := 0; i < 2000; i++ {
+			key := []byte(fmt.Sprint("key", i))
+			est := signed.Estimate(key)
+			signedErr += float64(est - 10)
+			cmErr += float64(cm.Query(key)) - 10
+			if est < 10 {
+				under++
+			}
+		}
+		So(cmErr/2000, ShouldBeGreaterThan, 500)
+		So(math.Abs(signedErr/2000), ShouldBeLessThan, 20)
+		So(under, ShouldBeGreaterThan, 500)
+	})
+
+	Convey("Heavy keys are estimated closely", t, func() {
+		s := NewSketchSigned(0.9, 0.99)
+		for i := 0; i < 1000; i++ {
+			s.Add([]byte(fmt.Sprint("light", i)), 1)
+		}
+		So(s.Count([]byte("heavy"), 10000), ShouldAlmostEqual, 10000, 100)
+		So(s.Query([]byte("heavy")), ShouldAlmostEqual, 10000, 100)
+	})
+
+	Convey("Negative estimates are clamped by Query", t, func() {
+		s := NewSketchSigned(0, 0)
+		s.Add([]byte("a"), -5)
+		So(s.Estimate([]byte("a")), ShouldEqual, -5)
+		So(s.Query([]byte("a")), ShouldEqual, 0)
+	})
+
+	Convey("Handles and numeric keys count the same keys", t, func() {
+		s := NewSketchSigned(0, 0)
+		So(s.Count([]byte("a"), 3), ShouldEqual, 3)
+		So(s.CountHandle(Prehash([]byte("a")), 2), ShouldEqual, 5)
+		So(s.QueryHandle(FNV1a.Prehash([]byte("a"))), ShouldEqual, 5)
+
+		So(s.CountUint64(7, 4), ShouldEqual, 4)
+		So(s.Query([]byte{0, 0, 0, 0, 0, 0, 0, 7}), ShouldEqual, 4)
+		So(s.QueryUint64(7), ShouldEqual, 4)
+	})
+
+	Convey("Forgotten keys drop to 0", t, func() {
+		s := NewSketchSigned(0, 0)
+		s.Add([]byte("a"), 7)
+		s.Add([]byte("b"), 3)
+		s.Forget([]byte("a"))
+		So(s.Estimate([]byte("a")), ShouldEqual, 0)
+		So(s.Query([]byte("b")), ShouldEqual, 3)
+	})
+
+	Convey("Merged sketches hold both counts", t, func() {
+		a, b := NewSketchSigned(0, 0), NewSketchSigned(0, 0)
+		a.Add([]byte("x"), 2)
+		b.Add([]byte("x"), 3)
+		b.Add([]byte("y"), 1)
+		So(a.Merge(b), ShouldBeNil)
+		So(a.Query([]byte("x")), ShouldEqual, 5)
+		So(a.Query([]byte("y")), ShouldEqual, 1)
+
+		err := a.Merge(NewSketchSigned(0.9, 0.99))
+		So(errors.Is(err, ErrIncompatibleSketch), ShouldBeTrue)
+	})
+
+	Convey("Signed sketches round-trip through gob", t, func() {
+		s := NewSketchSigned(0.9, 0.99)
+		s.Add([]byte("a"), 42)
+		buf := &bytes.Buffer{}
+		So(gob.NewEncoder(buf).Encode(s), ShouldBeNil)
+
+		var decoded SignedSketch
+		So(gob.NewDecoder(buf).Decode(&decoded), ShouldBeNil)
+		So(decoded.Query([]byte("a")), ShouldEqual, 42)
+		So(decoded.Params(), ShouldResemble, s.Params())
+	})
+
+	Convey("Corrupt encodings are rejected", t, func() {
+		for _, state := range []signedState{
+			{Width: 2, Depth: 1, Matrix: make([]int64, 2)},
+			{Width: 3, Depth: 37, Matrix: make([]int64, 3*37)},
+			{Width: 3, Depth: 1, Variant: 9, Matrix: make([]int64, 3)},
+			{Width: 3, Depth: 2, Matrix: make([]int64, 5)},
+		} {
+			buf := &bytes.Buffer{}
+			So(gob.NewEncoder(buf).Encode(state), ShouldBeNil)
+			var s SignedSketch
+			So(errors.Is(s.GobDecode(buf.Bytes()), ErrCorruptEncoding), ShouldBeTrue)
+		}
+	})
+
+	Convey("Medians of even counts are the mean of the middle two", t, func() {
+		So(median([]int64{3, 1, 2}), ShouldEqual, 2)
+		So(median([]int64{4, 1, 3, 2}), ShouldEqual, 2)
+		So(median([]int64{math.MaxInt64, math.MaxInt64}), ShouldEqual, math.MaxInt64)
+		So(median([]int64{-3, -5}), ShouldEqual, -4)
+	})
+}
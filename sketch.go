@@ -1,6 +1,11 @@
 package sketchy
 
-import "math"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+)
 
 var (
 	DefaultEpsilon = 0.999
@@ -13,18 +18,70 @@ type CountSketch interface {
 	// Returns the updated estimated count.
 	Count(key []byte, delta int) uint64
 
+	// Add adds delta to the count of occurrences of the given key, like
+	// Count, but without computing the updated estimate.
+	Add(key []byte, delta int)
+
 	// Query returns the estimated count of the given key.
 	Query(key []byte) uint64
+
+	// CountHandle is Count for a key hashed in advance by Prehash.
+	CountHandle(h KeyHandle, delta int) uint64
+
+	// QueryHandle is Query for a key hashed in advance by Prehash.
+	QueryHandle(h KeyHandle) uint64
+
+	// CountUint64 is Count for a numeric key. It is equivalent to counting
+	// the key's 8-byte big-endian encoding, without encoding it.
+	CountUint64(key uint64, delta int) uint64
+
+	// QueryUint64 is Query for a numeric key, as CountUint64 counts it.
+	QueryUint64(key uint64) uint64
+
+	// Forget removes, as far as it can, every occurrence of the given key,
+	// so that its estimated count drops to 0. Keys that collide with it
+	// may be underestimated afterwards.
+	Forget(key []byte)
+
+	// Dimensions returns the width and depth of the sketch's matrix of
+	// counters, which takes 8*width*depth bytes.
+	Dimensions() (width, depth uint)
+
+	// Params returns the effective parameters of the sketch: the epsilon
+	// and delta that its dimensions achieve, which may be closer to 1 than
+	// those it was created with.
+	Params() SketchParams
 }
 
 // fnvSketch provides a count-min sketch (http://en.wikipedia.org/wiki/Count-min_sketch)
-// using the FNV-1 hash.
+// using the FNV-1 hash. Counters are accessed atomically, so Query may run
+// concurrently with Count.
 type fnvSketch struct {
 	Epsilon float64
 	Delta   float64
 	Width   uint
 	Depth   uint
 	Matrix  []uint64
+
+	// Epoch and Stamps allow the matrix to be recycled without clearing it.
+	// When Stamps is non-nil, a counter whose stamp differs from Epoch is
+	// treated as zero. Sketches with stamps must have a single writer.
+	Epoch  uint32
+	Stamps []uint32
+
+	// Variant is the hash keys are counted with.
+	Variant HashVariant
+
+	// Layout is the arrangement of the counters in Matrix.
+	Layout Layout
+
+	// Conservative is true if counts are added by conservative update (see
+	// NewSketchConservative).
+	Conservative bool
+
+	// Exact, if non-nil, holds exact counts in place of Matrix (see
+	// ExactSketch).
+	Exact *exactCounts
 }
 
 // NewSketch returns a new, empty count-min sketch with the given parameters.
@@ -52,42 +109,230 @@ func NewSketch(epsilon, delta float64) CountSketch {
 		bucket.Delta = DefaultDelta
 	}
 	if bucket.Matrix == nil {
-		bucket.Width = uint(math.Ceil(math.E / (1 - bucket.Epsilon)))
-		bucket.Depth = uint(math.Ceil(math.Log(1 / (1 - bucket.Delta))))
+		bucket.Width, bucket.Depth = sketchSize(bucket.Epsilon, bucket.Delta)
 		bucket.Matrix = make([]uint64, bucket.Width*bucket.Depth)
 	}
 	return bucket
 }
 
+// NewSketchWithSize returns a new, empty count-min sketch with the given
+// dimensions, for sizing a sketch to a memory budget: its matrix takes
+// 8*width*depth bytes. Params reports the epsilon and delta it achieves.
+// The width must be at least 3, and the depth between 1 and 36.
+func NewSketchWithSize(width, depth uint) CountSketch {
+	epsilon, delta, ok := sizeParams(width, depth)
+	if !ok {
+		panic(fmt.Sprintf("sketchy: sketch of %dx%d counters can't be made", width, depth))
+	}
+	return NewSketch(epsilon, delta)
+}
+
+// sizeParams returns the epsilon and delta of a sketch with the given
+// dimensions, such that sketchSize gives those dimensions back. It returns
+// false if there are none.
+func sizeParams(width, depth uint) (epsilon, delta float64, ok bool) {
+	if width < 3 || depth < 1 || depth > 36 {
+		return 0, 0, false
+	}
+	epsilon = 1 - math.E/float64(width)
+	delta = 1 - math.Exp(-float64(depth))
+	// rounding may leave the parameters a hair off the dimensions' boundary
+	for i := 0; i < 64; i++ {
+		w, d := sketchSize(epsilon, delta)
+		if w == width && d == depth {
+			return epsilon, delta, true
+		}
+		if w > width {
+			epsilon = math.Nextafter(epsilon, 0)
+		} else if w < width {
+			epsilon = math.Nextafter(epsilon, 1)
+		}
+		if d > depth {
+			delta = math.Nextafter(delta, 0)
+		} else if d < depth {
+			delta = math.Nextafter(delta, 1)
+		}
+	}
+	return 0, 0, false
+}
+
+// Dimensions returns the width and depth of the sketch's matrix.
+func (r *fnvSketch) Dimensions() (width, depth uint) { return r.Width, r.Depth }
+
+// Params returns the effective parameters of the sketch.
+func (r *fnvSketch) Params() SketchParams {
+	p := SketchParams{Hash: r.Variant}
+	p.Epsilon, p.Delta, _ = sizeParams(r.Width, r.Depth)
+	return p
+}
+
+// sketchSize returns the width and depth of a sketch with the given
+// parameters.
+func sketchSize(epsilon, delta float64) (width, depth uint) {
+	width = uint(math.Ceil(math.E / (1 - epsilon)))
+	depth = uint(math.Ceil(math.Log(1 / (1 - delta))))
+	return width, depth
+}
+
+// validate checks that a decoded sketch is internally consistent, so that
+// counting into it can't index outside its matrix.
+func (r *fnvSketch) validate() error {
+	if r.Exact != nil {
+		if r.Matrix != nil || r.Stamps != nil {
+			return errors.New("exact sketch has a matrix")
+		}
+		if !r.Variant.valid() {
+			return errors.New("unknown hash variant")
+		}
+		return nil
+	}
+	if !(r.Epsilon > 0 && r.Epsilon < 1 && r.Delta > 0 && r.Delta < 1) {
+		return errors.New("epsilon and delta must be in (0, 1)")
+	}
+	if width, depth := sketchSize(r.Epsilon, r.Delta); r.Width != width || r.Depth != depth {
+		return errors.New("dimensions don't match epsilon and delta")
+	}
+	if uint(len(r.Matrix)) != r.Width*r.Depth {
+		return errors.New("matrix size doesn't match dimensions")
+	}
+	if r.Stamps != nil && len(r.Stamps) != len(r.Matrix) {
+		return errors.New("stamps don't match matrix size")
+	}
+	if !r.Variant.valid() {
+		return errors.New("unknown hash variant")
+	}
+	if !r.Layout.valid() {
+		return errors.New("unknown layout")
+	}
+	return nil
+}
+
 // Count adds delta to the count of occurrences of the given key.
 // Returns the updated estimated count.
 func (r *fnvSketch) Count(key []byte, delta int) uint64 {
-	min := uint64(math.MaxUint64)
-	k := multihash(key)
+	min, _ := r.count(r.Variant.hash(key), delta)
+	return min
+}
+
+// CountHandle is Count for a key hashed in advance by Prehash.
+func (r *fnvSketch) CountHandle(h KeyHandle, delta int) uint64 {
+	min, _ := r.count(r.Variant.handle(h).k, delta)
+	return min
+}
+
+// count adds delta to the count of occurrences of the key with the given
+// hash, and returns the smallest and largest of its updated counters. The
+// difference between them is a measure of collisions.
+func (r *fnvSketch) count(k hashKernel, delta int) (min, max uint64) {
+	if r.Exact != nil {
+		n := r.Exact.add(k, delta)
+		return n, n
+	}
+	if r.Conservative && delta > 0 {
+		return r.countConservative(k, delta)
+	}
+	min = math.MaxUint64
 
 	for i := uint(0); i < r.Depth; i++ {
-		j := uint(k.hash(i)) % r.Width
-		k := i*r.Width + j
-		r.Matrix[k] += uint64(delta)
-		if v := r.Matrix[k]; v < min {
+		k := r.offset(i, k.index(i, r.Width))
+		if r.Stamps != nil && atomic.LoadUint32(&r.Stamps[k]) != r.Epoch {
+			atomic.StoreUint64(&r.Matrix[k], 0)
+			atomic.StoreUint32(&r.Stamps[k], r.Epoch)
+		}
+		v := atomic.AddUint64(&r.Matrix[k], uint64(delta))
+		if v < min {
 			min = v
 		}
+		if v > max {
+			max = v
+		}
 	}
 
-	return min
+	return min, max
+}
+
+// Add adds delta to the count of occurrences of the given key, without
+// computing the updated estimate.
+func (r *fnvSketch) Add(key []byte, delta int) {
+	k := r.Variant.hash(key)
+	if r.Exact != nil {
+		r.Exact.add(k, delta)
+		return
+	}
+	if r.Conservative && delta > 0 {
+		r.countConservative(k, delta)
+		return
+	}
+	for i := uint(0); i < r.Depth; i++ {
+		k := r.offset(i, k.index(i, r.Width))
+		if r.Stamps != nil && atomic.LoadUint32(&r.Stamps[k]) != r.Epoch {
+			atomic.StoreUint64(&r.Matrix[k], 0)
+			atomic.StoreUint32(&r.Stamps[k], r.Epoch)
+		}
+		atomic.AddUint64(&r.Matrix[k], uint64(delta))
+	}
 }
 
 // Query returns the estimated count of the given key.
-func (r *fnvSketch) Query(key []byte) uint64 {
-	k := multihash(key)
+func (r *fnvSketch) Query(key []byte) uint64 { return r.query(r.Variant.hash(key)) }
+
+// QueryHandle is Query for a key hashed in advance by Prehash.
+func (r *fnvSketch) QueryHandle(h KeyHandle) uint64 { return r.query(r.Variant.handle(h).k) }
+
+// CountUint64 is Count for the 8-byte big-endian encoding of key.
+func (r *fnvSketch) CountUint64(key uint64, delta int) uint64 {
+	min, _ := r.count(r.Variant.hashUint64(key), delta)
+	return min
+}
+
+// QueryUint64 is Query for the 8-byte big-endian encoding of key.
+func (r *fnvSketch) QueryUint64(key uint64) uint64 { return r.query(r.Variant.hashUint64(key)) }
+
+// query returns the estimated count of the key with the given hash.
+func (r *fnvSketch) query(k hashKernel) uint64 {
+	if r.Exact != nil {
+		return r.Exact.get(k)
+	}
 	min := uint64(math.MaxUint64)
 
 	for i := uint(0); i < r.Depth; i++ {
-		j := uint(k.hash(i)) % r.Width
-		if v := r.Matrix[i*r.Width+j]; v < min {
+		if v := r.cell(r.offset(i, k.index(i, r.Width))); v < min {
 			min = v
 		}
 	}
 
 	return min
 }
+
+// cell returns the value of the counter at matrix index k, treating counters
+// stamped with a previous epoch as zero.
+func (r *fnvSketch) cell(k uint) uint64 {
+	if r.Stamps != nil && atomic.LoadUint32(&r.Stamps[k]) != r.Epoch {
+		return 0
+	}
+	return atomic.LoadUint64(&r.Matrix[k])
+}
+
+// reset returns an empty sketch that takes over r's matrix, advancing the
+// epoch so every counter reads as zero until it is next written. Only the
+// first reset (and the reset after the epoch wraps around) pays for touching
+// every cell. Readers still holding r see its counters as they are
+// overwritten, but never race with the new sketch's header.
+func (r *fnvSketch) reset() *fnvSketch {
+	next := *r
+	if next.Exact != nil {
+		next.Exact = newExactCounts()
+		return &next
+	}
+	if next.Stamps == nil {
+		next.Stamps = make([]uint32, len(next.Matrix))
+	}
+	next.Epoch++
+	if next.Epoch == 0 {
+		for i := range next.Stamps {
+			atomic.StoreUint32(&next.Stamps[i], 0)
+		}
+		next.Epoch = 1
+	}
+	return &next
+}
@@ -100,4 +100,65 @@ func TestSketch(t *testing.T) {
 		bucket := NewSketch(0, 0)
 		So(bucket.Count([]byte("key"), 10), ShouldEqual, 10)
 	})
+
+	Convey("Add counts without returning the estimate", t, func() {
+		sketch := NewSketch(0, 0)
+		sketch.Add([]byte("key"), 3)
+		sketch.Add([]byte("key"), 4)
+		So(sketch.Query([]byte("key")), ShouldEqual, 7)
+
+		recycled := sketch.(*fnvSketch).reset()
+		recycled.Add([]byte("key"), 1)
+		So(recycled.Query([]byte("key")), ShouldEqual, 1)
+	})
+
+	Convey("Reset empties the sketch without reallocating", t, func() {
+		bucket := NewSketch(0, 0).(*fnvSketch)
+		matrix := bucket.Matrix
+		bucket.Count([]byte("key"), 10)
+		bucket.Count([]byte("other"), 5)
+
+		bucket = bucket.reset()
+		So(&bucket.Matrix[0], ShouldEqual, &matrix[0])
+		So(bucket.Query([]byte("key")), ShouldEqual, 0)
+		So(bucket.Query([]byte("other")), ShouldEqual, 0)
+		So(bucket.Count([]byte("key"), 3), ShouldEqual, 3)
+
+		bucket = bucket.reset()
+		So(bucket.Query([]byte("key")), ShouldEqual, 0)
+
+		Convey("and survives epoch wraparound", func() {
+			bucket.Epoch = ^uint32(0)
+			bucket.Count([]byte("key"), 7)
+			bucket = bucket.reset()
+			So(bucket.Epoch, ShouldEqual, 1)
+			So(bucket.Query([]byte("key")), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Sketches can be made to a size", t, func() {
+		for _, width := range []uint{3, 10, 272, 1000, 2719, 1 << 16} {
+			for depth := uint(1); depth <= 36; depth += 5 {
+				cs := NewSketchWithSize(width, depth).(*fnvSketch)
+				w, d := cs.Dimensions()
+				So(w, ShouldEqual, width)
+				So(d, ShouldEqual, depth)
+				So(len(cs.Matrix), ShouldEqual, width*depth)
+				So(cs.validate(), ShouldBeNil)
+
+				p := cs.Params()
+				w, d = p.New().Dimensions()
+				So([]uint{w, d}, ShouldResemble, []uint{width, depth})
+			}
+		}
+		So(func() { NewSketchWithSize(2, 5) }, ShouldPanic)
+		So(func() { NewSketchWithSize(100, 0) }, ShouldPanic)
+	})
+
+	Convey("Params reports the epsilon and delta a sketch achieves", t, func() {
+		p := NewSketch(0.999, 0.99).Params()
+		So(p.Epsilon, ShouldBeGreaterThanOrEqualTo, 0.999)
+		So(p.Epsilon, ShouldAlmostEqual, 1-math.E/2719, 1e-12)
+		So(p.Delta, ShouldAlmostEqual, 1-math.Exp(-5), 1e-12)
+	})
 }
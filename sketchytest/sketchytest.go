@@ -0,0 +1,213 @@
+/*
+Package sketchytest provides checks of the invariants that sketchy's
+sketches and counters guarantee, for the tests of code that wraps or
+embeds them.
+*/
+package sketchytest
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"euphoria.io/sketchy"
+)
+
+// CheckNoUnderestimate counts n occurrences of random keys, with random
+// deltas, into a sketch from newSketch, and reports to t every key whose
+// estimated count is less than its true count. A count-min sketch may
+// overestimate counts, but never underestimates them. The keys and deltas
+// are drawn from seed, so a failure can be reproduced.
+func CheckNoUnderestimate(t testing.TB, newSketch func() sketchy.CountSketch, n int, seed int64) {
+	t.Helper()
+
+	rnd := rand.New(rand.NewSource(seed))
+	sketch := newSketch()
+	truth := map[string]uint64{}
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key%d", rnd.Intn(n/4+1))
+		delta := rnd.Intn(10) + 1
+		truth[key] += uint64(delta)
+		if rnd.Intn(2) == 0 {
+			sketch.Count([]byte(key), delta)
+		} else {
+			sketch.Add([]byte(key), delta)
+		}
+	}
+	for key, want := range truth {
+		if got := sketch.Query([]byte(key)); got < want {
+			t.Errorf("sketchytest: %q estimated at %d, below its true count %d (seed %d)", key, got, want, seed)
+		}
+	}
+}
+
+// CheckRoundTrip encodes counter with encoding/gob, decodes the encoding
+// into fresh, and reports to t every key whose rate over one of the
+// intervals differs between them by more than the given relative tolerance.
+// Both counters must read the same clock (see sketchy.WithClock), and it
+// must not advance during the check.
+func CheckRoundTrip(t testing.TB, counter, fresh sketchy.RateSketch, keys [][]byte, intervals []time.Duration, tolerance float64) {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(counter); err != nil {
+		t.Errorf("sketchytest: encoding counter: %s", err)
+		return
+	}
+	if err := gob.NewDecoder(buf).Decode(fresh); err != nil {
+		t.Errorf("sketchytest: decoding counter: %s", err)
+		return
+	}
+	for _, key := range keys {
+		for _, interval := range intervals {
+			want, got := counter.Query(key, interval), fresh.Query(key, interval)
+			if math.Abs(got-want) > tolerance*math.Abs(want) {
+				t.Errorf("sketchytest: rate of %q over %s is %v after decoding, %v before", key, interval, got, want)
+			}
+		}
+	}
+}
+
+// CheckRateBounds reports to t every key whose rate over interval is
+// negative, or more than every event counted could produce: their total
+// divided by a second, the shortest data a counter reports a rate for.
+// Collisions may inflate a key's rate, but never beyond that. Counts maps
+// each key to the total of the deltas counted for it, and must include every
+// key counted, unsampled.
+func CheckRateBounds(t testing.TB, counter sketchy.RateSketch, counts map[string]int, interval time.Duration) {
+	t.Helper()
+
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	for key := range counts {
+		rate := counter.Query([]byte(key), interval)
+		if rate < 0 || math.IsNaN(rate) || rate > float64(total) {
+			t.Errorf("sketchytest: rate of %q over %s is %v, outside [0, %d]", key, interval, rate, total)
+		}
+	}
+}
+
+// A SoakConfig describes the simulated traffic of CheckSoak.
+type SoakConfig struct {
+	// Duration is the simulated time to run for, e.g. three weeks. It must
+	// be at least three times Horizon.
+	Duration time.Duration
+
+	// Horizon is the longest interval the counter reports rates over. Keys
+	// that haven't been counted for longer must have decayed.
+	Horizon time.Duration
+
+	// Step is the simulated time between batches of events. The default is
+	// a minute.
+	Step time.Duration
+
+	// EventsPerStep is the number of events counted in each batch. The
+	// default is 100.
+	EventsPerStep int
+
+	// Seed is the seed the traffic is drawn from, so that a failure can be
+	// reproduced.
+	Seed int64
+}
+
+// CheckSoak runs a counter from newCounter, which must read the given clock
+// (see sketchy.WithClock), through cfg.Duration of simulated traffic, and
+// reports to t the slow failures that only show up after days of running:
+//
+//   - a gob encoding, or a number of buckets reported by its Stats (see
+//     sketchy.StatsOf), that grows by more than half after the second
+//     horizon;
+//   - keys counted only during the first horizon whose rates over the
+//     horizon, at the end, are still more than a tenth of the rate they
+//     were counted at. Collisions with the keys counted since may keep
+//     their rates from reaching zero, but not from decaying that far.
+//
+// The traffic is drawn from a population of keys that is replaced every
+// horizon, so that a counter that never expires its buckets, or keeps a
+// record of every key, grows without bound.
+//
+// The counter's footprint is measured by its encoding and Stats rather
+// than by the process's heap, so that CheckSoak gives the same result
+// alongside parallel tests. Memory that a counter neither encodes nor
+// reports isn't measured.
+func CheckSoak(t testing.TB, newCounter func(clock func() time.Time) sketchy.RateSketch, cfg SoakConfig) {
+	t.Helper()
+
+	if cfg.Step == 0 {
+		cfg.Step = time.Minute
+	}
+	if cfg.EventsPerStep == 0 {
+		cfg.EventsPerStep = 100
+	}
+	if cfg.Horizon <= 0 || cfg.Duration < 3*cfg.Horizon || cfg.Step <= 0 {
+		t.Errorf("sketchytest: soak of %s needs a positive horizon and step, and at least three horizons", cfg.Duration)
+		return
+	}
+
+	now := time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC)
+	start := now
+	counter := newCounter(func() time.Time { return now })
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+
+	// checkpoint returns the number of buckets the counter reports, and the
+	// size of its encoding.
+	checkpoint := func() (buckets, size int) {
+		buf := &bytes.Buffer{}
+		if err := gob.NewEncoder(buf).Encode(counter); err != nil {
+			t.Errorf("sketchytest: encoding counter: %s", err)
+		}
+		return len(sketchy.StatsOf(counter).Buckets), buf.Len()
+	}
+
+	const population, old = 1000, 10
+	var baseBuckets, baseSize, maxBuckets, maxSize int
+
+	for horizon := 0; now.Sub(start) < cfg.Duration; horizon++ {
+		end := now.Add(cfg.Horizon)
+		for ; now.Before(end) && now.Sub(start) < cfg.Duration; now = now.Add(cfg.Step) {
+			for i := 0; i < cfg.EventsPerStep; i++ {
+				key := fmt.Sprintf("h%d-key%d", horizon, rnd.Intn(population))
+				counter.Count([]byte(key), 1, 0)
+			}
+			if horizon == 0 {
+				for i := 0; i < old; i++ {
+					counter.Count([]byte(fmt.Sprintf("old%d", i)), cfg.EventsPerStep, 0)
+				}
+			}
+		}
+		// the first horizon fills the counter; the second is the baseline
+		switch buckets, size := checkpoint(); {
+		case horizon == 1:
+			baseBuckets, baseSize = buckets, size
+		case horizon > 1:
+			if buckets > maxBuckets {
+				maxBuckets = buckets
+			}
+			if size > maxSize {
+				maxSize = size
+			}
+		}
+	}
+
+	if maxBuckets > baseBuckets+baseBuckets/2 {
+		t.Errorf("sketchytest: buckets grew from %d to %d over %s (seed %d)", baseBuckets, maxBuckets, cfg.Duration, cfg.Seed)
+	}
+	if maxSize > baseSize+baseSize/2 {
+		t.Errorf("sketchytest: encoding grew from %d to %d bytes over %s (seed %d)", baseSize, maxSize, cfg.Duration, cfg.Seed)
+	}
+
+	limit := float64(cfg.EventsPerStep) / cfg.Step.Seconds() / 10
+	for i := 0; i < old; i++ {
+		key := fmt.Sprintf("old%d", i)
+		if rate := counter.Query([]byte(key), cfg.Horizon); rate > limit {
+			t.Errorf("sketchytest: rate of %q is %v after %s unseen, above %v (seed %d)",
+				key, rate, now.Sub(start)-cfg.Horizon, limit, cfg.Seed)
+		}
+	}
+}
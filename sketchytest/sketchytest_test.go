@@ -0,0 +1,127 @@
+package sketchytest
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"testing"
+	"time"
+
+	"euphoria.io/sketchy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// recorder is a testing.TB that records failures instead of failing.
+type recorder struct {
+	testing.TB
+	errors int
+}
+
+func (r *recorder) Helper()                       {}
+func (r *recorder) Errorf(string, ...interface{}) { r.errors++ }
+
+// lossySketch forgets every other count.
+type lossySketch struct {
+	sketchy.CountSketch
+	n int
+}
+
+func (s *lossySketch) Count(key []byte, delta int) uint64 {
+	if s.n++; s.n%2 == 0 {
+		return s.CountSketch.Query(key)
+	}
+	return s.CountSketch.Count(key, delta)
+}
+
+func (s *lossySketch) Add(key []byte, delta int) { s.Count(key, delta) }
+
+// leakyCounter keeps a copy of every key it counts, and reports keys at the
+// highest rate they were ever counted at.
+type leakyCounter struct {
+	sketchy.RateSketch
+	keys  [][]byte
+	peaks map[string]float64
+}
+
+func (c *leakyCounter) Count(key []byte, delta int, interval time.Duration) float64 {
+	c.keys = append(c.keys, append(make([]byte, 0, 256), key...))
+	rate := c.RateSketch.Count(key, delta, time.Minute)
+	c.peaks[string(key)] = math.Max(c.peaks[string(key)], rate)
+	return rate
+}
+
+func (c *leakyCounter) GobEncode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(c.RateSketch); err != nil {
+		return nil, err
+	}
+	err := enc.Encode(c.keys)
+	return buf.Bytes(), err
+}
+
+func (c *leakyCounter) Query(key []byte, interval time.Duration) float64 {
+	return math.Max(c.peaks[string(key)], c.RateSketch.Query(key, interval))
+}
+
+func TestChecks(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := func() time.Time { return now }
+	params := sketchy.RollupParams{Durations: []time.Duration{time.Minute, time.Hour, 24 * time.Hour}}
+
+	Convey("Sketches don't underestimate", t, func() {
+		r := &recorder{TB: t}
+		CheckNoUnderestimate(r, func() sketchy.CountSketch { return sketchy.NewSketch(0.9, 0.9) }, 10000, 1)
+		CheckNoUnderestimate(r, func() sketchy.CountSketch { return sketchy.NewSketchConservative(0.9, 0.9) }, 10000, 1)
+		So(r.errors, ShouldEqual, 0)
+
+		CheckNoUnderestimate(r, func() sketchy.CountSketch {
+			return &lossySketch{CountSketch: sketchy.NewSketch(0, 0)}
+		}, 1000, 1)
+		So(r.errors, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("Counters keep their rates across encoding", t, func() {
+		counter := params.New(sketchy.WithClock(clock))
+		counts := map[string]int{}
+		var keys [][]byte
+		for i := 0; i < 100; i++ {
+			key := string(rune('a' + i%10))
+			counter.Count([]byte(key), i, 0)
+			counts[key] += i
+			keys = append(keys, []byte(key))
+			now = now.Add(3 * time.Second)
+		}
+
+		r := &recorder{TB: t}
+		intervals := []time.Duration{time.Minute, 5 * time.Minute, time.Hour}
+		CheckRoundTrip(r, counter, params.New(sketchy.WithClock(clock)), keys, intervals, 1e-9)
+		CheckRateBounds(r, counter, counts, time.Hour)
+		So(r.errors, ShouldEqual, 0)
+
+		CheckRateBounds(r, counter, map[string]int{"a": 1}, time.Hour)
+		So(r.errors, ShouldEqual, 1)
+	})
+
+	Convey("Leaks show up in a soak", t, func() {
+		r := &recorder{TB: t}
+		hourly := sketchy.RollupParams{Durations: []time.Duration{time.Minute, time.Hour}}
+		CheckSoak(r, func(clock func() time.Time) sketchy.RateSketch {
+			return &leakyCounter{RateSketch: hourly.New(sketchy.WithClock(clock)), peaks: map[string]float64{}}
+		}, SoakConfig{Duration: 12 * time.Hour, Horizon: time.Hour, Seed: 1})
+		So(r.errors, ShouldBeGreaterThanOrEqualTo, 2)
+	})
+}
+
+func TestSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soaking for simulated weeks")
+	}
+	params := sketchy.RollupParams{Durations: []time.Duration{15 * time.Minute, time.Hour, 24 * time.Hour}}
+
+	Convey("A rollup counter runs for three weeks without leaking", t, func() {
+		CheckSoak(t, func(clock func() time.Time) sketchy.RateSketch {
+			return params.New(sketchy.WithClock(clock))
+		}, SoakConfig{Duration: 21 * 24 * time.Hour, Horizon: 24 * time.Hour, EventsPerStep: 20, Seed: 1})
+	})
+}
@@ -0,0 +1,70 @@
+package sketchy
+
+import "time"
+
+// Smoothing selects the weights used by QuerySmoothed to average per-bucket
+// rates.
+type Smoothing int
+
+const (
+	// Boxcar weights every bucket equally.
+	Boxcar Smoothing = iota
+
+	// Triangular weights the newest of k buckets by k, the next by k-1, and
+	// so on down to 1 for the oldest.
+	Triangular
+)
+
+// weight returns the weight of the j'th newest of k buckets.
+func (s Smoothing) weight(j, k int) float64 {
+	if s == Triangular {
+		return float64(k - j)
+	}
+	return 1
+}
+
+// smoothed returns the weighted average of the rate of the key with hash h
+// in each of the last k buckets, with noise from p. Buckets that have
+// covered less than a second are skipped. It doesn't lock the counter.
+func (rl *rollingCounter) smoothed(h hashKernel, now time.Time, k int, s Smoothing, p *privacy) float64 {
+	var sum, weights float64
+	v := rl.view()
+	buckets := v.buckets
+	for j := 0; j < k && j < len(buckets); j++ {
+		b := buckets[len(buckets)-1-j]
+		d := now.Sub(b.Time)
+		now = b.Time
+		if d > v.interval {
+			d = v.interval
+		}
+		if d < time.Second {
+			continue
+		}
+		w := s.weight(j, k)
+		sum += w * p.count(b.query(h), h, v.interval, b.Time) / d.Seconds()
+		weights += w
+	}
+	if weights == 0 {
+		return 0
+	}
+	return sum / weights
+}
+
+// QuerySmoothed returns the observed rate of the given key, averaged over
+// its rate in each of the last k buckets with the given weights. Buckets
+// that have covered less than a second are left out; if none remain, 0 is
+// returned.
+func (rl *rollingCounter) QuerySmoothed(key []byte, k int, s Smoothing) float64 {
+	return rl.smoothed(rl.prehash(key).k, rl.now(), k, s, rl.privacy)
+}
+
+// QuerySmoothed returns the observed rate of the given key, averaged over
+// its rate in each of the last k buckets of the finest level with the given
+// weights. Buckets that have covered less than a second are left out; if
+// none remain, 0 is returned.
+func (rc *rollupCounter) QuerySmoothed(key []byte, k int, s Smoothing) float64 {
+	if len(rc.Levels) == 0 {
+		return 0
+	}
+	return rc.Levels[0].smoothed(rc.prehash(key).k, rc.now(), k, s, rc.privacy)
+}
@@ -0,0 +1,60 @@
+package sketchy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQuerySmoothed(t *testing.T) {
+	now := time.Now()
+	key := []byte("key")
+
+	Convey("Rolling counters average per-bucket rates", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		So(counter.QuerySmoothed(key, 3, Boxcar), ShouldEqual, 0)
+
+		// rates of 1, 2 and 3 per second in consecutive minutes
+		for m := 1; m <= 3; m++ {
+			counter.Count(key, 60*m, 0)
+			now = now.Add(time.Minute)
+		}
+
+		So(counter.QuerySmoothed(key, 0, Boxcar), ShouldEqual, 0)
+		So(counter.QuerySmoothed(key, 1, Boxcar), ShouldAlmostEqual, 3)
+		So(counter.QuerySmoothed(key, 3, Boxcar), ShouldAlmostEqual, 2)
+		So(counter.QuerySmoothed(key, 3, Triangular), ShouldAlmostEqual, (3*3+2*2+1*1)/6.0)
+		So(counter.QuerySmoothed(key, 10, Boxcar), ShouldAlmostEqual, 2)
+	})
+
+	Convey("Buckets covering less than a second are skipped", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		counter.Count(key, 60, 0)
+		now = now.Add(time.Minute)
+		counter.Count(key, 1000, 0)
+		So(counter.QuerySmoothed(key, 2, Boxcar), ShouldAlmostEqual, 1)
+	})
+
+	Convey("Idle gaps don't dilute a bucket's rate", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		counter.Count(key, 60, 0)
+		now = now.Add(time.Hour)
+		counter.Count(key, 120, 0)
+		now = now.Add(time.Minute)
+		So(counter.QuerySmoothed(key, 2, Boxcar), ShouldAlmostEqual, 1.5)
+	})
+
+	Convey("Rollup counters smooth the finest level", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, time.Hour, 24*time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		for m := 1; m <= 2; m++ {
+			rollup.Count(key, 60*m, 0)
+			now = now.Add(time.Minute)
+		}
+		So(rollup.QuerySmoothed(key, 2, Boxcar), ShouldAlmostEqual, 1.5)
+	})
+}
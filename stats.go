@@ -0,0 +1,147 @@
+package sketchy
+
+import (
+	"math"
+	"time"
+)
+
+// Stats describes the state of a rate counter, for monitoring whether it is
+// sized appropriately for the traffic it sees.
+type Stats struct {
+	// Rate is the number of events per second counted over the data the
+	// counter retains (the finest level, for a RollupCounter).
+	Rate float64
+
+	// Buckets describes each retained bucket, oldest first. A RollupCounter
+	// lists the buckets of each level in turn, finest level first.
+	Buckets []BucketStats
+
+	// Recommended holds the sketch parameters that WithAutoTune last
+	// recommended, or zero values if there is no recommendation. A
+	// RollupCounter reports the largest recommendation of any level.
+	Recommended SketchParams
+
+	// Restored is when the state the counter was restored from with
+	// GobDecode was encoded, so that its age can be judged. It is zero if
+	// the counter wasn't restored, or the encoding predates this field.
+	Restored time.Time
+}
+
+// BucketStats describes a single bucket of a rate counter.
+type BucketStats struct {
+	Interval time.Duration // The maximum duration of the bucket.
+	Start    time.Time     // When the bucket was started.
+	Duration time.Duration // How long the bucket has been (or was) current.
+
+	// Events is the total of all deltas counted into the bucket.
+	Events uint64
+
+	// DistinctKeys estimates the number of distinct keys counted into the
+	// bucket. Buckets decoded from older encodings have no distinct keys
+	// register, so the estimate comes from the fraction of occupied counters
+	// in the sketch instead, and is +Inf if every counter is occupied.
+	DistinctKeys float64
+
+	// Occupancy is the fraction of the sketch's counters that are nonzero.
+	// As it approaches 1, collisions make estimates increasingly inaccurate.
+	Occupancy float64
+
+	// Late is the number of occurrences CountAt counted into the bucket
+	// after it had closed (see WithOnLateEvents).
+	Late uint64
+}
+
+// rowStats returns the total of the counters in the first row of the sketch,
+// which is the total of all deltas counted into it, and how many of those
+// counters are nonzero.
+func (r *fnvSketch) rowStats() (total uint64, occupied uint) {
+	for j := uint(0); j < r.Width; j++ {
+		if v := r.cell(r.offset(0, j)); v != 0 {
+			total += v
+			occupied++
+		}
+	}
+	return total, occupied
+}
+
+// linearCount estimates the number of distinct values hashed into width
+// cells, given how many cells are occupied.
+func linearCount(width, occupied uint) float64 {
+	if occupied >= width {
+		return math.Inf(1)
+	}
+	return float64(width) * math.Log(float64(width)/float64(width-occupied))
+}
+
+// stats describes the counter's buckets as of now. It doesn't lock the
+// counter.
+func (rl *rollingCounter) stats(now time.Time) ([]BucketStats, float64) {
+	v := rl.view()
+	buckets := v.buckets
+	result := make([]BucketStats, len(buckets))
+	var events uint64
+	for i, b := range buckets {
+		end := now
+		if i < len(buckets)-1 {
+			end = buckets[i+1].Time
+		}
+		result[i] = BucketStats{
+			Interval: v.interval,
+			Start:    b.Time,
+			Duration: end.Sub(b.Time),
+		}
+		if b.CountSketch != nil && b.CountSketch.Width > 0 {
+			total, occupied := b.CountSketch.rowStats()
+			result[i].Events = total
+			if b.Distinct != nil {
+				result[i].DistinctKeys = b.Distinct.estimate()
+			} else {
+				result[i].DistinctKeys = linearCount(b.CountSketch.Width, occupied)
+			}
+			result[i].Occupancy = float64(occupied) / float64(b.CountSketch.Width)
+			events += total
+		}
+	}
+	var rate float64
+	if len(buckets) > 0 {
+		if d := now.Sub(buckets[0].Time); d >= time.Second {
+			rate = float64(events) / d.Seconds()
+		}
+	}
+	return result, rate
+}
+
+// lockedStats returns the fields of Stats that writers hold rl.m to update.
+func (rl *rollingCounter) lockedStats() (restored time.Time, recommended SketchParams) {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+	return rl.restored, rl.recommended
+}
+
+// Stats describes the current state of the counter.
+func (rl *rollingCounter) Stats() Stats {
+	buckets, rate := rl.stats(rl.now())
+	rl.lateStats(buckets)
+	s := Stats{Rate: rate, Buckets: buckets}
+	s.Restored, s.Recommended = rl.lockedStats()
+	return s
+}
+
+// Stats describes the current state of the counter.
+func (rc *rollupCounter) Stats() Stats {
+	now := rc.now()
+	var s Stats
+	for i, c := range rc.Levels {
+		buckets, rate := c.stats(now)
+		restored, recommended := c.lockedStats()
+		if i == 0 {
+			s.Rate = rate
+			s.Restored = restored
+		}
+		if recommended.Epsilon > s.Recommended.Epsilon {
+			s.Recommended = recommended
+		}
+		s.Buckets = append(s.Buckets, buckets...)
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package sketchy
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStats(t *testing.T) {
+	now := time.Now()
+
+	Convey("Rolling counters report per-bucket totals and occupancy", t, func() {
+		counter := RollingCounter(0, 0, time.Minute, 3).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		So(counter.Stats(), ShouldResemble, Stats{Buckets: []BucketStats{}})
+
+		for i := 0; i < 100; i++ {
+			counter.Count([]byte(fmt.Sprintf("key%d", i)), 3, 0)
+		}
+		now = now.Add(time.Minute)
+		counter.Count([]byte("key"), 60, 0)
+		now = now.Add(30 * time.Second)
+
+		stats := counter.Stats()
+		So(len(stats.Buckets), ShouldEqual, 2)
+		So(stats.Rate, ShouldAlmostEqual, 360.0/90)
+
+		first := stats.Buckets[0]
+		So(first.Interval, ShouldEqual, time.Minute)
+		So(first.Duration, ShouldEqual, time.Minute)
+		So(first.Events, ShouldEqual, 300)
+		So(first.DistinctKeys, ShouldAlmostEqual, 100, 5)
+		So(first.Occupancy, ShouldBeGreaterThan, 0)
+		So(first.Occupancy, ShouldBeLessThanOrEqualTo, 100./2719)
+
+		last := stats.Buckets[1]
+		So(last.Duration, ShouldEqual, 30*time.Second)
+		So(last.Events, ShouldEqual, 60)
+		So(last.DistinctKeys, ShouldAlmostEqual, 1, 0.01)
+	})
+
+	Convey("Distinct keys are estimated by the bucket's register", t, func() {
+		// far more keys than counters saturate the sketch, but not the register
+		counter := RollingCounter(0.9, 0.1, time.Minute, 3).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		for i := 0; i < 500; i++ {
+			counter.Count([]byte(fmt.Sprintf("key%d", i)), 1, 0)
+		}
+		b := counter.Stats().Buckets[0]
+		So(b.Occupancy, ShouldEqual, 1)
+		So(b.DistinctKeys, ShouldAlmostEqual, 500, 25)
+
+		Convey("or linearly without one, as when decoded from older encodings", func() {
+			counter.loadBuckets()[0].Distinct = nil
+			So(math.IsInf(counter.Stats().Buckets[0].DistinctKeys, 1), ShouldBeTrue)
+		})
+	})
+
+	Convey("Saturated sketches report infinitely many keys", t, func() {
+		So(math.IsInf(linearCount(10, 10), 1), ShouldBeTrue)
+		So(linearCount(10, 0), ShouldEqual, 0)
+	})
+
+	Convey("Rollup counters report every level", t, func() {
+		rollup := RollupCounter(0, 0, time.Minute, time.Hour, 24*time.Hour).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		rollup.Count([]byte("key"), 10, 0)
+		now = now.Add(10 * time.Second)
+
+		stats := rollup.Stats()
+		So(stats.Rate, ShouldEqual, 1)
+		So(len(stats.Buckets), ShouldEqual, 2)
+		So(stats.Buckets[0].Interval, ShouldEqual, time.Minute)
+		So(stats.Buckets[1].Interval, ShouldEqual, time.Hour)
+		So(stats.Buckets[1].Events, ShouldEqual, 10)
+	})
+}
@@ -0,0 +1,165 @@
+package sketchy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// statsdPacketSize bounds the size of each packet a StatsDEmitter writes, to
+// fit in a single UDP datagram on ordinary networks.
+const statsdPacketSize = 1432
+
+// StatsDOptions configures a StatsDEmitter. Zero values take the defaults
+// noted.
+type StatsDOptions struct {
+	// Prefix is prepended to every metric name. The default is "sketchy.".
+	Prefix string
+
+	// Interval is the interval that rates and distinct keys are measured
+	// over. The default is one minute.
+	Interval time.Duration
+
+	// Keys are the keys whose rates are sent.
+	Keys [][]byte
+
+	// Tags are DogStatsD tags, such as "service:api", added to every metric.
+	// Plain StatsD servers don't accept tags, so leave this empty for them.
+	Tags []string
+
+	// SampleRate is the probability, in (0, 1], with which each key's rate
+	// is sent on each emission, for bounding the traffic of many keys. The
+	// counter's own metrics are always sent. The default is 1.
+	SampleRate float64
+
+	// Seed, if nonzero, is the seed that keys are sampled with, so that
+	// which rates are sent is reproducible. By default keys are sampled from
+	// the shared random source.
+	Seed int64
+}
+
+func (o StatsDOptions) withDefaults() StatsDOptions {
+	if o.Prefix == "" {
+		o.Prefix = "sketchy."
+	}
+	if o.Interval == 0 {
+		o.Interval = time.Minute
+	}
+	if o.SampleRate == 0 {
+		o.SampleRate = 1
+	}
+	return o
+}
+
+// A StatsDEmitter sends the rates of configured keys, and metrics of a
+// counter's health, to a StatsD or DogStatsD server as gauges.
+type StatsDEmitter struct {
+	w       io.Writer
+	counter RateSketch
+	opts    StatsDOptions
+	tags    string
+	random  *lockedRand
+}
+
+// NewStatsDEmitter returns a StatsDEmitter that writes metrics of counter to
+// w, which is normally a UDP connection to the server from net.Dial. Each
+// write is a single packet of newline-separated metrics.
+func NewStatsDEmitter(w io.Writer, counter RateSketch, opts StatsDOptions) *StatsDEmitter {
+	opts = opts.withDefaults()
+	if !(opts.SampleRate > 0 && opts.SampleRate <= 1) {
+		panic(fmt.Sprintf("sketchy: statsd sample rate %v is not in (0, 1]", opts.SampleRate))
+	}
+	e := &StatsDEmitter{w: w, counter: counter, opts: opts}
+	if opts.Seed != 0 {
+		e.random = &lockedRand{r: rand.New(rand.NewSource(opts.Seed))}
+	}
+	if len(opts.Tags) > 0 {
+		e.tags = "|#" + strings.Join(opts.Tags, ",")
+	}
+	return e
+}
+
+// Emit sends the current metrics once. It returns the first write error.
+func (e *StatsDEmitter) Emit() error {
+	stats := StatsOf(e.counter)
+	var lines []string
+	gauge := func(name string, v float64, sampled bool) {
+		line := e.opts.Prefix + name + ":" + formatFloat(v) + "|g"
+		if sampled {
+			line += "|@" + formatFloat(e.opts.SampleRate)
+		}
+		lines = append(lines, line+e.tags)
+	}
+
+	gauge("rate", stats.Rate, false)
+	gauge("buckets", float64(len(stats.Buckets)), false)
+	gauge("distinct_keys", DistinctKeys(e.counter, e.opts.Interval), false)
+	for i, b := range stats.Buckets {
+		if i == len(stats.Buckets)-1 || stats.Buckets[i+1].Interval != b.Interval {
+			gauge("occupancy."+formatDuration(b.Interval), b.Occupancy, false)
+		}
+	}
+	for _, key := range e.opts.Keys {
+		if e.opts.SampleRate < 1 && e.random.float64() >= e.opts.SampleRate {
+			continue
+		}
+		gauge("key."+statsdName(key)+".rate", e.counter.Query(key, e.opts.Interval), e.opts.SampleRate < 1)
+	}
+	return e.send(lines)
+}
+
+// send writes lines in as few packets as fit.
+func (e *StatsDEmitter) send(lines []string) error {
+	var packet strings.Builder
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := io.WriteString(e.w, packet.String())
+		packet.Reset()
+		return err
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
+
+// Run calls Emit every period until ctx is done, and then returns ctx's
+// error. Errors from Emit, which are usually transient for UDP, are
+// ignored.
+func (e *StatsDEmitter) Run(ctx context.Context, period time.Duration) error {
+	t := time.NewTicker(period)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			e.Emit()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// statsdName makes key safe for use in a metric name, replacing characters
+// that StatsD treats specially.
+func statsdName(key []byte) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, strings.ToValidUTF8(string(key), "_"))
+}
@@ -0,0 +1,96 @@
+package sketchy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type packetRecorder struct {
+	packets []string
+}
+
+func (r *packetRecorder) Write(p []byte) (int, error) {
+	r.packets = append(r.packets, string(p))
+	return len(p), nil
+}
+
+func TestStatsDEmitter(t *testing.T) {
+	now := time.Now()
+	newCounter := func() *rollingCounter {
+		counter := RollingCounter(0, 0, time.Minute, 10).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		return counter
+	}
+
+	Convey("Metrics are sent as gauges in one packet", t, func() {
+		counter := newCounter()
+		counter.Count([]byte("10.0.0.1:80"), 120, 0)
+		now = now.Add(time.Minute)
+
+		rec := &packetRecorder{}
+		e := NewStatsDEmitter(rec, counter, StatsDOptions{
+			Prefix: "api.",
+			Keys:   [][]byte{[]byte("10.0.0.1:80")},
+			Tags:   []string{"env:prod", "service:api"},
+		})
+		So(e.Emit(), ShouldBeNil)
+		So(len(rec.packets), ShouldEqual, 1)
+
+		lines := strings.Split(rec.packets[0], "\n")
+		So(lines, ShouldContain, "api.rate:2|g|#env:prod,service:api")
+		So(lines, ShouldContain, "api.buckets:1|g|#env:prod,service:api")
+		So(lines, ShouldContain, "api.key.10.0.0.1_80.rate:2|g|#env:prod,service:api")
+		So(rec.packets[0], ShouldContainSubstring, "api.occupancy.1m:")
+	})
+
+	Convey("Key rates are sampled", t, func() {
+		counter := newCounter()
+		keys := make([][]byte, 1000)
+		for i := range keys {
+			keys[i] = []byte(fmt.Sprint(i))
+		}
+		rec := &packetRecorder{}
+		e := NewStatsDEmitter(rec, counter, StatsDOptions{Keys: keys, SampleRate: 0.5})
+		So(e.Emit(), ShouldBeNil)
+		out := strings.Join(rec.packets, "\n")
+		So(strings.Count(out, "|@0.5"), ShouldAlmostEqual, 500, 100)
+		So(out, ShouldContainSubstring, "sketchy.rate:0|g\n")
+
+		Convey("and split into packets that fit in a datagram", func() {
+			So(len(rec.packets), ShouldBeGreaterThan, 1)
+			for _, p := range rec.packets {
+				So(len(p), ShouldBeLessThanOrEqualTo, statsdPacketSize)
+			}
+		})
+	})
+
+	Convey("Seeded emitters sample the same keys", t, func() {
+		keys := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e"), []byte("f")}
+		var outs []string
+		for i := 0; i < 2; i++ {
+			rec := &packetRecorder{}
+			e := NewStatsDEmitter(rec, newCounter(), StatsDOptions{Keys: keys, SampleRate: 0.5, Seed: 7})
+			So(e.Emit(), ShouldBeNil)
+			outs = append(outs, strings.Join(rec.packets, "\n"))
+		}
+		So(outs[1], ShouldEqual, outs[0])
+	})
+
+	Convey("Run emits until the context is done", t, func() {
+		rec := &packetRecorder{}
+		e := NewStatsDEmitter(rec, RollingCounter(0, 0, time.Minute, 10), StatsDOptions{})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		So(e.Run(ctx, 10*time.Millisecond), ShouldEqual, context.DeadlineExceeded)
+		So(len(rec.packets), ShouldBeGreaterThan, 0)
+	})
+
+	Convey("The sample rate must be in (0, 1]", t, func() {
+		So(func() { NewStatsDEmitter(&packetRecorder{}, newCounter(), StatsDOptions{SampleRate: 2}) }, ShouldPanic)
+	})
+}
@@ -0,0 +1,146 @@
+package sketchy
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A KeyCount is a key and its estimated count.
+type KeyCount struct {
+	Key   []byte
+	Count uint64
+}
+
+// A TopK tracks the heaviest keys it has counted: the k keys with the
+// largest estimated counts, which it can enumerate without keeping every
+// key. Every key is counted into a count-min sketch, and the candidates are
+// held in a min-heap by their estimates, so a key displaces the lightest
+// candidate once its estimate exceeds the candidate's. Like the sketch's
+// estimates, the candidates' counts may be overestimated.
+type TopK struct {
+	sketch *fnvSketch
+
+	m     sync.Mutex
+	heavy topHeap
+}
+
+// NewTopK returns a TopK that tracks the k heaviest keys, counting them into
+// a sketch with the given parameters (see NewSketch). The value of k must be
+// positive.
+func NewTopK(k int, epsilon, delta float64) *TopK {
+	if k <= 0 {
+		panic(fmt.Sprintf("sketchy: top-k size %d must be positive", k))
+	}
+	return &TopK{
+		sketch: NewSketch(epsilon, delta).(*fnvSketch),
+		heavy:  topHeap{k: k, index: map[hashKernel]int{}},
+	}
+}
+
+// Add adds delta to the count of the given key, making it a candidate if
+// its estimate is now among the k largest.
+func (t *TopK) Add(key []byte, delta int) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	k := multihash(key)
+	t.heavy.observe(k, key, t.sketch.Count(key, delta))
+}
+
+// Query returns the estimated count of the given key, whether or not it is
+// a candidate.
+func (t *TopK) Query(key []byte) uint64 { return t.sketch.Query(key) }
+
+// Top returns the n candidates with the largest estimated counts, heaviest
+// first, or every candidate if there are fewer than n.
+func (t *TopK) Top(n int) []KeyCount {
+	top := t.snapshot()
+	if n < len(top) {
+		top = top[:n]
+	}
+	return top
+}
+
+// Range calls f for each candidate, heaviest first, until f returns false.
+// It ranges over a snapshot of the candidates, so counting may continue
+// while it runs, and f may call the TopK's methods.
+func (t *TopK) Range(f func(key []byte, est uint64) bool) {
+	for _, kc := range t.snapshot() {
+		if !f(kc.Key, kc.Count) {
+			return
+		}
+	}
+}
+
+// snapshot returns a copy of the candidates, heaviest first.
+func (t *TopK) snapshot() []KeyCount {
+	t.m.Lock()
+	top := make([]KeyCount, len(t.heavy.entries))
+	for i, e := range t.heavy.entries {
+		top[i] = e.KeyCount
+	}
+	t.m.Unlock()
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return bytes.Compare(top[i].Key, top[j].Key) < 0
+	})
+	return top
+}
+
+// topHeap is a min-heap of up to k candidates by count.
+type topHeap struct {
+	k       int
+	entries []topEntry
+	index   map[hashKernel]int // position of each candidate in entries
+}
+
+type topEntry struct {
+	KeyCount
+	hash hashKernel
+}
+
+func (h *topHeap) Len() int           { return len(h.entries) }
+func (h *topHeap) Less(i, j int) bool { return h.entries[i].Count < h.entries[j].Count }
+
+func (h *topHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.index[h.entries[i].hash] = i
+	h.index[h.entries[j].hash] = j
+}
+
+func (h *topHeap) Push(x interface{}) {
+	e := x.(topEntry)
+	h.index[e.hash] = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+
+func (h *topHeap) Pop() interface{} {
+	e := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	delete(h.index, e.hash)
+	return e
+}
+
+// observe records that the key with hash k has the given estimated count,
+// updating it if it is a candidate, or adding it if it is heavier than the
+// lightest.
+func (h *topHeap) observe(k hashKernel, key []byte, count uint64) {
+	if i, ok := h.index[k]; ok {
+		h.entries[i].Count = count
+		heap.Fix(h, i)
+		return
+	}
+	if len(h.entries) >= h.k {
+		if count <= h.entries[0].Count {
+			return
+		}
+		heap.Pop(h)
+	}
+	heap.Push(h, topEntry{KeyCount: KeyCount{Key: append([]byte(nil), key...), Count: count}, hash: k})
+}
@@ -0,0 +1,87 @@
+package sketchy
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTopK(t *testing.T) {
+	Convey("The heaviest keys are found among many light ones", t, func() {
+		top := NewTopK(5, 0.99, 0.9)
+		rnd := rand.New(rand.NewSource(1))
+		for i := 0; i < 20000; i++ {
+			top.Add([]byte(fmt.Sprint("light", rnd.Intn(5000))), 1)
+			if i%20 == 0 {
+				top.Add([]byte(fmt.Sprint("heavy", i%100/20)), 10*(i%100/20+1))
+			}
+		}
+
+		heaviest := top.Top(3)
+		So(len(heaviest), ShouldEqual, 3)
+		for i, kc := range heaviest {
+			So(string(kc.Key), ShouldEqual, fmt.Sprint("heavy", 4-i))
+			So(kc.Count, ShouldBeGreaterThanOrEqualTo, uint64(200*10*(5-i)))
+			So(kc.Count, ShouldEqual, top.Query(kc.Key))
+		}
+		So(len(top.Top(100)), ShouldEqual, 5)
+	})
+
+	Convey("Lighter keys don't displace candidates", t, func() {
+		top := NewTopK(2, 0, 0)
+		top.Add([]byte("a"), 10)
+		top.Add([]byte("b"), 5)
+		top.Add([]byte("c"), 3)
+		So(top.Top(2), ShouldResemble, []KeyCount{{[]byte("a"), 10}, {[]byte("b"), 5}})
+
+		top.Add([]byte("c"), 3)
+		So(top.Top(2), ShouldResemble, []KeyCount{{[]byte("a"), 10}, {[]byte("c"), 6}})
+	})
+
+	Convey("Candidates are copied", t, func() {
+		top := NewTopK(1, 0, 0)
+		key := []byte("key")
+		top.Add(key, 1)
+		key[0] = 'x'
+		So(string(top.Top(1)[0].Key), ShouldEqual, "key")
+	})
+
+	Convey("Range walks a snapshot while counting continues", t, func() {
+		top := NewTopK(10, 0, 0)
+		for i := 0; i < 10; i++ {
+			top.Add([]byte(fmt.Sprint(i)), i+1)
+		}
+		var seen []string
+		top.Range(func(key []byte, est uint64) bool {
+			top.Add([]byte("new"), 100)
+			seen = append(seen, string(key))
+			return len(seen) < 3
+		})
+		So(seen, ShouldResemble, []string{"9", "8", "7"})
+		So(string(top.Top(1)[0].Key), ShouldEqual, "new")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					top.Add([]byte(fmt.Sprint(i, j%50)), 1)
+				}
+			}(i)
+		}
+		for i := 0; i < 100; i++ {
+			n := 0
+			top.Range(func([]byte, uint64) bool { n++; return true })
+			So(n, ShouldEqual, 10)
+		}
+		wg.Wait()
+	})
+
+	Convey("The size must be positive", t, func() {
+		So(func() { NewTopK(0, 0, 0) }, ShouldPanic)
+	})
+}
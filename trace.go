@@ -0,0 +1,132 @@
+package sketchy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// traceEvent is a line of a trace: one call to a counter, the time the
+// counter saw, and its result.
+type traceEvent struct {
+	Op       string        `json:"op"` // "count", "add", "query" or "rollover"
+	Time     time.Time     `json:"time"`
+	Key      []byte        `json:"key,omitempty"`
+	Delta    int           `json:"delta,omitempty"`
+	Interval time.Duration `json:"interval,omitempty"`
+	Result   float64       `json:"result,omitempty"`
+}
+
+// A TraceRecorder wraps a rate counter, recording every call made through it
+// as a line of JSON, so that the counter's behavior on real traffic can be
+// captured and later checked with ReplayTrace. Only the calls that change
+// or query rates are offered. It is safe for concurrent use, but records
+// concurrent calls in the order they complete.
+type TraceRecorder struct {
+	counter RateSketch
+	clock   func() time.Time
+
+	m   sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewTraceRecorder returns a TraceRecorder that records calls to counter in
+// w. Clock must be the clock the counter reads (see WithClock), or nil if
+// it uses time.Now, so that the trace records the times the counter saw.
+func NewTraceRecorder(w io.Writer, counter RateSketch, clock func() time.Time) *TraceRecorder {
+	if clock == nil {
+		clock = time.Now
+	}
+	return &TraceRecorder{counter: counter, clock: clock, enc: json.NewEncoder(w)}
+}
+
+// record calls f with the counter's current time, and records its result.
+func (t *TraceRecorder) record(e traceEvent, f func() float64) float64 {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	e.Time = t.clock()
+	e.Result = f()
+	if t.err == nil {
+		t.err = t.enc.Encode(e)
+	}
+	return e.Result
+}
+
+// Count calls the counter's Count, and records the call.
+func (t *TraceRecorder) Count(key []byte, delta int, interval time.Duration) float64 {
+	e := traceEvent{Op: "count", Key: key, Delta: delta, Interval: interval}
+	return t.record(e, func() float64 { return t.counter.Count(key, delta, interval) })
+}
+
+// Add calls the counter's Add, and records the call.
+func (t *TraceRecorder) Add(key []byte, delta int) {
+	t.record(traceEvent{Op: "add", Key: key, Delta: delta}, func() float64 {
+		Add(t.counter, key, delta)
+		return 0
+	})
+}
+
+// Query calls the counter's Query, and records the call.
+func (t *TraceRecorder) Query(key []byte, interval time.Duration) float64 {
+	e := traceEvent{Op: "query", Key: key, Interval: interval}
+	return t.record(e, func() float64 { return t.counter.Query(key, interval) })
+}
+
+// Rollover calls the counter's Rollover, and records the call.
+func (t *TraceRecorder) Rollover() {
+	t.record(traceEvent{Op: "rollover"}, func() float64 {
+		Rollover(t.counter)
+		return 0
+	})
+}
+
+// Err returns the first error writing the trace, if any.
+func (t *TraceRecorder) Err() error {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.err
+}
+
+// ReplayTrace replays a trace written by a TraceRecorder against a new
+// counter, returning an error wrapping ErrTraceMismatch for the first
+// result that differs from the recorded one by more than the given relative
+// tolerance. newCounter must return a counter that reads the time from
+// clock (see WithClock), which ReplayTrace sets to the recorded time of each
+// call. Options that sample randomly make replays nondeterministic.
+func ReplayTrace(r io.Reader, newCounter func(clock func() time.Time) RateSketch, tolerance float64) error {
+	var now time.Time
+	counter := newCounter(func() time.Time { return now })
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var e traceEvent
+		if err := dec.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w: trace line %d: %s", ErrCorruptEncoding, line, err)
+		}
+
+		now = e.Time
+		var result float64
+		switch e.Op {
+		case "count":
+			result = counter.Count(e.Key, e.Delta, e.Interval)
+		case "add":
+			Add(counter, e.Key, e.Delta)
+		case "query":
+			result = counter.Query(e.Key, e.Interval)
+		case "rollover":
+			Rollover(counter)
+		default:
+			return fmt.Errorf("%w: trace line %d: unknown op %q", ErrCorruptEncoding, line, e.Op)
+		}
+		if math.Abs(result-e.Result) > tolerance*math.Abs(e.Result) {
+			return fmt.Errorf("%w: trace line %d: %s of %q at %s returned %v, recorded %v",
+				ErrTraceMismatch, line, e.Op, e.Key, e.Time.Format(time.RFC3339Nano), result, e.Result)
+		}
+	}
+}
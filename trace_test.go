@@ -0,0 +1,62 @@
+package sketchy
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTrace(t *testing.T) {
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	params := RollupParams{Durations: []time.Duration{time.Minute, time.Hour, 24 * time.Hour}}
+
+	record := func() *bytes.Buffer {
+		now := start
+		clock := func() time.Time { return now }
+		buf := &bytes.Buffer{}
+		rec := NewTraceRecorder(buf, params.New(WithClock(clock)), clock)
+		for i := 0; i < 100; i++ {
+			rec.Count([]byte{byte(i % 7)}, i%5+1, time.Minute)
+			if i%3 == 0 {
+				rec.Add([]byte("added"), 2)
+			}
+			rec.Query([]byte{3}, 5*time.Minute)
+			if i == 50 {
+				rec.Rollover()
+			}
+			now = now.Add(7 * time.Second)
+		}
+		So(rec.Err(), ShouldBeNil)
+		return buf
+	}
+
+	Convey("A recorded trace replays against the same implementation", t, func() {
+		trace := record()
+		So(strings.Count(trace.String(), "\n"), ShouldEqual, 235)
+		So(trace.String(), ShouldContainSubstring, `"op":"rollover"`)
+
+		err := ReplayTrace(trace, func(clock func() time.Time) RateSketch {
+			return params.New(WithClock(clock))
+		}, 1e-9)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("A different implementation is caught", t, func() {
+		err := ReplayTrace(record(), func(clock func() time.Time) RateSketch {
+			return RollingParams{Interval: 10 * time.Second, NumIntervals: 6}.New(WithClock(clock))
+		}, 1e-9)
+		So(errors.Is(err, ErrTraceMismatch), ShouldBeTrue)
+	})
+
+	Convey("Malformed traces are rejected", t, func() {
+		newCounter := func(clock func() time.Time) RateSketch { return params.New(WithClock(clock)) }
+		err := ReplayTrace(strings.NewReader(`{"op":"explode"}`), newCounter, 0)
+		So(errors.Is(err, ErrCorruptEncoding), ShouldBeTrue)
+		err = ReplayTrace(strings.NewReader(`{"op":`), newCounter, 0)
+		So(errors.Is(err, ErrCorruptEncoding), ShouldBeTrue)
+	})
+}
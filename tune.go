@@ -0,0 +1,70 @@
+package sketchy
+
+import (
+	"fmt"
+	"math"
+)
+
+// WithAutoTune makes a counter watch for collisions in its sketches, and
+// recommend wider sketches when they are too frequent. Each call to Count
+// measures the difference between the largest and smallest of the key's
+// counters in the current bucket, which is due entirely to other keys
+// colliding with it. When a bucket closes, if the average difference
+// exceeded maxSpread events, the counter recommends an epsilon whose width
+// would bring it down to maxSpread. The recommendation is reported in Stats,
+// and if apply is true it is also used for every new bucket.
+func WithAutoTune(maxSpread float64, apply bool) Option {
+	if !(maxSpread > 0) {
+		panic(fmt.Sprintf("sketchy: auto-tune spread %v is not positive", maxSpread))
+	}
+	t := &tuning{maxSpread: maxSpread, apply: apply}
+	return func(o *options) { o.tuning = t }
+}
+
+type tuning struct {
+	maxSpread float64
+	apply     bool
+}
+
+// spreadStats accumulates the spread between the row estimates of counted
+// keys. It is guarded by the counter's lock.
+type spreadStats struct {
+	sum uint64
+	n   uint64
+}
+
+func (s *spreadStats) observe(min, max uint64) {
+	s.sum += max - min
+	s.n++
+}
+
+// retune recommends new sketch parameters from the spread observed in the
+// bucket being closed, and applies them if configured to. The caller must
+// hold rl.m.
+func (rl *rollingCounter) retune(t *tuning) {
+	buckets := rl.loadBuckets()
+	spread := rl.spread
+	rl.spread = spreadStats{}
+	if spread.n == 0 || len(buckets) == 0 || buckets[len(buckets)-1].CountSketch == nil {
+		return
+	}
+	cs := buckets[len(buckets)-1].CountSketch
+	avg := float64(spread.sum) / float64(spread.n)
+	if avg <= t.maxSpread {
+		return
+	}
+
+	// collisions per counter are inversely proportional to width
+	width := math.Ceil(float64(cs.Width) * avg / t.maxSpread)
+	if limit := float64(maxDecodedCells / cs.Depth); width > limit {
+		width = limit
+	}
+	p := SketchParams{Epsilon: 1 - math.E/width, Delta: cs.Delta}
+	if p.Epsilon <= cs.Epsilon {
+		return
+	}
+	rl.recommended = p
+	if t.apply {
+		rl.Epsilon, rl.Delta = p.Epsilon, p.Delta
+	}
+}
@@ -0,0 +1,82 @@
+package sketchy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithAutoTune(t *testing.T) {
+	now := time.Now()
+
+	fill := func(counter RateSketch, keys int) {
+		for i := 0; i < keys; i++ {
+			counter.Count([]byte(fmt.Sprintf("key%d", i)), 1, 0)
+		}
+	}
+
+	Convey("Undersized sketches get a recommendation", t, func() {
+		counter := RollingParams{
+			SketchParams: SketchParams{Epsilon: 0.9, Delta: 0.9},
+			Interval:     time.Minute,
+			NumIntervals: 3,
+		}.New(WithAutoTune(1, false)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		fill(counter, 1000)
+		So(counter.Stats().Recommended, ShouldResemble, SketchParams{})
+		counter.Rollover()
+
+		rec := counter.Stats().Recommended
+		So(rec.Epsilon, ShouldBeGreaterThan, 0.95)
+		So(rec.Delta, ShouldEqual, 0.9)
+		So(counter.loadBuckets()[1].CountSketch.Width, ShouldEqual, 28)
+	})
+
+	Convey("Recommendations can be applied at the next rotation", t, func() {
+		counter := RollingParams{
+			SketchParams: SketchParams{Epsilon: 0.9, Delta: 0.9},
+			Interval:     time.Minute,
+			NumIntervals: 3,
+		}.New(WithAutoTune(1, true)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+
+		fill(counter, 1000)
+		counter.Rollover()
+		wide := counter.loadBuckets()[1].CountSketch
+		So(wide.Epsilon, ShouldEqual, counter.Stats().Recommended.Epsilon)
+		So(wide.Width, ShouldBeGreaterThan, 28)
+
+		// sketches keep widening while collisions remain frequent
+		fill(counter, 1000)
+		counter.Rollover()
+		So(counter.loadBuckets()[2].CountSketch.Width, ShouldBeGreaterThan, wide.Width)
+	})
+
+	Convey("Sketches with few collisions are left alone", t, func() {
+		counter := RollingParams{Interval: time.Minute, NumIntervals: 3}.New(
+			WithAutoTune(1, true)).(*rollingCounter)
+		counter.clock = func() time.Time { return now }
+		fill(counter, 10)
+		counter.Rollover()
+		So(counter.Stats().Recommended, ShouldResemble, SketchParams{})
+		So(counter.loadBuckets()[1].CountSketch.Width, ShouldEqual, 2719)
+	})
+
+	Convey("Rollup levels are tuned individually", t, func() {
+		rollup := RollupParams{
+			SketchParams: SketchParams{Epsilon: 0.9, Delta: 0.9},
+			Durations:    []time.Duration{time.Minute, time.Hour},
+		}.New(WithAutoTune(1, false)).(*rollupCounter)
+		rollup.clock = func() time.Time { return now }
+		fill(rollup, 1000)
+		rollup.Rollover()
+		So(rollup.Stats().Recommended.Epsilon, ShouldBeGreaterThan, 0.95)
+	})
+
+	Convey("Spreads must be positive", t, func() {
+		So(func() { WithAutoTune(0, false) }, ShouldPanic)
+	})
+}